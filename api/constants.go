@@ -12,4 +12,12 @@ const (
 	VolumeManager         = "ceph-volume-provider"
 
 	MachineArchitectureLabel = "common.ironcore.dev/architecture"
+
+	// BucketMaxSizeAnnotation is the IRI bucket annotation holding the storage quota of a bucket.
+	BucketMaxSizeAnnotation = "ceph-provider.ironcore.dev/max-size"
+	// BucketCORSAnnotation is the IRI bucket annotation holding the CORS rules of a bucket as JSON. The provider
+	// cannot apply CORS rules yet, buckets carrying them are rejected.
+	BucketCORSAnnotation = "ceph-provider.ironcore.dev/cors"
+	// BucketLifecycleAnnotation is the IRI bucket annotation holding the lifecycle configuration of a bucket as JSON.
+	BucketLifecycleAnnotation = "ceph-provider.ironcore.dev/lifecycle"
 )
@@ -4,6 +4,10 @@
 package api
 
 import (
+	"fmt"
+	"slices"
+	"time"
+
 	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
 )
 
@@ -19,6 +23,8 @@ type ImageState string
 const (
 	ImageStatePending   ImageState = "Pending"
 	ImageStateAvailable ImageState = "Available"
+	ImageStateFailed    ImageState = "Failed"
+	ImageStateValidated ImageState = "Validated"
 )
 
 type EncryptionState string
@@ -35,6 +41,64 @@ type ImageSpec struct {
 	ImageArchitecture *string         `json:"imageArchitecture"`
 	SnapshotRef       *string         `json:"snapshotRef"`
 	Encryption        *EncryptionSpec `json:"encryption"`
+	Features          []string        `json:"features,omitempty"`
+	ObjectSizeBytes   uint64          `json:"objectSizeBytes,omitempty"`
+	StripeUnit        uint64          `json:"stripeUnit,omitempty"`
+	StripeCount       uint64          `json:"stripeCount,omitempty"`
+	DataPool          string          `json:"dataPool,omitempty"`
+	AllowShrink       bool            `json:"allowShrink,omitempty"`
+	// Flatten overrides whether the image is flattened after being cloned, regardless of its clone depth.
+	Flatten *bool `json:"flatten,omitempty"`
+	// Pool is the pool the image should be stored in. Changing it migrates an available image to the pool.
+	// Defaults to the pool of the provider.
+	Pool string `json:"pool,omitempty"`
+	// Mirroring enables rbd mirroring of the image once it is created.
+	Mirroring *MirroringSpec `json:"mirroring,omitempty"`
+	// RBDName is the name of the rbd image. Defaults to a name derived from the image id.
+	RBDName string `json:"rbdName,omitempty"`
+	// ThickProvision fully allocates an empty image once it is created. Images cloned from a snapshot or a template
+	// are not thick-provisioned, as allocating them would overwrite the cloned content.
+	ThickProvision bool `json:"thickProvision,omitempty"`
+	// QoS are the typed quality of service limits of the image. Limits set in Limits take precedence.
+	QoS *QoS `json:"qos,omitempty"`
+	// TemplateRef is the id of an available image the image is cloned from copy-on-write. The template is cloned from
+	// a protected rbd snapshot of it, which is created by the first clone and reused by all later ones, so clones
+	// reflect the template at the time of its first clone.
+	TemplateRef *string `json:"templateRef,omitempty"`
+	// ReadOnly restricts the credentials handed out for the image to read-only access. It only takes effect with
+	// credentials scoped to the image.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// Priority orders the reconciles of queued images. Images of a higher priority, e.g. boot images, are reconciled
+	// before queued images of a lower priority. Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// QoS are the average and burst limits of an image. A value of 0 leaves the limit unset.
+type QoS struct {
+	IOPS      int64 `json:"iops,omitempty"`
+	IOPSBurst int64 `json:"iopsBurst,omitempty"`
+	// BPS is the average bandwidth limit in bytes per second.
+	BPS int64 `json:"bps,omitempty"`
+	// BPSBurst is the burst bandwidth limit in bytes per second.
+	BPSBurst int64 `json:"bpsBurst,omitempty"`
+}
+
+type MirroringMode string
+
+const (
+	MirroringModeJournal  MirroringMode = "journal"
+	MirroringModeSnapshot MirroringMode = "snapshot"
+)
+
+type MirroringSpec struct {
+	Mode MirroringMode `json:"mode"`
+}
+
+type MirroringStatus struct {
+	Mode MirroringMode `json:"mode"`
+	// State is the rbd mirroring state of the image, e.g. enabled.
+	State   string `json:"state"`
+	Primary bool   `json:"primary"`
 }
 
 type EncryptionType string
@@ -44,21 +108,145 @@ const (
 	EncryptionTypeUnencrypted EncryptionType = "Unencrypted"
 )
 
+type EncryptionFormat string
+
+const (
+	EncryptionFormatLUKS1 EncryptionFormat = "luks1"
+	EncryptionFormatLUKS2 EncryptionFormat = "luks2"
+)
+
 type EncryptionSpec struct {
-	Type                EncryptionType `json:"type"`
-	EncryptedPassphrase []byte         `json:"encryptedPassphrase"`
+	Type EncryptionType `json:"type"`
+	// Format is the encryption format of the image. Defaults to luks2.
+	Format              EncryptionFormat `json:"format,omitempty"`
+	EncryptedPassphrase []byte           `json:"encryptedPassphrase"`
 }
 
 type ImageStatus struct {
-	State      ImageState      `json:"state"`
-	Encryption EncryptionState `json:"encryption"`
-	Access     *ImageAccess    `json:"access"`
-	Size       uint64          `json:"size"`
+	State      ImageState       `json:"state"`
+	Encryption EncryptionState  `json:"encryption"`
+	Access     *ImageAccess     `json:"access"`
+	Size       uint64           `json:"size"`
+	LastError  string           `json:"lastError,omitempty"`
+	Digest     string           `json:"digest,omitempty"`
+	Conditions []ImageCondition `json:"conditions,omitempty"`
+	// ResolvedImage is the image reference ResolvedDigest was resolved from.
+	ResolvedImage  string `json:"resolvedImage,omitempty"`
+	ResolvedDigest string `json:"resolvedDigest,omitempty"`
+	// WWN is the WWN assigned to the image. It does not change once set.
+	WWN string `json:"wwn,omitempty"`
+	// Pool is the pool the image is stored in if it was migrated. Empty for the pool of the provider.
+	Pool string `json:"pool,omitempty"`
+	// MigrationSourcePool is the pool the image was migrated from while its rbd image is not removed from there yet.
+	MigrationSourcePool string `json:"migrationSourcePool,omitempty"`
+	// Mirroring is the mirroring status of the image if mirroring was requested.
+	Mirroring *MirroringStatus `json:"mirroring,omitempty"`
+	// RBDName is the custom name the rbd image is stored under. Empty for the name derived from the image id.
+	RBDName string `json:"rbdName,omitempty"`
+	// CreatedAt is the time the provider started provisioning the image.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	// ProvisioningDuration is the time it took until the image became available.
+	ProvisioningDuration time.Duration `json:"provisioningDuration,omitempty"`
+	// ThickProvisionProgress is the percentage of the image allocated while thick-provisioning it.
+	ThickProvisionProgress int32 `json:"thickProvisionProgress,omitempty"`
+	// ResizedAt is the time the rbd image was last resized after the image became available. Clients attached to
+	// the image watch it to learn of the new size, e.g. to expand their filesystem.
+	ResizedAt *time.Time `json:"resizedAt,omitempty"`
+	// ReconciledSpecHash is the hash of the spec the available image was last fully reconciled with. Reconciles of
+	// images whose spec still has this hash are skipped.
+	ReconciledSpecHash string `json:"reconciledSpecHash,omitempty"`
+	// LastExport is the last export of the image to an os image registry.
+	LastExport *ImageExport `json:"lastExport,omitempty"`
+	// SnapshotRef is the snapshot the available image was cloned from. It must not change once set, see
+	// ValidateProvisionedImage.
+	SnapshotRef string `json:"snapshotRef,omitempty"`
+}
+
+// ImageExport describes an export of an image as os image.
+type ImageExport struct {
+	// Reference is the os image reference the image was pushed to.
+	Reference string `json:"reference"`
+	// Digest is the digest of the pushed os image manifest.
+	Digest     string    `json:"digest"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// GetWWN returns the assigned WWN of the image, falling back to the requested one.
+func (i *Image) GetWWN() string {
+	if i.Status.WWN != "" {
+		return i.Status.WWN
+	}
+	return i.Spec.WWN
+}
+
+type ImageConditionType string
+
+const (
+	ImageConditionSnapshotReady ImageConditionType = "SnapshotReady"
+	// ImageConditionTemplateReady is false while the template an image is cloned from is not available.
+	ImageConditionTemplateReady ImageConditionType = "TemplateReady"
+	// ImageConditionReconciled is false with the reason of a terminal error once an image failed, or while the spec of
+	// an available image changes fields that are immutable once provisioned.
+	ImageConditionReconciled ImageConditionType = "Reconciled"
+	// ImageConditionMigrating is true while an image is copied to another pool and false if the migration failed.
+	ImageConditionMigrating ImageConditionType = "Migrating"
+)
+
+type ConditionStatus string
+
+const (
+	ConditionTrue  ConditionStatus = "True"
+	ConditionFalse ConditionStatus = "False"
+)
+
+type ImageCondition struct {
+	Type    ImageConditionType `json:"type"`
+	Status  ConditionStatus    `json:"status"`
+	Reason  string             `json:"reason,omitempty"`
+	Message string             `json:"message,omitempty"`
+}
+
+// GetCondition returns the condition of the given type, if present.
+func (s *ImageStatus) GetCondition(conditionType ImageConditionType) (ImageCondition, bool) {
+	for _, condition := range s.Conditions {
+		if condition.Type == conditionType {
+			return condition, true
+		}
+	}
+	return ImageCondition{}, false
+}
+
+// SetCondition adds the condition or replaces an existing condition of the same type.
+// It reports whether the conditions changed.
+func (s *ImageStatus) SetCondition(condition ImageCondition) bool {
+	for i, existing := range s.Conditions {
+		if existing.Type == condition.Type {
+			if existing == condition {
+				return false
+			}
+			s.Conditions[i] = condition
+			return true
+		}
+	}
+	s.Conditions = append(s.Conditions, condition)
+	return true
+}
+
+// RemoveCondition removes the condition of the given type. It reports whether the conditions changed.
+func (s *ImageStatus) RemoveCondition(conditionType ImageConditionType) bool {
+	n := len(s.Conditions)
+	s.Conditions = slices.DeleteFunc(s.Conditions, func(condition ImageCondition) bool {
+		return condition.Type == conditionType
+	})
+	return len(s.Conditions) != n
 }
 
 type ImageAccess struct {
+	// Monitors is the comma-separated list of monitor addresses.
 	Monitors string `json:"monitors"`
-	Handle   string `json:"handle"`
+	// MonitorEndpoints are the single host:port monitor addresses, with IPv6 hosts in brackets.
+	MonitorEndpoints []string `json:"monitorEndpoints,omitempty"`
+	Handle           string   `json:"handle"`
 
 	User    string `json:"user"`
 	UserKey string `json:"userKey"`
@@ -66,6 +254,41 @@ type ImageAccess struct {
 
 type Limits map[LimitType]int64
 
+// Validate checks that the limits are not negative and that the burst limits are not below the average limits.
+func (q *QoS) Validate() error {
+	for _, limit := range []struct {
+		name           string
+		average, burst int64
+	}{
+		{"iops", q.IOPS, q.IOPSBurst},
+		{"bps", q.BPS, q.BPSBurst},
+	} {
+		if limit.average < 0 || limit.burst < 0 {
+			return fmt.Errorf("%s limits must not be negative", limit.name)
+		}
+		if limit.burst != 0 && limit.burst < limit.average {
+			return fmt.Errorf("%s burst %d must not be less than the average %d", limit.name, limit.burst, limit.average)
+		}
+	}
+	return nil
+}
+
+// Limits returns the rbd qos limits of the set QoS fields.
+func (q *QoS) Limits() Limits {
+	limits := Limits{}
+	for limit, value := range map[LimitType]int64{
+		IOPSLimit:      q.IOPS,
+		IOPSBurstLimit: q.IOPSBurst,
+		BPSLimit:       q.BPS,
+		BPSBurstLimit:  q.BPSBurst,
+	} {
+		if value != 0 {
+			limits[limit] = value
+		}
+	}
+	return limits
+}
+
 const (
 	IOPSLimit                   LimitType = "rbd_qos_iops_limit"
 	IOPSBurstLimit              LimitType = "rbd_qos_iops_burst"
@@ -4,6 +4,8 @@
 package api
 
 import (
+	"slices"
+
 	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
 )
 
@@ -28,9 +30,50 @@ type SnapshotStatus struct {
 	State  SnapshotState `json:"state"`
 	Digest string        `json:"digest"`
 	Size   int64         `json:"size"`
+	// PopulateProgress is the percentage of the snapshot content written while populating it from an image.
+	PopulateProgress int32 `json:"populateProgress,omitempty"`
+	// ImageRefs are the sorted IDs of the images created from the snapshot whose deletion has not completed yet.
+	ImageRefs []string `json:"imageRefs,omitempty"`
+}
+
+// AddImageRef records that the image references the snapshot. It reports whether the reference was added.
+func (s *Snapshot) AddImageRef(imageID string) bool {
+	i, found := slices.BinarySearch(s.Status.ImageRefs, imageID)
+	if found {
+		return false
+	}
+	s.Status.ImageRefs = slices.Insert(s.Status.ImageRefs, i, imageID)
+	return true
+}
+
+// RemoveImageRef drops the reference of the image to the snapshot. It reports whether the reference was removed.
+func (s *Snapshot) RemoveImageRef(imageID string) bool {
+	i, found := slices.BinarySearch(s.Status.ImageRefs, imageID)
+	if !found {
+		return false
+	}
+	s.Status.ImageRefs = slices.Delete(s.Status.ImageRefs, i, i+1)
+	return true
+}
+
+// ReferenceCount returns the number of images referencing the snapshot.
+func (s *Snapshot) ReferenceCount() int {
+	return len(s.Status.ImageRefs)
 }
 
 type SnapshotSource struct {
 	IronCoreImage string `json:"ironcoreImage"`
 	VolumeImageID string `json:"volumeImageId"`
+	// SnapshotName is the name of the rbd snapshot of an ironcore image. Defaults to the provider's snapshot version.
+	SnapshotName string `json:"snapshotName,omitempty"`
+	// URL is the http(s) or s3 URL of a raw disk image to populate the snapshot from.
+	URL string `json:"url,omitempty"`
+	// URLDigest is the expected digest of the content at URL, e.g. sha256:<hex>. The content is not verified if empty.
+	URLDigest string `json:"urlDigest,omitempty"`
+}
+
+// PopulatesImage reports whether the snapshot content is populated into an rbd image of its own, from an ironcore
+// image or a URL, instead of being taken of a volume image.
+func (s *SnapshotSource) PopulatesImage() bool {
+	return s.IronCoreImage != "" || s.URL != ""
 }
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package api_test
+
+import (
+	"github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot image references", func() {
+	It("should count each referencing image once", func() {
+		snapshot := &api.Snapshot{}
+
+		Expect(snapshot.AddImageRef("foo")).To(BeTrue())
+		Expect(snapshot.AddImageRef("bar")).To(BeTrue())
+		Expect(snapshot.AddImageRef("foo")).To(BeFalse())
+		Expect(snapshot.Status.ImageRefs).To(Equal([]string{"bar", "foo"}))
+		Expect(snapshot.ReferenceCount()).To(Equal(2))
+
+		Expect(snapshot.RemoveImageRef("foo")).To(BeTrue())
+		Expect(snapshot.RemoveImageRef("foo")).To(BeFalse())
+		Expect(snapshot.RemoveImageRef("bar")).To(BeTrue())
+		Expect(snapshot.ReferenceCount()).To(BeZero())
+	})
+})
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Image features accepted in ImageSpec.Features.
+const (
+	ImageFeatureLayering      = "layering"
+	ImageFeatureStriping      = "striping"
+	ImageFeatureExclusiveLock = "exclusive-lock"
+	ImageFeatureObjectMap     = "object-map"
+	ImageFeatureFastDiff      = "fast-diff"
+	ImageFeatureDeepFlatten   = "deep-flatten"
+	ImageFeatureJournaling    = "journaling"
+)
+
+// ImageFeatures are all image features accepted in ImageSpec.Features.
+var ImageFeatures = []string{
+	ImageFeatureLayering,
+	ImageFeatureStriping,
+	ImageFeatureExclusiveLock,
+	ImageFeatureObjectMap,
+	ImageFeatureFastDiff,
+	ImageFeatureDeepFlatten,
+	ImageFeatureJournaling,
+}
+
+// ValidateImage validates the spec of the image independently of any ceph cluster, e.g. before the image is
+// reconciled or when it is admitted.
+func ValidateImage(img *Image) field.ErrorList {
+	allErrs := validateImageSpec(&img.Spec, field.NewPath("spec"))
+	if img.Spec.SnapshotRef != nil && img.Spec.Image != "" && !isResolvedSnapshotRef(img) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "image"), "must not be set together with snapshotRef"))
+	}
+	if templateRef := img.Spec.TemplateRef; templateRef != nil && *templateRef == img.ID {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "templateRef"), *templateRef, "must not reference the image itself"))
+	}
+	return allErrs
+}
+
+// ValidateProvisionedImage validates the spec of the available image against the state it was provisioned with: the
+// snapshot it was cloned from must not change and it must not be shrunk below its size unless AllowShrink is set.
+// Growing it remains allowed. size is the size requested by the spec after rounding.
+func ValidateProvisionedImage(img *Image, size uint64) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if size < img.Status.Size && !img.Spec.AllowShrink {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "size"),
+			fmt.Sprintf("must not be decreased below the provisioned size of %d bytes unless allowShrink is set", img.Status.Size)))
+	}
+
+	if snapshotRef := img.Status.SnapshotRef; snapshotRef != "" {
+		if img.Spec.SnapshotRef == nil || *img.Spec.SnapshotRef != snapshotRef {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "snapshotRef"),
+				fmt.Sprintf("must not be changed from %s once the image is provisioned", snapshotRef)))
+		}
+	}
+
+	return allErrs
+}
+
+// isResolvedSnapshotRef reports whether the snapshotRef of the image is the snapshot its os image was resolved to by
+// the provider rather than one set together with the os image.
+func isResolvedSnapshotRef(img *Image) bool {
+	return img.Status.ResolvedDigest != "" &&
+		img.Status.ResolvedImage == img.Spec.Image &&
+		img.Status.ResolvedDigest == *img.Spec.SnapshotRef
+}
+
+func validateImageSpec(spec *ImageSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.Size == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("size"), "size must be positive"))
+	}
+
+	if spec.TemplateRef != nil {
+		if spec.SnapshotRef != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("templateRef"), "must not be set together with snapshotRef"))
+		}
+		if spec.Image != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("templateRef"), "must not be set together with image"))
+		}
+	}
+
+	for i, feature := range spec.Features {
+		if !slices.Contains(ImageFeatures, feature) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("features").Index(i), feature, ImageFeatures))
+		}
+	}
+
+	for limit, value := range spec.Limits {
+		if value < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("limits").Key(string(limit)), value, "must not be negative"))
+		}
+	}
+
+	if spec.QoS != nil {
+		if err := spec.QoS.Validate(); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("qos"), spec.QoS, err.Error()))
+		}
+	}
+
+	if mirroring := spec.Mirroring; mirroring != nil {
+		modes := []MirroringMode{MirroringModeJournal, MirroringModeSnapshot}
+		if !slices.Contains(modes, mirroring.Mode) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("mirroring", "mode"), mirroring.Mode, modes))
+		}
+	}
+
+	return allErrs
+}
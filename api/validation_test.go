@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package api_test
+
+import (
+	"github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("ValidateImage", func() {
+	fieldError := func(errType field.ErrorType, fieldPath string) OmegaMatcher {
+		return PointTo(MatchFields(IgnoreExtras, Fields{
+			"Type":  Equal(errType),
+			"Field": Equal(fieldPath),
+		}))
+	}
+
+	It("should accept a valid image", func() {
+		Expect(api.ValidateImage(&api.Image{Spec: api.ImageSpec{
+			Size:      1024,
+			Image:     "registry.example.com/os:latest",
+			Features:  []string{api.ImageFeatureLayering, api.ImageFeatureExclusiveLock},
+			Limits:    api.Limits{api.IOPSLimit: 100},
+			QoS:       &api.QoS{IOPS: 100, IOPSBurst: 200},
+			Mirroring: &api.MirroringSpec{Mode: api.MirroringModeSnapshot},
+		}})).To(BeEmpty())
+	})
+
+	It("should require a size", func() {
+		Expect(api.ValidateImage(&api.Image{})).To(ConsistOf(
+			fieldError(field.ErrorTypeRequired, "spec.size"),
+		))
+	})
+
+	It("should reject a snapshot source together with an os image", func() {
+		Expect(api.ValidateImage(&api.Image{Spec: api.ImageSpec{
+			Size:        1024,
+			Image:       "registry.example.com/os:latest",
+			SnapshotRef: ptr.To("snap"),
+		}})).To(ConsistOf(
+			fieldError(field.ErrorTypeForbidden, "spec.image"),
+		))
+	})
+
+	It("should accept the snapshot the os image was resolved to", func() {
+		Expect(api.ValidateImage(&api.Image{
+			Spec: api.ImageSpec{
+				Size:        1024,
+				Image:       "registry.example.com/os:latest",
+				SnapshotRef: ptr.To("sha256:foo"),
+			},
+			Status: api.ImageStatus{
+				ResolvedImage:  "registry.example.com/os:latest",
+				ResolvedDigest: "sha256:foo",
+			},
+		})).To(BeEmpty())
+	})
+
+	It("should reject a template source together with another source or referencing the image itself", func() {
+		Expect(api.ValidateImage(&api.Image{Spec: api.ImageSpec{
+			Size:        1024,
+			Image:       "registry.example.com/os:latest",
+			TemplateRef: ptr.To("template"),
+		}})).To(ConsistOf(
+			fieldError(field.ErrorTypeForbidden, "spec.templateRef"),
+		))
+
+		img := &api.Image{Spec: api.ImageSpec{Size: 1024, SnapshotRef: ptr.To("snap"), TemplateRef: ptr.To("foo")}}
+		img.ID = "foo"
+		Expect(api.ValidateImage(img)).To(ConsistOf(
+			fieldError(field.ErrorTypeForbidden, "spec.templateRef"),
+			fieldError(field.ErrorTypeInvalid, "spec.templateRef"),
+		))
+	})
+
+	It("should reject negative limits", func() {
+		Expect(api.ValidateImage(&api.Image{Spec: api.ImageSpec{
+			Size:   1024,
+			Limits: api.Limits{api.IOPSLimit: -1, api.BPSLimit: 100},
+			QoS:    &api.QoS{BPS: -1},
+		}})).To(ConsistOf(
+			fieldError(field.ErrorTypeInvalid, "spec.limits[rbd_qos_iops_limit]"),
+			fieldError(field.ErrorTypeInvalid, "spec.qos"),
+		))
+	})
+
+	It("should reject invalid feature names and mirroring modes", func() {
+		Expect(api.ValidateImage(&api.Image{Spec: api.ImageSpec{
+			Size:      1024,
+			Features:  []string{api.ImageFeatureLayering, "teleportation"},
+			Mirroring: &api.MirroringSpec{Mode: "carrier-pigeon"},
+		}})).To(ConsistOf(
+			fieldError(field.ErrorTypeNotSupported, "spec.features[1]"),
+			fieldError(field.ErrorTypeNotSupported, "spec.mirroring.mode"),
+		))
+	})
+})
+
+var _ = Describe("ValidateProvisionedImage", func() {
+	provisioned := func() *api.Image {
+		return &api.Image{
+			Spec:   api.ImageSpec{Size: 2048, SnapshotRef: ptr.To("snap")},
+			Status: api.ImageStatus{Size: 2048, SnapshotRef: "snap"},
+		}
+	}
+
+	It("should accept an unchanged or grown image", func() {
+		Expect(api.ValidateProvisionedImage(provisioned(), 2048)).To(BeEmpty())
+		Expect(api.ValidateProvisionedImage(provisioned(), 4096)).To(BeEmpty())
+	})
+
+	It("should reject shrinking the image unless allowed", func() {
+		img := provisioned()
+		Expect(api.ValidateProvisionedImage(img, 1024)).To(ConsistOf(
+			HaveField("Field", "spec.size"),
+		))
+
+		img.Spec.AllowShrink = true
+		Expect(api.ValidateProvisionedImage(img, 1024)).To(BeEmpty())
+	})
+
+	It("should reject changing or removing the snapshot the image was cloned from", func() {
+		img := provisioned()
+		img.Spec.SnapshotRef = ptr.To("other")
+		Expect(api.ValidateProvisionedImage(img, 2048)).To(ConsistOf(
+			HaveField("Field", "spec.snapshotRef"),
+		))
+
+		img.Spec.SnapshotRef = nil
+		Expect(api.ValidateProvisionedImage(img, 2048)).To(ConsistOf(
+			HaveField("Field", "spec.snapshotRef"),
+		))
+	})
+
+	It("should not restrict the snapshot of images not cloned from one", func() {
+		img := provisioned()
+		img.Status.SnapshotRef = ""
+		Expect(api.ValidateProvisionedImage(img, 2048)).To(BeEmpty())
+	})
+})
@@ -8,15 +8,19 @@ import (
 	goflag "flag"
 	"fmt"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/ironcore-dev/ceph-provider/internal/bcr"
 	"github.com/ironcore-dev/ceph-provider/internal/bucketserver"
+	"github.com/ironcore-dev/ceph-provider/internal/logging"
 	"github.com/ironcore-dev/controller-utils/configutils"
 	"github.com/ironcore-dev/ironcore/broker/common"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -25,8 +29,15 @@ type Options struct {
 	Kubeconfig string
 	Address    string
 
+	// LogComponentVerbosity are the log verbosity levels of components, overriding the zap log level for them.
+	LogComponentVerbosity map[string]int
+
 	Namespace                  string
+	NamespaceLabel             string
+	AccessSecretTimeout        time.Duration
+	AccessSecretSyncInterval   time.Duration
 	BucketPoolStorageClassName string
+	BucketClassStorageClasses  map[string]string
 
 	PathSupportedBucketClasses string
 	BucketClassSelector        map[string]string
@@ -38,7 +49,11 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.Address, "address", "/var/run/ceph-bucket-provider.sock", "Address to listen on.")
 
 	fs.StringVar(&o.Namespace, "namespace", o.Namespace, "Target Kubernetes namespace to use.")
+	fs.DurationVar(&o.AccessSecretTimeout, "access-secret-timeout", o.AccessSecretTimeout, "Time to wait for the bucket access secret to be populated when creating a bucket. If zero, the bucket is returned as pending without waiting.")
+	fs.DurationVar(&o.AccessSecretSyncInterval, "access-secret-sync-interval", bucketserver.DefaultAccessSecretSyncInterval, "Interval the bucket metadata is propagated to the bucket access secrets in.")
+	fs.StringVar(&o.NamespaceLabel, "namespace-label", o.NamespaceLabel, "Bucket label naming the Kubernetes namespace to place the bucket in. Buckets without the label are placed in the target namespace.")
 	fs.StringVar(&o.BucketPoolStorageClassName, "bucket-pool-storage-class-name", o.BucketPoolStorageClassName, "Name of the target bucket pool storage class.")
+	fs.StringToStringVar(&o.BucketClassStorageClasses, "bucket-class-storage-classes", nil, "Storage classes to create the bucket claims of buckets of the given bucket classes with, e.g. 'fast=rook-ceph-bucket-ssd'. Buckets of other classes use the bucket pool storage class.")
 	fs.StringVar(&o.BucketEndpoint, "bucket-endpoint", o.BucketEndpoint, "Endpoint at which the buckets are reachable.")
 
 	fs.StringToStringVar(&o.BucketClassSelector, "bucket-class-selector", nil, "Selector for bucket classes to report as available.")
@@ -58,10 +73,16 @@ func Command() *cobra.Command {
 
 	cmd := &cobra.Command{
 		Use: "bucket",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			logger := zap.New(zap.UseFlagOptions(&zapOpts))
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			logOpts := logging.Options{ComponentVerbosity: opts.LogComponentVerbosity}
+			logOpts.ApplyToZap(&zapOpts)
+			logger, err := logging.New(zap.New(zap.UseFlagOptions(&zapOpts)), logOpts)
+			if err != nil {
+				return err
+			}
 			ctrl.SetLogger(logger)
 			cmd.SetContext(ctrl.LoggerInto(cmd.Context(), ctrl.Log))
+			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return Run(cmd.Context(), opts)
@@ -71,6 +92,7 @@ func Command() *cobra.Command {
 	goFlags := goflag.NewFlagSet("", 0)
 	zapOpts.BindFlags(goFlags)
 	cmd.PersistentFlags().AddGoFlagSet(goFlags)
+	cmd.PersistentFlags().StringToIntVar(&opts.LogComponentVerbosity, "log-component-verbosity", nil, fmt.Sprintf("Log verbosity of components overriding the zap log level, e.g. snapshot=4. Components: %s.", strings.Join(logging.Components(), ", ")))
 
 	opts.AddFlags(cmd.Flags())
 	opts.MarkFlagsRequired(cmd)
@@ -97,9 +119,18 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("failed to initialize bucket class registry: %w", err)
 	}
 
+	var namespaceFromBucket func(bucket *iriv1alpha1.Bucket) string
+	if opts.NamespaceLabel != "" {
+		namespaceFromBucket = bucketserver.NamespaceFromBucketLabel(opts.NamespaceLabel, opts.Namespace)
+	}
+
 	srv, err := bucketserver.New(cfg, classRegistry, bucketserver.Options{
 		Namespace:                  opts.Namespace,
+		NamespaceFromBucket:        namespaceFromBucket,
+		AccessSecretTimeout:        opts.AccessSecretTimeout,
+		AccessSecretSyncInterval:   opts.AccessSecretSyncInterval,
 		BucketPoolStorageClassName: opts.BucketPoolStorageClassName,
+		BucketClassStorageClasses:  opts.BucketClassStorageClasses,
 		BucketClassSelector:        opts.BucketClassSelector,
 		BucketEndpoint:             opts.BucketEndpoint,
 	})
@@ -125,7 +156,7 @@ func Run(ctx context.Context, opts Options) error {
 
 	grpcSrv := grpc.NewServer(
 		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-			log := log.WithName(info.FullMethod)
+			log := log.WithName(logging.LoggerName(logging.ComponentBucket)).WithName(info.FullMethod)
 			ctx = ctrl.LoggerInto(ctx, log)
 			log.V(1).Info("Request")
 			resp, err = handler(ctx, req)
@@ -136,6 +167,9 @@ func Run(ctx context.Context, opts Options) error {
 		}),
 	)
 	iriv1alpha1.RegisterBucketRuntimeServer(grpcSrv, srv)
+	grpc_health_v1.RegisterHealthServer(grpcSrv, bucketserver.NewHealthServer(srv))
+
+	go srv.SyncAccessSecrets(ctrl.LoggerInto(ctx, log.WithName(logging.LoggerName(logging.ComponentBucket))))
 
 	setupLog.Info("Starting server", "Address", l.Addr().String())
 	go func() {
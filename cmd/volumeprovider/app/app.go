@@ -5,37 +5,64 @@ package app
 
 import (
 	"context"
+	"errors"
 	goflag "flag"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/ceph/go-ceph/rados"
 	"github.com/go-logr/logr"
 	providerapi "github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/ceph"
 	"github.com/ironcore-dev/ceph-provider/internal/controllers"
 	"github.com/ironcore-dev/ceph-provider/internal/encryption"
+	"github.com/ironcore-dev/ceph-provider/internal/health"
+	"github.com/ironcore-dev/ceph-provider/internal/layercache"
+	"github.com/ironcore-dev/ceph-provider/internal/logging"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/reconnect"
+	"github.com/ironcore-dev/ceph-provider/internal/replay"
+	"github.com/ironcore-dev/ceph-provider/internal/rook"
+	"github.com/ironcore-dev/ceph-provider/internal/round"
 	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	"github.com/ironcore-dev/ceph-provider/internal/vcr"
 	"github.com/ironcore-dev/ceph-provider/internal/volumeserver"
+	"github.com/ironcore-dev/controller-utils/configutils"
 	"github.com/ironcore-dev/ironcore/broker/common"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	"github.com/ironcore-dev/provider-utils/eventutils/event"
 	eventrecorder "github.com/ironcore-dev/provider-utils/eventutils/recorder"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
 type Options struct {
-	Address string
+	Kubeconfig string
+	Address    string
+
+	// LogComponentVerbosity are the log verbosity levels of components, overriding the zap log level for them.
+	LogComponentVerbosity map[string]int
+
+	HealthProbeBindAddress string
+	MetricsBindAddress     string
+	HealthCheckInterval    time.Duration
 
 	PathSupportedVolumeClasses string
+	PoolStatsRefreshInterval   time.Duration
+	PoolCapabilities           vcr.PoolCapabilities
 
 	Ceph CephOptions
 }
@@ -46,53 +73,178 @@ type CephOptions struct {
 	KeyFile     string
 	KeyringFile string
 	Pool        string
+	Namespace   string
 	Client      string
 
-	ConnectTimeout time.Duration
+	ConnectTimeout      time.Duration
+	ReconnectMaxBackoff time.Duration
+	ClientMountTimeout  time.Duration
+	OSDOpTimeout        time.Duration
 
 	BurstFactor            int64
 	BurstDurationInSeconds int64
 
 	PopulatorBufferSize int64
+	LayerCacheDir       string
+	LayerCacheMaxSize   int64
+	PopulateConcurrency int
 
 	KeyEncryptionKeyPath string
 
 	VolumeEventStoreOptions eventrecorder.EventStoreOptions
 
-	WorkerSize int
+	WorkerSize         int
+	SnapshotWorkerSize int
+
+	MaxReconcileRetries int
+
+	AuthFetchTimeout  time.Duration
+	AuthCacheTTL      time.Duration
+	ScopedCredentials bool
+
+	DryRun bool
+
+	ShutdownGracePeriod time.Duration
+
+	RegistryDockerConfigPath string
+	SnapshotS3Endpoint       string
+
+	FlattenThreshold int
+
+	SizeRounding          string
+	SizeRoundingAlignment uint64
+
+	OrphanImageGC            bool
+	OrphanImageGCInterval    time.Duration
+	OrphanImageGCGracePeriod time.Duration
+	SnapshotVerify           bool
+	SnapshotVerifyInterval   time.Duration
+	ImageTrashRetention      time.Duration
+	ImageTrashPurgeInterval  time.Duration
+	ImageDeletionGracePeriod time.Duration
+	SourceRequeueInterval    time.Duration
+	PoolConcurrency          int
+	Maintenance              bool
+	MaintenanceRequeue       time.Duration
+	IOContextPoolSize        int
+	ImageFormat              uint64
+	ExportedLabels           []string
+
+	RookMonitorConfigMapNamespace string
+	RookMonitorConfigMapName      string
+	RookMonitorConfigMapDataKey   string
+	RookClusterID                 string
+	MonitorRefreshInterval        time.Duration
+
+	ImageFinalizer          string
+	ImagePreviousFinalizers []string
+	ImageResyncPeriod       time.Duration
+	ImageDeletionPolicy     string
+	WWNSeed                 int64
 }
 
 func (o *Options) Defaults() {
+	o.HealthProbeBindAddress = ":8082"
+	o.MetricsBindAddress = ":8083"
+	o.HealthCheckInterval = health.DefaultInterval
+	o.PoolStatsRefreshInterval = volumeserver.DefaultPoolStatsRefreshInterval
 	o.Ceph.ConnectTimeout = 10 * time.Second
+	o.Ceph.ReconnectMaxBackoff = reconnect.DefaultMaxBackoff
 	o.Ceph.BurstFactor = 10
 	o.Ceph.BurstDurationInSeconds = 15
 	o.Ceph.PopulatorBufferSize = 5 * 1024 * 1024
-	o.Ceph.WorkerSize = 15
+	o.Ceph.LayerCacheMaxSize = layercache.DefaultMaxSize
+	o.Ceph.WorkerSize = controllers.DefaultWorkerSize
+	o.Ceph.AuthFetchTimeout = controllers.DefaultAuthFetchTimeout
+	o.Ceph.AuthCacheTTL = controllers.DefaultAuthCacheTTL
+	o.Ceph.ShutdownGracePeriod = controllers.DefaultShutdownGrace
+	o.Ceph.OrphanImageGCInterval = controllers.DefaultOrphanImageGCInterval
+	o.Ceph.OrphanImageGCGracePeriod = controllers.DefaultOrphanImageGCGracePeriod
+	o.Ceph.SnapshotVerifyInterval = controllers.DefaultSnapshotVerifyInterval
+	o.Ceph.ImageTrashPurgeInterval = controllers.DefaultTrashPurgeInterval
+	o.Ceph.RookMonitorConfigMapNamespace = rook.NamespaceDefaultValue
+	o.Ceph.RookMonitorConfigMapDataKey = rook.MonitorConfigMapDataKeyDefaultValue
+	o.Ceph.RookClusterID = rook.ClusterIdDefaultValue
+	o.Ceph.MonitorRefreshInterval = controllers.DefaultMonitorRefreshInterval
+	o.Ceph.ImageFinalizer = controllers.ImageFinalizer
+	o.Ceph.ImageDeletionPolicy = string(controllers.ImageDeletionPolicyFlatten)
+	o.Ceph.ImageFormat = uint64(controllers.ImageFormatV2)
 }
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "Path pointing to a kubeconfig file to use for reading the rook mon endpoint config map.")
 	fs.StringVar(&o.Address, "address", "/var/run/ceph-volume-provider.sock", "Address to listen on.")
+	fs.StringVar(&o.HealthProbeBindAddress, "health-probe-bind-address", o.HealthProbeBindAddress, "Address the health probe endpoints /healthz and /readyz bind to. If empty, the endpoints are disabled.")
+	fs.StringVar(&o.MetricsBindAddress, "metrics-bind-address", o.MetricsBindAddress, "Address the metrics endpoint /metrics binds to. If empty, the endpoint is disabled.")
+	fs.DurationVar(&o.HealthCheckInterval, "health-check-interval", o.HealthCheckInterval, "Interval the ceph connectivity is checked in for the readiness probe.")
 
 	fs.StringVar(&o.PathSupportedVolumeClasses, "supported-volume-classes", o.PathSupportedVolumeClasses, "File containing supported volume classes.")
+	fs.Int64Var(&o.PoolCapabilities.MaxIOPS, "pool-max-iops", o.PoolCapabilities.MaxIOPS, "Highest IOPS a volume of the ceph pool can be provisioned with. Volume classes requesting more are not advertised. 0 is unlimited.")
+	fs.Int64Var(&o.PoolCapabilities.MaxTPS, "pool-max-tps", o.PoolCapabilities.MaxTPS, "Highest throughput in bytes per second a volume of the ceph pool can be provisioned with. Volume classes requesting more are not advertised. 0 is unlimited.")
+	fs.DurationVar(&o.PoolStatsRefreshInterval, "pool-stats-refresh-interval", o.PoolStatsRefreshInterval, "Interval the ceph pool stats reported as volume class capacity are refreshed in.")
 
 	fs.Int64Var(&o.Ceph.BurstFactor, "limits-burst-factor", o.Ceph.BurstFactor, "Defines the factor to calculate the burst limits.")
 	fs.Int64Var(&o.Ceph.BurstDurationInSeconds, "limits-burst-duration", o.Ceph.BurstDurationInSeconds, "Defines the burst duration in seconds.")
 
 	fs.Int64Var(&o.Ceph.PopulatorBufferSize, "populator-buffer-size", o.Ceph.PopulatorBufferSize, "Defines the buffer size (in bytes) which is used for downloading a image.")
+	fs.StringVar(&o.Ceph.LayerCacheDir, "layer-cache-dir", o.Ceph.LayerCacheDir, "Directory os image layers are cached in, so that populating snapshots of the same layer again doesn't fetch it from the registry. If empty, layers are not cached.")
+	fs.Int64Var(&o.Ceph.LayerCacheMaxSize, "layer-cache-max-size", o.Ceph.LayerCacheMaxSize, "Total size (in bytes) of the cached layers, the least recently used layers are evicted beyond it.")
 
 	fs.StringVar(&o.Ceph.Monitors, "ceph-monitors", o.Ceph.Monitors, "Ceph Monitors to connect to.")
 	fs.DurationVar(&o.Ceph.ConnectTimeout, "ceph-connect-timeout", o.Ceph.ConnectTimeout, "Connect timeout for establishing a connection to ceph.")
+	fs.DurationVar(&o.Ceph.ReconnectMaxBackoff, "ceph-reconnect-max-backoff", o.Ceph.ReconnectMaxBackoff, "Maximum delay between attempts to re-establish a lost connection to ceph.")
+	fs.DurationVar(&o.Ceph.ClientMountTimeout, "ceph-client-mount-timeout", o.Ceph.ClientMountTimeout, "Time connecting to the ceph monitors may take (client_mount_timeout). 0 keeps the ceph default.")
+	fs.DurationVar(&o.Ceph.OSDOpTimeout, "ceph-osd-op-timeout", o.Ceph.OSDOpTimeout, "Time a rados operation on an osd may take before it fails and is retried (rados_osd_op_timeout). 0 keeps the ceph default of waiting forever.")
+	fs.DurationVar(&o.Ceph.AuthFetchTimeout, "ceph-auth-fetch-timeout", o.Ceph.AuthFetchTimeout, "Timeout for fetching the ceph client credentials from the monitors.")
+	fs.DurationVar(&o.Ceph.AuthCacheTTL, "ceph-auth-cache-ttl", o.Ceph.AuthCacheTTL, "Duration for which fetched ceph client credentials are cached.")
+	fs.BoolVar(&o.Ceph.ScopedCredentials, "ceph-scoped-credentials", o.Ceph.ScopedCredentials, "Hand out the key of a ceph client per image with caps scoped to its rbd image instead of the key of the shared client.")
 	fs.StringVar(&o.Ceph.User, "ceph-user", o.Ceph.User, "Ceph User.")
 	fs.StringVar(&o.Ceph.KeyFile, "ceph-key-file", o.Ceph.KeyFile, "ceph-key-file or ceph-keyring-file must be provided (ceph-key-file has precedence). ceph-key-file contains contains only the ceph key.")
 	fs.StringVar(&o.Ceph.KeyringFile, "ceph-keyring-file", o.Ceph.KeyringFile, "ceph-key-file or ceph-keyring-file must be provided (ceph-key-file has precedence)s. ceph-keyring-file contains the ceph key and client information.")
 	fs.StringVar(&o.Ceph.Pool, "ceph-pool", o.Ceph.Pool, "Ceph pool which is used to store objects.")
+	fs.StringVar(&o.Ceph.Namespace, "ceph-rbd-namespace", o.Ceph.Namespace, "Rbd namespace within the ceph pool the images are stored in. It is created if it does not exist. Defaults to the default namespace.")
 	fs.StringVar(&o.Ceph.Client, "ceph-client", o.Ceph.Client, "Ceph client which grants access to pools/images eg. 'client.volumes'")
 	fs.StringVar(&o.Ceph.KeyEncryptionKeyPath, "ceph-kek-path", o.Ceph.KeyEncryptionKeyPath, "path to the key encryption key file (32 Bit - KEK) to encrypt volume keys.")
 	fs.IntVar(&o.Ceph.VolumeEventStoreOptions.MaxEvents, "volume-event-max-events", 100, "Maximum number of volume events that can be stored.")
 	fs.DurationVar(&o.Ceph.VolumeEventStoreOptions.TTL, "volume-event-ttl", 5*time.Minute, "Time to live for volume events.")
 	fs.DurationVar(&o.Ceph.VolumeEventStoreOptions.ResyncInterval, "volume-event-resync-interval", 1*time.Minute, "Interval for resynchronizing the volume events.")
 
-	fs.IntVar(&o.Ceph.WorkerSize, "worker-size", o.Ceph.WorkerSize, "Defines the factor to calculate the burst limits.")
+	fs.IntVar(&o.Ceph.MaxReconcileRetries, "max-reconcile-retries", o.Ceph.MaxReconcileRetries, "Number of failed reconciles after which an image is marked as failed (0 retries indefinitely).")
+	fs.BoolVar(&o.Ceph.DryRun, "dry-run", o.Ceph.DryRun, "Only validate images and mark them as validated without creating them in ceph.")
+	fs.DurationVar(&o.Ceph.ShutdownGracePeriod, "shutdown-grace-period", o.Ceph.ShutdownGracePeriod, "Time in-flight image reconciles may take to finish on shutdown.")
+	fs.StringVar(&o.Ceph.RegistryDockerConfigPath, "registry-docker-config", o.Ceph.RegistryDockerConfigPath, "Path to a docker config file with the credentials to pull os images from private registries.")
+	fs.StringVar(&o.Ceph.SnapshotS3Endpoint, "snapshot-s3-endpoint", o.Ceph.SnapshotS3Endpoint, "Endpoint s3:// snapshot source urls are fetched from, path-style and without authentication.")
+	fs.IntVar(&o.Ceph.FlattenThreshold, "flatten-threshold", o.Ceph.FlattenThreshold, "Clone depth at which images cloned from snapshots are flattened (0 disables flattening).")
+	fs.StringVar(&o.Ceph.SizeRounding, "size-rounding", o.Ceph.SizeRounding, "Strategy requested image sizes are rounded with: none, up or nearest. Defaults to rounding up to MiB below 1 GiB and to GiB above.")
+	fs.Uint64Var(&o.Ceph.SizeRoundingAlignment, "size-rounding-alignment", o.Ceph.SizeRoundingAlignment, "Alignment in bytes image sizes are rounded to a multiple of with the up and nearest size rounding.")
+	fs.BoolVar(&o.Ceph.OrphanImageGC, "orphan-image-gc", o.Ceph.OrphanImageGC, "Periodically remove rbd images of the pool which have no corresponding image or snapshot.")
+	fs.DurationVar(&o.Ceph.OrphanImageGCInterval, "orphan-image-gc-interval", o.Ceph.OrphanImageGCInterval, "Interval the pool is checked for orphaned rbd images in.")
+	fs.DurationVar(&o.Ceph.OrphanImageGCGracePeriod, "orphan-image-gc-grace-period", o.Ceph.OrphanImageGCGracePeriod, "Minimum age of an orphaned rbd image before it is removed.")
+	fs.BoolVar(&o.Ceph.SnapshotVerify, "snapshot-verify", o.Ceph.SnapshotVerify, "Periodically repopulate populated snapshots whose rbd image or rbd snapshot is missing.")
+	fs.DurationVar(&o.Ceph.SnapshotVerifyInterval, "snapshot-verify-interval", o.Ceph.SnapshotVerifyInterval, "Interval populated snapshots are checked for their rbd image and rbd snapshot in.")
+	fs.IntVar(&o.Ceph.PoolConcurrency, "pool-concurrency", o.Ceph.PoolConcurrency, "Number of images of the same target pool reconciled at once. 0 only bounds the reconciles by the worker size.")
+	fs.IntVar(&o.Ceph.IOContextPoolSize, "io-context-pool-size", o.Ceph.IOContextPoolSize, "Number of idle io contexts kept per pool and reused across image reconciles. 0 opens an io context per reconcile.")
+	fs.DurationVar(&o.Ceph.ImageTrashRetention, "image-trash-retention", o.Ceph.ImageTrashRetention, "Time the rbd images of deleted images are kept in the rbd trash, from where they can be restored. 0 removes them immediately.")
+	fs.DurationVar(&o.Ceph.ImageDeletionGracePeriod, "image-deletion-grace-period", o.Ceph.ImageDeletionGracePeriod, "Time deleted images are retained before their rbd images are removed. 0 removes them right away.")
+	fs.DurationVar(&o.Ceph.SourceRequeueInterval, "image-source-requeue-interval", o.Ceph.SourceRequeueInterval, "Interval images waiting for their snapshot or template are requeued in.")
+	fs.StringSliceVar(&o.Ceph.ExportedLabels, "image-exported-labels", o.Ceph.ExportedLabels, fmt.Sprintf("Keys of the image labels written to the metadata of their rbd images under the %q prefix.", controllers.LabelMetadataPrefix))
+	fs.BoolVar(&o.Ceph.Maintenance, "maintenance", o.Ceph.Maintenance, "Start in maintenance mode, pausing the reconciliation of images and snapshots, image exports and the background rbd cleanup and verification. The maintenance mode is turned on with SIGUSR1 and off with SIGUSR2 at runtime.")
+	fs.DurationVar(&o.Ceph.MaintenanceRequeue, "maintenance-requeue-interval", o.Ceph.MaintenanceRequeue, "Interval images and snapshots are requeued in while in maintenance mode.")
+	fs.DurationVar(&o.Ceph.ImageTrashPurgeInterval, "image-trash-purge-interval", o.Ceph.ImageTrashPurgeInterval, "Interval the rbd trash is checked for rbd images whose retention has passed in.")
+	fs.StringVar(&o.Ceph.RookMonitorConfigMapName, "rook-mon-endpoint-config-map", o.Ceph.RookMonitorConfigMapName, fmt.Sprintf("Name of the rook mon endpoint config map the monitors handed out to images are refreshed from, e.g. %s. If empty, the ceph monitors are handed out.", rook.MonitorConfigMapNameDefaultValue))
+	fs.StringVar(&o.Ceph.RookMonitorConfigMapNamespace, "rook-mon-endpoint-config-map-namespace", o.Ceph.RookMonitorConfigMapNamespace, "Namespace of the rook mon endpoint config map.")
+	fs.StringVar(&o.Ceph.RookMonitorConfigMapDataKey, "rook-mon-endpoint-config-map-data-key", o.Ceph.RookMonitorConfigMapDataKey, fmt.Sprintf("Key of the rook mon endpoint config map the monitors are read from: %s or %s.", rook.MonitorConfigMapDataKeyDefaultValue, rook.MonitorDataKey))
+	fs.StringVar(&o.Ceph.RookClusterID, "rook-cluster-id", o.Ceph.RookClusterID, "Cluster id of the csi cluster config the monitors are read from.")
+	fs.DurationVar(&o.Ceph.MonitorRefreshInterval, "monitor-refresh-interval", o.Ceph.MonitorRefreshInterval, "Interval the monitors are refreshed in from the rook mon endpoint config map.")
+	fs.DurationVar(&o.Ceph.ImageResyncPeriod, "image-resync-period", o.Ceph.ImageResyncPeriod, "Period all images are re-enqueued in for reconciliation in case an event was missed. 0 disables the resync.")
+	fs.Uint64Var(&o.Ceph.ImageFormat, "image-format", o.Ceph.ImageFormat, "Rbd image format images are created with: 1 or 2. Format 1 supports neither image features nor cloning.")
+	fs.StringVar(&o.Ceph.ImageDeletionPolicy, "image-deletion-policy", o.Ceph.ImageDeletionPolicy, fmt.Sprintf("Policy images with clones are deleted with: %s flattens the clones, %s retries the deletion until the clones are gone.", controllers.ImageDeletionPolicyFlatten, controllers.ImageDeletionPolicyBlock))
+	fs.Int64Var(&o.Ceph.WWNSeed, "wwn-seed", o.Ceph.WWNSeed, "Seed to generate the WWNs of images deterministically from, e.g. for testing. If zero, WWNs are generated randomly.")
+	fs.StringVar(&o.Ceph.ImageFinalizer, "image-finalizer", o.Ceph.ImageFinalizer, "Finalizer the image reconciler adds to images. Finalizers of other owners are left intact.")
+	fs.StringSliceVar(&o.Ceph.ImagePreviousFinalizers, "image-previous-finalizers", o.Ceph.ImagePreviousFinalizers, "Finalizers the image reconciler added to images before, e.g. with a different --image-finalizer. They are released like the image finalizer.")
+	fs.IntVar(&o.Ceph.WorkerSize, "worker-size", o.Ceph.WorkerSize, "Defines the number of concurrent workers of the image and snapshot reconcilers.")
+	fs.IntVar(&o.Ceph.SnapshotWorkerSize, "snapshot-worker-size", o.Ceph.SnapshotWorkerSize, "Number of concurrent workers of the snapshot reconciler. 0 uses the worker size.")
+	fs.IntVar(&o.Ceph.PopulateConcurrency, "snapshot-populate-concurrency", o.Ceph.PopulateConcurrency, "Number of snapshots populated from os images or URLs at once. 0 only bounds the populations by the snapshot workers.")
 }
 
 func (o *Options) MarkFlagsRequired(cmd *cobra.Command) {
@@ -110,10 +262,16 @@ func Command() *cobra.Command {
 
 	cmd := &cobra.Command{
 		Use: "volume",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			logger := zap.New(zap.UseFlagOptions(&zapOpts))
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			logOpts := logging.Options{ComponentVerbosity: opts.LogComponentVerbosity}
+			logOpts.ApplyToZap(&zapOpts)
+			logger, err := logging.New(zap.New(zap.UseFlagOptions(&zapOpts)), logOpts)
+			if err != nil {
+				return err
+			}
 			ctrl.SetLogger(logger)
 			cmd.SetContext(ctrl.LoggerInto(cmd.Context(), ctrl.Log))
+			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return Run(cmd.Context(), opts)
@@ -123,6 +281,7 @@ func Command() *cobra.Command {
 	goFlags := goflag.NewFlagSet("", 0)
 	zapOpts.BindFlags(goFlags)
 	cmd.PersistentFlags().AddGoFlagSet(goFlags)
+	cmd.PersistentFlags().StringToIntVar(&opts.LogComponentVerbosity, "log-component-verbosity", nil, fmt.Sprintf("Log verbosity of components overriding the zap log level, e.g. snapshot=4. Components: %s.", strings.Join(logging.Components(), ", ")))
 
 	opts.Defaults()
 	opts.AddFlags(cmd.Flags())
@@ -131,6 +290,33 @@ func Command() *cobra.Command {
 	return cmd
 }
 
+// newRookMonitorSource returns the source of the rook mon endpoint config map if it is configured.
+func newRookMonitorSource(opts Options) (controllers.MonitorSource, error) {
+	if opts.Ceph.RookMonitorConfigMapName == "" {
+		return nil, nil
+	}
+
+	cfg, err := configutils.GetConfig(configutils.Kubeconfig(opts.Kubeconfig))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return &rook.MonitorConfigMapSource{
+		Client: c,
+		ConfigMap: client.ObjectKey{
+			Namespace: opts.Ceph.RookMonitorConfigMapNamespace,
+			Name:      opts.Ceph.RookMonitorConfigMapName,
+		},
+		DataKey:   opts.Ceph.RookMonitorConfigMapDataKey,
+		ClusterID: opts.Ceph.RookClusterID,
+	}, nil
+}
+
 func configureCephAuth(opts *CephOptions) (func() error, error) {
 	noOpCleanup := func() error { return nil }
 	if opts.KeyFile == "" && opts.KeyringFile == "" {
@@ -168,8 +354,8 @@ func Run(ctx context.Context, opts Options) error {
 	log := ctrl.LoggerFrom(ctx)
 	setupLog := log.WithName("setup")
 
-	if opts.Ceph.WorkerSize <= 1 {
-		err := fmt.Errorf("invalid configuration: worker-size must be greater than 1, but got %d", opts.Ceph.WorkerSize)
+	if opts.Ceph.WorkerSize < 1 {
+		err := fmt.Errorf("invalid configuration: worker-size must be greater than 0, but got %d", opts.Ceph.WorkerSize)
 		setupLog.Error(err, "Worker size validation failed")
 		return err
 	}
@@ -191,27 +377,69 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("failed to init encryptor: %w", err)
 	}
 
-	setupLog.Info("Establishing ceph connection", "Monitors", opts.Ceph.Monitors, "User", opts.Ceph.User, "Timeout", opts.Ceph.ConnectTimeout)
-	connectCtx, cancelConnect := context.WithTimeout(ctx, opts.Ceph.ConnectTimeout)
-	defer cancelConnect()
-	conn, err := ceph.ConnectToRados(connectCtx, ceph.Credentials{
-		Monitors: opts.Ceph.Monitors,
-		User:     opts.Ceph.User,
-		Keyfile:  opts.Ceph.KeyFile,
-	})
+	connOptions := ceph.ConnOptions{
+		MountTimeout: opts.Ceph.ClientMountTimeout,
+		OSDOpTimeout: opts.Ceph.OSDOpTimeout,
+	}
+	if err := connOptions.Validate(); err != nil {
+		return fmt.Errorf("configuration invalid: %w", err)
+	}
+
+	connManager, err := reconnect.NewManager(
+		log.WithName("ceph-connection"),
+		func(ctx context.Context) (*rados.Conn, error) {
+			connectCtx, cancelConnect := context.WithTimeout(ctx, opts.Ceph.ConnectTimeout)
+			defer cancelConnect()
+			return ceph.ConnectToRados(connectCtx, ceph.Credentials{
+				Monitors: opts.Ceph.Monitors,
+				User:     opts.Ceph.User,
+				Keyfile:  opts.Ceph.KeyFile,
+			}, connOptions)
+		},
+		(*rados.Conn).Shutdown,
+		reconnect.Options{
+			MaxBackoff: opts.Ceph.ReconnectMaxBackoff,
+		},
+	)
 	if err != nil {
+		return fmt.Errorf("failed to initialize ceph connection manager: %w", err)
+	}
+
+	setupLog.Info("Establishing ceph connection", "Monitors", opts.Ceph.Monitors, "User", opts.Ceph.User, "Timeout", opts.Ceph.ConnectTimeout)
+	if err := connManager.Connect(ctx); err != nil {
 		return fmt.Errorf("failed to establish rados connection: %w", err)
 	}
 
-	if err := ceph.CheckIfPoolExists(conn, opts.Ceph.Pool); err != nil {
+	conn, releaseConn, err := connManager.Acquire()
+	if err != nil {
+		return fmt.Errorf("failed to get rados connection: %w", err)
+	}
+
+	err = ceph.CheckIfPoolExists(conn, opts.Ceph.Pool)
+	releaseConn()
+	if err != nil {
 		return fmt.Errorf("configuration invalid: %w", err)
 	}
 
+	if err := ceph.ValidateNamespace(opts.Ceph.Namespace); err != nil {
+		return fmt.Errorf("configuration invalid: %w", err)
+	}
+	if err := ceph.EnsureNamespace(connManager, opts.Ceph.Pool, opts.Ceph.Namespace); err != nil {
+		return fmt.Errorf("failed to ensure rbd namespace: %w", err)
+	}
+
+	imageStrategy := strategy.ImageStrategy
+	if opts.Ceph.WWNSeed != 0 {
+		setupLog.Info("Generating WWNs deterministically", "Seed", opts.Ceph.WWNSeed)
+		imageStrategy.WWNGen = strategy.NewSeededWWNGen(opts.Ceph.WWNSeed)
+	}
+
 	setupLog.Info("Configuring image store", "OmapName", omap.NameVolumes)
-	imageStore, err := omap.New(conn, opts.Ceph.Pool, omap.Options[*providerapi.Image]{
+	imageStore, err := omap.New(connManager, opts.Ceph.Pool, omap.Options[*providerapi.Image]{
 		OmapName:       omap.NameVolumes,
 		NewFunc:        func() *providerapi.Image { return &providerapi.Image{} },
-		CreateStrategy: strategy.ImageStrategy,
+		CreateStrategy: imageStrategy,
+		Migrations:     strategy.ImageMigrations,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to initialize image store: %w", err)
@@ -226,11 +454,17 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("failed to initialize image events: %w", err)
 	}
 
+	imageReplayEvents, err := replay.NewSource[*providerapi.Image](imageEvents, imageStore.List)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image replay events: %w", err)
+	}
+
 	setupLog.Info("Configuring snapshot store", "OmapName", omap.NameSnapshots)
-	snapshotStore, err := omap.New(conn, opts.Ceph.Pool, omap.Options[*providerapi.Snapshot]{
+	snapshotStore, err := omap.New(connManager, opts.Ceph.Pool, omap.Options[*providerapi.Snapshot]{
 		OmapName:       omap.NameSnapshots,
 		NewFunc:        func() *providerapi.Snapshot { return &providerapi.Snapshot{} },
 		CreateStrategy: strategy.SnapshotStrategy,
+		Migrations:     strategy.SnapshotMigrations,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to initialize snapshot store: %w", err)
@@ -247,19 +481,60 @@ func Run(ctx context.Context, opts Options) error {
 
 	volumeEventStore := eventrecorder.NewEventStore(log, opts.Ceph.VolumeEventStoreOptions)
 
+	monitorSource, err := newRookMonitorSource(opts)
+	if err != nil {
+		return fmt.Errorf("failed to initialize rook monitor source: %w", err)
+	}
+
+	maintenanceMode := maintenance.NewMode(log.WithName("maintenance"), opts.Ceph.Maintenance)
+	if opts.Ceph.Maintenance {
+		setupLog.Info("Starting in maintenance mode, reconciliation is paused")
+	}
+
 	imageReconciler, err := controllers.NewImageReconciler(
-		log.WithName("image-reconciler"),
-		conn,
+		log.WithName(logging.LoggerName(logging.ComponentImage)),
+		connManager,
 		imageStore, snapshotStore,
 		volumeEventStore,
-		imageEvents,
+		imageReplayEvents,
 		snapshotEvents,
 		encryptor,
 		controllers.ImageReconcilerOptions{
 			Monitors:   opts.Ceph.Monitors,
 			Client:     opts.Ceph.Client,
 			Pool:       opts.Ceph.Pool,
+			Namespace:  opts.Ceph.Namespace,
 			WorkerSize: opts.Ceph.WorkerSize,
+
+			MaxReconcileRetries: opts.Ceph.MaxReconcileRetries,
+			AuthFetchTimeout:    opts.Ceph.AuthFetchTimeout,
+			AuthCacheTTL:        opts.Ceph.AuthCacheTTL,
+			ScopedCredentials:   opts.Ceph.ScopedCredentials,
+			DryRun:              opts.Ceph.DryRun,
+			ShutdownGracePeriod: opts.Ceph.ShutdownGracePeriod,
+			RegistryAuth:        controllers.RegistryAuth{DockerConfigPath: opts.Ceph.RegistryDockerConfigPath},
+			FlattenThreshold:    opts.Ceph.FlattenThreshold,
+			SizeRounding: round.Strategy{
+				Mode:      round.Mode(opts.Ceph.SizeRounding),
+				Alignment: opts.Ceph.SizeRoundingAlignment,
+			},
+			MonitorSource:          monitorSource,
+			MonitorRefreshInterval: opts.Ceph.MonitorRefreshInterval,
+			Finalizer:              opts.Ceph.ImageFinalizer,
+			PreviousFinalizers:     opts.Ceph.ImagePreviousFinalizers,
+			ResyncPeriod:           opts.Ceph.ImageResyncPeriod,
+			DeletionPolicy:         controllers.ImageDeletionPolicy(opts.Ceph.ImageDeletionPolicy),
+			WWNGen:                 imageStrategy.WWNGen,
+			TrashRetention:         opts.Ceph.ImageTrashRetention,
+			DeletionGracePeriod:    opts.Ceph.ImageDeletionGracePeriod,
+			SourceRequeueInterval:  opts.Ceph.SourceRequeueInterval,
+			PoolConcurrency:        opts.Ceph.PoolConcurrency,
+			IOContextPoolSize:      opts.Ceph.IOContextPoolSize,
+			ImageFormat:            controllers.ImageFormat(opts.Ceph.ImageFormat),
+			ExportedLabels:         opts.Ceph.ExportedLabels,
+
+			Maintenance:                maintenanceMode,
+			MaintenanceRequeueInterval: opts.Ceph.MaintenanceRequeue,
 		},
 	)
 	if err != nil {
@@ -268,6 +543,14 @@ func Run(ctx context.Context, opts Options) error {
 
 	g, ctx := errgroup.WithContext(ctx)
 
+	maintenanceMode.WatchSignals(ctx)
+
+	g.Go(func() error {
+		setupLog.Info("Starting ceph connection manager")
+		connManager.Start(ctx)
+		return nil
+	})
+
 	g.Go(func() error {
 		setupLog.Info("Starting image reconciler")
 		if err := imageReconciler.Start(ctx); err != nil {
@@ -277,22 +560,66 @@ func Run(ctx context.Context, opts Options) error {
 		return nil
 	})
 
+	var layerCache *layercache.Cache
+	if opts.Ceph.LayerCacheDir != "" {
+		setupLog.Info("Configuring layer cache", "Dir", opts.Ceph.LayerCacheDir, "MaxSize", opts.Ceph.LayerCacheMaxSize)
+		layerCache, err = layercache.New(log.WithName("layer-cache"), layercache.Options{
+			Dir:     opts.Ceph.LayerCacheDir,
+			MaxSize: opts.Ceph.LayerCacheMaxSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to initialize layer cache: %w", err)
+		}
+	}
+
+	snapshotWorkerSize := opts.Ceph.SnapshotWorkerSize
+	if snapshotWorkerSize == 0 {
+		snapshotWorkerSize = opts.Ceph.WorkerSize
+	}
 	snapshotReconciler, err := controllers.NewSnapshotReconciler(
-		log.WithName("snapshot-reconciler"),
-		conn,
+		log.WithName(logging.LoggerName(logging.ComponentSnapshot)),
+		connManager,
 		snapshotStore,
 		imageStore,
 		snapshotEvents,
 		controllers.SnapshotReconcilerOptions{
 			Pool:                opts.Ceph.Pool,
+			Namespace:           opts.Ceph.Namespace,
 			PopulatorBufferSize: opts.Ceph.PopulatorBufferSize,
-			WorkerSize:          opts.Ceph.WorkerSize,
+			WorkerSize:          snapshotWorkerSize,
+			PopulateConcurrency: opts.Ceph.PopulateConcurrency,
+			RegistryAuth:        controllers.RegistryAuth{DockerConfigPath: opts.Ceph.RegistryDockerConfigPath},
+			S3Endpoint:          opts.Ceph.SnapshotS3Endpoint,
+			LayerCache:          layerCache,
+
+			Maintenance:                maintenanceMode,
+			MaintenanceRequeueInterval: opts.Ceph.MaintenanceRequeue,
 		},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to initialize snapshot reconciler: %w", err)
 	}
 
+	if opts.MetricsBindAddress != "" {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		if err := imageReconciler.RegisterMetrics(registry); err != nil {
+			return fmt.Errorf("failed to register image metrics: %w", err)
+		}
+		if err := snapshotReconciler.RegisterMetrics(registry); err != nil {
+			return fmt.Errorf("failed to register snapshot metrics: %w", err)
+		}
+
+		g.Go(func() error {
+			setupLog.Info("Starting metrics server")
+			if err := runMetricsServer(ctx, setupLog, registry, opts); err != nil {
+				setupLog.Error(err, "failed to start metrics server")
+				return err
+			}
+			return nil
+		})
+	}
+
 	g.Go(func() error {
 		setupLog.Info("Starting snapshot reconciler")
 		if err := snapshotReconciler.Start(ctx); err != nil {
@@ -302,6 +629,76 @@ func Run(ctx context.Context, opts Options) error {
 		return nil
 	})
 
+	if opts.Ceph.OrphanImageGC {
+		orphanImageCollector, err := controllers.NewOrphanImageCollector(
+			log.WithName("orphan-image-collector"),
+			connManager,
+			imageStore,
+			snapshotStore,
+			controllers.OrphanImageCollectorOptions{
+				Pool:        opts.Ceph.Pool,
+				Namespace:   opts.Ceph.Namespace,
+				Interval:    opts.Ceph.OrphanImageGCInterval,
+				GracePeriod: opts.Ceph.OrphanImageGCGracePeriod,
+				Maintenance: maintenanceMode,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize orphan image collector: %w", err)
+		}
+
+		g.Go(func() error {
+			setupLog.Info("Starting orphan image collector")
+			orphanImageCollector.Start(ctx)
+			return nil
+		})
+	}
+
+	if opts.Ceph.SnapshotVerify {
+		snapshotVerifier, err := controllers.NewSnapshotVerifier(
+			log.WithName("snapshot-verifier"),
+			connManager,
+			snapshotStore,
+			controllers.SnapshotVerifierOptions{
+				Pool:        opts.Ceph.Pool,
+				Namespace:   opts.Ceph.Namespace,
+				Interval:    opts.Ceph.SnapshotVerifyInterval,
+				Maintenance: maintenanceMode,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize snapshot verifier: %w", err)
+		}
+
+		g.Go(func() error {
+			setupLog.Info("Starting snapshot verifier")
+			snapshotVerifier.Start(ctx)
+			return nil
+		})
+	}
+
+	if opts.Ceph.ImageTrashRetention > 0 {
+		trashPurger, err := controllers.NewTrashPurger(
+			log.WithName("trash-purger"),
+			connManager,
+			controllers.TrashPurgerOptions{
+				Pool:        opts.Ceph.Pool,
+				Namespace:   opts.Ceph.Namespace,
+				Interval:    opts.Ceph.ImageTrashPurgeInterval,
+				Maintenance: maintenanceMode,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize trash purger: %w", err)
+		}
+
+		g.Go(func() error {
+			setupLog.Info("Starting trash purger")
+			trashPurger.Start(ctx)
+			return nil
+		})
+	}
+
 	g.Go(func() error {
 		setupLog.Info("Starting image events")
 		if err := imageEvents.Start(ctx); err != nil {
@@ -331,12 +728,20 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("failed to load supported volume classes: %w", err)
 	}
 
+	if err := opts.PoolCapabilities.Validate(); err != nil {
+		return fmt.Errorf("invalid pool capabilities: %w", err)
+	}
+	supportedClasses, rejectedClasses := vcr.FilterSatisfiable(supportedClasses, opts.PoolCapabilities)
+	for name, reason := range rejectedClasses {
+		setupLog.Info("Not advertising volume class the pool can't satisfy", "VolumeClass", name, "Reason", reason.Error())
+	}
+
 	classRegistry, err := vcr.NewVolumeClassRegistry(supportedClasses)
 	if err != nil {
 		return fmt.Errorf("failed to initialize volume class registry: %w", err)
 	}
 
-	cephCommandClient, err := ceph.NewCommandClient(conn, opts.Ceph.Pool)
+	cephCommandClient, err := ceph.NewCommandClient(connManager, opts.Ceph.Pool)
 	if err != nil {
 		return fmt.Errorf("failed to initialize ceph command client: %w", err)
 	}
@@ -348,15 +753,46 @@ func Run(ctx context.Context, opts Options) error {
 		encryptor,
 		cephCommandClient,
 		volumeserver.Options{
-			VolumeEventStore:       volumeEventStore,
-			BurstFactor:            opts.Ceph.BurstFactor,
-			BurstDurationInSeconds: opts.Ceph.BurstDurationInSeconds,
+			VolumeEventStore:         volumeEventStore,
+			BurstFactor:              opts.Ceph.BurstFactor,
+			BurstDurationInSeconds:   opts.Ceph.BurstDurationInSeconds,
+			PoolStatsRefreshInterval: opts.PoolStatsRefreshInterval,
 		},
 	)
 	if err != nil {
 		return fmt.Errorf("error creating server: %w", err)
 	}
 
+	g.Go(func() error {
+		setupLog.Info("Starting pool stats refresh")
+		srv.StartPoolStatsRefresh(ctrl.LoggerInto(ctx, log.WithName("pool-stats")))
+		return nil
+	})
+
+	if opts.HealthProbeBindAddress != "" {
+		healthChecker, err := health.NewChecker(log.WithName("health-checker"), ceph.MonClient{Conns: connManager}, health.Options{
+			Interval: opts.HealthCheckInterval,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to initialize health checker: %w", err)
+		}
+
+		g.Go(func() error {
+			setupLog.Info("Starting health checker")
+			healthChecker.Start(ctx)
+			return nil
+		})
+
+		g.Go(func() error {
+			setupLog.Info("Starting health probe server")
+			if err := runHealthProbeServer(ctx, setupLog, healthChecker, opts); err != nil {
+				setupLog.Error(err, "failed to start health probe server")
+				return err
+			}
+			return nil
+		})
+	}
+
 	g.Go(func() error {
 		setupLog.Info("Starting grpc server")
 		if err := runGRPCServer(ctx, setupLog, log, srv, opts); err != nil {
@@ -368,6 +804,38 @@ func Run(ctx context.Context, opts Options) error {
 	return g.Wait()
 }
 
+func runHealthProbeServer(ctx context.Context, setupLog logr.Logger, checker *health.Checker, opts Options) error {
+	return runHTTPServer(ctx, setupLog, "health probe", opts.HealthProbeBindAddress, health.NewServeMux(checker))
+}
+
+func runMetricsServer(ctx context.Context, setupLog logr.Logger, gatherer prometheus.Gatherer, opts Options) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	return runHTTPServer(ctx, setupLog, "metrics", opts.MetricsBindAddress, mux)
+}
+
+func runHTTPServer(ctx context.Context, setupLog logr.Logger, name, address string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		setupLog.Info(fmt.Sprintf("Shutting down %s server", name))
+		if err := srv.Shutdown(context.Background()); err != nil {
+			setupLog.Error(err, fmt.Sprintf("failed to shut down %s server", name))
+		}
+	}()
+
+	setupLog.Info(fmt.Sprintf("Serving %s endpoints", name), "Address", address)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving %s endpoints: %w", name, err)
+	}
+	return nil
+}
+
 func runGRPCServer(ctx context.Context, setupLog logr.Logger, log logr.Logger, srv *volumeserver.Server, opts Options) error {
 	setupLog.V(1).Info("Cleaning up any previous socket")
 	if err := common.CleanupSocketIfExists(opts.Address); err != nil {
@@ -13,6 +13,7 @@ import (
 	objectbucketv1alpha1 "github.com/kube-object-storage/lib-bucket-provisioner/pkg/apis/objectbucket.io/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var bucketClaimStateToIRIState = map[objectbucketv1alpha1.ObjectBucketClaimStatusPhase]iriv1alpha1.BucketState{
@@ -46,6 +47,11 @@ func (s *Server) convertBucketClaimAndAccessSecretToBucket(
 		return nil, fmt.Errorf("failed to convert access secret to bucket access: %w", err)
 	}
 
+	// A bound bucket claim is only usable once the provisioner populated its access secret.
+	if state == iriv1alpha1.BucketState_BUCKET_AVAILABLE && access == nil {
+		state = iriv1alpha1.BucketState_BUCKET_PENDING
+	}
+
 	return &iriv1alpha1.Bucket{
 		Metadata: metadata,
 		Spec: &iriv1alpha1.BucketSpec{
@@ -78,7 +84,7 @@ func (s *Server) convertAccessSecretToBucketAccess(
 	}
 
 	if accessSecret == nil {
-		return nil, fmt.Errorf("access secret not contained in aggregate bucket")
+		return nil, nil
 	}
 
 	return &iriv1alpha1.BucketAccess{
@@ -87,7 +93,24 @@ func (s *Server) convertAccessSecretToBucketAccess(
 	}, nil
 }
 
+// findBucketClaimForID looks up a bucket claim across namespaces.
+func (s *Server) findBucketClaimForID(ctx context.Context, id string) (*objectbucketv1alpha1.ObjectBucketClaim, error) {
+	bucketClaimList := &objectbucketv1alpha1.ObjectBucketClaimList{}
+	if err := s.listManagedAndCreated(ctx, bucketClaimList, client.MatchingFields{"metadata.name": id}); err != nil {
+		return nil, fmt.Errorf("error getting bucket claim with ID %s: %w", id, err)
+	}
+
+	if len(bucketClaimList.Items) == 0 {
+		return nil, fmt.Errorf("failed to get bucket %s: %w", id, utils.ErrBucketIsntManaged)
+	}
+	return &bucketClaimList.Items[0], nil
+}
+
 func (s *Server) getBucketClaimForID(ctx context.Context, id string) (*objectbucketv1alpha1.ObjectBucketClaim, error) {
+	if s.namespaceFromBucket != nil {
+		return s.findBucketClaimForID(ctx, id)
+	}
+
 	bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{}
 	if err := s.getManagedAndCreated(ctx, id, bucketClaim); err != nil {
 		if !apierrors.IsNotFound(err) {
@@ -13,27 +13,81 @@ import (
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
 	objectbucketv1alpha1 "github.com/kube-object-storage/lib-bucket-provisioner/pkg/apis/objectbucket.io/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// bucketClaimMaxSizeConfig is the additional bucket claim config key rook uses for the bucket quota.
+const bucketClaimMaxSizeConfig = "maxSize"
+
+func getBucketMaxSize(bucket *iriv1alpha1.Bucket) (*resource.Quantity, error) {
+	maxSize, ok := bucket.GetMetadata().GetAnnotations()[api.BucketMaxSizeAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	quantity, err := resource.ParseQuantity(maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid bucket max size %q: %w", utils.ErrInvalidBucketConfig, maxSize, err)
+	}
+	if quantity.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: bucket max size must be positive, got %s", utils.ErrInvalidBucketConfig, quantity.String())
+	}
+	return &quantity, nil
+}
+
+func setBucketClaimAdditionalConfig(bucketClaim *objectbucketv1alpha1.ObjectBucketClaim, key, value string) {
+	if bucketClaim.Spec.AdditionalConfig == nil {
+		bucketClaim.Spec.AdditionalConfig = make(map[string]string)
+	}
+	bucketClaim.Spec.AdditionalConfig[key] = value
+}
+
 func (s *Server) createBucketClaimAndAccessSecretFromBucket(
 	ctx context.Context,
 	log logr.Logger,
 	bucket *iriv1alpha1.Bucket,
 ) (*objectbucketv1alpha1.ObjectBucketClaim, *corev1.Secret, error) {
-	generateBucketName := s.idGen.Generate()
+	maxSize, err := getBucketMaxSize(bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkBucketCORS(bucket); err != nil {
+		return nil, nil, err
+	}
+
+	lifecycle, err := getBucketLifecycle(bucket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", utils.ErrInvalidBucketConfig, err)
+	}
+
+	storageClassName, err := s.bucketStorageClassName(bucket.GetSpec().GetClass())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	namespace := s.bucketNamespace(bucket)
+	if namespace != s.namespace {
+		log.V(2).Info("Ensuring bucket namespace", "Namespace", namespace)
+		if err := s.ensureNamespace(ctx, namespace); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ObjectBucketClaim",
 			APIVersion: "objectbucket.io/v1alpha1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      generateBucketName,
-			Namespace: s.namespace,
+			Namespace: namespace,
 		},
 		Spec: objectbucketv1alpha1.ObjectBucketClaimSpec{
-			StorageClassName:   s.bucketPoolStorageClassName,
-			GenerateBucketName: generateBucketName,
+			StorageClassName: storageClassName,
 		},
 	}
 
@@ -43,20 +97,128 @@ func (s *Server) createBucketClaimAndAccessSecretFromBucket(
 	api.SetClassLabel(bucketClaim, bucket.Spec.Class)
 	api.SetBucketManagerLabel(bucketClaim, api.BucketManager)
 
+	if maxSize != nil {
+		log.Info("Setting bucket quota, it is only enforced if the bucket provisioner supports it", "MaxSize", maxSize.String())
+		setBucketClaimAdditionalConfig(bucketClaim, bucketClaimMaxSizeConfig, maxSize.String())
+	}
+
+	if lifecycle != "" {
+		log.V(1).Info("Setting bucket lifecycle")
+		setBucketClaimAdditionalConfig(bucketClaim, bucketClaimLifecycleConfig, lifecycle)
+	}
+
 	log.V(2).Info("Creating bucket claim")
-	if err := s.client.Create(ctx, bucketClaim); err != nil {
-		return nil, nil, fmt.Errorf("failed to create bucket claim: %w", err)
+	bucketClaim, err = s.createBucketClaim(ctx, log, bucketClaim)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.accessSecretTimeout > 0 {
+		log.V(2).Info("Waiting for bucket access secret", "Timeout", s.accessSecretTimeout)
+		accessSecret, err := s.waitForBucketAccessSecret(ctx, bucketClaim)
+		if err != nil {
+			log.V(1).Info("Deleting bucket claim after failing to get bucket access secret")
+			if err := s.client.Delete(context.WithoutCancel(ctx), bucketClaim); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Error deleting bucket claim")
+			}
+			return nil, nil, err
+		}
+		if err := s.propagateBucketMetadataToAccessSecret(ctx, bucketClaim, accessSecret); err != nil {
+			log.Error(err, "Error propagating bucket metadata, it is propagated by the next access secret sync")
+		}
+		return bucketClaim, accessSecret, nil
 	}
 
 	log.V(2).Info("Getting bucket access secret")
-	accessSecret, err := s.getBucketAccessSecretIfRequired(bucketClaim, s.clientGetSecretFunc(ctx))
+	accessSecret, err := s.getBucketAccessSecretIfRequired(bucketClaim, s.clientGetSecretFunc(ctx, namespace))
 	if err != nil {
 		return nil, nil, err
 	}
+	if accessSecret != nil {
+		if err := s.propagateBucketMetadataToAccessSecret(ctx, bucketClaim, accessSecret); err != nil {
+			log.Error(err, "Error propagating bucket metadata, it is propagated by the next access secret sync")
+		}
+	}
 
 	return bucketClaim, accessSecret, nil
 }
 
+// maxBucketClaimNameAttempts is how often the name of a bucket claim is generated before giving up on collisions.
+const maxBucketClaimNameAttempts = 3
+
+// createBucketClaim creates the bucket claim under a generated name. The name is generated anew for every attempt,
+// so a bucket claim of a colliding name was never created by this request, and its name is regenerated.
+func (s *Server) createBucketClaim(
+	ctx context.Context,
+	log logr.Logger,
+	bucketClaim *objectbucketv1alpha1.ObjectBucketClaim,
+) (*objectbucketv1alpha1.ObjectBucketClaim, error) {
+	for attempt := 1; ; attempt++ {
+		name := s.idGen.Generate()
+		bucketClaim.Name = name
+		bucketClaim.Spec.GenerateBucketName = name
+
+		err := s.client.Create(ctx, bucketClaim)
+		if err == nil {
+			return bucketClaim, nil
+		}
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("failed to create bucket claim: %w", err)
+		}
+
+		if attempt == maxBucketClaimNameAttempts {
+			return nil, fmt.Errorf("failed to create bucket claim: generated name collided %d times: %w", attempt, err)
+		}
+		log.V(1).Info("Generated bucket claim name is taken, regenerating it", "BucketClaimName", name)
+	}
+}
+
+func isBucketAccessSecretPopulated(accessSecret *corev1.Secret) bool {
+	if len(accessSecret.Data) == 0 {
+		return false
+	}
+	for _, value := range accessSecret.Data {
+		if len(value) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForBucketAccessSecret polls until the bucket claim is bound and its access secret is populated.
+// The bucket claim is updated with the latest observed state.
+func (s *Server) waitForBucketAccessSecret(
+	ctx context.Context,
+	bucketClaim *objectbucketv1alpha1.ObjectBucketClaim,
+) (*corev1.Secret, error) {
+	var accessSecret *corev1.Secret
+	if err := wait.PollUntilContextTimeout(ctx, s.accessSecretPollInterval, s.accessSecretTimeout, true, func(ctx context.Context) (bool, error) {
+		if err := s.client.Get(ctx, client.ObjectKeyFromObject(bucketClaim), bucketClaim); err != nil {
+			return false, fmt.Errorf("error getting bucket claim: %w", err)
+		}
+
+		secret, err := s.getBucketAccessSecretIfRequired(bucketClaim, s.clientGetSecretFunc(ctx, bucketClaim.Namespace))
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("error getting bucket access secret: %w", err)
+		}
+		if secret == nil || !isBucketAccessSecretPopulated(secret) {
+			return false, nil
+		}
+
+		accessSecret = secret
+		return true, nil
+	}); err != nil {
+		if wait.Interrupted(err) {
+			return nil, fmt.Errorf("bucket access secret of bucket claim %s was not populated within %s: %w", bucketClaim.Name, s.accessSecretTimeout, err)
+		}
+		return nil, err
+	}
+	return accessSecret, nil
+}
+
 func (s *Server) CreateBucket(
 	ctx context.Context,
 	req *iriv1alpha1.CreateBucketRequest,
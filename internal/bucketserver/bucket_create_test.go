@@ -6,17 +6,34 @@ package bucketserver_test
 import (
 	"fmt"
 
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/bucketserver"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
 	irimetav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	objectbucketv1alpha1 "github.com/kube-object-storage/lib-bucket-provisioner/pkg/apis/objectbucket.io/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 )
 
+// sequenceIDGen generates the given ids in order, repeating the last one once they are exhausted.
+type sequenceIDGen struct {
+	ids  []string
+	next int
+}
+
+func (g *sequenceIDGen) Generate() string {
+	id := g.ids[min(g.next, len(g.ids)-1)]
+	g.next++
+	return id
+}
+
 var _ = Describe("CreateBucket test", func() {
 	It("Should create a bucket", func(ctx SpecContext) {
 		By("Creating a bucket")
@@ -111,5 +128,313 @@ var _ = Describe("CreateBucket test", func() {
 				)),
 			)),
 		))
+
+		By("Ensuring the bucket metadata is propagated to the bucket access secret")
+		Eventually(Object(accessSecret)).Should(SatisfyAll(
+			HaveField("Labels", SatisfyAll(
+				HaveKeyWithValue(api.ClassLabel, "foo"),
+				HaveKeyWithValue(api.ManagerLabel, api.BucketManager),
+			)),
+			HaveField("Annotations", HaveKeyWithValue(api.LabelsAnnotation, `{"foo":"bar"}`)),
+			HaveField("Type", Equal(corev1.SecretTypeOpaque)),
+			HaveField("Data", Equal(secretData)),
+		))
+	})
+
+	It("Should set the bucket quota on the bucket claim", func(ctx SpecContext) {
+		By("Creating a bucket with a max size")
+		createResp, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Annotations: map[string]string{api.BucketMaxSizeAnnotation: "10Gi"},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(bucketClient.DeleteBucket, &iriv1alpha1.DeleteBucketRequest{
+			BucketId: createResp.Bucket.Metadata.Id,
+		})
+
+		By("Ensuring the bucketClaim carries the quota")
+		bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      createResp.Bucket.Metadata.Id,
+				Namespace: rookNamespace.Name,
+			},
+		}
+		Eventually(Object(bucketClaim)).Should(
+			HaveField("Spec.AdditionalConfig", HaveKeyWithValue("maxSize", "10Gi")),
+		)
+	})
+
+	It("Should reject a non-positive bucket quota", func(ctx SpecContext) {
+		By("Creating a bucket with a negative max size")
+		_, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Annotations: map[string]string{api.BucketMaxSizeAnnotation: "-1Gi"},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(err).To(MatchError(ContainSubstring("bucket max size must be positive")))
+	})
+
+	It("Should pass the lifecycle through to the bucket claim", func(ctx SpecContext) {
+		By("Creating a bucket with a lifecycle")
+		createResp, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Annotations: map[string]string{
+						api.BucketLifecycleAnnotation: `{"Rules": [{"ID": "expire", "Status": "Enabled", "Prefix": "", "Expiration": {"Days": 30}}]}`,
+					},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(bucketClient.DeleteBucket, &iriv1alpha1.DeleteBucketRequest{
+			BucketId: createResp.Bucket.Metadata.Id,
+		})
+
+		By("Ensuring the bucketClaim carries the lifecycle")
+		bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      createResp.Bucket.Metadata.Id,
+				Namespace: rookNamespace.Name,
+			},
+		}
+		Eventually(Object(bucketClaim)).Should(
+			HaveField("Spec.AdditionalConfig", HaveKeyWithValue("bucketLifecycle",
+				`{"Rules":[{"ID":"expire","Status":"Enabled","Prefix":"","Expiration":{"Days":30}}]}`)),
+		)
+	})
+
+	It("Should reject cors rules as unsupported", func(ctx SpecContext) {
+		bucketClaimList := &objectbucketv1alpha1.ObjectBucketClaimList{}
+		Expect(k8sClient.List(ctx, bucketClaimList, client.InNamespace(rookNamespace.Name))).To(Succeed())
+		bucketClaims := len(bucketClaimList.Items)
+
+		By("Creating a bucket with valid cors rules")
+		_, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Annotations: map[string]string{
+						api.BucketCORSAnnotation: `[{
+							"AllowedOrigins": ["https://example.com"],
+							"AllowedMethods": ["GET", "PUT"],
+							"MaxAgeSeconds": 300
+						}]`,
+					},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+
+		By("Ensuring no bucketClaim was created")
+		Expect(k8sClient.List(ctx, bucketClaimList, client.InNamespace(rookNamespace.Name))).To(Succeed())
+		Expect(bucketClaimList.Items).To(HaveLen(bucketClaims))
+	})
+
+	It("Should reject invalid cors rules", func(ctx SpecContext) {
+		By("Creating a bucket with an unsupported cors method")
+		_, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Annotations: map[string]string{
+						api.BucketCORSAnnotation: `[{"AllowedOrigins": ["*"], "AllowedMethods": ["PATCH"]}]`,
+					},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(err).To(MatchError(ContainSubstring(`unsupported method "PATCH"`)))
+	})
+
+	It("Should reject a malformed lifecycle", func(ctx SpecContext) {
+		By("Creating a bucket with a lifecycle that is not valid JSON")
+		_, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Annotations: map[string]string{api.BucketLifecycleAnnotation: `{"Rules": [`},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(err).To(MatchError(ContainSubstring("invalid bucket lifecycle")))
+	})
+
+	It("Should create the bucket claim with the storage class mapped to the bucket class", func(ctx SpecContext) {
+		By("Creating a bucket of a mapped class")
+		createResp, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "bar",
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(bucketClient.DeleteBucket, &iriv1alpha1.DeleteBucketRequest{
+			BucketId: createResp.Bucket.Metadata.Id,
+		})
+
+		By("Ensuring the bucketClaim uses the mapped storage class")
+		bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      createResp.Bucket.Metadata.Id,
+				Namespace: rookNamespace.Name,
+			},
+		}
+		Eventually(Object(bucketClaim)).Should(HaveField("Spec.StorageClassName", "bar-tier"))
+	})
+
+	It("Should reject an unknown bucket class", func(ctx SpecContext) {
+		By("Creating a bucket of an unknown class")
+		_, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "baz",
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(err).To(MatchError(ContainSubstring("bucket class not found: baz")))
+	})
+
+	It("Should create the bucket claim in the namespace named by the namespace label", func(ctx SpecContext) {
+		By("Creating a bucket with the namespace label")
+		createResp, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Labels: map[string]string{"tenant": "tenant-a"},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Ensuring the bucket namespace is created")
+		Eventually(Get(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"}})).Should(Succeed())
+
+		By("Ensuring the bucketClaim is created in the bucket namespace")
+		bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      createResp.Bucket.Metadata.Id,
+				Namespace: "tenant-a",
+			},
+		}
+		Eventually(Object(bucketClaim)).Should(HaveField("Spec.GenerateBucketName", createResp.Bucket.Metadata.Id))
+
+		By("Ensuring the bucket is listed by its id")
+		listResp, err := bucketClient.ListBuckets(ctx, &iriv1alpha1.ListBucketsRequest{
+			Filter: &iriv1alpha1.BucketFilter{Id: createResp.Bucket.Metadata.Id},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(listResp.Buckets).To(ConsistOf(HaveField("Metadata.Id", createResp.Bucket.Metadata.Id)))
+
+		By("Deleting the bucket")
+		_, err = bucketClient.DeleteBucket(ctx, &iriv1alpha1.DeleteBucketRequest{
+			BucketId: createResp.Bucket.Metadata.Id,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Ensuring the bucketClaim is gone")
+		Eventually(Get(bucketClaim)).Should(Satisfy(apierrors.IsNotFound))
+	})
+
+	Context("with colliding bucket claim names", func() {
+		newServer := func(ids ...string) *bucketserver.Server {
+			srv, err := bucketserver.New(cfg, nil, bucketserver.Options{
+				IDGen:                      &sequenceIDGen{ids: ids},
+				Namespace:                  rookNamespace.Name,
+				BucketPoolStorageClassName: "foo",
+				BucketClassStorageClasses:  map[string]string{"foo": "foo"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return srv
+		}
+
+		deleteBucketClaim := func(name string) {
+			DeferCleanup(func(ctx SpecContext) {
+				bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: rookNamespace.Name},
+				}
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, bucketClaim))).To(Succeed())
+			})
+		}
+
+		It("Should regenerate the name of a bucket claim taken by another bucket claim", func(ctx SpecContext) {
+			By("Creating a bucket claim taking the first generated name")
+			taken := &objectbucketv1alpha1.ObjectBucketClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "taken-claim", Namespace: rookNamespace.Name},
+				Spec: objectbucketv1alpha1.ObjectBucketClaimSpec{
+					StorageClassName:   "foo",
+					GenerateBucketName: "taken-claim",
+				},
+			}
+			Expect(k8sClient.Create(ctx, taken)).To(Succeed())
+			deleteBucketClaim(taken.Name)
+			deleteBucketClaim("fresh-claim")
+
+			By("Creating a bucket")
+			srv := newServer("taken-claim", "fresh-claim")
+			createResp, err := srv.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+				Bucket: &iriv1alpha1.Bucket{
+					Metadata: &irimetav1alpha1.ObjectMetadata{},
+					Spec:     &iriv1alpha1.BucketSpec{Class: "foo"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Ensuring the bucket got a newly generated name")
+			Expect(createResp.Bucket.Metadata.Id).To(Equal("fresh-claim"))
+			Expect(Object(taken)()).To(HaveField("ObjectMeta.Labels", BeEmpty()))
+		})
+
+		It("Should not return the bucket claim of an identical bucket", func(ctx SpecContext) {
+			deleteBucketClaim("same-claim")
+			srv := newServer("same-claim")
+			req := &iriv1alpha1.CreateBucketRequest{
+				Bucket: &iriv1alpha1.Bucket{
+					Metadata: &irimetav1alpha1.ObjectMetadata{
+						Labels: map[string]string{"foo": "bar"},
+					},
+					Spec: &iriv1alpha1.BucketSpec{Class: "foo"},
+				},
+			}
+
+			By("Creating the bucket")
+			createResp, err := srv.CreateBucket(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(createResp.Bucket.Metadata.Id).To(Equal("same-claim"))
+
+			By("Ensuring an identical bucket is rejected once the generated names are exhausted")
+			_, err = srv.CreateBucket(ctx, req)
+			Expect(err).To(MatchError(ContainSubstring("generated name collided 3 times")))
+		})
 	})
 })
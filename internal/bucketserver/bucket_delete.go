@@ -5,6 +5,7 @@ package bucketserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
@@ -17,7 +18,11 @@ func (s *Server) DeleteBucket(ctx context.Context, req *iriv1alpha1.DeleteBucket
 
 	bucketClaim, err := s.getBucketClaimForID(ctx, req.BucketId)
 	if err != nil {
-		return nil, utils.ConvertInternalErrorToGRPC(err)
+		if !errors.Is(err, utils.ErrBucketIsntManaged) {
+			return nil, utils.ConvertInternalErrorToGRPC(err)
+		}
+		log.V(1).Info("Bucket already deleted")
+		return &iriv1alpha1.DeleteBucketResponse{}, nil
 	}
 
 	log.V(1).Info("Deleting bucket")
@@ -25,7 +30,8 @@ func (s *Server) DeleteBucket(ctx context.Context, req *iriv1alpha1.DeleteBucket
 		if !apierrors.IsNotFound(err) {
 			return nil, fmt.Errorf("error deleting bucket claim: %w", err)
 		}
-		return nil, utils.ConvertInternalErrorToGRPC(fmt.Errorf("failed to delete bucket claim %s: %w", req.BucketId, utils.ErrBucketNotFound))
+		log.V(1).Info("Bucket already deleted")
+		return &iriv1alpha1.DeleteBucketResponse{}, nil
 	}
 
 	log.V(1).Info("Bucket deleted")
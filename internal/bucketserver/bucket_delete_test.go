@@ -126,4 +126,12 @@ var _ = Describe("DeleteBucket test", func() {
 		})
 		Eventually(Get(bucketClaim)).Should(Satisfy(apierrors.IsNotFound))
 	})
+
+	It("Should succeed deleting an already deleted bucket", func(ctx SpecContext) {
+		By("Deleting a bucket that does not exist")
+		_, err := bucketClient.DeleteBucket(ctx, &iriv1alpha1.DeleteBucketRequest{
+			BucketId: "does-not-exist",
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
 })
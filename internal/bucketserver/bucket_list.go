@@ -10,28 +10,29 @@ import (
 
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
-	"github.com/ironcore-dev/ironcore/broker/common"
+	"github.com/ironcore-dev/controller-utils/metautils"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
 	objectbucketv1alpha1 "github.com/kube-object-storage/lib-bucket-provisioner/pkg/apis/objectbucket.io/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (s *Server) listManagedAndCreated(ctx context.Context, list client.ObjectList) error {
-	return s.client.List(ctx, list,
-		client.InNamespace(s.namespace),
-		client.MatchingLabels{
-			api.ManagerLabel: api.BucketManager,
-		},
-	)
+func (s *Server) listManagedAndCreated(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	opts = append(opts, client.MatchingLabels{
+		api.ManagerLabel: api.BucketManager,
+	})
+	return s.client.List(ctx, list, append(s.namespaceListOptions(), opts...)...)
 }
 
-func (s *Server) clientGetSecretFunc(ctx context.Context) func(string) (*corev1.Secret, error) {
+func (s *Server) clientGetSecretFunc(ctx context.Context, namespace string) func(string) (*corev1.Secret, error) {
 	return func(name string) (*corev1.Secret, error) {
 		secret := &corev1.Secret{}
-		if err := s.client.Get(ctx, client.ObjectKey{Namespace: s.namespace, Name: name}, secret); err != nil {
+		if err := s.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
 			return nil, err
 		}
 		return secret, nil
@@ -55,37 +56,147 @@ func (s *Server) getAccessSecretForBucketClaim(
 ) (*corev1.Secret, error) {
 	accessSecret, err := s.getBucketAccessSecretIfRequired(bucketClaim, getSecret)
 	if err != nil {
-		return nil, fmt.Errorf("error getting bucket access secret: %w", err)
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("error getting bucket access secret: %w", err)
+		}
+		return nil, nil
 	}
 	return accessSecret, nil
 }
 
-func (s *Server) getAllManagedBuckets(ctx context.Context) ([]*iriv1alpha1.Bucket, error) {
+// propagateBucketMetadataToAccessSecret copies the IRI labels and annotations as well as the class and manager
+// labels of the bucket claim to its access secret. The access secret is created by the bucket provisioner, only the
+// propagated metadata is patched and all other fields are left to the provisioner. Reads of buckets don't propagate
+// metadata, it is propagated when the bucket is created and by SyncAccessSecrets.
+func (s *Server) propagateBucketMetadataToAccessSecret(
+	ctx context.Context,
+	bucketClaim *objectbucketv1alpha1.ObjectBucketClaim,
+	accessSecret *corev1.Secret,
+) error {
+	base := accessSecret.DeepCopy()
+	for _, key := range []string{api.LabelsAnnotation, api.AnnotationsAnnotation} {
+		if value, ok := bucketClaim.Annotations[key]; ok {
+			metautils.SetAnnotation(accessSecret, key, value)
+		}
+	}
+	for _, key := range []string{api.ClassLabel, api.ManagerLabel} {
+		if value, ok := bucketClaim.Labels[key]; ok {
+			metautils.SetLabel(accessSecret, key, value)
+		}
+	}
+	if equality.Semantic.DeepEqual(base.ObjectMeta, accessSecret.ObjectMeta) {
+		return nil
+	}
+
+	if err := s.client.Patch(ctx, accessSecret, client.MergeFrom(base)); err != nil {
+		return fmt.Errorf("error propagating bucket metadata to access secret: %w", err)
+	}
+	return nil
+}
+
+// listManagedAccessSecrets lists the managed secrets in the namespaces of the given bucket claims, keyed by
+// namespace and name, so that claims are only ever paired with a secret of their own namespace.
+func (s *Server) listManagedAccessSecrets(
+	ctx context.Context,
+	bucketClaims []objectbucketv1alpha1.ObjectBucketClaim,
+) (map[client.ObjectKey]*corev1.Secret, error) {
+	namespaces := sets.New[string]()
+	for _, bucketClaim := range bucketClaims {
+		namespaces.Insert(bucketClaim.Namespace)
+	}
+
+	res := make(map[client.ObjectKey]*corev1.Secret)
+	for _, namespace := range sets.List(namespaces) {
+		secretList := &corev1.SecretList{}
+		if err := s.client.List(ctx, secretList,
+			client.InNamespace(namespace),
+			client.MatchingLabels{api.ManagerLabel: api.BucketManager},
+		); err != nil {
+			return nil, fmt.Errorf("error listing secrets in namespace %s: %w", namespace, err)
+		}
+
+		for i := range secretList.Items {
+			secret := &secretList.Items[i]
+			res[client.ObjectKeyFromObject(secret)] = secret
+		}
+	}
+	return res, nil
+}
+
+// listedSecretFunc looks up secrets of the given namespace in the listed secrets. Secrets that are not listed, e.g.
+// because the provisioner created them without the manager label, are fetched from the namespace.
+func (s *Server) listedSecretFunc(
+	ctx context.Context,
+	namespace string,
+	secrets map[client.ObjectKey]*corev1.Secret,
+) func(string) (*corev1.Secret, error) {
+	getSecret := s.clientGetSecretFunc(ctx, namespace)
+	return func(name string) (*corev1.Secret, error) {
+		if secret, ok := secrets[client.ObjectKey{Namespace: namespace, Name: name}]; ok {
+			return secret, nil
+		}
+		return getSecret(name)
+	}
+}
+
+// SyncAccessSecrets propagates the bucket metadata to the access secrets of all managed buckets in the access secret
+// sync interval until the context is done. The bucket provisioner creates the access secret once the bucket claim is
+// bound, which is usually after the bucket was created.
+func (s *Server) SyncAccessSecrets(ctx context.Context) {
+	log := s.loggerFrom(ctx)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.syncAccessSecrets(ctx); err != nil {
+			log.Error(err, "Error syncing bucket access secrets")
+		}
+	}, s.accessSecretSyncInterval)
+}
+
+func (s *Server) syncAccessSecrets(ctx context.Context) error {
 	bucketClaimList := &objectbucketv1alpha1.ObjectBucketClaimList{}
 	if err := s.listManagedAndCreated(ctx, bucketClaimList); err != nil {
-		return nil, fmt.Errorf("error listing buckets: %w", err)
+		return fmt.Errorf("error listing buckets: %w", err)
 	}
 
-	secretList := &corev1.SecretList{}
-	if err := s.client.List(ctx, secretList,
-		client.InNamespace(s.namespace),
-	); err != nil {
-		return nil, fmt.Errorf("error listing secrets: %w", err)
+	accessSecrets, err := s.listManagedAccessSecrets(ctx, bucketClaimList.Items)
+	if err != nil {
+		return err
 	}
 
-	secretByNameGetter, err := common.NewObjectGetter[string, *corev1.Secret](
-		corev1.Resource("secrets"),
-		common.ByObjectName[*corev1.Secret](),
-		common.ObjectSlice[string](secretList.Items),
-	)
+	var errs []error
+	for i := range bucketClaimList.Items {
+		bucketClaim := &bucketClaimList.Items[i]
+		getSecret := s.listedSecretFunc(ctx, bucketClaim.Namespace, accessSecrets)
+		accessSecret, err := s.getAccessSecretForBucketClaim(bucketClaim, getSecret)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: %w", bucketClaim.Name, err))
+			continue
+		}
+		if accessSecret == nil {
+			continue
+		}
+		if err := s.propagateBucketMetadataToAccessSecret(ctx, bucketClaim, accessSecret); err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: %w", bucketClaim.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) getAllManagedBuckets(ctx context.Context) ([]*iriv1alpha1.Bucket, error) {
+	bucketClaimList := &objectbucketv1alpha1.ObjectBucketClaimList{}
+	if err := s.listManagedAndCreated(ctx, bucketClaimList); err != nil {
+		return nil, fmt.Errorf("error listing buckets: %w", err)
+	}
+
+	accessSecrets, err := s.listManagedAccessSecrets(ctx, bucketClaimList.Items)
 	if err != nil {
-		return nil, fmt.Errorf("error constructing secret getter: %w", err)
+		return nil, err
 	}
 
 	var res []*iriv1alpha1.Bucket
 	for i := range bucketClaimList.Items {
 		bucketClaim := &bucketClaimList.Items[i]
-		accessSecret, err := s.getAccessSecretForBucketClaim(bucketClaim, secretByNameGetter.Get)
+		getSecret := s.listedSecretFunc(ctx, bucketClaim.Namespace, accessSecrets)
+		accessSecret, err := s.getAccessSecretForBucketClaim(bucketClaim, getSecret)
 		if err != nil {
 			return nil, fmt.Errorf("error aggregating bucket %s: %w", bucketClaim.Name, err)
 		}
@@ -121,15 +232,12 @@ func (s *Server) filterBuckets(buckets []*iriv1alpha1.Bucket, filter *iriv1alpha
 }
 
 func (s *Server) getBucketForID(ctx context.Context, id string) (*iriv1alpha1.Bucket, error) {
-	bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{}
-	if err := s.getManagedAndCreated(ctx, id, bucketClaim); err != nil {
-		if !apierrors.IsNotFound(err) {
-			return nil, fmt.Errorf("error getting bucket %s: %w", id, err)
-		}
-		return nil, fmt.Errorf("failed to get bucket %s: %w", id, utils.ErrBucketIsntManaged)
+	bucketClaim, err := s.getBucketClaimForID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	accessSecret, err := s.getAccessSecretForBucketClaim(bucketClaim, s.clientGetSecretFunc(ctx))
+	accessSecret, err := s.getAccessSecretForBucketClaim(bucketClaim, s.clientGetSecretFunc(ctx, bucketClaim.Namespace))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get access secret for bucket: %w", err)
 	}
@@ -4,8 +4,10 @@
 package bucketserver_test
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/ironcore-dev/ceph-provider/api"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
 	irimetav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	objectbucketv1alpha1 "github.com/kube-object-storage/lib-bucket-provisioner/pkg/apis/objectbucket.io/v1alpha1"
@@ -144,4 +146,116 @@ var _ = Describe("ListBucket test", func() {
 			Expect(resp.Buckets).To(BeEmpty())
 		})
 	})
+
+	It("Should pair bucket claims only with the access secret of their namespace", func(ctx SpecContext) {
+		By("Creating a bucket in a tenant namespace")
+		createResp, err := bucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Labels: map[string]string{"tenant": "tenant-b", "list": "tenant-b"},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		bucketID := createResp.Bucket.Metadata.Id
+		DeferCleanup(bucketClient.DeleteBucket, &iriv1alpha1.DeleteBucketRequest{BucketId: bucketID})
+
+		By("Binding the bucketClaim and creating its access secret")
+		bindBucketClaim(ctx, "tenant-b", bucketID, map[string][]byte{"AccessKeyID": []byte("tenant-b")})
+
+		By("Creating a managed secret of the same name in another namespace")
+		otherSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      bucketID,
+				Namespace: rookNamespace.Name,
+				Labels:    map[string]string{api.ManagerLabel: api.BucketManager},
+			},
+			Data: map[string][]byte{"AccessKeyID": []byte("other")},
+		}
+		Expect(k8sClient.Create(ctx, otherSecret)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, otherSecret)
+
+		By("Listing the buckets")
+		Eventually(func(g Gomega) {
+			resp, err := bucketClient.ListBuckets(ctx, &iriv1alpha1.ListBucketsRequest{
+				Filter: &iriv1alpha1.BucketFilter{
+					LabelSelector: map[string]string{"list": "tenant-b"},
+				},
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(resp.Buckets).To(ConsistOf(SatisfyAll(
+				HaveField("Metadata.Id", bucketID),
+				HaveField("Status.Access.SecretData", HaveKeyWithValue("AccessKeyID", []byte("tenant-b"))),
+			)))
+		}).Should(Succeed())
+	})
+
+	It("Should list buckets of the target namespace without namespace label", func(ctx SpecContext) {
+		By("Creating a bucket")
+		createResp, err := targetNamespaceBucketClient.CreateBucket(ctx, &iriv1alpha1.CreateBucketRequest{
+			Bucket: &iriv1alpha1.Bucket{
+				Metadata: &irimetav1alpha1.ObjectMetadata{
+					Labels: map[string]string{"tenant": "tenant-c", "list": "target-namespace"},
+				},
+				Spec: &iriv1alpha1.BucketSpec{
+					Class: "foo",
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		bucketID := createResp.Bucket.Metadata.Id
+		DeferCleanup(targetNamespaceBucketClient.DeleteBucket, &iriv1alpha1.DeleteBucketRequest{BucketId: bucketID})
+
+		By("Binding the bucketClaim in the target namespace and creating its access secret")
+		bindBucketClaim(ctx, rookNamespace.Name, bucketID, map[string][]byte{"AccessKeyID": []byte("target")})
+
+		By("Listing the buckets")
+		Eventually(func(g Gomega) {
+			resp, err := targetNamespaceBucketClient.ListBuckets(ctx, &iriv1alpha1.ListBucketsRequest{
+				Filter: &iriv1alpha1.BucketFilter{
+					LabelSelector: map[string]string{"list": "target-namespace"},
+				},
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(resp.Buckets).To(ConsistOf(SatisfyAll(
+				HaveField("Metadata.Id", bucketID),
+				HaveField("Status.Access.SecretData", HaveKeyWithValue("AccessKeyID", []byte("target"))),
+			)))
+		}).Should(Succeed())
+	})
 })
+
+// bindBucketClaim binds the bucket claim of the given bucket like the bucket provisioner would and creates its access
+// secret with the given data.
+func bindBucketClaim(ctx context.Context, namespace, bucketID string, secretData map[string][]byte) {
+	GinkgoHelper()
+
+	bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bucketID,
+			Namespace: namespace,
+		},
+	}
+	Eventually(Get(bucketClaim)).Should(Succeed())
+
+	bucketClaimBase := bucketClaim.DeepCopy()
+	bucketClaim.Spec.BucketName = bucketID
+	Expect(k8sClient.Patch(ctx, bucketClaim, client.MergeFrom(bucketClaimBase))).To(Succeed())
+
+	bucketClaimBase = bucketClaim.DeepCopy()
+	bucketClaim.Status.Phase = objectbucketv1alpha1.ObjectBucketClaimStatusPhaseBound
+	Expect(k8sClient.Status().Patch(ctx, bucketClaim, client.MergeFrom(bucketClaimBase))).To(Succeed())
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bucketID,
+			Namespace: namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: secretData,
+	}
+	Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bucketserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/utils"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
+)
+
+// bucketClaimLifecycleConfig is the additional bucket claim config key rook uses for the bucket lifecycle.
+const bucketClaimLifecycleConfig = "bucketLifecycle"
+
+var corsMethods = []string{"GET", "PUT", "POST", "DELETE", "HEAD"}
+
+// corsRule is a CORS rule of a bucket in the format of the S3 PutBucketCors API.
+type corsRule struct {
+	ID             string   `json:"ID,omitempty"`
+	AllowedOrigins []string `json:"AllowedOrigins"`
+	AllowedMethods []string `json:"AllowedMethods"`
+	AllowedHeaders []string `json:"AllowedHeaders,omitempty"`
+	ExposeHeaders  []string `json:"ExposeHeaders,omitempty"`
+	MaxAgeSeconds  *int32   `json:"MaxAgeSeconds,omitempty"`
+}
+
+// lifecycleConfiguration is the lifecycle of a bucket in the format of the S3 PutBucketLifecycleConfiguration API.
+type lifecycleConfiguration struct {
+	Rules []lifecycleRule `json:"Rules"`
+}
+
+type lifecycleRule struct {
+	ID                             string                   `json:"ID,omitempty"`
+	Status                         string                   `json:"Status"`
+	Prefix                         *string                  `json:"Prefix,omitempty"`
+	Filter                         json.RawMessage          `json:"Filter,omitempty"`
+	Expiration                     *lifecycleExpiration     `json:"Expiration,omitempty"`
+	NoncurrentVersionExpiration    *lifecycleNoncurrentDays `json:"NoncurrentVersionExpiration,omitempty"`
+	AbortIncompleteMultipartUpload *lifecycleAbortMultipart `json:"AbortIncompleteMultipartUpload,omitempty"`
+}
+
+type lifecycleExpiration struct {
+	Days *int32  `json:"Days,omitempty"`
+	Date *string `json:"Date,omitempty"`
+}
+
+type lifecycleNoncurrentDays struct {
+	NoncurrentDays int32 `json:"NoncurrentDays"`
+}
+
+type lifecycleAbortMultipart struct {
+	DaysAfterInitiation int32 `json:"DaysAfterInitiation"`
+}
+
+// decodeStrict decodes the JSON document, rejecting unknown fields and trailing data.
+func decodeStrict(data string, v any) error {
+	decoder := json.NewDecoder(bytes.NewBufferString(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after JSON document")
+	}
+	return nil
+}
+
+// checkBucketCORS validates the CORS rules of the bucket, if set. The bucket claim has no config for CORS rules and
+// the provider has no S3 access to the buckets to apply them, so valid rules are rejected as unsupported.
+func checkBucketCORS(bucket *iriv1alpha1.Bucket) error {
+	data, ok := bucket.GetMetadata().GetAnnotations()[api.BucketCORSAnnotation]
+	if !ok {
+		return nil
+	}
+
+	if err := validateBucketCORS(data); err != nil {
+		return fmt.Errorf("%w: %w", utils.ErrInvalidBucketConfig, err)
+	}
+	return fmt.Errorf("%w: bucket cors rules cannot be applied", utils.ErrBucketConfigUnsupported)
+}
+
+func validateBucketCORS(data string) error {
+	var rules []corsRule
+	if err := decodeStrict(data, &rules); err != nil {
+		return fmt.Errorf("invalid bucket cors rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("invalid bucket cors rules: at least one rule is required")
+	}
+	for i, rule := range rules {
+		if len(rule.AllowedOrigins) == 0 {
+			return fmt.Errorf("invalid bucket cors rule %d: at least one allowed origin is required", i)
+		}
+		if len(rule.AllowedMethods) == 0 {
+			return fmt.Errorf("invalid bucket cors rule %d: at least one allowed method is required", i)
+		}
+		for _, method := range rule.AllowedMethods {
+			if !slices.Contains(corsMethods, method) {
+				return fmt.Errorf("invalid bucket cors rule %d: unsupported method %q", i, method)
+			}
+		}
+		if rule.MaxAgeSeconds != nil && *rule.MaxAgeSeconds < 0 {
+			return fmt.Errorf("invalid bucket cors rule %d: max age must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// getBucketLifecycle returns the validated lifecycle configuration of the bucket as compact JSON, if set.
+func getBucketLifecycle(bucket *iriv1alpha1.Bucket) (string, error) {
+	data, ok := bucket.GetMetadata().GetAnnotations()[api.BucketLifecycleAnnotation]
+	if !ok {
+		return "", nil
+	}
+
+	var lifecycle lifecycleConfiguration
+	if err := decodeStrict(data, &lifecycle); err != nil {
+		return "", fmt.Errorf("invalid bucket lifecycle: %w", err)
+	}
+	if len(lifecycle.Rules) == 0 {
+		return "", fmt.Errorf("invalid bucket lifecycle: at least one rule is required")
+	}
+	for i, rule := range lifecycle.Rules {
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return "", fmt.Errorf("invalid bucket lifecycle rule %d: status must be Enabled or Disabled, got %q", i, rule.Status)
+		}
+		if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+			return "", fmt.Errorf("invalid bucket lifecycle rule %d: an action is required", i)
+		}
+		if expiration := rule.Expiration; expiration != nil {
+			if (expiration.Days == nil) == (expiration.Date == nil) {
+				return "", fmt.Errorf("invalid bucket lifecycle rule %d: expiration requires either days or a date", i)
+			}
+			if expiration.Days != nil && *expiration.Days <= 0 {
+				return "", fmt.Errorf("invalid bucket lifecycle rule %d: expiration days must be positive", i)
+			}
+		}
+		if rule.NoncurrentVersionExpiration != nil && rule.NoncurrentVersionExpiration.NoncurrentDays <= 0 {
+			return "", fmt.Errorf("invalid bucket lifecycle rule %d: noncurrent days must be positive", i)
+		}
+		if rule.AbortIncompleteMultipartUpload != nil && rule.AbortIncompleteMultipartUpload.DaysAfterInitiation <= 0 {
+			return "", fmt.Errorf("invalid bucket lifecycle rule %d: days after initiation must be positive", i)
+		}
+	}
+
+	encoded, err := json.Marshal(lifecycle)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode bucket lifecycle: %w", err)
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bucketserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
+	objectbucketv1alpha1 "github.com/kube-object-storage/lib-bucket-provisioner/pkg/apis/objectbucket.io/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("convertBucketClaimAndAccessSecretToBucket", func() {
+	var (
+		s            *Server
+		accessSecret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		s = &Server{bucketEndpoint: "example.com"}
+		accessSecret = &corev1.Secret{
+			Data: map[string][]byte{
+				"AccessKeyID":     []byte("foo"),
+				"SecretAccessKey": []byte("bar"),
+			},
+		}
+	})
+
+	newBucketClaim := func(phase objectbucketv1alpha1.ObjectBucketClaimStatusPhase) *objectbucketv1alpha1.ObjectBucketClaim {
+		bucketClaim := &objectbucketv1alpha1.ObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+			Spec:       objectbucketv1alpha1.ObjectBucketClaimSpec{BucketName: "foo"},
+			Status:     objectbucketv1alpha1.ObjectBucketClaimStatus{Phase: phase},
+		}
+		api.SetClassLabel(bucketClaim, "standard")
+		Expect(api.SetLabelsAnnotation(bucketClaim, nil)).To(Succeed())
+		Expect(api.SetAnnotationsAnnotation(bucketClaim, nil)).To(Succeed())
+		return bucketClaim
+	}
+
+	DescribeTable("should map the bucket claim phase to the bucket state",
+		func(phase objectbucketv1alpha1.ObjectBucketClaimStatusPhase, withSecret bool, expectedState iriv1alpha1.BucketState, expectAccess bool) {
+			var secret *corev1.Secret
+			if withSecret {
+				secret = accessSecret
+			}
+
+			bucket, err := s.convertBucketClaimAndAccessSecretToBucket(newBucketClaim(phase), secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bucket.Status.State).To(Equal(expectedState))
+			if expectAccess {
+				Expect(bucket.Status.Access).To(SatisfyAll(
+					HaveField("Endpoint", "foo.example.com"),
+					HaveField("SecretData", accessSecret.Data),
+				))
+			} else {
+				Expect(bucket.Status.Access).To(BeNil())
+			}
+		},
+		Entry("no phase", objectbucketv1alpha1.ObjectBucketClaimStatusPhase(""), false, iriv1alpha1.BucketState_BUCKET_PENDING, false),
+		Entry("pending without secret", objectbucketv1alpha1.ObjectBucketClaimStatusPhase(objectbucketv1alpha1.ObjectBucketClaimStatusPhasePending), false, iriv1alpha1.BucketState_BUCKET_PENDING, false),
+		Entry("bound", objectbucketv1alpha1.ObjectBucketClaimStatusPhase(objectbucketv1alpha1.ObjectBucketClaimStatusPhaseBound), true, iriv1alpha1.BucketState_BUCKET_AVAILABLE, true),
+		Entry("bound without secret", objectbucketv1alpha1.ObjectBucketClaimStatusPhase(objectbucketv1alpha1.ObjectBucketClaimStatusPhaseBound), false, iriv1alpha1.BucketState_BUCKET_PENDING, false),
+		Entry("failed", objectbucketv1alpha1.ObjectBucketClaimStatusPhase(objectbucketv1alpha1.ObjectBucketClaimStatusPhaseFailed), false, iriv1alpha1.BucketState_BUCKET_ERROR, false),
+		Entry("released", objectbucketv1alpha1.ObjectBucketClaimStatusPhase(objectbucketv1alpha1.ObjectBucketClaimStatusPhaseReleased), false, iriv1alpha1.BucketState_BUCKET_PENDING, false),
+	)
+
+	It("should reject unknown phases", func() {
+		_, err := s.convertBucketClaimAndAccessSecretToBucket(newBucketClaim("Unknown"), nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("waitForBucketAccessSecret", func() {
+	var (
+		s           *Server
+		bucketClaim *objectbucketv1alpha1.ObjectBucketClaim
+	)
+
+	BeforeEach(func() {
+		bucketClaim = &objectbucketv1alpha1.ObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			Status:     objectbucketv1alpha1.ObjectBucketClaimStatus{Phase: objectbucketv1alpha1.ObjectBucketClaimStatusPhaseBound},
+		}
+		s = &Server{
+			client:                   fake.NewClientBuilder().WithScheme(scheme).WithObjects(bucketClaim.DeepCopy()).Build(),
+			accessSecretTimeout:      time.Second,
+			accessSecretPollInterval: 10 * time.Millisecond,
+		}
+	})
+
+	It("should return the access secret once it appears", func(ctx SpecContext) {
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(100 * time.Millisecond)
+			Expect(s.client.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+				Data:       map[string][]byte{"AccessKeyID": []byte("foo"), "SecretAccessKey": []byte("bar")},
+			})).To(Succeed())
+		}()
+
+		accessSecret, err := s.waitForBucketAccessSecret(ctx, bucketClaim)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(accessSecret.Data).To(HaveKeyWithValue("AccessKeyID", []byte("foo")))
+	})
+
+	It("should fail if the access secret is never populated", func(ctx SpecContext) {
+		Expect(s.client.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		})).To(Succeed())
+
+		_, err := s.waitForBucketAccessSecret(ctx, bucketClaim)
+		Expect(err).To(MatchError(ContainSubstring("was not populated within 1s")))
+	})
+
+	It("should stop waiting when the context is cancelled", func(ctx SpecContext) {
+		ctx2, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := s.waitForBucketAccessSecret(ctx2, bucketClaim)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
@@ -6,18 +6,23 @@ package bucketserver
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	"github.com/ironcore-dev/ironcore/broker/common/idgen"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/bucket/v1alpha1"
 	objectbucketv1alpha1 "github.com/kube-object-storage/lib-bucket-provisioner/pkg/apis/objectbucket.io/v1alpha1"
 	rookv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	kubernetes "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -47,10 +52,16 @@ type Server struct {
 	bucketClassess      BucketClassRegistry
 	bucketClassSelector client.MatchingLabels
 
-	namespace string
+	namespace           string
+	namespaceFromBucket func(bucket *iriv1alpha1.Bucket) string
 
 	bucketEndpoint             string
 	bucketPoolStorageClassName string
+	bucketClassStorageClasses  map[string]string
+
+	accessSecretTimeout      time.Duration
+	accessSecretPollInterval time.Duration
+	accessSecretSyncInterval time.Duration
 }
 
 func (s *Server) loggerFrom(ctx context.Context, keysWithValues ...interface{}) logr.Logger {
@@ -64,6 +75,39 @@ type Options struct {
 	BucketEndpoint             string
 	BucketPoolStorageClassName string
 	BucketClassSelector        map[string]string
+
+	// BucketClassStorageClasses maps bucket classes to the storage class their bucket claims are created with.
+	// Buckets of classes without a mapping use BucketPoolStorageClassName.
+	BucketClassStorageClasses map[string]string
+
+	// NamespaceFromBucket determines the namespace the bucket claim of a bucket is placed in.
+	// If unset, all bucket claims are placed in Namespace.
+	NamespaceFromBucket func(bucket *iriv1alpha1.Bucket) string
+
+	// AccessSecretTimeout is how long CreateBucket waits for the bucket access secret to be populated.
+	// If zero, CreateBucket returns the pending bucket without waiting.
+	AccessSecretTimeout time.Duration
+	// AccessSecretPollInterval is the interval the bucket access secret is polled in while waiting.
+	AccessSecretPollInterval time.Duration
+	// AccessSecretSyncInterval is the interval SyncAccessSecrets propagates the bucket metadata to the access
+	// secrets in. Defaults to DefaultAccessSecretSyncInterval.
+	AccessSecretSyncInterval time.Duration
+}
+
+const (
+	DefaultAccessSecretPollInterval = 1 * time.Second
+	DefaultAccessSecretSyncInterval = 1 * time.Minute
+)
+
+// NamespaceFromBucketLabel places bucket claims in the namespace named by the given bucket label,
+// falling back to the default namespace for buckets without the label.
+func NamespaceFromBucketLabel(label, defaultNamespace string) func(bucket *iriv1alpha1.Bucket) string {
+	return func(bucket *iriv1alpha1.Bucket) string {
+		if namespace := bucket.GetMetadata().GetLabels()[label]; namespace != "" {
+			return namespace
+		}
+		return defaultNamespace
+	}
 }
 
 func setOptionsDefaults(o *Options) {
@@ -74,6 +118,14 @@ func setOptionsDefaults(o *Options) {
 	if o.IDGen == nil {
 		o.IDGen = idgen.Default
 	}
+
+	if o.AccessSecretPollInterval == 0 {
+		o.AccessSecretPollInterval = DefaultAccessSecretPollInterval
+	}
+
+	if o.AccessSecretSyncInterval == 0 {
+		o.AccessSecretSyncInterval = DefaultAccessSecretSyncInterval
+	}
 }
 
 var _ iriv1alpha1.BucketRuntimeServer = (*Server)(nil)
@@ -82,9 +134,19 @@ var _ iriv1alpha1.BucketRuntimeServer = (*Server)(nil)
 //+kubebuilder:rbac:groups=objectbucket.io,resources=objectbucketclaims/status,verbs=get
 
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create
 
 func New(cfg *rest.Config, bucketClassRegistry BucketClassRegistry, opts Options) (*Server, error) {
+	for class, storageClassName := range opts.BucketClassStorageClasses {
+		if storageClassName == "" {
+			return nil, fmt.Errorf("must specify storage class name for bucket class %s", class)
+		}
+	}
+
+	if opts.AccessSecretSyncInterval < 0 {
+		return nil, fmt.Errorf("access secret sync interval must not be negative, got %s", opts.AccessSecretSyncInterval)
+	}
+
 	setOptionsDefaults(&opts)
 
 	c, err := client.New(cfg, client.Options{
@@ -100,11 +162,61 @@ func New(cfg *rest.Config, bucketClassRegistry BucketClassRegistry, opts Options
 		bucketClassess:             bucketClassRegistry,
 		bucketClassSelector:        opts.BucketClassSelector,
 		namespace:                  opts.Namespace,
+		namespaceFromBucket:        opts.NamespaceFromBucket,
 		bucketPoolStorageClassName: opts.BucketPoolStorageClassName,
+		bucketClassStorageClasses:  opts.BucketClassStorageClasses,
 		bucketEndpoint:             opts.BucketEndpoint,
+		accessSecretTimeout:        opts.AccessSecretTimeout,
+		accessSecretPollInterval:   opts.AccessSecretPollInterval,
+		accessSecretSyncInterval:   opts.AccessSecretSyncInterval,
 	}, nil
 }
 
+// bucketNamespace returns the namespace the bucket claim of the bucket is placed in.
+func (s *Server) bucketNamespace(bucket *iriv1alpha1.Bucket) string {
+	if s.namespaceFromBucket == nil {
+		return s.namespace
+	}
+	return s.namespaceFromBucket(bucket)
+}
+
+// bucketStorageClassName returns the storage class the bucket claim of a bucket of the given class is created with.
+// Classes that are neither mapped nor supported are rejected.
+func (s *Server) bucketStorageClassName(class string) (string, error) {
+	if class == "" {
+		return s.bucketPoolStorageClassName, nil
+	}
+	if storageClassName, ok := s.bucketClassStorageClasses[class]; ok {
+		return storageClassName, nil
+	}
+	if s.bucketClassess != nil {
+		if _, ok := s.bucketClassess.Get(class); ok {
+			return s.bucketPoolStorageClassName, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", utils.ErrBucketClassNotFound, class)
+}
+
+// namespaceListOptions restricts listing to the namespaces bucket claims may be placed in.
+func (s *Server) namespaceListOptions() []client.ListOption {
+	if s.namespaceFromBucket == nil {
+		return []client.ListOption{client.InNamespace(s.namespace)}
+	}
+	return nil
+}
+
+func (s *Server) ensureNamespace(ctx context.Context, namespace string) error {
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid bucket namespace %q: %s", namespace, strings.Join(errs, ", "))
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	if err := s.client.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("error creating namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
 func (s *Server) getManagedAndCreated(ctx context.Context, name string, obj client.Object) error {
 	key := client.ObjectKey{Namespace: s.namespace, Name: name}
 	if err := s.client.Get(ctx, key, obj); err != nil {
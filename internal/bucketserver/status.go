@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bucketserver
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// HealthCheck is the result of checking a single dependency of the bucket server.
+type HealthCheck struct {
+	Name    string
+	Healthy bool
+	Message string
+}
+
+// Health is the result of checking the dependencies of the bucket server.
+type Health struct {
+	Healthy bool
+	Checks  []HealthCheck
+}
+
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get
+
+// Status checks that the bucket pool storage class exists and the bucket namespace is accessible.
+func (s *Server) Status(ctx context.Context) Health {
+	checks := []HealthCheck{
+		s.checkObject(ctx, "StorageClass", client.ObjectKey{Name: s.bucketPoolStorageClassName}, &storagev1.StorageClass{}),
+		s.checkObject(ctx, "Namespace", client.ObjectKey{Name: s.namespace}, &corev1.Namespace{}),
+	}
+
+	health := Health{Healthy: true, Checks: checks}
+	for _, check := range checks {
+		health.Healthy = health.Healthy && check.Healthy
+	}
+	return health
+}
+
+func (s *Server) checkObject(ctx context.Context, name string, key client.ObjectKey, obj client.Object) HealthCheck {
+	if key.Name == "" {
+		return HealthCheck{Name: name, Message: fmt.Sprintf("no %s configured", name)}
+	}
+	if err := s.client.Get(ctx, key, obj); err != nil {
+		return HealthCheck{Name: name, Message: fmt.Sprintf("failed to get %s %s: %s", name, key.Name, err)}
+	}
+	return HealthCheck{Name: name, Healthy: true, Message: fmt.Sprintf("%s %s exists", name, key.Name)}
+}
+
+// HealthServer serves the status of the bucket server via the gRPC health checking protocol.
+type HealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+
+	server *Server
+}
+
+func NewHealthServer(server *Server) *HealthServer {
+	return &HealthServer{server: server}
+}
+
+var _ grpc_health_v1.HealthServer = (*HealthServer)(nil)
+
+// Check reports whether the bucket server can serve requests. The health of all services is the same.
+func (h *HealthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	health := h.server.Status(ctx)
+	if !health.Healthy {
+		log := h.server.loggerFrom(ctx)
+		for _, check := range health.Checks {
+			if !check.Healthy {
+				log.Info("Health check failed", "Check", check.Name, "Message", check.Message)
+			}
+		}
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// Watch is not supported, clients poll Check instead.
+func (h *HealthServer) Watch(*grpc_health_v1.HealthCheckRequest, grpc_health_v1.Health_WatchServer) error {
+	return status.Error(codes.Unimplemented, "watching the bucket server health is not supported")
+}
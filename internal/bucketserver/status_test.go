@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bucketserver_test
+
+import (
+	"github.com/ironcore-dev/ceph-provider/internal/bucketserver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Status", func() {
+	createStorageClass := func(ctx SpecContext, name string) {
+		storageClass := &storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: name},
+			Provisioner: "rook-ceph.ceph.rook.io/bucket",
+		}
+		Expect(k8sClient.Create(ctx, storageClass)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, storageClass)
+	}
+
+	It("Should report a healthy bucket server", func(ctx SpecContext) {
+		By("Creating the bucket pool storage class")
+		createStorageClass(ctx, "foo")
+
+		By("Checking the health of the bucket server")
+		resp, err := healthClient.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Status).To(Equal(grpc_health_v1.HealthCheckResponse_SERVING))
+	})
+
+	It("Should report a missing bucket pool storage class", func(ctx SpecContext) {
+		By("Checking the health of the bucket server without the storage class")
+		resp, err := healthClient.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Status).To(Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+
+		By("Ensuring the status names the failed check")
+		srv, err := bucketserver.New(cfg, nil, bucketserver.Options{
+			Namespace:                  rookNamespace.Name,
+			BucketPoolStorageClassName: "missing",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(srv.Status(ctx)).To(SatisfyAll(
+			HaveField("Healthy", BeFalse()),
+			HaveField("Checks", ConsistOf(
+				SatisfyAll(
+					HaveField("Name", "StorageClass"),
+					HaveField("Healthy", BeFalse()),
+					HaveField("Message", ContainSubstring("missing")),
+				),
+				SatisfyAll(
+					HaveField("Name", "Namespace"),
+					HaveField("Healthy", BeTrue()),
+				),
+			)),
+		))
+	})
+})
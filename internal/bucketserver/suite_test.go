@@ -23,6 +23,7 @@ import (
 	rookv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -47,10 +48,15 @@ const (
 
 var (
 	bucketClient  iriv1alpha1.BucketRuntimeClient
+	healthClient  grpc_health_v1.HealthClient
 	testEnv       *envtest.Environment
 	cfg           *rest.Config
 	k8sClient     client.Client
 	rookNamespace *corev1.Namespace
+
+	// targetNamespaceBucketClient talks to a bucket provider without namespace label, placing all bucket claims in
+	// the target namespace.
+	targetNamespaceBucketClient iriv1alpha1.BucketRuntimeClient
 )
 
 func TestAPIs(t *testing.T) {
@@ -163,11 +169,25 @@ var _ = BeforeSuite(func(ctx SpecContext) {
 		Address:                    fmt.Sprintf("%s/ceph-bucket-provider.sock", os.Getenv("PWD")),
 		Kubeconfig:                 kubeConfigFile.Name(),
 		Namespace:                  rookNamespace.Name,
+		NamespaceLabel:             "tenant",
 		BucketEndpoint:             bucketBaseURL,
 		BucketPoolStorageClassName: "foo",
+		BucketClassStorageClasses:  map[string]string{"bar": "bar-tier"},
 		PathSupportedBucketClasses: bucketClassesFile.Name(),
+		AccessSecretSyncInterval:   100 * time.Millisecond,
 	}
+	gconn := startApp(opts)
+	bucketClient = iriv1alpha1.NewBucketRuntimeClient(gconn)
+	healthClient = grpc_health_v1.NewHealthClient(gconn)
+
+	By("starting the app without namespace label")
+	opts.Address = fmt.Sprintf("%s/ceph-bucket-provider-target-namespace.sock", os.Getenv("PWD"))
+	opts.NamespaceLabel = ""
+	targetNamespaceBucketClient = iriv1alpha1.NewBucketRuntimeClient(startApp(opts))
+})
 
+// startApp runs the bucket provider with the given options and connects to it.
+func startApp(opts app.Options) *grpc.ClientConn {
 	serverCtx, cancel := context.WithCancel(context.Background())
 	DeferCleanup(cancel)
 
@@ -185,10 +205,9 @@ var _ = BeforeSuite(func(ctx SpecContext) {
 
 	gconn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	Expect(err).NotTo(HaveOccurred())
-
-	bucketClient = iriv1alpha1.NewBucketRuntimeClient(gconn)
 	DeferCleanup(gconn.Close)
-})
+	return gconn
+}
 
 func isSocketAvailable(socketPath string) (bool, error) {
 	fileInfo, err := os.Stat(socketPath)
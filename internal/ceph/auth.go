@@ -9,7 +9,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ceph/go-ceph/rados"
 )
@@ -20,7 +22,56 @@ type Credentials struct {
 	Keyfile  string
 }
 
-func ConnectToRados(ctx context.Context, c Credentials) (*rados.Conn, error) {
+// ConnOptions configures the timeouts of rados connections, so that operations on unresponsive monitors or osds
+// fail and are retried instead of blocking forever. Zero values keep the defaults of ceph.
+type ConnOptions struct {
+	// MountTimeout is the time connecting to the monitors may take, see client_mount_timeout.
+	MountTimeout time.Duration
+	// OSDOpTimeout is the time an osd operation may take before it fails with a timeout, see rados_osd_op_timeout.
+	OSDOpTimeout time.Duration
+}
+
+// Validate returns an error if a timeout is negative.
+func (o ConnOptions) Validate() error {
+	if o.MountTimeout < 0 {
+		return fmt.Errorf("client mount timeout must not be negative, got %s", o.MountTimeout)
+	}
+	if o.OSDOpTimeout < 0 {
+		return fmt.Errorf("osd op timeout must not be negative, got %s", o.OSDOpTimeout)
+	}
+	return nil
+}
+
+// configSetter sets rados config options of a connection.
+type configSetter interface {
+	SetConfigOption(option, value string) error
+}
+
+// apply sets the configured timeouts on the connection. It has to be called before connecting, as rados reads them
+// when connecting.
+func (o ConnOptions) apply(conn configSetter) error {
+	for _, opt := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"client_mount_timeout", o.MountTimeout},
+		{"rados_osd_op_timeout", o.OSDOpTimeout},
+	} {
+		if opt.timeout == 0 {
+			continue
+		}
+		if err := conn.SetConfigOption(opt.name, strconv.FormatFloat(opt.timeout.Seconds(), 'f', -1, 64)); err != nil {
+			return fmt.Errorf("setting %s failed: %w", opt.name, err)
+		}
+	}
+	return nil
+}
+
+func ConnectToRados(ctx context.Context, c Credentials, opts ConnOptions) (*rados.Conn, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
 	args := []string{"-m", c.Monitors, "--keyfile=" + c.Keyfile}
 	conn, err := rados.NewConnWithUser(c.User)
 	if err != nil {
@@ -30,6 +81,9 @@ func ConnectToRados(ctx context.Context, c Credentials) (*rados.Conn, error) {
 	if err != nil {
 		return nil, fmt.Errorf("parsing cmdline args (%v) failed: %w", args, err)
 	}
+	if err := opts.apply(conn); err != nil {
+		return nil, err
+	}
 
 	done := make(chan error, 1)
 	go func() {
@@ -3,7 +3,13 @@
 
 package ceph
 
-import "testing"
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+)
 
 func TestGetKeyFromKeyring(t *testing.T) {
 	key, err := GetKeyFromKeyring("./test.key")
@@ -15,3 +21,44 @@ func TestGetKeyFromKeyring(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestConnOptionsApply(t *testing.T) {
+	conn, err := rados.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Shutdown()
+
+	opts := ConnOptions{MountTimeout: 30 * time.Second, OSDOpTimeout: 1500 * time.Millisecond}
+	if err := opts.apply(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	for option, expected := range map[string]float64{
+		"client_mount_timeout": 30,
+		"rados_osd_op_timeout": 1.5,
+	} {
+		value, err := conn.GetConfigOption(option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual, err := strconv.ParseFloat(value, 64); err != nil || actual != expected {
+			t.Errorf("expected %s to be %v, got %q", option, expected, value)
+		}
+	}
+}
+
+func TestConnOptionsValidate(t *testing.T) {
+	for _, opts := range []ConnOptions{
+		{MountTimeout: -time.Second},
+		{OSDOpTimeout: -time.Second},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", opts)
+		}
+	}
+
+	if err := (ConnOptions{}).Validate(); err != nil {
+		t.Errorf("expected the ceph defaults to be valid, got %v", err)
+	}
+}
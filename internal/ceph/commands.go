@@ -6,8 +6,6 @@ package ceph
 import (
 	"encoding/json"
 	"fmt"
-
-	"github.com/ceph/go-ceph/rados"
 )
 
 type CommandRequest struct {
@@ -56,19 +54,24 @@ type PoolStats struct {
 	MaxAvail    int64   `json:"max_avail"`
 }
 
+// TotalBytes returns the capacity of the pool, i.e. the used and the still available bytes.
+func (s *PoolStats) TotalBytes() int64 {
+	return int64(s.BytesUsed) + s.MaxAvail
+}
+
 type Command interface {
 	PoolStats() (*PoolStats, error)
 }
 
-func NewCommandClient(conn *rados.Conn, poolName string) (*CommandClient, error) {
+func NewCommandClient(conns ConnAccessor, poolName string) (*CommandClient, error) {
 	return &CommandClient{
-		conn:     conn,
+		mon:      MonClient{Conns: conns},
 		poolName: poolName,
 	}, nil
 }
 
 type CommandClient struct {
-	conn     *rados.Conn
+	mon      MonClient
 	poolName string
 }
 
@@ -82,7 +85,7 @@ func (c *CommandClient) PoolStats() (*PoolStats, error) {
 		return nil, fmt.Errorf("failed to marshal df command request data: %w", err)
 	}
 
-	resp, _, err := c.conn.MonCommand(req)
+	resp, _, err := c.mon.MonCommand(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to do df request: %w", err)
 	}
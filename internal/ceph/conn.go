@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// ErrPoolNotFound is returned when opening an io context for a pool that does not exist.
+var ErrPoolNotFound = errors.New("pool not found")
+
+// ConnAccessor provides the current rados connection. Errors of operations on the connection are
+// reported back via ObserveError, so a lost connection can be re-established.
+type ConnAccessor interface {
+	// Acquire returns the current connection. The connection is not shut down before the returned release func is
+	// called, so anything opened on it has to be closed before.
+	Acquire() (*rados.Conn, func(), error)
+	ObserveError(err error)
+}
+
+// StaticConn returns a ConnAccessor always providing the given connection.
+func StaticConn(conn *rados.Conn) ConnAccessor {
+	return staticConn{conn: conn}
+}
+
+type staticConn struct {
+	conn *rados.Conn
+}
+
+func (c staticConn) Acquire() (*rados.Conn, func(), error) { return c.conn, func() {}, nil }
+
+func (c staticConn) ObserveError(error) {}
+
+// OpenIOContext opens an io context on the current connection of the accessor. The returned func destroys the io
+// context and releases the connection.
+func OpenIOContext(conns ConnAccessor, pool string) (*rados.IOContext, func(), error) {
+	conn, release, err := conns.Acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ioCtx, err := conn.OpenIOContext(pool)
+	if err != nil {
+		conns.ObserveError(err)
+		release()
+		return nil, nil, openIOContextError(pool, err)
+	}
+	return ioCtx, func() {
+		ioCtx.Destroy()
+		release()
+	}, nil
+}
+
+// OpenNamespacedIOContext opens an io context on the current connection of the accessor and sets its rbd namespace.
+// The default namespace is used if namespace is empty. The returned func destroys the io context and releases the
+// connection.
+func OpenNamespacedIOContext(conns ConnAccessor, pool, namespace string) (*rados.IOContext, func(), error) {
+	ioCtx, release, err := OpenIOContext(conns, pool)
+	if err != nil {
+		return nil, nil, err
+	}
+	if namespace != "" {
+		ioCtx.SetNamespace(namespace)
+	}
+	return ioCtx, release, nil
+}
+
+func openIOContextError(pool string, err error) error {
+	if errors.Is(err, rados.ErrNotFound) {
+		return fmt.Errorf("%w: %s: %w", ErrPoolNotFound, pool, err)
+	}
+	return err
+}
+
+// MonClient runs commands on the current connection of the accessor.
+type MonClient struct {
+	Conns ConnAccessor
+}
+
+func (c MonClient) MonCommand(args []byte) ([]byte, string, error) {
+	conn, release, err := c.Conns.Acquire()
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	data, info, err := conn.MonCommand(args)
+	c.Conns.ObserveError(err)
+	return data, info, err
+}
+
+func (c MonClient) GetPoolByName(name string) (int64, error) {
+	conn, release, err := c.Conns.Acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	id, err := conn.GetPoolByName(name)
+	c.Conns.ObserveError(err)
+	return id, err
+}
@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+func TestOpenIOContextErrorPoolNotFound(t *testing.T) {
+	err := openIOContextError("volumes", rados.ErrNotFound)
+	if !errors.Is(err, ErrPoolNotFound) || !errors.Is(err, rados.ErrNotFound) {
+		t.Errorf("expected pool not found error, got %v", err)
+	}
+
+	if err := openIOContextError("volumes", rados.ErrNotConnected); errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("expected connection error not to be a pool not found error, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// DefaultIOContextPoolSize is the default number of idle io contexts kept per pool.
+const DefaultIOContextPoolSize = 4
+
+type IOContextPoolOptions struct {
+	// Size is the number of idle io contexts kept per pool. Io contexts released while Size io contexts of their pool
+	// are idle are destroyed. Defaults to DefaultIOContextPoolSize.
+	Size int
+}
+
+// IOContextPool lends io contexts of the current connection, so that operations reuse them instead of opening and
+// destroying an io context each.
+//
+// Idle io contexts are tied to the connection they were opened on and keep it acquired. Once the accessor provides a
+// new connection, the io contexts of the previous one are destroyed and the previous connection is released.
+type IOContextPool struct {
+	conns ConnAccessor
+	size  int
+
+	open         func(conn *rados.Conn, pool string) (*rados.IOContext, error)
+	setNamespace func(ioCtx *rados.IOContext, namespace string)
+	destroy      func(ioCtx *rados.IOContext)
+
+	mu     sync.Mutex
+	conn   *rados.Conn
+	idle   map[string][]idleIOContext
+	closed bool
+}
+
+// idleIOContext is an io context of the pool with the release func of the connection it was opened on.
+type idleIOContext struct {
+	ioCtx       *rados.IOContext
+	releaseConn func()
+}
+
+func NewIOContextPool(conns ConnAccessor, opts IOContextPoolOptions) (*IOContextPool, error) {
+	if conns == nil {
+		return nil, fmt.Errorf("must specify conns")
+	}
+
+	if opts.Size < 0 {
+		return nil, fmt.Errorf("size must not be negative, got %d", opts.Size)
+	}
+
+	if opts.Size == 0 {
+		opts.Size = DefaultIOContextPoolSize
+	}
+
+	return &IOContextPool{
+		conns:        conns,
+		size:         opts.Size,
+		open:         (*rados.Conn).OpenIOContext,
+		setNamespace: (*rados.IOContext).SetNamespace,
+		destroy:      (*rados.IOContext).Destroy,
+		idle:         make(map[string][]idleIOContext),
+	}, nil
+}
+
+// Get borrows an io context of the pool with its rbd namespace set. It has to be handed back by calling the returned
+// release func and must not be used afterwards.
+func (p *IOContextPool) Get(pool, namespace string) (*rados.IOContext, func(), error) {
+	conn, releaseConn, err := p.conns.Acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ioCtx, ok := p.takeIdle(conn, pool)
+	if ok {
+		// The idle io context already holds the connection.
+		releaseConn()
+	} else {
+		opened, err := p.open(conn, pool)
+		if err != nil {
+			p.conns.ObserveError(err)
+			releaseConn()
+			return nil, nil, openIOContextError(pool, err)
+		}
+		ioCtx = idleIOContext{ioCtx: opened, releaseConn: releaseConn}
+	}
+
+	if namespace != "" {
+		p.setNamespace(ioCtx.ioCtx, namespace)
+	}
+
+	var once sync.Once
+	return ioCtx.ioCtx, func() { once.Do(func() { p.release(conn, pool, ioCtx) }) }, nil
+}
+
+// takeIdle returns an idle io context of the pool, if any. The io contexts of a previous connection are destroyed.
+func (p *IOContextPool) takeIdle(conn *rados.Conn, pool string) (idleIOContext, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != conn {
+		p.conn = conn
+		p.destroyIdle()
+		return idleIOContext{}, false
+	}
+
+	idle := p.idle[pool]
+	if len(idle) == 0 {
+		return idleIOContext{}, false
+	}
+	ioCtx := idle[len(idle)-1]
+	p.idle[pool] = idle[:len(idle)-1]
+	return ioCtx, true
+}
+
+func (p *IOContextPool) release(conn *rados.Conn, pool string, ioCtx idleIOContext) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Io contexts of a previous connection are destroyed without being used again, their connection may be gone.
+	if conn != p.conn || p.closed || len(p.idle[pool]) >= p.size {
+		p.destroy(ioCtx.ioCtx)
+		ioCtx.releaseConn()
+		return
+	}
+
+	// The namespace is reset, so that borrowers of the default namespace don't inherit the one of a previous borrower.
+	p.setNamespace(ioCtx.ioCtx, "")
+	p.idle[pool] = append(p.idle[pool], ioCtx)
+}
+
+// Close destroys the idle io contexts. Io contexts released afterwards are destroyed right away.
+func (p *IOContextPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.destroyIdle()
+}
+
+// destroyIdle destroys the idle io contexts and releases their connection. p.mu has to be held.
+func (p *IOContextPool) destroyIdle() {
+	for _, idle := range p.idle {
+		for _, ioCtx := range idle {
+			p.destroy(ioCtx.ioCtx)
+			ioCtx.releaseConn()
+		}
+	}
+	p.idle = make(map[string][]idleIOContext)
+}
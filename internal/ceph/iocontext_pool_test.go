@@ -0,0 +1,307 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// switchableConn is a ConnAccessor whose connection can be replaced, like after a reconnect. It counts the
+// unreleased acquisitions of every connection.
+type switchableConn struct {
+	mu       sync.Mutex
+	conn     *rados.Conn
+	acquired map[*rados.Conn]int
+}
+
+func (c *switchableConn) Acquire() (*rados.Conn, func(), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn := c.conn
+	if c.acquired == nil {
+		c.acquired = make(map[*rados.Conn]int)
+	}
+	c.acquired[conn]++
+	return conn, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.acquired[conn]--
+	}, nil
+}
+
+func (c *switchableConn) ObserveError(error) {}
+
+func (c *switchableConn) set(conn *rados.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = conn
+}
+
+func (c *switchableConn) acquisitions(conn *rados.Conn) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.acquired[conn]
+}
+
+// fakeIOContexts replaces the rados calls of an IOContextPool, recording the namespace of every io context.
+type fakeIOContexts struct {
+	mu         sync.Mutex
+	opened     int
+	destroyed  int
+	namespaces map[*rados.IOContext]string
+	// namespaceSets counts the namespace changes of every io context.
+	namespaceSets map[*rados.IOContext]int
+	borrowed      map[*rados.IOContext]bool
+}
+
+func newFakeIOContextPool(t *testing.T, conns ConnAccessor, size int) (*IOContextPool, *fakeIOContexts) {
+	t.Helper()
+	p, err := NewIOContextPool(conns, IOContextPoolOptions{Size: size})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeIOContexts{
+		namespaces:    make(map[*rados.IOContext]string),
+		namespaceSets: make(map[*rados.IOContext]int),
+		borrowed:      make(map[*rados.IOContext]bool),
+	}
+	p.open = func(*rados.Conn, string) (*rados.IOContext, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.opened++
+		ioCtx := new(rados.IOContext)
+		f.namespaces[ioCtx] = ""
+		return ioCtx, nil
+	}
+	p.setNamespace = func(ioCtx *rados.IOContext, namespace string) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.namespaces[ioCtx] = namespace
+		f.namespaceSets[ioCtx]++
+	}
+	p.destroy = func(*rados.IOContext) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.destroyed++
+	}
+	return p, f
+}
+
+// borrow marks the io context as borrowed and returns an error if it already is or has an unexpected namespace.
+func (f *fakeIOContexts) borrow(ioCtx *rados.IOContext, namespace string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.borrowed[ioCtx] {
+		return fmt.Errorf("io context %p was lent twice", ioCtx)
+	}
+	if actual := f.namespaces[ioCtx]; actual != namespace {
+		return fmt.Errorf("expected namespace %q, got %q", namespace, actual)
+	}
+	f.borrowed[ioCtx] = true
+	return nil
+}
+
+func (f *fakeIOContexts) giveBack(ioCtx *rados.IOContext) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.borrowed, ioCtx)
+}
+
+func TestIOContextPoolConcurrentBorrowers(t *testing.T) {
+	const (
+		borrowers = 16
+		size      = 4
+	)
+	p, f := newFakeIOContextPool(t, StaticConn(&rados.Conn{}), size)
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, borrowers)
+	)
+	for i := range borrowers {
+		namespace := ""
+		if i%2 == 0 {
+			namespace = "tenant"
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				ioCtx, release, err := p.Get("volumes", namespace)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := f.borrow(ioCtx, namespace); err != nil {
+					errs <- err
+					return
+				}
+				f.giveBack(ioCtx)
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if f.opened > borrowers {
+		t.Errorf("expected at most %d io contexts to be opened, got %d", borrowers, f.opened)
+	}
+	if idle := len(p.idle["volumes"]); idle > size {
+		t.Errorf("expected at most %d idle io contexts, got %d", size, idle)
+	}
+	if f.opened-f.destroyed != len(p.idle["volumes"]) {
+		t.Errorf("expected all io contexts but the idle ones to be destroyed, opened %d, destroyed %d", f.opened, f.destroyed)
+	}
+}
+
+func TestIOContextPoolReuse(t *testing.T) {
+	p, f := newFakeIOContextPool(t, StaticConn(&rados.Conn{}), 1)
+
+	ioCtx, release, err := p.Get("volumes", "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release()
+
+	reused, releaseReused, err := p.Get("volumes", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseReused()
+	if reused != ioCtx {
+		t.Errorf("expected the released io context to be reused")
+	}
+	if namespace := f.namespaces[reused]; namespace != "" {
+		t.Errorf("expected the namespace to be reset on release, got %q", namespace)
+	}
+
+	other, releaseOther, err := p.Get("images", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseOther()
+	if other == ioCtx {
+		t.Errorf("expected io contexts not to be shared across pools")
+	}
+}
+
+func TestIOContextPoolConnectionChange(t *testing.T) {
+	stale := &rados.Conn{}
+	conns := &switchableConn{conn: stale}
+	p, f := newFakeIOContextPool(t, conns, 2)
+
+	ioCtx, release, err := p.Get("volumes", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	borrowed, releaseBorrowed, err := p.Get("volumes", "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if n := conns.acquisitions(stale); n != 2 {
+		t.Errorf("expected the idle and the borrowed io context to hold the connection, got %d acquisitions", n)
+	}
+
+	current := &rados.Conn{}
+	conns.set(current)
+	reopened, releaseReopened, err := p.Get("volumes", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened == ioCtx || reopened == borrowed {
+		t.Errorf("expected the io contexts of the previous connection not to be reused")
+	}
+	if f.destroyed != 1 {
+		t.Errorf("expected the idle io context of the previous connection to be destroyed, got %d", f.destroyed)
+	}
+	if n := conns.acquisitions(stale); n != 1 {
+		t.Errorf("expected only the borrowed io context to hold the previous connection, got %d acquisitions", n)
+	}
+
+	releaseBorrowed()
+	if n := f.namespaceSets[borrowed]; n != 1 {
+		t.Errorf("expected the io context of the previous connection not to be touched on release, got %d namespace changes", n)
+	}
+	releaseReopened()
+	if idle := p.idle["volumes"]; len(idle) != 1 || idle[0].ioCtx != reopened {
+		t.Errorf("expected only the io context of the current connection to be idle, got %v", idle)
+	}
+	if f.destroyed != 2 {
+		t.Errorf("expected the io contexts of the previous connection to be destroyed, got %d", f.destroyed)
+	}
+	if n := conns.acquisitions(stale); n != 0 {
+		t.Errorf("expected the previous connection to be released, got %d acquisitions", n)
+	}
+
+	p.Close()
+	if f.destroyed != 3 {
+		t.Errorf("expected the idle io context to be destroyed on close, got %d", f.destroyed)
+	}
+	if n := conns.acquisitions(current); n != 0 {
+		t.Errorf("expected the connection to be released on close, got %d acquisitions", n)
+	}
+}
+
+// BenchmarkIOContextPool compares opening an io context per operation against borrowing it from a pool. It requires
+// a ceph cluster configured via CEPH_MONITORS, CEPH_USER, CEPH_KEYFILE and CEPH_POOL.
+func BenchmarkIOContextPool(b *testing.B) {
+	monitors, user, keyfile, pool := os.Getenv("CEPH_MONITORS"), os.Getenv("CEPH_USER"), os.Getenv("CEPH_KEYFILE"), os.Getenv("CEPH_POOL")
+	if monitors == "" || user == "" || keyfile == "" || pool == "" {
+		b.Skip("CEPH_MONITORS, CEPH_USER, CEPH_KEYFILE and CEPH_POOL have to be set")
+	}
+
+	conn, err := ConnectToRados(context.Background(), Credentials{Monitors: monitors, User: user, Keyfile: keyfile}, ConnOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Shutdown()
+	conns := StaticConn(conn)
+
+	b.Run("OpenPerOperation", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, release, err := OpenNamespacedIOContext(conns, pool, "")
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				release()
+			}
+		})
+	})
+
+	b.Run("Pooled", func(b *testing.B) {
+		p, err := NewIOContextPool(conns, IOContextPoolOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer p.Close()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, release, err := p.Get(pool, "")
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				release()
+			}
+		})
+	})
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// ValidateNamespace checks that namespace can be used as rbd namespace. The empty namespace is the default one.
+func ValidateNamespace(namespace string) error {
+	if strings.ContainsAny(namespace, "/@") {
+		return fmt.Errorf("rbd namespace %q must not contain '/' or '@'", namespace)
+	}
+	return nil
+}
+
+// MaxImageNameLength is the maximum length of an rbd image name.
+const MaxImageNameLength = 96
+
+// ValidateImageName checks that name can be used as rbd image name.
+func ValidateImageName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("rbd image name must not be empty")
+	case len(name) > MaxImageNameLength:
+		return fmt.Errorf("rbd image name %q must not be longer than %d characters", name, MaxImageNameLength)
+	case strings.ContainsAny(name, "/@"):
+		return fmt.Errorf("rbd image name %q must not contain '/' or '@'", name)
+	case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return fmt.Errorf("rbd image name %q must not contain whitespace", name)
+	}
+	return nil
+}
+
+// EnsureNamespace creates the rbd namespace in the pool if it does not exist yet.
+func EnsureNamespace(conns ConnAccessor, pool, namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+
+	ioCtx, release, err := OpenIOContext(conns, pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	exists, err := librbd.NamespaceExists(ioCtx, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to check rbd namespace %s: %w", namespace, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := librbd.NamespaceCreate(ioCtx, namespace); err != nil {
+		return fmt.Errorf("failed to create rbd namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// ImageSpec returns the rbd image spec of the image, i.e. pool/image or pool/namespace/image.
+func ImageSpec(pool, namespace, image string) string {
+	if namespace == "" {
+		return pool + "/" + image
+	}
+	return pool + "/" + namespace + "/" + image
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImageSpec(t *testing.T) {
+	if spec := ImageSpec("pool", "", "img_foo"); spec != "pool/img_foo" {
+		t.Errorf("unexpected image spec in default namespace: %s", spec)
+	}
+
+	if spec := ImageSpec("pool", "tenant", "img_foo"); spec != "pool/tenant/img_foo" {
+		t.Errorf("unexpected namespaced image spec: %s", spec)
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	for _, namespace := range []string{"", "tenant", "tenant-a_1"} {
+		if err := ValidateNamespace(namespace); err != nil {
+			t.Errorf("expected namespace %q to be valid: %v", namespace, err)
+		}
+	}
+
+	for _, namespace := range []string{"tenant/a", "tenant@snap"} {
+		if err := ValidateNamespace(namespace); err == nil {
+			t.Errorf("expected namespace %q to be invalid", namespace)
+		}
+	}
+}
+
+func TestValidateImageName(t *testing.T) {
+	for _, name := range []string{"vm-disk-1", "external.image_01", strings.Repeat("a", MaxImageNameLength)} {
+		if err := ValidateImageName(name); err != nil {
+			t.Errorf("expected image name %q to be valid: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "pool/image", "image@snap", "my image", strings.Repeat("a", MaxImageNameLength+1)} {
+		if err := ValidateImageName(name); err == nil {
+			t.Errorf("expected image name %q to be invalid", name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"sync"
+	"time"
+)
+
+type cephCredentials struct {
+	user string
+	key  string
+}
+
+type authCacheEntry struct {
+	credentials cephCredentials
+	expiresAt   time.Time
+}
+
+// authCache caches ceph client credentials per client name for a fixed duration.
+type authCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]authCacheEntry
+}
+
+func newAuthCache(ttl time.Duration) *authCache {
+	return &authCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]authCacheEntry),
+	}
+}
+
+func (c *authCache) get(client string) (cephCredentials, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[client]
+	if !ok {
+		return cephCredentials{}, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, client)
+		return cephCredentials{}, false
+	}
+	return entry.credentials, true
+}
+
+func (c *authCache) set(client string, credentials cephCredentials) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[client] = authCacheEntry{
+		credentials: credentials,
+		expiresAt:   c.now().Add(c.ttl),
+	}
+}
+
+func (c *authCache) remove(client string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, client)
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+)
+
+// ReconcileImages reconciles the given images one after another on a single io context, e.g. to provision many
+// images at once without opening an io context per image. Images failing to reconcile are handed over to the
+// queue to be retried like any other image and do not stop the batch. The returned error joins their errors.
+func (r *ImageReconciler) ReconcileImages(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var ioCtx *rados.IOContext
+	if !r.dryRun {
+		var (
+			release func()
+			err     error
+		)
+		ioCtx, release, err = r.openIOContext(r.pool)
+		if err != nil {
+			return fmt.Errorf("unable to get io context: %w", err)
+		}
+		defer release()
+	}
+
+	return r.reconcileImages(ctx, ioCtx, ids)
+}
+
+func (r *ImageReconciler) reconcileImages(ctx context.Context, ioCtx *rados.IOContext, ids []string) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	var errs []error
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			// The remaining images are reconciled by the queue instead.
+			for _, id := range ids[i:] {
+				r.queue.Add(id)
+			}
+			return errors.Join(append(errs, err)...)
+		}
+
+		if err := r.reconcileBatchImage(ctx, log.WithValues("imageId", id), ioCtx, id); err != nil {
+			errs = append(errs, fmt.Errorf("failed to reconcile image %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *ImageReconciler) reconcileBatchImage(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, id string) error {
+	if r.maintenance.deferIfPaused(log, id) {
+		return nil
+	}
+
+	r.imageMu.Lock(id)
+	defer r.imageMu.Unlock(id)
+
+	release, err := r.acquirePoolSlot(ctx, id)
+	if err != nil {
+		if errors.Is(err, errPoolSlotsBusy) {
+			// The image is reconciled by the queue once a slot is free.
+			r.queue.AddAfter(id, poolSlotRequeueDelay)
+			return nil
+		}
+		r.handleReconcileError(ctx, log, id, err)
+		return err
+	}
+	defer release()
+
+	if err := r.reconcileWithIOContext(logr.NewContext(ctx, log), ioCtx, id); err != nil {
+		r.conns.ObserveError(err)
+		r.handleReconcileError(ctx, log, id, err)
+		return err
+	}
+	return nil
+}
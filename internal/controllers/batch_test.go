@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	eventrecorder "github.com/ironcore-dev/provider-utils/eventutils/recorder"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("reconcileImages", func() {
+	var (
+		r          *ImageReconciler
+		reconciled []string
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+
+		reconciled = nil
+		r.reconcileWithIOContext = func(ctx context.Context, ioCtx *rados.IOContext, id string) error {
+			reconciled = append(reconciled, id)
+			if id == "bar" {
+				return errors.New("failed to create rbd image")
+			}
+			return nil
+		}
+	})
+
+	It("should continue the batch after a failed image and retry it via the queue", func(ctx SpecContext) {
+		err := r.reconcileImages(ctx, nil, []string{"foo", "bar", "baz"})
+		Expect(err).To(MatchError(ContainSubstring("failed to reconcile image bar")))
+		Expect(err).NotTo(MatchError(ContainSubstring("foo")))
+
+		Expect(reconciled).To(Equal([]string{"foo", "bar", "baz"}))
+		Expect(r.queue.NumRequeues("bar")).To(Equal(1))
+		Eventually(r.queue.Len).Should(Equal(1))
+	})
+
+	It("should hand the remaining images over to the queue when cancelled", func(ctx SpecContext) {
+		cancelCtx, cancel := context.WithCancel(ctx)
+		r.reconcileWithIOContext = func(ctx context.Context, ioCtx *rados.IOContext, id string) error {
+			reconciled = append(reconciled, id)
+			cancel()
+			return nil
+		}
+
+		Expect(r.reconcileImages(cancelCtx, nil, []string{"foo", "bar", "baz"})).To(MatchError(context.Canceled))
+		Expect(reconciled).To(Equal([]string{"foo"}))
+		Expect(r.queue.Len()).To(Equal(2))
+	})
+
+	It("should serialize reconciles of the same image with the workers", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Every reconcile increments the image size of a copy it read, so concurrent reconciles of the image would
+		// fail to update it.
+		var reconciles atomic.Int64
+		increment := func(ctx context.Context, id string) error {
+			reconciles.Add(1)
+			img, err := r.images.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			updated := *img
+			time.Sleep(time.Millisecond)
+			updated.Status.Size++
+			_, err = r.images.Update(ctx, &updated)
+			return err
+		}
+		r.reconcile = increment
+		r.reconcileWithIOContext = func(ctx context.Context, ioCtx *rados.IOContext, id string) error {
+			return increment(ctx, id)
+		}
+
+		const workers, batches = 4, 20
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for r.processNextWorkItem(ctx, ctx, logr.Discard()) {
+				}
+			}()
+		}
+
+		var batchWg sync.WaitGroup
+		for range batches {
+			batchWg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer batchWg.Done()
+				r.queue.Add("foo")
+				Expect(r.reconcileImages(ctx, nil, []string{"foo"})).To(Succeed())
+			}()
+		}
+		batchWg.Wait()
+		r.queue.ShutDownWithDrain()
+		wg.Wait()
+
+		Expect(reconciles.Load()).To(BeNumerically(">", batches))
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.Size", BeEquivalentTo(reconciles.Load())))
+	})
+})
+
+// BenchmarkImageCreation compares creating images with an io context per image against a single io context
+// for the whole batch. It requires a ceph cluster configured via CEPH_MONITORS, CEPH_USER, CEPH_KEYFILE and CEPH_POOL.
+func BenchmarkImageCreation(b *testing.B) {
+	monitors, user, keyfile, pool := os.Getenv("CEPH_MONITORS"), os.Getenv("CEPH_USER"), os.Getenv("CEPH_KEYFILE"), os.Getenv("CEPH_POOL")
+	if monitors == "" || user == "" || keyfile == "" || pool == "" {
+		b.Skip("CEPH_MONITORS, CEPH_USER, CEPH_KEYFILE and CEPH_POOL have to be set")
+	}
+
+	conn, err := ceph.ConnectToRados(context.Background(), ceph.Credentials{Monitors: monitors, User: user, Keyfile: keyfile}, ceph.ConnOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Shutdown()
+
+	const batchSize = 20
+	for _, bm := range []struct {
+		name      string
+		reconcile func(ctx context.Context, r *ImageReconciler, ids []string) error
+	}{
+		{"PerImage", func(ctx context.Context, r *ImageReconciler, ids []string) error {
+			for _, id := range ids {
+				if err := r.reconcileImage(ctx, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"Batch", func(ctx context.Context, r *ImageReconciler, ids []string) error {
+			return r.ReconcileImages(ctx, ids)
+		}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for n := range b.N {
+				b.StopTimer()
+				r, ids := newBenchmarkImageReconciler(b, conn, monitors, user, pool, fmt.Sprintf("bench-%s-%d", bm.name, n), batchSize)
+				b.StartTimer()
+
+				if err := bm.reconcile(context.Background(), r, ids); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				removeBenchmarkImages(b, conn, pool, ids)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func newBenchmarkImageReconciler(b *testing.B, conn *rados.Conn, monitors, user, pool, prefix string, count int) (*ImageReconciler, []string) {
+	images := newMemoryStore[*providerapi.Image]()
+	snapshots := newMemoryStore[*providerapi.Snapshot]()
+	imageEvents, err := event.NewListWatchSource[*providerapi.Image](images.List, images.Watch, event.ListWatchSourceOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	snapshotEvents, err := event.NewListWatchSource[*providerapi.Snapshot](snapshots.List, snapshots.Watch, event.ListWatchSourceOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	r, err := NewImageReconciler(
+		logr.Discard(),
+		ceph.StaticConn(conn),
+		images,
+		snapshots,
+		eventrecorder.NewEventStore(logr.Discard(), eventrecorder.EventStoreOptions{}),
+		imageEvents,
+		snapshotEvents,
+		noopEncryptor{},
+		ImageReconcilerOptions{Monitors: monitors, Client: "client." + user, Pool: pool},
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ids := make([]string, 0, count)
+	for i := range count {
+		id := fmt.Sprintf("%s-%d", prefix, i)
+		if _, err := images.Create(context.Background(), &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: id, Finalizers: []string{ImageFinalizer}},
+			Spec:     providerapi.ImageSpec{Size: 1024 * 1024},
+		}); err != nil {
+			b.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return r, ids
+}
+
+func removeBenchmarkImages(b *testing.B, conn *rados.Conn, pool string, ids []string) {
+	ioCtx, err := conn.OpenIOContext(pool)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ioCtx.Destroy()
+
+	for _, id := range ids {
+		if err := librbd.RemoveImage(ioCtx, ImageIDToRBDID(id)); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+			b.Fatal(err)
+		}
+	}
+}
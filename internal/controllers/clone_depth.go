@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// CloneDepthKey is the image metadata key recording the number of clones between an image and its base image.
+const CloneDepthKey = "ironcore.clone-depth"
+
+// shouldFlatten reports whether a cloned image of the given clone depth has to be flattened.
+// The per-image override takes precedence over the threshold, a threshold of 0 disables flattening.
+func shouldFlatten(depth, threshold int, override *bool) bool {
+	if override != nil {
+		return *override
+	}
+	return threshold > 0 && depth >= threshold
+}
+
+func getCloneDepth(img *librbd.Image) (int, error) {
+	value, err := img.GetMetadata(CloneDepthKey)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get clone depth: %w", err)
+	}
+
+	depth, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clone depth %q: %w", value, err)
+	}
+	return depth, nil
+}
+
+func getParentCloneDepth(ioCtx *rados.IOContext, parentName string) (int, error) {
+	parent, err := librbd.OpenImageReadOnly(ioCtx, parentName, librbd.NoSnapshot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open parent image %s: %w", parentName, err)
+	}
+	defer func() { _ = parent.Close() }()
+
+	return getCloneDepth(parent)
+}
+
+// flattenCloneIfRequired records the clone depth of a freshly cloned image and flattens it once
+// the clone depth reaches the flatten threshold, decoupling it from its parent snapshot.
+func (r *ImageReconciler) flattenCloneIfRequired(log logr.Logger, ioCtx *rados.IOContext, img *librbd.Image, parentName string, image *providerapi.Image) error {
+	parentDepth, err := getParentCloneDepth(ioCtx, parentName)
+	if err != nil {
+		return err
+	}
+
+	depth := parentDepth + 1
+	if shouldFlatten(depth, r.flattenThreshold, image.Spec.Flatten) {
+		log.V(1).Info("Flattening cloned image", "CloneDepth", depth, "FlattenThreshold", r.flattenThreshold)
+		if err := img.Flatten(); err != nil {
+			return fmt.Errorf("failed to flatten cloned image: %w", err)
+		}
+		depth = 0
+	}
+
+	if err := img.SetMetadata(CloneDepthKey, strconv.Itoa(depth)); err != nil {
+		return fmt.Errorf("failed to set clone depth: %w", err)
+	}
+	log.V(2).Info("Set clone depth", "CloneDepth", depth)
+	return nil
+}
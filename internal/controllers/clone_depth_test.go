@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("shouldFlatten", func() {
+	DescribeTable("should decide on flattening a cloned image",
+		func(depth, threshold int, override *bool, expected bool) {
+			Expect(shouldFlatten(depth, threshold, override)).To(Equal(expected))
+		},
+		Entry("below the threshold", 1, 2, nil, false),
+		Entry("at the threshold", 2, 2, nil, true),
+		Entry("above the threshold", 3, 2, nil, true),
+		Entry("disabled threshold", 10, 0, nil, false),
+		Entry("forced below the threshold", 1, 2, ptr.To(true), true),
+		Entry("forced with disabled threshold", 1, 0, ptr.To(true), true),
+		Entry("prevented at the threshold", 2, 2, ptr.To(false), false),
+	)
+
+	It("should reject a negative flatten threshold", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{FlattenThreshold: -1})
+		Expect(err).To(MatchError(ContainSubstring("flatten threshold")))
+	})
+})
@@ -4,6 +4,7 @@
 package controllers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -11,8 +12,12 @@ import (
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/go-logr/logr"
 	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/paging"
 	"github.com/ironcore-dev/ironcore-image/oci/image"
 	"github.com/ironcore-dev/ironcore-image/oci/remote"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"k8s.io/utils/ptr"
 )
@@ -32,11 +37,56 @@ func SnapshotIDToRBDID(snapshotID string) string {
 	return SnapshotRBDIDPrefix + snapshotID
 }
 
+// ErrInvalidRBDName is returned if the custom rbd image name of an image cannot be used.
+var ErrInvalidRBDName = errors.New("invalid rbd image name")
+
+// ErrInvalidImageSpec is returned if the spec of an image is invalid, see providerapi.ValidateImage.
+var ErrInvalidImageSpec = errors.New("invalid image spec")
+
+// validateImageSpec validates the spec of the image independently of ceph.
+func validateImageSpec(img *providerapi.Image) error {
+	if errs := providerapi.ValidateImage(img); len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidImageSpec, errs.ToAggregate())
+	}
+	return nil
+}
+
+// RBDImageName returns the name of the rbd image of the image: the custom name it was created with,
+// the requested custom name or the name derived from its id.
+func RBDImageName(img *providerapi.Image) string {
+	switch {
+	case img.Status.RBDName != "":
+		return img.Status.RBDName
+	case img.Spec.RBDName != "":
+		return img.Spec.RBDName
+	default:
+		return ImageIDToRBDID(img.ID)
+	}
+}
+
+// validateRBDName checks that name is a valid rbd image name outside the names derived by the provider.
+func validateRBDName(name string) error {
+	if err := ceph.ValidateImageName(name); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRBDName, err)
+	}
+	if isManagedRBDID(name) {
+		return fmt.Errorf("%w: %q must not start with %q or %q", ErrInvalidRBDName, name, ImageRBDIDPrefix, SnapshotRBDIDPrefix)
+	}
+	return nil
+}
+
+func ironcoreImageSnapshotName(snapshot *providerapi.Snapshot) string {
+	if snapshot.Source.SnapshotName != "" {
+		return snapshot.Source.SnapshotName
+	}
+	return ImageSnapshotVersion
+}
+
 func getSnapshotSourceDetails(snapshot *providerapi.Snapshot) (parentName string, snapName string, err error) {
 	switch {
-	case snapshot.Source.IronCoreImage != "":
+	case snapshot.Source.PopulatesImage():
 		parentName = SnapshotIDToRBDID(snapshot.ID)
-		snapName = ImageSnapshotVersion
+		snapName = ironcoreImageSnapshotName(snapshot)
 	case snapshot.Source.VolumeImageID != "":
 		parentName = ImageIDToRBDID(snapshot.Source.VolumeImageID)
 		snapName = snapshot.ID
@@ -60,6 +110,29 @@ func createOsImageSource(platform *ocispec.Platform) (image.Source, error) {
 	return remote.DockerRegistryWithPlatform(platform)
 }
 
+// imageResolver resolves os image references to their digest.
+type imageResolver interface {
+	Resolve(ctx context.Context, platform *ocispec.Platform, ref string) (string, error)
+}
+
+type registryResolver struct {
+	auth RegistryAuth
+}
+
+func (r registryResolver) Resolve(ctx context.Context, platform *ocispec.Platform, ref string) (string, error) {
+	osImgSrc, err := newOsImageSource(r.auth, platform)
+	if err != nil {
+		return "", fmt.Errorf("failed to create os image source: %w", err)
+	}
+
+	resolvedImg, err := osImgSrc.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve image ref in os image source: %w", classifyRegistryError(err))
+	}
+
+	return resolvedImg.Descriptor().Digest.String(), nil
+}
+
 func toPlatform(arch *string) *ocispec.Platform {
 	if arch == nil {
 		return nil
@@ -82,14 +155,14 @@ func openImage(ioCtx *rados.IOContext, imageName string) (*librbd.Image, error)
 	return img, nil
 }
 
-func flattenImage(log logr.Logger, conn *rados.Conn, pool string, imageName string) error {
+func flattenImage(log logr.Logger, conns ceph.ConnAccessor, pool, namespace string, imageName string) error {
 	log.V(2).Info("Flatten cloned image", "clonedImageId", imageName)
 
-	ioCtx, err := conn.OpenIOContext(pool)
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(conns, pool, namespace)
 	if err != nil {
 		return fmt.Errorf("unable to open io context for pool %s: %w", pool, err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
 	img, err := openImage(ioCtx, imageName)
 	if err != nil {
@@ -117,7 +190,7 @@ func createSnapshot(log logr.Logger, ioCtx *rados.IOContext, snapshotName string
 	}
 	log.Info("Snapshot created")
 
-	if err := imgSnap.Protect(); err != nil {
+	if err := ensureSnapshotProtected(imgSnap); err != nil {
 		return fmt.Errorf("unable to protect snapshot %s: %w", snapshotName, err)
 	}
 
@@ -127,6 +200,23 @@ func createSnapshot(log logr.Logger, ioCtx *rados.IOContext, snapshotName string
 	return nil
 }
 
+// flushAndCreateSnapshot flushes the cached writes of the image before creating the snapshot.
+func flushAndCreateSnapshot(log logr.Logger, ioCtx *rados.IOContext, snapshotName string, imageName string) error {
+	img, err := openImage(ioCtx, imageName)
+	if err != nil {
+		return err
+	}
+
+	log.V(2).Info("Flush image before creating snapshot", "ImageName", imageName)
+	err = img.Flush()
+	closeImage(log, img)
+	if err != nil {
+		return fmt.Errorf("unable to flush image %s: %w", imageName, err)
+	}
+
+	return createSnapshot(log, ioCtx, snapshotName, imageName)
+}
+
 func removeSnapshot(snapshot *librbd.Snapshot) error {
 	isProtected, err := snapshot.IsProtected()
 	if err != nil {
@@ -145,15 +235,17 @@ func removeSnapshot(snapshot *librbd.Snapshot) error {
 	return nil
 }
 
-func flattenChildImages(log logr.Logger, conn *rados.Conn, img *librbd.Image) error {
-	pools, childImgs, err := img.ListChildren()
+// flattenChildImages flattens all clones of the image that are not in the trash. The clones are expected in the given
+// rbd namespace of their pools.
+func flattenChildImages(log logr.Logger, conns ceph.ConnAccessor, namespace string, img *librbd.Image) error {
+	children, err := liveImageChildren(img)
 	if err != nil {
-		return fmt.Errorf("unable to list children: %w", err)
+		return err
 	}
-	log.V(2).Info("Snapshot references", "pools", len(pools), "rbd-images", len(childImgs))
+	log.V(2).Info("Snapshot references", "rbd-images", len(children))
 
-	for i, snapChildImgName := range childImgs {
-		if err := flattenImage(log, conn, pools[i], snapChildImgName); err != nil {
+	for _, child := range children {
+		if err := flattenImage(log, conns, child.PoolName, namespace, child.ImageName); err != nil {
 			return err
 		}
 	}
@@ -191,8 +283,7 @@ func protectSnapshot(log logr.Logger, ioCtx *rados.IOContext, imageName string,
 	}
 	defer closeImage(log, img)
 
-	snapshot := img.GetSnapshot(snapshotName)
-	if err := snapshot.Protect(); err != nil {
+	if err := ensureSnapshotProtected(img.GetSnapshot(snapshotName)); err != nil {
 		return fmt.Errorf("unable to protect existing snapshot %s: %w", snapshotName, err)
 	}
 	if err := img.SetSnapshot(snapshotName); err != nil {
@@ -201,3 +292,41 @@ func protectSnapshot(log logr.Logger, ioCtx *rados.IOContext, imageName string,
 	log.V(2).Info("Successfully protected snapshot", "snapshotId", snapshotName)
 	return nil
 }
+
+// protectableSnapshot is the subset of rbd snapshot operations used to protect snapshots.
+type protectableSnapshot interface {
+	IsProtected() (bool, error)
+	Protect() error
+}
+
+// ensureSnapshotProtected protects the snapshot unless it is protected already. Protecting a protected snapshot
+// fails in rbd, so a failed protection of a snapshot protected meanwhile, e.g. by a concurrent reconcile, succeeds.
+func ensureSnapshotProtected(snapshot protectableSnapshot) error {
+	if isProtected, err := snapshot.IsProtected(); err != nil {
+		return fmt.Errorf("failed to check if snapshot is protected: %w", err)
+	} else if isProtected {
+		return nil
+	}
+
+	if err := snapshot.Protect(); err != nil {
+		if isProtected, checkErr := snapshot.IsProtected(); checkErr == nil && isProtected {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// listPages calls fn with the objects of the store page by page if the store supports paging, so that large stores
+// aren't loaded at once, and with all objects otherwise.
+func listPages[E apiutils.Object](ctx context.Context, s store.Store[E], fn func(objs []E) error) error {
+	if lister, ok := s.(paging.Lister[E]); ok {
+		return paging.Each(ctx, lister, paging.DefaultLimit, fn)
+	}
+
+	objs, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(objs)
+}
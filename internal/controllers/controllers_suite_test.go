@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ironcore-dev/ceph-provider/internal/paging"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestControllers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Controllers Suite")
+}
+
+// memoryStore is a minimal in-memory store.Store used to exercise the reconcilers without a ceph cluster. Like the omap
+// store, it stores and returns copies of the objects, so that changes to an object are only stored by updating it, and
+// refuses updates of objects that were updated since they were read.
+type memoryStore[E apiutils.Object] struct {
+	mu   sync.Mutex
+	objs map[string]E
+	// pages is the number of pages listed.
+	pages int
+}
+
+func newMemoryStore[E apiutils.Object]() *memoryStore[E] {
+	return &memoryStore[E]{objs: map[string]E{}}
+}
+
+func (s *memoryStore[E]) Create(_ context.Context, obj E) (E, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objs[obj.GetID()]; ok {
+		var zero E
+		return zero, fmt.Errorf("object with id %q %w", obj.GetID(), store.ErrAlreadyExists)
+	}
+	obj.IncrementResourceVersion()
+	s.objs[obj.GetID()] = clone(obj)
+	return obj, nil
+}
+
+func (s *memoryStore[E]) Get(_ context.Context, id string) (E, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objs[id]
+	if !ok {
+		var zero E
+		return zero, fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+	}
+	return clone(obj), nil
+}
+
+func (s *memoryStore[E]) Update(_ context.Context, obj E) (E, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldObj, ok := s.objs[obj.GetID()]
+	if !ok {
+		var zero E
+		return zero, fmt.Errorf("object with id %q: %w", obj.GetID(), store.ErrNotFound)
+	}
+	if oldObj.GetResourceVersion() != obj.GetResourceVersion() {
+		var zero E
+		return zero, fmt.Errorf("failed to update object %q at resourceVersion %d, latest is %d: %w",
+			obj.GetID(), obj.GetResourceVersion(), oldObj.GetResourceVersion(), store.ErrResourceVersionNotLatest)
+	}
+	// Like the omap store, deleted objects are removed once all finalizers are released.
+	if obj.GetDeletedAt() != nil && len(obj.GetFinalizers()) == 0 {
+		delete(s.objs, obj.GetID())
+		return obj, nil
+	}
+	obj.IncrementResourceVersion()
+	s.objs[obj.GetID()] = clone(obj)
+	return obj, nil
+}
+
+func (s *memoryStore[E]) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objs, id)
+	return nil
+}
+
+func (s *memoryStore[E]) List(_ context.Context) ([]E, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []E
+	for _, obj := range s.objs {
+		res = append(res, clone(obj))
+	}
+	return res, nil
+}
+
+func (s *memoryStore[E]) ListPage(_ context.Context, opts paging.Options) (paging.Page[E], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pages++
+	return paging.ListPage(opts, func(startAfter string, limit int64) ([]string, []E, error) {
+		var ids []string
+		for _, id := range slices.Sorted(maps.Keys(s.objs)) {
+			if id > startAfter && int64(len(ids)) < limit {
+				ids = append(ids, id)
+			}
+		}
+		objs := make([]E, 0, len(ids))
+		for _, id := range ids {
+			objs = append(objs, clone(s.objs[id]))
+		}
+		return ids, objs, nil
+	})
+}
+
+func (s *memoryStore[E]) Watch(_ context.Context) (store.Watch[E], error) {
+	return nil, fmt.Errorf("watch not supported")
+}
+
+// clone deep-copies the object by round-tripping it through json, the encoding of the omap store.
+func clone[E apiutils.Object](obj E) E {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	res := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(E)
+	if err := json.Unmarshal(data, res); err != nil {
+		panic(err)
+	}
+	return res
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("image finalizer", func() {
+	const (
+		customFinalizer   = "example.com/image"
+		previousFinalizer = "example.com/previous-image"
+	)
+
+	It("should default to the namespaced finalizer", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.finalizer).To(Equal(ImageFinalizer))
+	})
+
+	It("should add the configured finalizer next to the finalizers of other owners", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{Finalizer: customFinalizer})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{"other"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(Succeed())
+
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Finalizers).To(Equal([]string{"other", customFinalizer}))
+	})
+
+	DescribeTable("should only remove its own finalizer",
+		func(finalizers, expected []string) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{
+				Finalizer:          customFinalizer,
+				PreviousFinalizers: []string{previousFinalizer},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			img := &providerapi.Image{Metadata: apiutils.Metadata{Finalizers: finalizers}}
+
+			Expect(r.hasFinalizer(img)).To(BeTrue())
+			r.removeFinalizer(img)
+			Expect(img.Finalizers).To(Equal(expected))
+			Expect(r.hasFinalizer(img)).To(BeFalse())
+		},
+		Entry("only its own", []string{customFinalizer}, []string{}),
+		Entry("before others", []string{customFinalizer, "a", "b"}, []string{"a", "b"}),
+		Entry("between others", []string{"a", customFinalizer, "b"}, []string{"a", "b"}),
+		Entry("legacy finalizer", []string{"a", LegacyImageFinalizer}, []string{"a"}),
+		Entry("previous finalizer", []string{previousFinalizer, "a"}, []string{"a"}),
+		Entry("current and previous finalizer", []string{previousFinalizer, "a", customFinalizer}, []string{"a"}),
+	)
+
+	It("should reject empty previous finalizers", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{PreviousFinalizers: []string{""}})
+		Expect(err).To(MatchError("previous finalizers must not be empty"))
+	})
+
+	It("should not own finalizers of other reconcilers", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{Finalizer: customFinalizer})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.hasFinalizer(&providerapi.Image{Metadata: apiutils.Metadata{Finalizers: []string{ImageFinalizer}}})).To(BeFalse())
+	})
+
+	Context("deletion", func() {
+		var (
+			r     *ImageReconciler
+			conns *countingConnAccessor
+		)
+
+		BeforeEach(func() {
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{Finalizer: customFinalizer})
+			Expect(err).NotTo(HaveOccurred())
+			conns = &countingConnAccessor{}
+			r.conns = conns
+		})
+
+		It("should block the deletion until all owners released the image", func(ctx SpecContext) {
+			By("releasing its own finalizer")
+			img, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{
+					ID:         "foo",
+					DeletedAt:  ptr.To(time.Now()),
+					Finalizers: []string{"a", customFinalizer, "b"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			r.removeFinalizer(img)
+			_, err = r.images.Update(ctx, img)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("reconciling the image again")
+			Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(Succeed())
+			Expect(conns.calls).To(BeZero())
+			img, err = r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Finalizers).To(Equal([]string{"a", "b"}))
+
+			By("releasing the remaining finalizers")
+			img.Finalizers = nil
+			_, err = r.images.Update(ctx, img)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = r.images.Get(ctx, "foo")
+			Expect(err).To(MatchError(store.ErrNotFound))
+		})
+	})
+})
@@ -1,6 +1,12 @@
 // SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
 // SPDX-License-Identifier: Apache-2.0
 
+// Package controllers reconciles the images and snapshots of the volume provider with their rbd images and snapshots.
+//
+// Besides reconciling the images of its queue, the ImageReconciler offers operations the volume provider does not
+// serve: ExportImage, ImportImage, RestoreImage, ReconcileImages and SetImagesLimits. They are library APIs for
+// tooling embedding the reconciler, which calls them directly on a reconciler created with NewImageReconciler on the
+// stores of the provider.
 package controllers
 
 import (
@@ -12,20 +18,31 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ceph/go-ceph/rados"
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/containerd/containerd/reference"
 	"github.com/go-logr/logr"
 	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
 	"github.com/ironcore-dev/ceph-provider/internal/encryption"
+	"github.com/ironcore-dev/ceph-provider/internal/logging"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	"github.com/ironcore-dev/ceph-provider/internal/replay"
 	"github.com/ironcore-dev/ceph-provider/internal/round"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	utilssync "github.com/ironcore-dev/ceph-provider/internal/sync"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
+	"github.com/ironcore-dev/ironcore/broker/common/idgen"
 	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
 	"github.com/ironcore-dev/provider-utils/eventutils/event"
 	eventrecorder "github.com/ironcore-dev/provider-utils/eventutils/recorder"
 	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/utils/ptr"
 )
@@ -33,19 +50,147 @@ import (
 const (
 	LimitMetadataPrefix = "conf_"
 	WWNKey              = "wwn"
-	imageDigestLabel    = "image-digest"
+	// DigestKey is the rbd image metadata key of the digest of the snapshot an image was cloned from. It carries the
+	// prefix of the project's current name ironcore instead of the one of its former name onmetal, like all other
+	// identifiers of the provider.
+	DigestKey = "ironcore.digest"
+	// OwnerKey is the rbd image metadata key of the id of the image an rbd image was created for. Existing rbd images
+	// are only adopted by the image whose id they carry.
+	OwnerKey         = "ironcore.image-id"
+	imageDigestLabel = "image-digest"
+
+	DefaultWorkerSize       = 15
+	DefaultAuthFetchTimeout = 30 * time.Second
+	DefaultAuthCacheTTL     = 5 * time.Minute
+	DefaultShutdownGrace    = 30 * time.Second
+
+	// DefaultSourceRequeueInterval is the default interval images waiting for their snapshot or template are
+	// requeued in.
+	DefaultSourceRequeueInterval = 30 * time.Second
 )
 
+// cephClient is the subset of the rados connection used to query the cluster.
+type cephClient interface {
+	MonCommand(args []byte) ([]byte, string, error)
+	GetPoolByName(name string) (int64, error)
+}
+
 type ImageReconcilerOptions struct {
+	// Monitors are the comma-separated host:port addresses of the ceph monitors handed out in the image access.
+	// They may be omitted if a MonitorSource is specified.
 	Monitors   string
 	Client     string
 	Pool       string
 	WorkerSize int
+
+	// Namespace is the rbd namespace within the pool the images are stored in. Defaults to the default namespace.
+	Namespace string
+
+	// MaxReconcileRetries is the number of failed reconciles after which an image is marked as failed.
+	// A value of 0 retries indefinitely.
+	MaxReconcileRetries int
+
+	// AuthFetchTimeout bounds the time spent fetching the ceph client credentials from the monitors.
+	AuthFetchTimeout time.Duration
+
+	// AuthCacheTTL is the duration for which fetched ceph client credentials are reused.
+	AuthCacheTTL time.Duration
+
+	// ScopedCredentials hands out the key of a ceph client per image, with caps scoped to its rbd image, instead of
+	// the key of Client. Clones may read their parent chain. The clients are named after Client and the image id and
+	// removed with the image.
+	ScopedCredentials bool
+
+	// DryRun only validates images and marks them as validated without writing to ceph.
+	DryRun bool
+
+	// ShutdownGracePeriod is the time in-flight reconciles may take to finish once the reconciler is stopped.
+	ShutdownGracePeriod time.Duration
+
+	RegistryAuth RegistryAuth
+
+	// FlattenThreshold is the clone depth at which cloned images are flattened. 0 disables flattening.
+	FlattenThreshold int
+
+	// WWNGen generates the WWN of an image whose requested WWN is already in use.
+	WWNGen idgen.IDGen
+
+	// SizeRounding is the strategy the requested image sizes are rounded with. Defaults to round.OffBytes.
+	SizeRounding round.Strategy
+
+	// MonitorSource refreshes the monitors periodically, e.g. from the rook mon endpoint ConfigMap.
+	MonitorSource MonitorSource
+
+	// MonitorRefreshInterval is the interval the monitors are refreshed in from the MonitorSource.
+	MonitorRefreshInterval time.Duration
+
+	// Finalizer is the finalizer the reconciler adds to images. Defaults to ImageFinalizer.
+	Finalizer string
+
+	// PreviousFinalizers are finalizers the reconciler added to images before, e.g. with a different Finalizer. They
+	// are released like Finalizer, as is LegacyImageFinalizer.
+	PreviousFinalizers []string
+
+	// ThickProvisionProgressInterval is the interval the progress of thick-provisioning an image is reported in.
+	// Defaults to DefaultThickProvisionProgressInterval.
+	ThickProvisionProgressInterval time.Duration
+
+	// ResyncPeriod is the period all images of the store are enqueued in, so that images whose events were missed
+	// are reconciled eventually. A value of 0 disables the resync.
+	ResyncPeriod time.Duration
+
+	// DeletionPolicy decides how images with clones are deleted. Defaults to ImageDeletionPolicyFlatten.
+	DeletionPolicy ImageDeletionPolicy
+
+	// TracerProvider provides the tracer of the reconcile spans. Defaults to the global tracer provider, which does
+	// not record spans unless one is configured.
+	TracerProvider trace.TracerProvider
+
+	// TrashRetention is the time the rbd images of deleted images are kept in the rbd trash before the TrashPurger
+	// removes them. A value of 0 removes the rbd images immediately.
+	TrashRetention time.Duration
+
+	// DeletionGracePeriod is the time deleted images are retained before their rbd images are removed. The deletion
+	// can be aborted within the grace period by clearing the deletion timestamp of the image. A value of 0 removes
+	// the rbd images right away.
+	DeletionGracePeriod time.Duration
+
+	// LifecycleSink receives the lifecycle transitions of the images, e.g. to expose them to higher layers.
+	LifecycleSink ImageLifecycleSink
+
+	// PoolConcurrency is the number of images of the same target pool that are reconciled at once, so that many
+	// images of one pool don't saturate it. Images of a busy pool are requeued instead of occupying a worker. A value
+	// of 0 only bounds the reconciles by the worker size.
+	PoolConcurrency int
+
+	// SourceRequeueInterval is the interval images waiting for a missing or unpopulated snapshot, or an unavailable
+	// template, are requeued in, so that they progress without relying on events of their source.
+	// Defaults to DefaultSourceRequeueInterval.
+	SourceRequeueInterval time.Duration
+
+	// ExportedLabels are the keys of the image labels written to the metadata of their rbd images under
+	// LabelMetadataPrefix and kept in sync with them, so that tooling operating on rbd images sees them. No labels are
+	// exported if empty.
+	ExportedLabels []string
+
+	// Maintenance pauses the reconciliation of images while it is on, e.g. during ceph maintenance. Images are always
+	// reconciled if nil.
+	Maintenance *maintenance.Mode
+	// MaintenanceRequeueInterval is the interval images are requeued in while the maintenance mode is on.
+	// Defaults to maintenance.DefaultRequeueInterval.
+	MaintenanceRequeueInterval time.Duration
+
+	// IOContextPoolSize is the number of idle io contexts kept per pool, so that reconciles reuse them instead of
+	// opening an io context each. A value of 0 opens an io context per reconcile.
+	IOContextPoolSize int
+
+	// ImageFormat is the rbd image format images are created with. Defaults to ImageFormatV2.
+	ImageFormat ImageFormat
 }
 
 func NewImageReconciler(
 	log logr.Logger,
-	conn *rados.Conn,
+	conns ceph.ConnAccessor,
 	images store.Store[*providerapi.Image],
 	snapshots store.Store[*providerapi.Snapshot],
 	eventRecorder eventrecorder.EventRecorder,
@@ -54,8 +199,8 @@ func NewImageReconciler(
 	keyEncryption encryption.Encryptor,
 	opts ImageReconcilerOptions,
 ) (*ImageReconciler, error) {
-	if conn == nil {
-		return nil, fmt.Errorf("must specify conn")
+	if conns == nil {
+		return nil, fmt.Errorf("must specify conns")
 	}
 
 	if images == nil {
@@ -82,40 +227,257 @@ func NewImageReconciler(
 		return nil, fmt.Errorf("must specify pool")
 	}
 
-	if opts.Monitors == "" {
-		return nil, fmt.Errorf("must specify monitors")
+	if opts.Monitors == "" && opts.MonitorSource == nil {
+		return nil, fmt.Errorf("must specify monitors or monitor source")
+	}
+
+	var monitorEndpoints []string
+	if opts.Monitors != "" {
+		var err error
+		if monitorEndpoints, err = parseMonitors(opts.Monitors); err != nil {
+			return nil, fmt.Errorf("invalid monitors: %w", err)
+		}
+	}
+
+	if opts.MonitorRefreshInterval < 0 {
+		return nil, fmt.Errorf("monitor refresh interval must not be negative, got %s", opts.MonitorRefreshInterval)
+	}
+
+	if opts.MonitorRefreshInterval == 0 {
+		opts.MonitorRefreshInterval = DefaultMonitorRefreshInterval
 	}
 
 	if opts.Client == "" {
 		return nil, fmt.Errorf("must specify ceph client")
 	}
 
+	if err := ceph.ValidateNamespace(opts.Namespace); err != nil {
+		return nil, err
+	}
+
+	if opts.WorkerSize < 0 {
+		return nil, fmt.Errorf("worker size must be greater than 0, got %d", opts.WorkerSize)
+	}
+
 	if opts.WorkerSize == 0 {
-		opts.WorkerSize = 15
-	}
-
-	return &ImageReconciler{
-		log:            log,
-		conn:           conn,
-		queue:          workqueue.NewTypedRateLimitingQueue[string](workqueue.DefaultTypedControllerRateLimiter[string]()),
-		images:         images,
-		snapshots:      snapshots,
-		EventRecorder:  eventRecorder,
-		imageEvents:    imageEvents,
-		snapshotEvents: snapshotEvents,
-		monitors:       opts.Monitors,
-		client:         opts.Client,
-		pool:           opts.Pool,
-		keyEncryption:  keyEncryption,
-		workerSize:     opts.WorkerSize,
-	}, nil
+		opts.WorkerSize = DefaultWorkerSize
+	}
+
+	if opts.MaxReconcileRetries < 0 {
+		return nil, fmt.Errorf("max reconcile retries must not be negative, got %d", opts.MaxReconcileRetries)
+	}
+
+	if opts.AuthFetchTimeout < 0 {
+		return nil, fmt.Errorf("auth fetch timeout must not be negative, got %s", opts.AuthFetchTimeout)
+	}
+
+	if opts.AuthFetchTimeout == 0 {
+		opts.AuthFetchTimeout = DefaultAuthFetchTimeout
+	}
+
+	if opts.AuthCacheTTL < 0 {
+		return nil, fmt.Errorf("auth cache ttl must not be negative, got %s", opts.AuthCacheTTL)
+	}
+
+	if opts.AuthCacheTTL == 0 {
+		opts.AuthCacheTTL = DefaultAuthCacheTTL
+	}
+
+	if opts.WWNGen == nil {
+		opts.WWNGen = strategy.ImageStrategy.WWNGen
+	}
+
+	if err := opts.SizeRounding.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid size rounding: %w", err)
+	}
+
+	if opts.FlattenThreshold < 0 {
+		return nil, fmt.Errorf("flatten threshold must not be negative, got %d", opts.FlattenThreshold)
+	}
+
+	if opts.Finalizer == "" {
+		opts.Finalizer = ImageFinalizer
+	}
+
+	if slices.Contains(opts.PreviousFinalizers, "") {
+		return nil, fmt.Errorf("previous finalizers must not be empty")
+	}
+
+	if opts.ThickProvisionProgressInterval < 0 {
+		return nil, fmt.Errorf("thick provision progress interval must not be negative, got %s", opts.ThickProvisionProgressInterval)
+	}
+
+	if opts.ThickProvisionProgressInterval == 0 {
+		opts.ThickProvisionProgressInterval = DefaultThickProvisionProgressInterval
+	}
+
+	if opts.ResyncPeriod < 0 {
+		return nil, fmt.Errorf("resync period must not be negative, got %s", opts.ResyncPeriod)
+	}
+
+	if opts.SourceRequeueInterval < 0 {
+		return nil, fmt.Errorf("source requeue interval must not be negative, got %s", opts.SourceRequeueInterval)
+	}
+
+	if opts.SourceRequeueInterval == 0 {
+		opts.SourceRequeueInterval = DefaultSourceRequeueInterval
+	}
+
+	for _, key := range opts.ExportedLabels {
+		if key == "" {
+			return nil, fmt.Errorf("exported label keys must not be empty")
+		}
+	}
+
+	if opts.MaintenanceRequeueInterval < 0 {
+		return nil, fmt.Errorf("maintenance requeue interval must not be negative, got %s", opts.MaintenanceRequeueInterval)
+	}
+
+	if opts.MaintenanceRequeueInterval == 0 {
+		opts.MaintenanceRequeueInterval = maintenance.DefaultRequeueInterval
+	}
+
+	if opts.TrashRetention < 0 {
+		return nil, fmt.Errorf("trash retention must not be negative, got %s", opts.TrashRetention)
+	}
+
+	if opts.DeletionGracePeriod < 0 {
+		return nil, fmt.Errorf("deletion grace period must not be negative, got %s", opts.DeletionGracePeriod)
+	}
+
+	if opts.PoolConcurrency < 0 {
+		return nil, fmt.Errorf("pool concurrency must not be negative, got %d", opts.PoolConcurrency)
+	}
+
+	if opts.IOContextPoolSize < 0 {
+		return nil, fmt.Errorf("io context pool size must not be negative, got %d", opts.IOContextPoolSize)
+	}
+
+	switch opts.ImageFormat {
+	case 0:
+		opts.ImageFormat = ImageFormatV2
+	case ImageFormatV1, ImageFormatV2:
+	default:
+		return nil, fmt.Errorf("unsupported image format %d", opts.ImageFormat)
+	}
+
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+
+	switch opts.DeletionPolicy {
+	case "":
+		opts.DeletionPolicy = ImageDeletionPolicyFlatten
+	case ImageDeletionPolicyFlatten, ImageDeletionPolicyBlock:
+	default:
+		return nil, fmt.Errorf("unsupported image deletion policy %q", opts.DeletionPolicy)
+	}
+
+	if opts.ShutdownGracePeriod < 0 {
+		return nil, fmt.Errorf("shutdown grace period must not be negative, got %s", opts.ShutdownGracePeriod)
+	}
+
+	if opts.ShutdownGracePeriod == 0 {
+		opts.ShutdownGracePeriod = DefaultShutdownGrace
+	}
+
+	priorities := newImagePriorityIndex()
+	r := &ImageReconciler{
+		log:              log,
+		conns:            conns,
+		cephClient:       ceph.MonClient{Conns: conns},
+		queue:            newImageWorkqueue(priorities),
+		imageMu:          utilssync.NewMutexMap[string](),
+		thickProvisions:  map[string]*thickProvisioning{},
+		exports:          sets.New[string](),
+		images:           images,
+		snapshots:        snapshots,
+		EventRecorder:    eventRecorder,
+		imageEvents:      imageEvents,
+		snapshotEvents:   snapshotEvents,
+		monitors:         strings.Join(monitorEndpoints, ","),
+		monitorEndpoints: monitorEndpoints,
+		monitorSource:    opts.MonitorSource,
+		client:           opts.Client,
+		pool:             opts.Pool,
+		namespace:        opts.Namespace,
+		keyEncryption:    keyEncryption,
+		workerSize:       opts.WorkerSize,
+
+		maxReconcileRetries:    opts.MaxReconcileRetries,
+		authFetchTimeout:       opts.AuthFetchTimeout,
+		authCache:              newAuthCache(opts.AuthCacheTTL),
+		scopedCredentials:      opts.ScopedCredentials,
+		dryRun:                 opts.DryRun,
+		snapshotImages:         newSnapshotImageIndex(),
+		templateImages:         newTemplateImageIndex(),
+		imageStates:            newImageStateIndex(),
+		imagePriorities:        priorities,
+		registry:               registryResolver{auth: opts.RegistryAuth},
+		shutdownGracePeriod:    opts.ShutdownGracePeriod,
+		flattenThreshold:       opts.FlattenThreshold,
+		wwnGen:                 opts.WWNGen,
+		sizeRounding:           opts.SizeRounding,
+		monitorRefreshInterval: opts.MonitorRefreshInterval,
+		metrics:                newImageMetrics(),
+
+		finalizer:                      opts.Finalizer,
+		previousFinalizers:             append([]string{LegacyImageFinalizer}, opts.PreviousFinalizers...),
+		thickProvisionProgressInterval: opts.ThickProvisionProgressInterval,
+		sourceRequeueInterval:          opts.SourceRequeueInterval,
+		imageFormat:                    opts.ImageFormat,
+		resyncPeriod:                   opts.ResyncPeriod,
+		deletionPolicy:                 opts.DeletionPolicy,
+		tracer:                         opts.TracerProvider.Tracer(tracerName),
+		trashRetention:                 opts.TrashRetention,
+		deletionGracePeriod:            opts.DeletionGracePeriod,
+		lifecycleSink:                  opts.LifecycleSink,
+		exportedLabelKeys:              slices.Clone(opts.ExportedLabels),
+		rbdRemover:                     librbdImageRemover{},
+		parentSnapshots:                librbdParentSnapshots{},
+		now:                            time.Now,
+	}
+	if opts.PoolConcurrency > 0 {
+		r.poolSlots = utilssync.NewSemaphoreMap[string](opts.PoolConcurrency)
+	}
+	if opts.IOContextPoolSize > 0 {
+		ioContexts, err := ceph.NewIOContextPool(conns, ceph.IOContextPoolOptions{Size: opts.IOContextPoolSize})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create io context pool: %w", err)
+		}
+		r.ioContexts = ioContexts
+	}
+	r.maintenance = newMaintenanceBacklog(opts.Maintenance, opts.MaintenanceRequeueInterval, r.queue)
+	r.reconcile = r.reconcileImage
+	r.reconcileWithIOContext = r.reconcileImageWithIOContext
+	r.migrator = &connImageMigrator{conns: conns, namespace: opts.Namespace}
+	r.rbdImages = &connImageSizer{conns: conns, namespace: opts.Namespace}
+	r.rbdImageIDs = &connImageIDReader{conns: conns, namespace: opts.Namespace}
+	r.templateSnapshots = &connTemplateSnapshots{conns: conns, namespace: opts.Namespace}
+	r.rbdTrash = &connImageTrash{conns: conns, namespace: opts.Namespace}
+	r.trashRecords = &omapTrashRecords{conns: conns, pool: opts.Pool, namespace: opts.Namespace}
+	r.rbdReader = &connImageReader{conns: conns, namespace: opts.Namespace}
+	r.rbdWriter = &connImageWriter{conns: conns, namespace: opts.Namespace}
+	r.newImageSink = registrySinkFunc(opts.RegistryAuth)
+	return r, nil
 }
 
 type ImageReconciler struct {
-	log  logr.Logger
-	conn *rados.Conn
+	log        logr.Logger
+	conns      ceph.ConnAccessor
+	cephClient cephClient
 
 	queue workqueue.TypedRateLimitingInterface[string]
+	// imageMu serializes reconciles of the same image, e.g. by a worker and a batch.
+	imageMu *utilssync.MutexMap[string]
+	// wwnMu serializes WWN assignments, so that the uniqueness check and the persisting of a WWN are atomic.
+	wwnMu sync.Mutex
+	// thickProvisions holds the allocations of images running in the background by image id.
+	thickProvisions   map[string]*thickProvisioning
+	thickProvisionsMu sync.Mutex
+	// exports holds the ids of the images being exported.
+	exports   sets.Set[string]
+	exportsMu sync.Mutex
 
 	images    store.Store[*providerapi.Image]
 	snapshots store.Store[*providerapi.Snapshot]
@@ -124,21 +486,106 @@ type ImageReconciler struct {
 	imageEvents    event.Source[*providerapi.Image]
 	snapshotEvents event.Source[*providerapi.Snapshot]
 
-	monitors string
-	client   string
-	pool     string
+	// monitorsMu guards the monitors, which are replaced when refreshed from the monitor source.
+	monitorsMu             sync.RWMutex
+	monitors               string
+	monitorEndpoints       []string
+	monitorSource          MonitorSource
+	monitorRefreshInterval time.Duration
+	client                 string
+	pool                   string
+	namespace              string
 
 	keyEncryption encryption.Encryptor
 
 	workerSize int
+
+	maxReconcileRetries int
+	authFetchTimeout    time.Duration
+	authCache           *authCache
+	scopedCredentials   bool
+	dryRun              bool
+
+	snapshotImages *snapshotImageIndex
+	templateImages *snapshotImageIndex
+	imageStates    *imageStateIndex
+	// imagePriorities holds the priorities the queue orders images by.
+	imagePriorities *imagePriorityIndex
+	registry        imageResolver
+
+	shutdownGracePeriod    time.Duration
+	flattenThreshold       int
+	wwnGen                 idgen.IDGen
+	sizeRounding           round.Strategy
+	reconcile              func(ctx context.Context, id string) error
+	reconcileWithIOContext func(ctx context.Context, ioCtx *rados.IOContext, id string) error
+	migrator               imageMigrator
+	rbdImages              rbdImageSizer
+	rbdImageIDs            rbdImageIDReader
+	templateSnapshots      rbdTemplateSnapshots
+	rbdReader              rbdImageReader
+	rbdWriter              rbdImageWriter
+	newImageSink           imageSinkFunc
+
+	metrics imageMetrics
+
+	finalizer                      string
+	previousFinalizers             []string
+	thickProvisionProgressInterval time.Duration
+	sourceRequeueInterval          time.Duration
+	imageFormat                    ImageFormat
+	resyncPeriod                   time.Duration
+	deletionPolicy                 ImageDeletionPolicy
+	tracer                         trace.Tracer
+	trashRetention                 time.Duration
+	deletionGracePeriod            time.Duration
+	lifecycleSink                  ImageLifecycleSink
+	maintenance                    *maintenanceBacklog
+	exportedLabelKeys              []string
+	rbdRemover                     rbdImageRemover
+	parentSnapshots                rbdParentSnapshots
+	rbdTrash                       rbdImageTrash
+	trashRecords                   trashRecords
+	now                            func() time.Time
+	// poolSlots bounds the concurrent reconciles per target pool, it is nil without pool concurrency.
+	poolSlots *utilssync.SemaphoreMap[string]
+	// ioContexts lends the io contexts of reconciles, it is nil without io context pooling.
+	ioContexts *ceph.IOContextPool
 }
 
 func (r *ImageReconciler) Start(ctx context.Context) error {
 	log := r.log
 
-	imgEventReg, err := r.imageEvents.AddHandler(event.HandlerFunc[*providerapi.Image](func(evt event.Event[*providerapi.Image]) {
+	if r.monitorSource != nil {
+		if err := r.refreshMonitors(ctx); err != nil {
+			if monitors, _ := r.currentMonitors(); monitors == "" {
+				return err
+			}
+			log.Error(err, "Failed to refresh monitors, using the configured monitors")
+		}
+		go r.startMonitorRefresh(ctx)
+	}
+
+	imgHandler := event.HandlerFunc[*providerapi.Image](func(evt event.Event[*providerapi.Image]) {
+		r.indexImage(evt)
 		r.queue.Add(evt.Object.ID)
-	}))
+		if evt.Object.Status.State == providerapi.ImageStateAvailable {
+			// Clones waiting for their template are reconciled once it is available.
+			for _, id := range r.templateImages.imagesFor(evt.Object.ID) {
+				r.queue.Add(id)
+			}
+		}
+	})
+	var (
+		imgEventReg event.HandlerRegistration
+		err         error
+	)
+	if src, ok := r.imageEvents.(replay.ReplaySource[*providerapi.Image]); ok {
+		// Existing images are replayed, so they are reconciled right away instead of on the first list of the source.
+		imgEventReg, err = src.AddHandlerWithOptions(ctx, imgHandler, replay.HandlerOptions{Replay: true})
+	} else {
+		imgEventReg, err = r.imageEvents.AddHandler(imgHandler)
+	}
 	if err != nil {
 		return err
 	}
@@ -146,23 +593,16 @@ func (r *ImageReconciler) Start(ctx context.Context) error {
 		_ = r.imageEvents.RemoveHandler(imgEventReg)
 	}()
 
+	if r.resyncPeriod > 0 {
+		go r.startResync(ctx)
+	}
+
 	snapEventReg, err := r.snapshotEvents.AddHandler(event.HandlerFunc[*providerapi.Snapshot](func(evt event.Event[*providerapi.Snapshot]) {
 		if evt.Type != event.TypeUpdated || evt.Object.Status.State != providerapi.SnapshotStateReady {
 			return
 		}
 
-		imageList, err := r.images.List(ctx)
-		if err != nil {
-			log.Error(err, "failed to list images")
-			return
-		}
-
-		for _, img := range imageList {
-			if snapshotRef := img.Spec.SnapshotRef; snapshotRef != nil && *snapshotRef == evt.Object.ID {
-				r.Eventf(img.Metadata, corev1.EventTypeNormal, "ImagePullSucceeded", "Pulled image %s", *img.Spec.SnapshotRef)
-				r.queue.Add(img.ID)
-			}
-		}
+		r.enqueueSnapshotImages(ctx, log, evt.Object.ID)
 	}))
 	if err != nil {
 		return err
@@ -171,9 +611,21 @@ func (r *ImageReconciler) Start(ctx context.Context) error {
 		_ = r.snapshotEvents.RemoveHandler(snapEventReg)
 	}()
 
+	// In-flight reconciles run with their own context which is only cancelled once the grace period
+	// after stopping the reconciler is exceeded, so that rbd images are not left half-created.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
 	go func() {
 		<-ctx.Done()
 		r.queue.ShutDown()
+
+		select {
+		case <-time.After(r.shutdownGracePeriod):
+			log.Info("Shutdown grace period exceeded, cancelling in-flight reconciles")
+			cancelWork()
+		case <-workCtx.Done():
+		}
 	}()
 
 	var wg sync.WaitGroup
@@ -181,28 +633,85 @@ func (r *ImageReconciler) Start(ctx context.Context) error {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for r.processNextWorkItem(ctx, log) {
+			for r.processNextWorkItem(ctx, workCtx, log) {
 			}
 		}()
 	}
 
 	wg.Wait()
+	r.stopThickProvisionings()
+	if r.ioContexts != nil {
+		r.ioContexts.Close()
+	}
 	return nil
 }
 
-func (r *ImageReconciler) processNextWorkItem(ctx context.Context, log logr.Logger) bool {
+func (r *ImageReconciler) indexImage(evt event.Event[*providerapi.Image]) {
+	if evt.Type == event.TypeDeleted {
+		r.snapshotImages.delete(evt.Object.ID)
+		r.templateImages.delete(evt.Object.ID)
+		r.imageStates.delete(evt.Object.ID)
+		r.imagePriorities.delete(evt.Object.ID)
+		return
+	}
+	r.snapshotImages.set(evt.Object)
+	r.templateImages.set(evt.Object)
+	r.imageStates.set(evt.Object)
+	r.imagePriorities.set(evt.Object)
+}
+
+func (r *ImageReconciler) enqueueSnapshotImages(ctx context.Context, log logr.Logger, snapshotID string) {
+	for _, imageID := range r.snapshotImages.imagesFor(snapshotID) {
+		img, err := r.images.Get(ctx, imageID)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				log.Error(err, "failed to get image", "imageId", imageID)
+			}
+			continue
+		}
+
+		r.Eventf(img.Metadata, corev1.EventTypeNormal, "ImagePullSucceeded", "Pulled image %s", snapshotID)
+		r.queue.Add(img.ID)
+	}
+}
+
+func (r *ImageReconciler) processNextWorkItem(ctx, workCtx context.Context, log logr.Logger) bool {
 	id, shutdown := r.queue.Get()
 	if shutdown {
 		return false
 	}
 	defer r.queue.Done(id)
 
+	// Items still queued when stopping are not started anymore, they are picked up again after a restart.
+	if ctx.Err() != nil {
+		return false
+	}
+
 	log = log.WithValues("imageId", id)
-	ctx = logr.NewContext(ctx, log)
+	workCtx = logr.NewContext(workCtx, log)
 
-	if err := r.reconcileImage(ctx, id); err != nil {
-		log.Error(err, "failed to reconcile image")
-		r.queue.AddRateLimited(id)
+	if r.maintenance.deferIfPaused(log, id) {
+		return true
+	}
+
+	r.imageMu.Lock(id)
+	defer r.imageMu.Unlock(id)
+
+	release, err := r.acquirePoolSlot(workCtx, id)
+	if err != nil {
+		if errors.Is(err, errPoolSlotsBusy) {
+			log.V(1).Info("All reconcile slots of the pool are busy, requeueing", "RequeueAfter", poolSlotRequeueDelay)
+			r.queue.AddAfter(id, poolSlotRequeueDelay)
+			return true
+		}
+		r.handleReconcileError(workCtx, log, id, err)
+		return true
+	}
+	defer release()
+
+	if err := r.reconcile(workCtx, id); err != nil {
+		r.conns.ObserveError(err)
+		r.handleReconcileError(workCtx, log, id, err)
 		return true
 	}
 
@@ -210,31 +719,187 @@ func (r *ImageReconciler) processNextWorkItem(ctx context.Context, log logr.Logg
 	return true
 }
 
+func (r *ImageReconciler) handleReconcileError(ctx context.Context, log logr.Logger, id string, reconcileErr error) {
+	if errors.Is(reconcileErr, store.ErrResourceVersionNotLatest) {
+		// The image was updated concurrently, it is read again and reconciled from its latest version. Conflicts
+		// don't count as retries, as they don't indicate a failure of the image.
+		log.V(1).Info("Image was updated concurrently, requeueing", "Error", reconcileErr)
+		r.queue.Add(id)
+		return
+	}
+
+	reason, terminal := terminalErrorReason(reconcileErr)
+	if !terminal && (r.maxReconcileRetries == 0 || r.queue.NumRequeues(id) < r.maxReconcileRetries) {
+		log.Error(reconcileErr, "failed to reconcile image")
+		r.queue.AddRateLimited(id)
+		return
+	}
+
+	failed, err := r.markImageFailed(ctx, id, reason, reconcileErr)
+	if err != nil {
+		log.Error(err, "failed to mark image as failed")
+		r.queue.AddRateLimited(id)
+		return
+	}
+	if !failed {
+		log.Error(reconcileErr, "failed to reconcile image")
+		if terminal {
+			// Retrying cannot succeed, the image is reconciled again on its next change.
+			r.queue.Forget(id)
+			return
+		}
+		r.queue.AddRateLimited(id)
+		return
+	}
+
+	log.Error(reconcileErr, "failed to reconcile image, giving up", "retries", r.queue.NumRequeues(id), "reason", reason)
+	r.queue.Forget(id)
+}
+
+// terminalErrorReason reports whether retrying cannot resolve the error, e.g. because the configuration is invalid,
+// and the reason to record for it.
+func terminalErrorReason(err error) (string, bool) {
+	var resolveErr *ResolveError
+	switch {
+	case errors.Is(err, ceph.ErrPoolNotFound):
+		return "PoolNotFound", true
+	case errors.As(err, &resolveErr) && resolveErr.Permanent:
+		return resolveErr.Reason, true
+	case errors.Is(err, ErrInvalidRBDName):
+		return "InvalidRBDName", true
+	case errors.Is(err, ErrInvalidQoS):
+		return "InvalidQoS", true
+	case errors.Is(err, ErrInvalidImageSpec):
+		return "InvalidSpec", true
+	case errors.Is(err, ErrIncompatibleImageFormat):
+		return "IncompatibleImageFormat", true
+	default:
+		return "", false
+	}
+}
+
+// markImageFailed transitions the image into the failed state. Images being deleted are never marked as failed
+// so that their deletion is retried.
+func (r *ImageReconciler) markImageFailed(ctx context.Context, id, reason string, reconcileErr error) (bool, error) {
+	img, err := r.images.Get(ctx, id)
+	if err != nil {
+		return false, store.IgnoreErrNotFound(err)
+	}
+
+	if img.DeletedAt != nil {
+		return false, nil
+	}
+
+	img.Status.State = providerapi.ImageStateFailed
+	img.Status.LastError = reconcileErr.Error()
+	if reason != "" {
+		img.Status.SetCondition(providerapi.ImageCondition{
+			Type:    providerapi.ImageConditionReconciled,
+			Status:  providerapi.ConditionFalse,
+			Reason:  reason,
+			Message: reconcileErr.Error(),
+		})
+	}
+	img, err = r.images.Update(ctx, img)
+	if err != nil {
+		return false, fmt.Errorf("failed to update image state: %w", err)
+	}
+	r.emitLifecycleEvent(img, ImageLifecycleFailed)
+	r.Eventf(img.Metadata, corev1.EventTypeWarning, "ReconcileImageFailed", "Giving up reconciling image: %s", reconcileErr)
+
+	return true, nil
+}
+
 const (
-	ImageFinalizer = "image"
+	// ImageFinalizer is the default finalizer of the image reconciler.
+	ImageFinalizer = "ceph-provider.ironcore.dev/image"
+	// LegacyImageFinalizer is the finalizer of images created by previous versions. It is released like the
+	// configured finalizer, see ImageReconcilerOptions.PreviousFinalizers.
+	LegacyImageFinalizer = "image"
 )
 
+// hasFinalizer reports whether the image carries the finalizer of the reconciler or one of its previous finalizers.
+func (r *ImageReconciler) hasFinalizer(image *providerapi.Image) bool {
+	return slices.ContainsFunc(image.Finalizers, func(finalizer string) bool {
+		return finalizer == r.finalizer || slices.Contains(r.previousFinalizers, finalizer)
+	})
+}
+
+// removeFinalizer removes the finalizer and the previous finalizers of the reconciler, leaving the finalizers of
+// other owners intact.
+func (r *ImageReconciler) removeFinalizer(image *providerapi.Image) {
+	image.Finalizers = utils.DeleteSliceElement(image.Finalizers, r.finalizer)
+	for _, finalizer := range r.previousFinalizers {
+		image.Finalizers = utils.DeleteSliceElement(image.Finalizers, finalizer)
+	}
+}
+
 func (r *ImageReconciler) deleteImage(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
-	if !slices.Contains(image.Finalizers, ImageFinalizer) {
+	if !r.hasFinalizer(image) {
 		log.V(1).Info("image has no finalizer: done")
 		return nil
 	}
 
+	if remaining := r.deletionGraceRemaining(image); remaining > 0 {
+		log.V(1).Info("Retaining deleted image until its deletion grace period elapsed", "Remaining", remaining)
+		r.queue.AddAfter(image.ID, remaining)
+		return nil
+	}
+
+	if r.isExporting(image.ID) {
+		log.V(1).Info("Retaining deleted image until its export is done")
+		r.queue.AddAfter(image.ID, exportDeletionRequeueDelay)
+		return nil
+	}
+
+	// The image is kept open while it is thick-provisioned.
+	r.cancelThickProvisioning(image.ID)
+
+	if err := r.checkImageChildren(log, ioCtx, image); err != nil {
+		return err
+	}
+
+	// The maintenance mode may have been turned on while checking the children, the clones of a template are not
+	// flattened until it is turned off again.
+	if r.maintenance.deferIfPaused(log, image.ID) {
+		return nil
+	}
+
+	if err := r.templateSnapshots.RemoveSnapshot(log, r.imagePool(image), RBDImageName(image), TemplateSnapshotName); err != nil {
+		return fmt.Errorf("failed to remove template snapshot: %w", err)
+	}
+	// A snapshot left behind by an interrupted export must not be taken for a volume snapshot.
+	if err := r.templateSnapshots.RemoveSnapshot(log, r.imagePool(image), RBDImageName(image), ExportSnapshotName); err != nil {
+		return fmt.Errorf("failed to remove export snapshot: %w", err)
+	}
+
 	if err := r.deleteImageSnapshots(ctx, log, ioCtx, image); err != nil {
 		return fmt.Errorf("failed to delete image snapshots: %w", err)
 	}
 
-	if err := librbd.RemoveImage(ioCtx, ImageIDToRBDID(image.ID)); err != nil && !errors.Is(err, librbd.ErrNotFound) {
-		return fmt.Errorf("failed to remove rbd image: %w", err)
+	if err := r.removeRBDImage(log, ioCtx, image); err != nil {
+		return err
+	}
+
+	if err := r.removeMigrationSource(ctx, log, image); err != nil {
+		return err
+	}
+
+	if err := r.removeImageCredentials(ctx, log, image); err != nil {
+		return err
+	}
+
+	if err := r.removeSnapshotRef(ctx, log, image); err != nil {
+		return err
 	}
-	log.V(2).Info("Rbd image deleted")
 
-	image.Finalizers = utils.DeleteSliceElement(image.Finalizers, ImageFinalizer)
+	r.removeFinalizer(image)
 	if _, err := r.images.Update(ctx, image); store.IgnoreErrNotFound(err) != nil {
 		return fmt.Errorf("failed to update image metadata: %w", err)
 	}
+	r.emitLifecycleEvent(image, ImageLifecycleDeleted)
 	r.Eventf(image.Metadata, corev1.EventTypeNormal, "ImageDeletionSucceeded", "Deleted image")
-	log.V(2).Info("Removed Finalizers")
+	log.V(2).Info("Removed finalizer", "remainingFinalizers", image.Finalizers)
 
 	return nil
 }
@@ -244,7 +909,7 @@ func (r *ImageReconciler) deleteImage(ctx context.Context, log logr.Logger, ioCt
 // 2. Flatten all child images(cloned images from step 1 and rbd images which are restored using this snapshot) of each snapshot.
 // 3. Remove all snapshots of rbd image and update each snapshot source in store to cloned rbd image id
 func (r *ImageReconciler) deleteImageSnapshots(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
-	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
+	img, err := openImage(ioCtx, RBDImageName(image))
 	if err != nil {
 		if !errors.Is(err, librbd.ErrNotFound) {
 			return err
@@ -289,7 +954,7 @@ func (r *ImageReconciler) deleteImageSnapshots(ctx context.Context, log logr.Log
 	}
 
 	// flatten all child images of the original image's snapshots
-	if err := flattenChildImages(log, r.conn, img); err != nil {
+	if err := flattenChildImages(log, r.conns, r.namespace, img); err != nil {
 		return fmt.Errorf("failed to flatten snapshot child images: %w", err)
 	}
 
@@ -322,7 +987,7 @@ func (r *ImageReconciler) deleteImageSnapshots(ctx context.Context, log logr.Log
 }
 
 func (r *ImageReconciler) cloneSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapName string, image *providerapi.Image) error {
-	rbdExists, err := r.isImageExisting(ioCtx, snapName)
+	rbdExists, err := r.isImageExisting(ioCtx, ImageIDToRBDID(snapName))
 	if err != nil {
 		return fmt.Errorf("failed to check rbd image existence: %w", err)
 	}
@@ -347,17 +1012,19 @@ func (r *ImageReconciler) cloneSnapshot(ctx context.Context, log logr.Logger, io
 		Spec: providerapi.ImageSpec{
 			Size:        image.Spec.Size,
 			Limits:      image.Spec.Limits,
+			QoS:         image.Spec.QoS,
 			SnapshotRef: ptr.To(snapName),
 			Encryption:  image.Spec.Encryption,
+			Features:    image.Spec.Features,
 		},
 	}
 
 	if !rbdExists {
-		options := librbd.NewRbdImageOptions()
-		defer options.Destroy()
-		if err := options.SetString(librbd.ImageOptionDataPool, r.pool); err != nil {
-			return fmt.Errorf("failed to set data pool: %w", err)
+		options, err := r.newImageOptions(clonedImage)
+		if err != nil {
+			return fmt.Errorf("failed to configure image options: %w", err)
 		}
+		defer options.Destroy()
 
 		log.V(2).Info("Creating image from snapshot", "snapshotId", snapName)
 		if ok, err := r.createImageFromSnapshot(ctx, log, ioCtx, clonedImage, snapName, options); err != nil {
@@ -397,7 +1064,16 @@ type fetchAuthResponse struct {
 	Key string `json:"key"`
 }
 
-func (r *ImageReconciler) fetchAuth(log logr.Logger) (string, string, error) {
+func (r *ImageReconciler) fetchAuth(ctx context.Context, log logr.Logger) (_ string, _ string, retErr error) {
+	ctx, span := r.startSpan(ctx, "fetchAuth")
+	defer func() { endSpan(span, retErr) }()
+
+	log = log.WithName(logging.LoggerName(logging.ComponentAuth))
+	if credentials, ok := r.authCache.get(r.client); ok {
+		log.V(3).Info("Using cached client credentials", "name", r.client)
+		return credentials.user, credentials.key, nil
+	}
+
 	cmd1, err := json.Marshal(map[string]string{
 		"prefix": "auth get-key",
 		"entity": r.client,
@@ -408,9 +1084,9 @@ func (r *ImageReconciler) fetchAuth(log logr.Logger) (string, string, error) {
 	}
 
 	log.V(3).Info("Try to fetch client", "name", r.client)
-	data, _, err := r.conn.MonCommand(cmd1)
+	data, err := r.monCommand(ctx, cmd1)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to execute mon command: %w", err)
+		return "", "", err
 	}
 
 	response := fetchAuthResponse{}
@@ -418,43 +1094,131 @@ func (r *ImageReconciler) fetchAuth(log logr.Logger) (string, string, error) {
 		return "", "", fmt.Errorf("unable to unmarshal response: %w", err)
 	}
 
-	return strings.TrimPrefix(r.client, "client."), response.Key, nil
+	credentials := cephCredentials{
+		user: strings.TrimPrefix(r.client, "client."),
+		key:  response.Key,
+	}
+	r.authCache.set(r.client, credentials)
+
+	return credentials.user, credentials.key, nil
 }
 
-func (r *ImageReconciler) reconcileSnapshot(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
-	if img.Spec.Image == "" || img.Spec.SnapshotRef != nil {
-		return nil
+// monCommand executes the given mon command and aborts waiting for it once the context is done
+// or the auth fetch timeout elapsed, as MonCommand blocks indefinitely without mon quorum.
+func (r *ImageReconciler) monCommand(ctx context.Context, cmd []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.authFetchTimeout)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
 	}
+	done := make(chan result, 1)
+	go func() {
+		data, _, err := r.cephClient.MonCommand(cmd)
+		done <- result{data: data, err: err}
+	}()
 
-	log.V(2).Info("Parse image reference", "Image", img.Spec.Image)
-	spec, err := reference.Parse(img.Spec.Image)
-	if err != nil {
-		return fmt.Errorf("failed to parse image reference: %w", err)
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, fmt.Errorf("failed to execute mon command: %w", res.err)
+		}
+		return res.data, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timed out executing mon command: %w", ctx.Err())
+	}
+}
+
+// resolveImageDigest resolves the digest of the os image of the image. The digest is pinned in the image status so
+// that retried reconciles do not hit the registry again as long as the image reference is unchanged.
+func (r *ImageReconciler) resolveImageDigest(ctx context.Context, log logr.Logger, img *providerapi.Image) (string, error) {
+	if img.Status.ResolvedDigest != "" && img.Status.ResolvedImage == img.Spec.Image {
+		log.V(2).Info("Using pinned image digest", "digest", img.Status.ResolvedDigest)
+		return img.Status.ResolvedDigest, nil
 	}
 
 	log.V(2).Info("Resolve image reference")
-	osImgSrc, err := createOsImageSource(toPlatform(img.Spec.ImageArchitecture))
+	digest, err := r.registry.Resolve(ctx, toPlatform(img.Spec.ImageArchitecture), img.Spec.Image)
 	if err != nil {
-		return fmt.Errorf("failed to create os image source: %w", err)
+		if errors.Is(err, ErrImageUnauthorized) {
+			r.Eventf(img.Metadata, corev1.EventTypeWarning, "ImageUnauthorized", "Unauthorized to resolve image %s", img.Spec.Image)
+		}
+		return "", newResolveError(err)
 	}
 
-	resolvedImg, err := osImgSrc.Resolve(ctx, img.Spec.Image)
-	if err != nil {
-		return fmt.Errorf("failed to resolve image ref in os image source: %w", err)
+	img.Status.ResolvedImage = img.Spec.Image
+	img.Status.ResolvedDigest = digest
+	if _, err := r.images.Update(ctx, img); err != nil {
+		return "", fmt.Errorf("failed to pin resolved image digest: %w", err)
 	}
+	log.V(2).Info("Pinned image digest", "digest", digest)
 
-	snapshotDigest := resolvedImg.Descriptor().Digest.String()
-	resolvedImageName := fmt.Sprintf("%s@%s", spec.Locator, snapshotDigest)
+	return digest, nil
+}
 
-	//TODO select later by label
-	snap, err := r.snapshots.Get(ctx, snapshotDigest)
+// backfillResolvedImage pins the digest of os image volumes whose snapshot was resolved before resolved digests were
+// pinned in the image status. Otherwise their snapshotRef would fail the validation as set together with the image.
+// Only snapshots populated from the os image of the image are taken as resolved from it. The returned image replaces
+// the given one.
+func (r *ImageReconciler) backfillResolvedImage(ctx context.Context, log logr.Logger, img *providerapi.Image) (*providerapi.Image, error) {
+	if img.Spec.Image == "" || img.Spec.SnapshotRef == nil || img.Status.ResolvedDigest != "" {
+		return img, nil
+	}
+
+	spec, err := reference.Parse(img.Spec.Image)
 	if err != nil {
-		switch {
-		case errors.Is(err, store.ErrNotFound):
-			log.V(2).Info("Create image snapshot", "SnapshotID", snapshotDigest)
-			snapshotLabels := map[string]string{
-				imageDigestLabel: snapshotDigest,
-			}
+		return img, nil
+	}
+	snap, err := r.snapshots.Get(ctx, *img.Spec.SnapshotRef)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return img, nil
+		}
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	if snap.Source.IronCoreImage != fmt.Sprintf("%s@%s", spec.Locator, snap.ID) {
+		return img, nil
+	}
+
+	img.Status.ResolvedImage = img.Spec.Image
+	img.Status.ResolvedDigest = snap.ID
+	if img, err = r.images.Update(ctx, img); err != nil {
+		return nil, fmt.Errorf("failed to pin resolved image digest: %w", err)
+	}
+	log.V(1).Info("Backfilled resolved image digest", "digest", snap.ID)
+	return img, nil
+}
+
+func (r *ImageReconciler) reconcileSnapshot(ctx context.Context, log logr.Logger, img *providerapi.Image) (retErr error) {
+	if img.Spec.Image == "" || img.Spec.SnapshotRef != nil {
+		return nil
+	}
+
+	ctx, span := r.startSpan(ctx, "reconcileSnapshot", r.imageSpanAttributes(img)...)
+	defer func() { endSpan(span, retErr) }()
+
+	log.V(2).Info("Parse image reference", "Image", img.Spec.Image)
+	spec, err := reference.Parse(img.Spec.Image)
+	if err != nil {
+		return &ResolveError{Permanent: true, Reason: "InvalidImageReference", Err: fmt.Errorf("failed to parse image reference: %w", err)}
+	}
+
+	snapshotDigest, err := r.resolveImageDigest(ctx, log, img)
+	if err != nil {
+		return err
+	}
+	resolvedImageName := fmt.Sprintf("%s@%s", spec.Locator, snapshotDigest)
+
+	// Snapshots of os images are stored under their digest, the image-digest label is informational.
+	snap, err := r.snapshots.Get(ctx, snapshotDigest)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			log.V(2).Info("Create image snapshot", "SnapshotID", snapshotDigest)
+			snapshotLabels := map[string]string{
+				imageDigestLabel: snapshotDigest,
+			}
 
 			if img.Spec.ImageArchitecture != nil {
 				snapshotLabels[providerapi.MachineArchitectureLabel] = *img.Spec.ImageArchitecture
@@ -490,14 +1254,14 @@ func (r *ImageReconciler) reconcileSnapshot(ctx context.Context, log logr.Logger
 	return nil
 }
 
-func (r *ImageReconciler) isImageExisting(ioCtx *rados.IOContext, imageID string) (bool, error) {
+func (r *ImageReconciler) isImageExisting(ioCtx *rados.IOContext, rbdName string) (bool, error) {
 	images, err := librbd.GetImageNames(ioCtx)
 	if err != nil {
 		return false, fmt.Errorf("failed to list images: %w", err)
 	}
 
 	for _, img := range images {
-		if ImageIDToRBDID(imageID) == img {
+		if rbdName == img {
 			return true, nil
 		}
 	}
@@ -505,28 +1269,152 @@ func (r *ImageReconciler) isImageExisting(ioCtx *rados.IOContext, imageID string
 	return false, nil
 }
 
+// needsResize reports whether an image of the current size has to be resized to the requested size.
+// Shrinking is refused unless explicitly allowed, as it discards data beyond the requested size.
+func needsResize(currentSize, requestedSize uint64, allowShrink bool) (bool, error) {
+	switch {
+	case currentSize == requestedSize:
+		return false, nil
+	case requestedSize < currentSize && !allowShrink:
+		return false, fmt.Errorf("refusing to shrink image from %d to %d bytes", currentSize, requestedSize)
+	default:
+		return true, nil
+	}
+}
+
+// imageResizer is the subset of rbd image operations used to ensure the size of an image.
+type imageResizer interface {
+	GetSize() (uint64, error)
+	Resize(size uint64) error
+}
+
+// ensureImageSize resizes the rbd image to the requested size of the image and reports whether it was resized.
+func (r *ImageReconciler) ensureImageSize(log logr.Logger, img imageResizer, image *providerapi.Image) (bool, error) {
+	currentSize, err := img.GetSize()
+	if err != nil {
+		return false, fmt.Errorf("failed to get image size: %w", err)
+	}
+
+	requestedSize, err := r.imageSize(image)
+	if err != nil {
+		return false, err
+	}
+
+	resize, err := needsResize(currentSize, requestedSize, image.Spec.AllowShrink)
+	if err != nil || !resize {
+		return false, err
+	}
+
+	if err := img.Resize(requestedSize); err != nil {
+		return false, fmt.Errorf("failed to resize rbd image: %w", err)
+	}
+	log.V(2).Info("Resized image", "bytes", requestedSize, "previousBytes", currentSize)
+	return true, nil
+}
+
+// adoptImage takes over an rbd image that was created by a previous reconcile which did not finish, e.g. because
+// the provider crashed before the image was available. The image is grown if it is smaller than requested.
+func (r *ImageReconciler) adoptImage(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	log.V(1).Info("Adopting existing rbd image")
+	img, err := openImage(ioCtx, RBDImageName(image))
+	if err != nil {
+		return err
+	}
+	defer closeImage(log, img)
+
+	if err := checkImageOwner(img, image); err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "AdoptImageFailed", "Failed to adopt existing image: %s", err)
+		return fmt.Errorf("failed to adopt existing image: %w", err)
+	}
+	if _, err := r.ensureImageSize(log, img, image); err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "AdoptImageFailed", "Failed to adopt existing image: %s", err)
+		return fmt.Errorf("failed to adopt existing image: %w", err)
+	}
+	return nil
+}
+
+// errImageNotOwned is returned if an existing rbd image was not created for the image that would adopt it.
+var errImageNotOwned = errors.New("rbd image was not created for the image")
+
+// setImageOwner marks the rbd image as created for the image, so that it can be adopted by it, see checkImageOwner.
+func setImageOwner(md imageMetadata, image *providerapi.Image) error {
+	if err := md.SetMetadata(OwnerKey, image.ID); err != nil {
+		return fmt.Errorf("failed to set owner of rbd image: %w", err)
+	}
+	return nil
+}
+
+// checkImageOwner checks that the existing rbd image was created for the image. rbd images created by others, e.g.
+// by an operator or a provider sharing the pool, must not be taken over. An rbd image without owner under the name
+// derived from the image id was created for the image by a reconcile interrupted before it set the owner, as custom
+// rbd names must not use the derived names. It is marked as created for the image.
+func checkImageOwner(md imageMetadata, image *providerapi.Image) error {
+	metadata, err := md.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list rbd image metadata: %w", err)
+	}
+	owner := metadata[OwnerKey]
+	if owner == "" && RBDImageName(image) == ImageIDToRBDID(image.ID) {
+		return setImageOwner(md, image)
+	}
+	if owner != image.ID {
+		return fmt.Errorf("%w: %s is %q", errImageNotOwned, OwnerKey, owner)
+	}
+	return nil
+}
+
+// markImageOwner opens the rbd image of the image and marks it as created for the image.
+func markImageOwner(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	img, err := openImage(ioCtx, RBDImageName(image))
+	if err != nil {
+		return err
+	}
+	defer closeImage(log, img)
+
+	return setImageOwner(img, image)
+}
+
 func (r *ImageReconciler) updateImage(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) (err error) {
 	log.V(2).Info("Updating image")
-	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
+	img, err := openImage(ioCtx, RBDImageName(image))
 	if err != nil {
 		return err
 	}
 	defer closeImage(log, img)
 
+	if err := r.syncImageLimits(log, img, image); err != nil {
+		return fmt.Errorf("failed to update limits: %w", err)
+	}
+
+	if err := r.syncImageLabels(log, img, image); err != nil {
+		return fmt.Errorf("failed to update labels: %w", err)
+	}
+
+	return r.resizeImage(ctx, log, img, image)
+}
+
+// resizeImage resizes the rbd image of an available image to its requested size. librbd notifies the clients that
+// have the image open of the new size, the resize is recorded in the image status for clients that watch the image
+// instead, e.g. to expand their filesystem.
+func (r *ImageReconciler) resizeImage(ctx context.Context, log logr.Logger, img imageResizer, image *providerapi.Image) error {
 	currentImageSize, err := img.GetSize()
 	if err != nil {
 		return fmt.Errorf("failed to get image size: %w", err)
 	}
 
-	requestedSize := round.OffBytes(image.Spec.Size)
+	requestedSize, err := r.provisionedImageSize(image)
+	if err != nil {
+		return err
+	}
 
-	switch {
-	case currentImageSize == requestedSize:
+	resize, err := needsResize(currentImageSize, requestedSize, image.Spec.AllowShrink)
+	if err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "UpdateImageSizeFailed", "Image shrink not allowed")
+		return err
+	}
+	if !resize {
 		log.V(2).Info("No update needed: Old and new image size same")
 		return nil
-	case requestedSize < currentImageSize:
-		r.Eventf(image.Metadata, corev1.EventTypeWarning, "UpdateImageSizeFailed", "Image shrink not supported")
-		return fmt.Errorf("failed to shrink image: not supported")
 	}
 
 	if err := img.Resize(requestedSize); err != nil {
@@ -535,22 +1423,166 @@ func (r *ImageReconciler) updateImage(ctx context.Context, log logr.Logger, ioCt
 	}
 
 	image.Status.Size = requestedSize
-	if _, err = r.images.Update(ctx, image); err != nil {
+	image.Status.ResizedAt = ptr.To(r.now())
+	updated, err := r.images.Update(ctx, image)
+	if err != nil {
 		return fmt.Errorf("failed to update size information of image: %w", err)
 	}
 	r.Eventf(image.Metadata, corev1.EventTypeNormal, "UpdatedImageSizeSucceeded", "Updated image size. requestedSize: %d currentSize: %d", requestedSize, currentImageSize)
+	r.emitLifecycleEvent(updated, ImageLifecycleResized)
 	log.V(1).Info("Updated image", "requestedSize", requestedSize, "currentSize", currentImageSize)
 	return nil
 }
 
+// checkRBDName checks that the requested custom rbd image name is valid and neither used by another image nor by an
+// existing rbd image of the target pool.
+func (r *ImageReconciler) checkRBDName(ctx context.Context, img *providerapi.Image) error {
+	if err := validateRBDName(img.Spec.RBDName); err != nil {
+		return err
+	}
+
+	images, err := r.images.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+	for _, other := range images {
+		if other.ID != img.ID && RBDImageName(other) == img.Spec.RBDName {
+			return fmt.Errorf("%w: %q is already used by image %s", ErrInvalidRBDName, img.Spec.RBDName, other.ID)
+		}
+	}
+
+	pool := r.imagePool(img)
+	if _, err := r.rbdImages.ImageSize(pool, img.Spec.RBDName); err == nil {
+		return fmt.Errorf("%w: rbd image %s/%s already exists", ErrInvalidRBDName, pool, img.Spec.RBDName)
+	} else if !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to check rbd image %s/%s: %w", pool, img.Spec.RBDName, err)
+	}
+	return nil
+}
+
+// validateImage checks that an image could be created from its spec without writing to ceph.
+func (r *ImageReconciler) validateImage(ctx context.Context, img *providerapi.Image) error {
+	if err := validateImageSpec(img); err != nil {
+		return err
+	}
+
+	if _, err := r.imageSize(img); err != nil {
+		return err
+	}
+
+	if _, err := imageObjectOrder(img.Spec); err != nil {
+		return err
+	}
+
+	if err := validateImageFormat(r.imageFormat, img); err != nil {
+		return err
+	}
+
+	if _, err := imageLimits(img); err != nil {
+		return err
+	}
+
+	if img.Spec.Mirroring != nil {
+		if _, err := imageMirrorMode(img.Spec.Mirroring.Mode); err != nil {
+			return err
+		}
+	}
+
+	for _, pool := range []string{r.pool, r.imageDataPool(img)} {
+		if _, err := r.cephClient.GetPoolByName(pool); err != nil {
+			return fmt.Errorf("failed to look up pool %s: %w", pool, err)
+		}
+	}
+
+	if snapshotRef := img.Spec.SnapshotRef; snapshotRef != nil {
+		if _, err := r.snapshots.Get(ctx, *snapshotRef); err != nil {
+			return fmt.Errorf("failed to resolve snapshot %s: %w", *snapshotRef, err)
+		}
+	} else if img.Spec.Image != "" {
+		if _, err := reference.Parse(img.Spec.Image); err != nil {
+			return fmt.Errorf("failed to parse image reference: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *ImageReconciler) reconcileImageDryRun(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
+	if img.DeletedAt != nil {
+		// Releasing the image without removing its rbd image would orphan the rbd image, it is deleted once the
+		// reconciler runs without dry run. The image keeps its reference to the snapshot it was created from until
+		// then, as its rbd image still depends on the snapshot.
+		log.V(1).Info("Not deleting image in dry run")
+		return nil
+	}
+
+	if img.Status.State == providerapi.ImageStateValidated || img.Status.State == providerapi.ImageStateFailed {
+		return nil
+	}
+
+	if err := r.validateImage(ctx, img); err != nil {
+		return fmt.Errorf("failed to validate image: %w", err)
+	}
+
+	img.Status.State = providerapi.ImageStateValidated
+	if _, err := r.images.Update(ctx, img); err != nil {
+		return fmt.Errorf("failed to update image state: %w", err)
+	}
+
+	log.V(1).Info("Successfully validated image")
+	return nil
+}
+
 func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
-	log := logr.FromContextOrDiscard(ctx)
-	ioCtx, err := r.conn.OpenIOContext(r.pool)
+	if r.dryRun {
+		return r.reconcileImageWithIOContext(ctx, nil, id)
+	}
+
+	if r.isImageReconciled(ctx, id) {
+		logr.FromContextOrDiscard(ctx).V(2).Info("Image is unchanged since its last reconcile, skipping", "imageId", id)
+		return nil
+	}
+
+	ioCtx, release, err := r.openIOContext(r.pool)
 	if err != nil {
 		return fmt.Errorf("unable to get io context: %w", err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
+	return r.reconcileImageWithIOContext(ctx, ioCtx, id)
+}
+
+// openIOContext opens an io context of the pool, borrowing it from the io context pool if pooling is enabled. The
+// returned func releases the io context.
+func (r *ImageReconciler) openIOContext(pool string) (*rados.IOContext, func(), error) {
+	if r.ioContexts != nil {
+		return r.ioContexts.Get(pool, r.namespace)
+	}
+
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(r.conns, pool, r.namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ioCtx, release, nil
+}
+
+// imageLogValues returns the logger key/values every log line of an image reconcile carries. The state and digest
+// are the ones the reconcile started with.
+func imageLogValues(pool string, img *providerapi.Image) []any {
+	return []any{
+		"pool", pool,
+		"snapshotRef", ptr.Deref(img.Spec.SnapshotRef, ""),
+		"digest", img.Status.Digest,
+		"state", img.Status.State,
+	}
+}
+
+// reconcileImageWithIOContext reconciles the image using the given io context, which is nil in dry run mode.
+func (r *ImageReconciler) reconcileImageWithIOContext(ctx context.Context, ioCtx *rados.IOContext, id string) (retErr error) {
+	ctx, span := r.startSpan(ctx, "reconcileImage", imageIDAttribute.String(id))
+	defer func() { endSpan(span, retErr) }()
+
+	log := logr.FromContextOrDiscard(ctx)
 	img, err := r.images.Get(ctx, id)
 	if err != nil {
 		if !errors.Is(err, store.ErrNotFound) {
@@ -559,6 +1591,23 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 		return nil
 	}
 
+	span.SetAttributes(r.imageSpanAttributes(img)...)
+	log = log.WithValues(imageLogValues(r.imagePool(img), img)...)
+	ctx = logr.NewContext(ctx, log)
+
+	if r.dryRun {
+		return r.reconcileImageDryRun(ctx, log, img)
+	}
+
+	if pool := r.imagePool(img); pool != r.pool {
+		poolIOCtx, release, err := r.openIOContext(pool)
+		if err != nil {
+			return fmt.Errorf("unable to get io context for pool %s: %w", pool, err)
+		}
+		defer release()
+		ioCtx = poolIOCtx
+	}
+
 	if img.DeletedAt != nil {
 		if err := r.deleteImage(ctx, log, ioCtx, img); err != nil {
 			return fmt.Errorf("failed to delete image: %w", err)
@@ -567,19 +1616,61 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 		return nil
 	}
 
-	if !slices.Contains(img.Finalizers, ImageFinalizer) {
-		img.Finalizers = append(img.Finalizers, ImageFinalizer)
-		if _, err := r.images.Update(ctx, img); err != nil {
+	if !r.hasFinalizer(img) {
+		if img.Spec.RBDName != "" {
+			if err := r.checkRBDName(ctx, img); err != nil {
+				return err
+			}
+			img.Status.RBDName = img.Spec.RBDName
+		}
+		img.Finalizers = append(img.Finalizers, r.finalizer)
+		img.Status.CreatedAt = ptr.To(r.now())
+		img, err = r.images.Update(ctx, img)
+		if err != nil {
 			return fmt.Errorf("failed to set finalizers: %w", err)
 		}
+		r.emitLifecycleEvent(img, ImageLifecycleCreated)
+		return nil
+	}
+
+	if img.Status.State == providerapi.ImageStateFailed {
+		log.V(1).Info("Image is in failed state, skipping reconciliation", "lastError", img.Status.LastError)
 		return nil
 	}
 
+	// Images are validated before they are created, so that invalid specs fail fast instead of deep inside the
+	// reconcile. Available images are not failed by specs that became invalid since, but changes of their immutable
+	// fields are refused.
+	if img.Status.State != providerapi.ImageStateAvailable {
+		if img, err = r.backfillResolvedImage(ctx, log, img); err != nil {
+			return err
+		}
+		if err := validateImageSpec(img); err != nil {
+			return err
+		}
+	} else {
+		if img, err = r.backfillSnapshotRef(ctx, log, img); err != nil {
+			return err
+		}
+		var violated bool
+		if img, violated, err = r.enforceImmutableFields(ctx, log, img); err != nil || violated {
+			return err
+		}
+	}
+
+	if err := r.assignWWN(ctx, log, img); err != nil {
+		return fmt.Errorf("failed to assign wwn: %w", err)
+	}
+
 	if err := r.reconcileSnapshot(ctx, log, img); err != nil {
 		return fmt.Errorf("failed to reconcile snapshot: %w", err)
 	}
 
-	imageExists, err := r.isImageExisting(ioCtx, img.ID)
+	if err := r.addSnapshotRef(ctx, log, img); err != nil {
+		return err
+	}
+
+	imageExists, err := r.isImageExisting(ioCtx, RBDImageName(img))
 	if err != nil {
 		return fmt.Errorf("failed to check image existence: %w", err)
 	}
@@ -590,25 +1681,58 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 			if err := r.updateImage(ctx, log, ioCtx, img); err != nil {
 				return fmt.Errorf("failed to update image: %w", err)
 			}
-			return nil
+			if err := r.migrateImageIfRequested(ctx, log, img); err != nil {
+				return fmt.Errorf("failed to migrate image: %w", err)
+			}
+			return r.recordReconciledSpec(ctx, img)
+		}
+		if err := r.adoptImage(log, ioCtx, img); err != nil {
+			return err
 		}
 	} else {
-		options := librbd.NewRbdImageOptions()
-		defer options.Destroy()
-		if err := options.SetString(librbd.ImageOptionDataPool, r.pool); err != nil {
-			return fmt.Errorf("failed to set data pool: %w", err)
+		options, err := r.newImageOptions(img)
+		if err != nil {
+			return fmt.Errorf("failed to configure image options: %w", err)
 		}
-		log.V(2).Info("Configured pool", "pool", r.pool)
+		defer options.Destroy()
+		log.V(2).Info("Configured image options", "pool", r.pool, "features", img.Spec.Features)
 
 		switch {
+		case img.Spec.TemplateRef != nil:
+			log.V(2).Info("Creating image from template", "templateId", *img.Spec.TemplateRef)
+			conditions := slices.Clone(img.Status.Conditions)
+			ok, err := r.createImageFromTemplate(ctx, log, ioCtx, img, *img.Spec.TemplateRef, options)
+			if err != nil {
+				return fmt.Errorf("failed to create image from template: %w", err)
+			}
+			if !ok {
+				if slices.Equal(conditions, img.Status.Conditions) {
+					return nil
+				}
+				if _, err := r.images.Update(ctx, img); err != nil {
+					return fmt.Errorf("failed to update image conditions: %w", err)
+				}
+				return nil
+			}
+
 		case img.Spec.SnapshotRef != nil:
 			snapshotRef := img.Spec.SnapshotRef
+			if img.Spec.StripeUnit != 0 || img.Spec.StripeCount != 0 {
+				log.Info("Stripe settings are ignored for images cloned from a snapshot, cloned images inherit the parent geometry")
+			}
 			log.V(2).Info("Creating image from snapshot", "snapshotId", *snapshotRef)
+			conditions := slices.Clone(img.Status.Conditions)
 			ok, err := r.createImageFromSnapshot(ctx, log, ioCtx, img, *snapshotRef, options)
 			if err != nil {
 				return fmt.Errorf("failed to create image from snapshot: %w", err)
 			}
 			if !ok {
+				if slices.Equal(conditions, img.Status.Conditions) {
+					return nil
+				}
+				if _, err := r.images.Update(ctx, img); err != nil {
+					return fmt.Errorf("failed to update image conditions: %w", err)
+				}
 				return nil
 			}
 
@@ -618,6 +1742,14 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 				return fmt.Errorf("failed to create empty image: %w", err)
 			}
 		}
+		r.emitLifecycleEvent(img, ImageLifecyclePopulating)
+	}
+
+	if provisioned, err := r.thickProvisionImage(ctx, log, img); err != nil || !provisioned {
+		if err != nil {
+			return fmt.Errorf("failed to thick-provision image: %w", err)
+		}
+		return nil
 	}
 
 	if err := r.setWWN(log, ioCtx, img); err != nil {
@@ -633,22 +1765,40 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 		return fmt.Errorf("failed to set limits: %w", err)
 	}
 
-	user, key, err := r.fetchAuth(log)
+	if err := r.setImageMirroring(log, ioCtx, img); err != nil {
+		return fmt.Errorf("failed to set mirroring: %w", err)
+	}
+
+	if err := r.setImageLabels(log, ioCtx, img); err != nil {
+		return fmt.Errorf("failed to set labels: %w", err)
+	}
+
+	user, key, err := r.imageCredentials(ctx, log, img)
 	if err != nil {
 		return fmt.Errorf("failed to fetch credentials: %w", err)
 	}
 
-	img.Status.Access = &providerapi.ImageAccess{
-		Monitors: r.monitors,
-		Handle:   fmt.Sprintf("%s/%s", r.pool, ImageIDToRBDID(img.ID)),
-		User:     user,
-		UserKey:  key,
+	img.Status.Access = r.imageAccess(img, user, key)
+	size, err := r.imageSize(img)
+	if err != nil {
+		return err
+	}
+
+	specHash, err := r.imageSpecHash(img)
+	if err != nil {
+		return err
 	}
+
 	img.Status.State = providerapi.ImageStateAvailable
-	img.Status.Size = round.OffBytes(img.Spec.Size)
-	if _, err = r.images.Update(ctx, img); err != nil {
+	img.Status.Size = size
+	img.Status.SnapshotRef = ptr.Deref(img.Spec.SnapshotRef, "")
+	img.Status.ReconciledSpecHash = specHash
+	r.recordProvisioningDuration(img)
+	img, err = r.images.Update(ctx, img)
+	if err != nil {
 		return fmt.Errorf("failed to update image metadate: %w", err)
 	}
+	r.emitLifecycleEvent(img, ImageLifecycleAvailable)
 
 	log.V(1).Info("Successfully reconciled image")
 
@@ -656,67 +1806,136 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 }
 
 func (r *ImageReconciler) setImageLimits(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
-	if len(image.Spec.Limits) <= 0 {
+	limits, err := imageLimits(image)
+	if err != nil {
+		return err
+	}
+	if len(limits) <= 0 {
 		return nil
 	}
 
 	log.V(1).Info("Configuring limits")
-	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
+	img, err := openImage(ioCtx, RBDImageName(image))
 	if err != nil {
 		return err
 	}
 	defer closeImage(log, img)
 
-	for limit, value := range image.Spec.Limits {
-		if err := img.SetMetadata(fmt.Sprintf("%s%s", LimitMetadataPrefix, limit), strconv.FormatInt(value, 10)); err != nil {
-			r.Eventf(image.Metadata, corev1.EventTypeNormal, "SetImageLimitFailed", "Failed to set image limit: %s", err)
-			return fmt.Errorf("failed to set limit (%s): %w", limit, err)
-		}
-		r.Eventf(image.Metadata, corev1.EventTypeNormal, "SetImageLimitSucceeded", "Image limit set. limit: %s value: %d", limit, value)
-		log.V(3).Info("Set image limit", "limit", limit, "value", value)
+	current, err := img.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list image metadata: %w", err)
+	}
+
+	set := make(map[string]string, len(limits))
+	for limit, value := range limits {
+		set[limitMetadataKey(limit)] = strconv.FormatInt(value, 10)
+	}
+	if err := applyLimits(log, img, current, set, nil); err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeNormal, "SetImageLimitFailed", "Failed to set image limits: %s", err)
+		return err
 	}
 
+	for limit, value := range limits {
+		r.Eventf(image.Metadata, corev1.EventTypeNormal, "SetImageLimitSucceeded", "Image limit set. limit: %s value: %d", limit, value)
+	}
 	return nil
 }
 
 func (r *ImageReconciler) setWWN(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
 	log.V(1).Info("Setting WWN")
-	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
+	img, err := openImage(ioCtx, RBDImageName(image))
 	if err != nil {
 		return err
 	}
 	defer closeImage(log, img)
 
-	if err := img.SetMetadata(WWNKey, image.Spec.WWN); err != nil {
-		return fmt.Errorf("failed to set wwn (%s): %w", image.Spec.WWN, err)
+	wwn := image.GetWWN()
+	if err := img.SetMetadata(WWNKey, wwn); err != nil {
+		return fmt.Errorf("failed to set wwn (%s): %w", wwn, err)
 	}
-	log.V(3).Info("Set image wwn", "wwn", image.Spec.WWN)
+	log.V(3).Info("Set image wwn", "wwn", wwn)
 
 	return nil
 }
 
+func encryptionFormatOptions(format providerapi.EncryptionFormat, passphrase []byte) (librbd.EncryptionOptions, error) {
+	switch format {
+	case providerapi.EncryptionFormatLUKS1:
+		return librbd.EncryptionOptionsLUKS1{
+			Alg:        librbd.EncryptionAlgorithmAES256,
+			Passphrase: passphrase,
+		}, nil
+	case "", providerapi.EncryptionFormatLUKS2:
+		return librbd.EncryptionOptionsLUKS2{
+			Alg:        librbd.EncryptionAlgorithmAES256,
+			Passphrase: passphrase,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported encryption format %q", format)
+	}
+}
+
+// isParentEncrypted reports whether the image is cloned from a snapshot of an image whose encryption header is
+// already set. Such clones inherit the header and must not be formatted again.
+func (r *ImageReconciler) isParentEncrypted(ctx context.Context, image *providerapi.Image) (bool, error) {
+	if image.Spec.SnapshotRef == nil {
+		return false, nil
+	}
+
+	snapshot, err := r.snapshots.Get(ctx, *image.Spec.SnapshotRef)
+	if err != nil {
+		return false, store.IgnoreErrNotFound(err)
+	}
+
+	if snapshot.Source.VolumeImageID == "" || snapshot.Source.VolumeImageID == image.ID {
+		return false, nil
+	}
+
+	parent, err := r.images.Get(ctx, snapshot.Source.VolumeImageID)
+	if err != nil {
+		return false, store.IgnoreErrNotFound(err)
+	}
+
+	return parent.Status.Encryption == providerapi.EncryptionStateHeaderSet, nil
+}
+
 func (r *ImageReconciler) setEncryptionHeader(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
 	if image.Spec.Encryption == nil || image.Spec.Encryption.Type == "" || image.Spec.Encryption.Type == providerapi.EncryptionTypeUnencrypted || image.Status.Encryption == providerapi.EncryptionStateHeaderSet {
 		return nil
 	}
 
-	log.V(1).Info("Configuring encryption")
-	passphrase, err := r.keyEncryption.Decrypt(image.Spec.Encryption.EncryptedPassphrase)
+	parentEncrypted, err := r.isParentEncrypted(ctx, image)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt passphrase: %w", err)
+		return fmt.Errorf("failed to check parent encryption: %w", err)
 	}
 
-	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
-	if err != nil {
-		return err
-	}
-	defer closeImage(log, img)
+	if parentEncrypted {
+		log.V(1).Info("Image inherits the encryption header of its parent")
+	} else {
+		log.V(1).Info("Configuring encryption", "format", image.Spec.Encryption.Format)
+		if len(image.Spec.Encryption.EncryptedPassphrase) == 0 {
+			return fmt.Errorf("encryption enabled but passphrase missing")
+		}
+
+		passphrase, err := r.keyEncryption.Decrypt(image.Spec.Encryption.EncryptedPassphrase)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt passphrase: %w", err)
+		}
 
-	if err := img.EncryptionFormat(librbd.EncryptionOptionsLUKS2{
-		Alg:        librbd.EncryptionAlgorithmAES256,
-		Passphrase: passphrase,
-	}); err != nil {
-		return fmt.Errorf("failed to set encryption format: %w", err)
+		encryptionOptions, err := encryptionFormatOptions(image.Spec.Encryption.Format, passphrase)
+		if err != nil {
+			return err
+		}
+
+		img, err := openImage(ioCtx, RBDImageName(image))
+		if err != nil {
+			return err
+		}
+		defer closeImage(log, img)
+
+		if err := img.EncryptionFormat(encryptionOptions); err != nil {
+			return fmt.Errorf("failed to set encryption format: %w", err)
+		}
 	}
 
 	image.Status.Encryption = providerapi.EncryptionStateHeaderSet
@@ -728,36 +1947,158 @@ func (r *ImageReconciler) setEncryptionHeader(ctx context.Context, log logr.Logg
 	return nil
 }
 
+// imageSize returns the requested size of the image rounded by the configured strategy.
+func (r *ImageReconciler) imageSize(image *providerapi.Image) (uint64, error) {
+	size, err := r.sizeRounding.Round(image.Spec.Size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid image size %d: %w", image.Spec.Size, err)
+	}
+	return size, nil
+}
+
+// provisionedImageSize returns the size an available image should have. Rounding only applies to requests the
+// provisioned size does not satisfy yet, so changing the rounding strategy does not grow provisioned images.
+func (r *ImageReconciler) provisionedImageSize(image *providerapi.Image) (uint64, error) {
+	size, err := r.imageSize(image)
+	if err != nil {
+		return 0, err
+	}
+	if image.Spec.Size <= image.Status.Size && size > image.Status.Size {
+		return image.Status.Size, nil
+	}
+	return size, nil
+}
+
 func (r *ImageReconciler) createEmptyImage(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image, options *librbd.ImageOptions) error {
-	if err := librbd.CreateImage(ioCtx, ImageIDToRBDID(image.ID), round.OffBytes(image.Spec.Size), options); err != nil {
+	size, err := r.imageSize(image)
+	if err != nil {
+		return err
+	}
+
+	if err := librbd.CreateImage(ioCtx, RBDImageName(image), size, options); err != nil {
+		if errors.Is(err, librbd.ErrExist) {
+			return r.adoptImage(log, ioCtx, image)
+		}
 		r.Eventf(image.Metadata, corev1.EventTypeWarning, "EmptyImageCreationFailed", "Empty image creation failed: %s", err)
 		return fmt.Errorf("failed to create rbd image: %w", err)
 	}
+	if err := markImageOwner(log, ioCtx, image); err != nil {
+		return err
+	}
 	r.Eventf(image.Metadata, corev1.EventTypeNormal, "EmptyImageCreationSucceeded", "Created empty image. bytes: %d", image.Spec.Size)
 	log.V(2).Info("Created empty image", "bytes", image.Spec.Size)
 
 	return nil
 }
 
-func (r *ImageReconciler) createImageFromSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image, snapshotRef string, options *librbd.ImageOptions) (bool, error) {
+// getPopulatedSnapshot returns the referenced snapshot if it is populated and can be cloned. Otherwise, the
+// SnapshotReady condition of the image is set to explain why the image is still pending.
+func (r *ImageReconciler) getPopulatedSnapshot(ctx context.Context, log logr.Logger, image *providerapi.Image, snapshotRef string) (*providerapi.Snapshot, error) {
 	snapshot, err := r.snapshots.Get(ctx, snapshotRef)
 	if err != nil {
 		if !errors.Is(err, store.ErrNotFound) {
-			return false, fmt.Errorf("failed to get snapshot: %w", err)
+			return nil, fmt.Errorf("failed to get snapshot: %w", err)
 		}
 
 		log.V(1).Info("snapshot not found", "snapshotId", snapshotRef)
-		return false, nil
+		image.Status.SetCondition(providerapi.ImageCondition{
+			Type:    providerapi.ImageConditionSnapshotReady,
+			Status:  providerapi.ConditionFalse,
+			Reason:  "SnapshotNotFound",
+			Message: fmt.Sprintf("snapshot %s not found", snapshotRef),
+		})
+		r.requeueWaitingImage(log, image)
+		return nil, nil
 	}
 
 	if snapshot.Status.Size > int64(image.Spec.Size) {
 		r.Eventf(image.Metadata, corev1.EventTypeWarning, "ImageSizeIsSmallerThanSnapshotSize", "image %s size is smaller than snapshot size: %d < %d", image.ID, image.Spec.Size, snapshot.Status.Size)
-		return false, fmt.Errorf("image %s size is smaller than snapshot size: (%d < %d)", image.ID, image.Spec.Size, snapshot.Status.Size)
+		return nil, fmt.Errorf("image %s size is smaller than snapshot size: (%d < %d)", image.ID, image.Spec.Size, snapshot.Status.Size)
 	}
 
 	if snapshot.Status.State != providerapi.SnapshotStateReady && snapshot.Status.State != providerapi.SnapshotStatePopulated {
 		log.V(1).Info("snapshot is not populated", "state", snapshot.Status.State)
-		return false, nil
+		image.Status.SetCondition(providerapi.ImageCondition{
+			Type:    providerapi.ImageConditionSnapshotReady,
+			Status:  providerapi.ConditionFalse,
+			Reason:  "SnapshotPopulating",
+			Message: fmt.Sprintf("snapshot %s is in state %s", snapshotRef, snapshot.Status.State),
+		})
+		r.requeueWaitingImage(log, image)
+		return nil, nil
+	}
+
+	image.Status.RemoveCondition(providerapi.ImageConditionSnapshotReady)
+	return snapshot, nil
+}
+
+// requeueWaitingImage requeues the image waiting for its snapshot or template after the source requeue interval.
+func (r *ImageReconciler) requeueWaitingImage(log logr.Logger, image *providerapi.Image) {
+	log.V(2).Info("Requeueing image waiting for its source", "after", r.sourceRequeueInterval)
+	r.queue.AddAfter(image.ID, r.sourceRequeueInterval)
+}
+
+// errSnapshotParentNotFound is returned if the rbd snapshot an image should be cloned from does not exist.
+var errSnapshotParentNotFound = errors.New("rbd parent snapshot not found")
+
+// handleMissingParentSnapshot handles a snapshot whose rbd snapshot was removed out-of-band. Snapshots of os images
+// and URLs are reset to pending, so the snapshot reconciler populates them again, snapshots of volumes are marked as
+// failed.
+func (r *ImageReconciler) handleMissingParentSnapshot(ctx context.Context, log logr.Logger, image *providerapi.Image, snapshot *providerapi.Snapshot, parentName, snapName string) error {
+	state := providerapi.SnapshotStateFailed
+	if snapshot.Source.PopulatesImage() {
+		state = providerapi.SnapshotStatePending
+	}
+	log.V(1).Info("Rbd parent snapshot does not exist", "parentName", parentName, "snapshotName", snapName, "snapshotState", state)
+
+	snapshot.Status.State = state
+	snapshot.Status.PopulateProgress = 0
+	if _, err := r.snapshots.Update(ctx, snapshot); store.IgnoreErrNotFound(err) != nil {
+		return fmt.Errorf("failed to update snapshot state: %w", err)
+	}
+
+	image.Status.SetCondition(providerapi.ImageCondition{
+		Type:    providerapi.ImageConditionSnapshotReady,
+		Status:  providerapi.ConditionFalse,
+		Reason:  "SnapshotParentNotFound",
+		Message: fmt.Sprintf("rbd snapshot %s@%s not found, snapshot %s is %s", parentName, snapName, snapshot.ID, state),
+	})
+	// Clones of snapshots of deleted images are created before they are stored.
+	if _, err := r.images.Update(ctx, image); store.IgnoreErrNotFound(err) != nil {
+		return fmt.Errorf("failed to update image conditions: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeWarning, "SnapshotParentNotFound", "Rbd snapshot %s@%s of snapshot %s not found", parentName, snapName, snapshot.ID)
+
+	return fmt.Errorf("%w: %s@%s of snapshot %s", errSnapshotParentNotFound, parentName, snapName, snapshot.ID)
+}
+
+// rbdParentSnapshots ensures the protection of the rbd snapshots images are cloned from, as cloning from an
+// unprotected snapshot fails.
+type rbdParentSnapshots interface {
+	// EnsureProtected protects the snapshot of the rbd image if it isn't protected yet and reports whether it exists.
+	EnsureProtected(log logr.Logger, ioCtx *rados.IOContext, imageName, snapName string) (bool, error)
+}
+
+type librbdParentSnapshots struct{}
+
+func (librbdParentSnapshots) EnsureProtected(log logr.Logger, ioCtx *rados.IOContext, imageName, snapName string) (bool, error) {
+	exists, protected, err := snapshotExistsAndProtected(log, ioCtx, imageName, snapName)
+	if err != nil || !exists || protected {
+		return exists, err
+	}
+	if err := protectSnapshot(log, ioCtx, imageName, snapName); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (r *ImageReconciler) createImageFromSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image, snapshotRef string, options *librbd.ImageOptions) (_ bool, retErr error) {
+	ctx, span := r.startSpan(ctx, "createImageFromSnapshot", r.imageSpanAttributes(image)...)
+	defer func() { endSpan(span, retErr) }()
+
+	snapshot, err := r.getPopulatedSnapshot(ctx, log, image, snapshotRef)
+	if err != nil || snapshot == nil {
+		return false, err
 	}
 
 	parentName, snapName, err := getSnapshotSourceDetails(snapshot)
@@ -766,50 +2107,99 @@ func (r *ImageReconciler) createImageFromSnapshot(ctx context.Context, log logr.
 	}
 
 	log.V(2).Info("Check if rbd snapshot exists", "snapshotId", snapName)
-	isSnapshotExist, isSnapshotProtected, err := snapshotExistsAndProtected(log, ioCtx, parentName, snapName)
+	isSnapshotExist, err := r.parentSnapshots.EnsureProtected(log, ioCtx, parentName, snapName)
 	if err != nil {
-		return false, fmt.Errorf("failed to check volume image snapshot existence: %w", err)
-	}
-	if isSnapshotExist && !isSnapshotProtected {
-		if err := protectSnapshot(log, ioCtx, parentName, snapName); err != nil {
-			return false, fmt.Errorf("failed to protect snapshot %s: %w", snapName, err)
-		}
-		isSnapshotExist = true
+		return false, fmt.Errorf("failed to ensure protection of snapshot %s: %w", snapName, err)
 	}
 	if !isSnapshotExist {
-		log.V(1).Info("Rbd snapshot does not exist. Mark snapshot as failed", "snapshotName", snapName)
-		snapshot.Status.State = providerapi.SnapshotStateFailed
-		if _, err := r.snapshots.Update(ctx, snapshot); store.IgnoreErrNotFound(err) != nil {
-			return false, fmt.Errorf("failed to update snapshot state: %w", err)
-		}
-		return false, nil
+		return false, r.handleMissingParentSnapshot(ctx, log, image, snapshot, parentName, snapName)
 	}
 	log.V(2).Info("Checked rbd snapshot existence", "snapshotId", snapName, "isSnapshotExist", isSnapshotExist)
 
-	ioCtx2, err := r.conn.OpenIOContext(r.pool)
+	img, err := r.cloneImage(log, ioCtx, image, r.pool, parentName, snapName, options)
 	if err != nil {
-		return false, fmt.Errorf("unable to get io context: %w", err)
+		if errors.Is(err, errSnapshotParentNotFound) {
+			return false, r.handleMissingParentSnapshot(ctx, log, image, snapshot, parentName, snapName)
+		}
+		return false, err
+	}
+	defer closeImage(log, img)
+
+	if err := setImageDigest(log, img, image, snapshot.Status.Digest); err != nil {
+		return false, err
 	}
-	defer ioCtx2.Destroy()
+
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "CreateImageFromSnapshotSucceeded", "Created image from snapshot. bytes: %d", image.Spec.Size)
+	return true, nil
+}
+
+// setImageDigest records the digest of the snapshot the image was cloned from as rbd image metadata and in the status
+// of the image. Snapshots without digest, e.g. the ones of volume images, are not recorded.
+func setImageDigest(log logr.Logger, md imageMetadata, image *providerapi.Image, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	if err := md.SetMetadata(DigestKey, digest); err != nil {
+		return fmt.Errorf("failed to set digest (%s): %w", digest, err)
+	}
+	image.Status.Digest = digest
+	log.V(3).Info("Set image digest", "digest", digest)
+	return nil
+}
+
+// cloneImage clones the rbd image of the image from the snapshot of the parent rbd image in the parent pool and
+// ensures the size and flattening of the clone. The clone of a previous reconcile is adopted. It returns an error
+// wrapping errSnapshotParentNotFound if the parent snapshot doesn't exist. The returned rbd image has to be closed.
+func (r *ImageReconciler) cloneImage(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image, parentPool, parentName, snapName string, options *librbd.ImageOptions) (*librbd.Image, error) {
+	parentIOCtx, releaseParent, err := ceph.OpenNamespacedIOContext(r.conns, parentPool, r.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer releaseParent()
 
 	log.V(1).Info("Cloning Image", "ParentName", parentName, "SnapName", snapName, "ImageID", image.ID)
-	if err = librbd.CloneImage(ioCtx2, parentName, snapName, ioCtx, ImageIDToRBDID(image.ID), options); err != nil {
-		r.Eventf(image.Metadata, corev1.EventTypeWarning, "CreateImageFromSnapshotFailed", "Failed to clone rbd image: %s", err)
-		return false, fmt.Errorf("failed to clone rbd image: %w", err)
+	adopted := false
+	if err = librbd.CloneImage(parentIOCtx, parentName, snapName, ioCtx, RBDImageName(image), options); err != nil {
+		switch {
+		case errors.Is(err, librbd.ErrExist):
+			// The clone of a previous reconcile is adopted, its size, flattening and digest are ensured below.
+			log.V(1).Info("Adopting existing clone")
+			adopted = true
+		case errors.Is(err, librbd.ErrNotFound):
+			return nil, fmt.Errorf("%w: %s@%s", errSnapshotParentNotFound, parentName, snapName)
+		default:
+			r.Eventf(image.Metadata, corev1.EventTypeWarning, "CreateImageFromSnapshotFailed", "Failed to clone rbd image: %s", err)
+			return nil, fmt.Errorf("failed to clone rbd image: %w", err)
+		}
+	} else {
+		log.V(2).Info("Cloned image")
 	}
-	log.V(2).Info("Cloned image")
 
-	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
+	img, err := openImage(ioCtx, RBDImageName(image))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	defer closeImage(log, img)
 
-	if err := img.Resize(round.OffBytes(image.Spec.Size)); err != nil {
-		return false, fmt.Errorf("failed to resize rbd image: %w", err)
+	if adopted {
+		err = checkImageOwner(img, image)
+	} else {
+		err = setImageOwner(img, image)
+	}
+	if err != nil {
+		closeImage(log, img)
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "CreateImageFromSnapshotFailed", "Failed to adopt existing clone: %s", err)
+		return nil, err
 	}
-	log.V(2).Info("Resized cloned image", "bytes", image.Spec.Size)
 
-	r.Eventf(image.Metadata, corev1.EventTypeNormal, "CreateImageFromSnapshotSucceeded", "Created image from snapshot. bytes: %d", image.Spec.Size)
-	return true, nil
+	if _, err := r.ensureImageSize(log, img, image); err != nil {
+		closeImage(log, img)
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "CreateImageFromSnapshotFailed", "Failed to resize cloned image: %s", err)
+		return nil, err
+	}
+
+	if err := r.flattenCloneIfRequired(log, parentIOCtx, img, parentName, image); err != nil {
+		closeImage(log, img)
+		return nil, err
+	}
+	return img, nil
 }
@@ -0,0 +1,1270 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/containerd/containerd/errdefs"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/replay"
+	"github.com/ironcore-dev/ceph-provider/internal/round"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	eventrecorder "github.com/ironcore-dev/provider-utils/eventutils/recorder"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/utils/ptr"
+)
+
+type noopEncryptor struct{}
+
+func (noopEncryptor) Encrypt(key []byte) ([]byte, error)          { return key, nil }
+func (noopEncryptor) Decrypt(encryptedKey []byte) ([]byte, error) { return encryptedKey, nil }
+
+type fakeCephClient struct {
+	delay    time.Duration
+	response []byte
+	// responses and errs override the response of the commands with the prefix.
+	responses map[string][]byte
+	errs      map[string]error
+	pools     []string
+	calls     atomic.Int32
+
+	mu       sync.Mutex
+	commands [][]byte
+}
+
+func (f *fakeCephClient) GetPoolByName(name string) (int64, error) {
+	if idx := slices.Index(f.pools, name); idx >= 0 {
+		return int64(idx), nil
+	}
+	return 0, rados.ErrNotFound
+}
+
+func (f *fakeCephClient) MonCommand(args []byte) ([]byte, string, error) {
+	f.calls.Add(1)
+	f.mu.Lock()
+	f.commands = append(f.commands, args)
+	f.mu.Unlock()
+	time.Sleep(f.delay)
+
+	var cmd struct {
+		Prefix string `json:"prefix"`
+	}
+	_ = json.Unmarshal(args, &cmd)
+	if err, ok := f.errs[cmd.Prefix]; ok {
+		return nil, "", err
+	}
+	if response, ok := f.responses[cmd.Prefix]; ok {
+		return response, "", nil
+	}
+	return f.response, "", nil
+}
+
+type fakeImageResolver struct {
+	digest string
+	calls  atomic.Int32
+}
+
+func (f *fakeImageResolver) Resolve(ctx context.Context, platform *ocispec.Platform, ref string) (string, error) {
+	f.calls.Add(1)
+	return f.digest, nil
+}
+
+// failingCreateStore fails the first creations of objects.
+type failingCreateStore[E apiutils.Object] struct {
+	store.Store[E]
+	failures int
+}
+
+func (s *failingCreateStore[E]) Create(ctx context.Context, obj E) (E, error) {
+	if s.failures > 0 {
+		s.failures--
+		var zero E
+		return zero, errors.New("failed to create object")
+	}
+	return s.Store.Create(ctx, obj)
+}
+
+// recordingConnAccessor records the errors reported back to the connection accessor.
+type recordingConnAccessor struct {
+	ceph.ConnAccessor
+	observed []error
+}
+
+func (a *recordingConnAccessor) ObserveError(err error) {
+	a.observed = append(a.observed, err)
+}
+
+type fakeImageResizer struct {
+	size      uint64
+	resizeErr error
+	resizes   []uint64
+}
+
+func (f *fakeImageResizer) GetSize() (uint64, error) {
+	return f.size, nil
+}
+
+func (f *fakeImageResizer) Resize(size uint64) error {
+	if f.resizeErr != nil {
+		return f.resizeErr
+	}
+	f.resizes = append(f.resizes, size)
+	f.size = size
+	return nil
+}
+
+func newTestImageReconciler(opts ImageReconcilerOptions) (*ImageReconciler, error) {
+	images := newMemoryStore[*providerapi.Image]()
+	snapshots := newMemoryStore[*providerapi.Snapshot]()
+
+	imageEvents, err := event.NewListWatchSource[*providerapi.Image](images.List, images.Watch, event.ListWatchSourceOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	snapshotEvents, err := event.NewListWatchSource[*providerapi.Snapshot](snapshots.List, snapshots.Watch, event.ListWatchSourceOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	if opts.Pool == "" {
+		opts.Pool = "pool"
+	}
+	if opts.Monitors == "" {
+		opts.Monitors = "10.0.0.1:6789"
+	}
+	if opts.Client == "" {
+		opts.Client = "client.volumes"
+	}
+
+	return NewImageReconciler(
+		logr.Discard(),
+		ceph.StaticConn(&rados.Conn{}),
+		images,
+		snapshots,
+		eventrecorder.NewEventStore(logr.Discard(), eventrecorder.EventStoreOptions{}),
+		imageEvents,
+		snapshotEvents,
+		noopEncryptor{},
+		opts,
+	)
+}
+
+var _ = Describe("ImageReconciler", func() {
+	Context("NewImageReconciler", func() {
+		// expectConcurrentReconciles starts the reconciler with more queued images than workers and asserts that
+		// exactly workers images are reconciled at once.
+		expectConcurrentReconciles := func(ctx SpecContext, opts ImageReconcilerOptions, workers int) {
+			GinkgoHelper()
+			r, err := newTestImageReconciler(opts)
+			Expect(err).NotTo(HaveOccurred())
+
+			var running, maximum atomic.Int32
+			release := make(chan struct{})
+			r.reconcile = func(ctx context.Context, id string) error {
+				current := running.Add(1)
+				defer running.Add(-1)
+				for {
+					if prev := maximum.Load(); current <= prev || maximum.CompareAndSwap(prev, current) {
+						break
+					}
+				}
+				<-release
+				return nil
+			}
+
+			startCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() { done <- r.Start(startCtx) }()
+
+			for i := range workers + 2 {
+				r.queue.Add(fmt.Sprintf("img-%d", i))
+			}
+			Eventually(running.Load).Should(BeEquivalentTo(workers))
+			Consistently(running.Load, 50*time.Millisecond).Should(BeEquivalentTo(workers))
+
+			close(release)
+			Eventually(r.queue.Len).Should(BeZero())
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(maximum.Load()).To(BeEquivalentTo(workers))
+		}
+
+		It("should reconcile as many images at once as the configured worker size", func(ctx SpecContext) {
+			expectConcurrentReconciles(ctx, ImageReconcilerOptions{WorkerSize: 3}, 3)
+		})
+
+		It("should fall back to the default worker size", func(ctx SpecContext) {
+			expectConcurrentReconciles(ctx, ImageReconcilerOptions{}, DefaultWorkerSize)
+		})
+
+		It("should use the configured rbd namespace", func() {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{Namespace: "tenant"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.namespace).To(Equal("tenant"))
+		})
+
+		It("should reject an invalid rbd namespace", func() {
+			_, err := newTestImageReconciler(ImageReconcilerOptions{Namespace: "tenant/a"})
+			Expect(err).To(MatchError(ContainSubstring("rbd namespace")))
+		})
+
+		It("should reject a negative worker size", func() {
+			_, err := newTestImageReconciler(ImageReconcilerOptions{WorkerSize: -1})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("handleReconcileError", func() {
+		It("should mark the image as failed after the configured retries", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{MaxReconcileRetries: 2})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			cloneErr := errors.New("failed to clone rbd image")
+			for range 2 {
+				r.handleReconcileError(ctx, logr.Discard(), "foo", cloneErr)
+				img, err := r.images.Get(ctx, "foo")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(img.Status.State).To(Equal(providerapi.ImageStatePending))
+			}
+
+			r.handleReconcileError(ctx, logr.Discard(), "foo", cloneErr)
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Status.State).To(Equal(providerapi.ImageStateFailed))
+			Expect(img.Status.LastError).To(Equal(cloneErr.Error()))
+			Expect(r.queue.NumRequeues("foo")).To(BeZero())
+		})
+
+		It("should keep retrying images that are being deleted", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{MaxReconcileRetries: 1})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo", DeletedAt: ptr.To(time.Now())},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for range 3 {
+				r.handleReconcileError(ctx, logr.Discard(), "foo", errors.New("failed to remove rbd image"))
+			}
+
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Status.State).To(Equal(providerapi.ImageStateAvailable))
+		})
+
+		It("should requeue conflicting updates without counting them as retries", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{MaxReconcileRetries: 1})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			conflictErr := fmt.Errorf("failed to update image state: %w", store.ErrResourceVersionNotLatest)
+			for range 3 {
+				r.handleReconcileError(ctx, logr.Discard(), "foo", conflictErr)
+			}
+
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Status.State).To(Equal(providerapi.ImageStatePending))
+			Expect(r.queue.NumRequeues("foo")).To(BeZero())
+			Expect(r.queue.Len()).To(Equal(1))
+		})
+	})
+
+	Context("fetchAuth", func() {
+		It("should return the credentials of the configured client", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			r.cephClient = &fakeCephClient{response: []byte(`{"key":"secret"}`)}
+
+			user, key, err := r.fetchAuth(ctx, logr.Discard())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user).To(Equal("volumes"))
+			Expect(key).To(Equal("secret"))
+		})
+
+		It("should abort when the context is cancelled", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			r.cephClient = &fakeCephClient{delay: time.Minute}
+
+			cancelCtx, cancel := context.WithCancel(ctx)
+			time.AfterFunc(10*time.Millisecond, cancel)
+
+			_, _, err = r.fetchAuth(cancelCtx, logr.Discard())
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("should abort after the auth fetch timeout", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{AuthFetchTimeout: 10 * time.Millisecond})
+			Expect(err).NotTo(HaveOccurred())
+			r.cephClient = &fakeCephClient{delay: time.Minute}
+
+			_, _, err = r.fetchAuth(ctx, logr.Discard())
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("should serve cached credentials until they expire", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{AuthCacheTTL: time.Minute})
+			Expect(err).NotTo(HaveOccurred())
+			client := &fakeCephClient{response: []byte(`{"key":"secret"}`)}
+			r.cephClient = client
+
+			now := time.Now()
+			r.authCache.now = func() time.Time { return now }
+
+			for range 3 {
+				_, key, err := r.fetchAuth(ctx, logr.Discard())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).To(Equal("secret"))
+			}
+			Expect(client.calls.Load()).To(BeEquivalentTo(1))
+
+			now = now.Add(time.Minute)
+			_, _, err = r.fetchAuth(ctx, logr.Discard())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.calls.Load()).To(BeEquivalentTo(2))
+		})
+	})
+
+	Context("getPopulatedSnapshot", func() {
+		It("should report the snapshot readiness as image condition", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			snapshot, err := r.snapshots.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "snap"},
+				Status:   providerapi.SnapshotStatus{State: providerapi.SnapshotStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			img := &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Size: 1024, SnapshotRef: ptr.To("snap")},
+			}
+
+			Expect(r.getPopulatedSnapshot(ctx, logr.Discard(), img, "snap")).To(BeNil())
+			condition, ok := img.Status.GetCondition(providerapi.ImageConditionSnapshotReady)
+			Expect(ok).To(BeTrue())
+			Expect(condition.Status).To(Equal(providerapi.ConditionFalse))
+			Expect(condition.Reason).To(Equal("SnapshotPopulating"))
+
+			snapshot.Status.State = providerapi.SnapshotStatePopulated
+			_, err = r.snapshots.Update(ctx, snapshot)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.getPopulatedSnapshot(ctx, logr.Discard(), img, "snap")).NotTo(BeNil())
+			_, ok = img.Status.GetCondition(providerapi.ImageConditionSnapshotReady)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should report a missing snapshot as image condition", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			img := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}}
+			Expect(r.getPopulatedSnapshot(ctx, logr.Discard(), img, "snap")).To(BeNil())
+			condition, ok := img.Status.GetCondition(providerapi.ImageConditionSnapshotReady)
+			Expect(ok).To(BeTrue())
+			Expect(condition.Reason).To(Equal("SnapshotNotFound"))
+		})
+
+		It("should requeue the image after the source requeue interval while the snapshot is not ready", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{SourceRequeueInterval: 50 * time.Millisecond})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+
+			_, err = r.snapshots.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "snap"},
+				Status:   providerapi.SnapshotStatus{State: providerapi.SnapshotStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, snapshotRef := range []string{"snap", "missing"} {
+				img := &providerapi.Image{
+					Metadata: apiutils.Metadata{ID: "foo"},
+					Spec:     providerapi.ImageSpec{Size: 1024, SnapshotRef: ptr.To(snapshotRef)},
+				}
+				Expect(r.getPopulatedSnapshot(ctx, logr.Discard(), img, snapshotRef)).To(BeNil())
+				Expect(r.queue.Len()).To(BeZero())
+
+				Eventually(r.queue.Len).Should(Equal(1))
+				id, _ := r.queue.Get()
+				Expect(id).To(Equal("foo"))
+				r.queue.Done(id)
+			}
+		})
+
+		It("should reject a negative source requeue interval", func() {
+			_, err := newTestImageReconciler(ImageReconcilerOptions{SourceRequeueInterval: -time.Second})
+			Expect(err).To(MatchError(ContainSubstring("source requeue interval must not be negative")))
+		})
+	})
+
+	Context("io context pooling", func() {
+		It("should only pool io contexts if a pool size is configured", func() {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.ioContexts).To(BeNil())
+
+			r, err = newTestImageReconciler(ImageReconcilerOptions{IOContextPoolSize: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.ioContexts).NotTo(BeNil())
+		})
+
+		It("should reject a negative io context pool size", func() {
+			_, err := newTestImageReconciler(ImageReconcilerOptions{IOContextPoolSize: -1})
+			Expect(err).To(MatchError(ContainSubstring("io context pool size must not be negative")))
+		})
+	})
+
+	Context("needsResize", func() {
+		It("should grow an image", func() {
+			Expect(needsResize(1024, 2048, false)).To(BeTrue())
+		})
+
+		It("should not resize an image of the requested size", func() {
+			Expect(needsResize(1024, 1024, false)).To(BeFalse())
+		})
+
+		It("should refuse to shrink an image", func() {
+			_, err := needsResize(2048, 1024, false)
+			Expect(err).To(MatchError(ContainSubstring("refusing to shrink image")))
+		})
+
+		It("should shrink an image if explicitly allowed", func() {
+			Expect(needsResize(2048, 1024, true)).To(BeTrue())
+		})
+	})
+
+	Context("ensureImageSize", func() {
+		const gib = uint64(1 << 30)
+
+		var r *ImageReconciler
+
+		BeforeEach(func() {
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should grow an adopted image that is smaller than requested", func() {
+			// A previous reconcile crashed after creating the image, before the spec size was increased.
+			img := &fakeImageResizer{size: gib}
+			image := &providerapi.Image{Spec: providerapi.ImageSpec{Size: 2 * gib}}
+
+			Expect(r.ensureImageSize(logr.Discard(), img, image)).To(BeTrue())
+			Expect(img.resizes).To(Equal([]uint64{2 * gib}))
+		})
+
+		It("should adopt an image of the requested size unchanged", func() {
+			img := &fakeImageResizer{size: 2 * gib}
+			image := &providerapi.Image{Spec: providerapi.ImageSpec{Size: 2 * gib}}
+
+			Expect(r.ensureImageSize(logr.Discard(), img, image)).To(BeFalse())
+			Expect(img.resizes).To(BeEmpty())
+		})
+
+		It("should refuse to adopt an image that is larger than requested", func() {
+			img := &fakeImageResizer{size: 3 * gib}
+			image := &providerapi.Image{Spec: providerapi.ImageSpec{Size: 2 * gib}}
+
+			_, err := r.ensureImageSize(logr.Discard(), img, image)
+			Expect(err).To(MatchError(ContainSubstring("refusing to shrink image")))
+			Expect(img.resizes).To(BeEmpty())
+		})
+
+		It("should fail if the adopted image cannot be resized", func() {
+			img := &fakeImageResizer{size: gib, resizeErr: errors.New("read-only")}
+			image := &providerapi.Image{Spec: providerapi.ImageSpec{Size: 2 * gib}}
+
+			_, err := r.ensureImageSize(logr.Discard(), img, image)
+			Expect(err).To(MatchError(ContainSubstring("failed to resize rbd image")))
+		})
+	})
+
+	Context("image owner", func() {
+		image := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}}
+
+		It("should adopt rbd images created for the image", func() {
+			md := fakeImageMetadata{}
+			Expect(setImageOwner(md, image)).To(Succeed())
+			Expect(md).To(HaveKeyWithValue(OwnerKey, "foo"))
+
+			Expect(checkImageOwner(md, image)).To(Succeed())
+		})
+
+		It("should not adopt rbd images created for another image", func() {
+			md := fakeImageMetadata{OwnerKey: "bar"}
+			Expect(checkImageOwner(md, image)).To(MatchError(errImageNotOwned))
+		})
+
+		It("should adopt rbd images without owner under the name derived from the image id", func() {
+			md := fakeImageMetadata{DigestKey: "sha256:abc"}
+			Expect(checkImageOwner(md, image)).To(Succeed())
+			Expect(md).To(HaveKeyWithValue(OwnerKey, "foo"))
+		})
+
+		It("should not adopt rbd images without owner under a custom name", func() {
+			custom := &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{RBDName: "custom"},
+			}
+			md := fakeImageMetadata{DigestKey: "sha256:abc"}
+			Expect(checkImageOwner(md, custom)).To(MatchError(errImageNotOwned))
+			Expect(md).NotTo(HaveKey(OwnerKey))
+		})
+	})
+
+	Context("resizeImage", func() {
+		const gib = uint64(1 << 30)
+
+		var (
+			r      *ImageReconciler
+			events []ImageLifecycleEvent
+			now    time.Time
+		)
+
+		BeforeEach(func() {
+			events = nil
+
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{
+				LifecycleSink: ImageLifecycleSinkFunc(func(evt ImageLifecycleEvent) {
+					events = append(events, evt)
+				}),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			now = time.Unix(1700000000, 0)
+			r.now = func() time.Time { return now }
+		})
+
+		availableImage := func(ctx SpecContext, size uint64) *providerapi.Image {
+			image, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Size: size},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable, Size: gib},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return image
+		}
+
+		It("should record the resize of a grown image", func(ctx SpecContext) {
+			img := &fakeImageResizer{size: gib}
+			image := availableImage(ctx, 2*gib)
+
+			Expect(r.resizeImage(ctx, logr.Discard(), img, image)).To(Succeed())
+			Expect(img.resizes).To(Equal([]uint64{2 * gib}))
+
+			stored, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Status.Size).To(Equal(2 * gib))
+			Expect(stored.Status.ResizedAt).To(HaveValue(BeTemporally("==", now)))
+
+			Expect(events).To(ConsistOf(SatisfyAll(
+				HaveField("Type", ImageLifecycleResized),
+				HaveField("Image.Status.Size", 2*gib),
+				HaveField("Time", now),
+			)))
+		})
+
+		It("should not record a resize of an image of the requested size", func(ctx SpecContext) {
+			img := &fakeImageResizer{size: gib}
+			image := availableImage(ctx, gib)
+
+			Expect(r.resizeImage(ctx, logr.Discard(), img, image)).To(Succeed())
+			Expect(img.resizes).To(BeEmpty())
+
+			stored, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Status.ResizedAt).To(BeNil())
+			Expect(events).To(BeEmpty())
+		})
+
+		It("should not record a failed resize", func(ctx SpecContext) {
+			img := &fakeImageResizer{size: gib, resizeErr: errors.New("read-only")}
+			image := availableImage(ctx, 2*gib)
+
+			Expect(r.resizeImage(ctx, logr.Discard(), img, image)).To(MatchError(ContainSubstring("failed to resize image")))
+
+			stored, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Status).To(SatisfyAll(
+				HaveField("Size", gib),
+				HaveField("ResizedAt", BeNil()),
+			))
+			Expect(events).To(BeEmpty())
+		})
+
+		It("should not round up the size of a provisioned image", func(ctx SpecContext) {
+			r.sizeRounding = round.Strategy{Mode: round.ModeUp, Alignment: 4 * gib}
+			img := &fakeImageResizer{size: gib}
+			image := availableImage(ctx, gib)
+
+			Expect(r.resizeImage(ctx, logr.Discard(), img, image)).To(Succeed())
+			Expect(img.resizes).To(BeEmpty())
+			Expect(events).To(BeEmpty())
+		})
+
+		It("should round up the size of a grown provisioned image", func(ctx SpecContext) {
+			r.sizeRounding = round.Strategy{Mode: round.ModeUp, Alignment: 4 * gib}
+			img := &fakeImageResizer{size: gib}
+			image := availableImage(ctx, 2*gib)
+
+			Expect(r.resizeImage(ctx, logr.Discard(), img, image)).To(Succeed())
+			Expect(img.resizes).To(Equal([]uint64{4 * gib}))
+		})
+	})
+
+	Context("DryRun", func() {
+		var r *ImageReconciler
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{DryRun: true})
+			Expect(err).NotTo(HaveOccurred())
+			// A dry run must not open any io context, every rbd call of a reconcile goes through one.
+			conns := &countingConnAccessor{}
+			r.conns = conns
+			DeferCleanup(func() {
+				Expect(conns.calls).To(BeZero())
+			})
+			r.cephClient = &fakeCephClient{pools: []string{"pool"}}
+
+			_, err = r.snapshots.Create(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "snap"}})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should mark a valid image as validated", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec: providerapi.ImageSpec{
+					Size:        1024,
+					SnapshotRef: ptr.To("snap"),
+					Features:    []string{"layering"},
+				},
+				Status: providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.reconcileImage(ctx, "foo")).To(Succeed())
+
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Status.State).To(Equal(providerapi.ImageStateValidated))
+			Expect(img.Status.Access).To(BeNil())
+		})
+
+		It("should reject an image with an unresolvable snapshot", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Size: 1024, SnapshotRef: ptr.To("missing")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.reconcileImage(ctx, "foo")).To(MatchError(ContainSubstring("failed to resolve snapshot missing")))
+		})
+
+		It("should reject an image without a size", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.reconcileImage(ctx, "foo")).To(MatchError(ContainSubstring("size must be positive")))
+		})
+
+		It("should reject an image with a missing data pool", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Size: 1024, DataPool: "ec"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.reconcileImage(ctx, "foo")).To(MatchError(ContainSubstring("failed to look up pool ec")))
+		})
+
+		It("should log the pool, snapshot, digest and state of the image on every line", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Size: 1024, SnapshotRef: ptr.To("snap")},
+				Status: providerapi.ImageStatus{
+					State:  providerapi.ImageStatePending,
+					Digest: "sha256:abc",
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var lines []string
+			log := funcr.New(func(prefix, args string) {
+				lines = append(lines, args)
+			}, funcr.Options{Verbosity: 10})
+
+			Expect(r.reconcileImage(logr.NewContext(ctx, log), "foo")).To(Succeed())
+			Expect(lines).NotTo(BeEmpty())
+			Expect(lines).To(HaveEach(SatisfyAll(
+				ContainSubstring(`"pool"="pool"`),
+				ContainSubstring(`"snapshotRef"="snap"`),
+				ContainSubstring(`"digest"="sha256:abc"`),
+				ContainSubstring(`"state"="Pending"`),
+			)))
+		})
+
+		It("should leave deleted images untouched", func(ctx SpecContext) {
+			snapshot, err := r.snapshots.Get(ctx, "snap")
+			Expect(err).NotTo(HaveOccurred())
+			snapshot.AddImageRef("foo")
+			_, err = r.snapshots.Update(ctx, snapshot)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo", DeletedAt: ptr.To(time.Now()), Finalizers: []string{ImageFinalizer}},
+				Spec:     providerapi.ImageSpec{SnapshotRef: ptr.To("snap")},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.reconcileImage(ctx, "foo")).To(Succeed())
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Finalizers).To(ConsistOf(ImageFinalizer))
+			Expect(img.Status.State).To(Equal(providerapi.ImageStateAvailable))
+
+			// The rbd image is not removed in dry run, so it keeps referencing the snapshot.
+			snapshot, err = r.snapshots.Get(ctx, "snap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshot.Status.ImageRefs).To(Equal([]string{"foo"}))
+		})
+	})
+
+	Context("setImageDigest", func() {
+		It("should record the digest as rbd image metadata and in the status", func() {
+			md := fakeImageMetadata{WWNKey: "wwn"}
+			img := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}}
+
+			for range 2 {
+				Expect(setImageDigest(logr.Discard(), md, img, "sha256:abc")).To(Succeed())
+				Expect(md).To(Equal(fakeImageMetadata{WWNKey: "wwn", DigestKey: "sha256:abc"}))
+				Expect(img.Status.Digest).To(Equal("sha256:abc"))
+			}
+		})
+
+		It("should not record an empty digest", func() {
+			md := fakeImageMetadata{}
+			img := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}}
+
+			Expect(setImageDigest(logr.Discard(), md, img, "")).To(Succeed())
+			Expect(md).To(BeEmpty())
+			Expect(img.Status.Digest).To(BeEmpty())
+		})
+	})
+
+	Context("encryption", func() {
+		It("should select the encryption format", func() {
+			Expect(encryptionFormatOptions("", []byte("secret"))).To(BeAssignableToTypeOf(librbd.EncryptionOptionsLUKS2{}))
+			Expect(encryptionFormatOptions(providerapi.EncryptionFormatLUKS2, []byte("secret"))).To(BeAssignableToTypeOf(librbd.EncryptionOptionsLUKS2{}))
+			Expect(encryptionFormatOptions(providerapi.EncryptionFormatLUKS1, []byte("secret"))).To(BeAssignableToTypeOf(librbd.EncryptionOptionsLUKS1{}))
+
+			_, err := encryptionFormatOptions("plain", []byte("secret"))
+			Expect(err).To(MatchError(ContainSubstring(`unsupported encryption format "plain"`)))
+		})
+
+		It("should fail if the passphrase is missing", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = r.setEncryptionHeader(ctx, logr.Discard(), nil, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec: providerapi.ImageSpec{
+					Encryption: &providerapi.EncryptionSpec{Type: providerapi.EncryptionTypeEncrypted},
+				},
+			})
+			Expect(err).To(MatchError(ContainSubstring("passphrase missing")))
+		})
+
+		It("should detect clones of encrypted images", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "parent"},
+				Status:   providerapi.ImageStatus{Encryption: providerapi.EncryptionStateHeaderSet},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = r.snapshots.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "snap"},
+				Source:   providerapi.SnapshotSource{VolumeImageID: "parent"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.isParentEncrypted(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "child"},
+				Spec:     providerapi.ImageSpec{SnapshotRef: ptr.To("snap")},
+			})).To(BeTrue())
+			Expect(r.isParentEncrypted(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "other"},
+				Spec:     providerapi.ImageSpec{SnapshotRef: ptr.To("missing")},
+			})).To(BeFalse())
+			Expect(r.isParentEncrypted(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "empty"}})).To(BeFalse())
+		})
+	})
+
+	Context("reconcileSnapshot", func() {
+		It("should not resolve a pinned image reference again", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			resolver := &fakeImageResolver{digest: "sha256:abc"}
+			r.registry = resolver
+			snapshots := &failingCreateStore[*providerapi.Snapshot]{Store: r.snapshots, failures: 2}
+			r.snapshots = snapshots
+
+			img, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Image: "registry/os-image:latest"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for range 2 {
+				Expect(r.reconcileSnapshot(ctx, logr.Discard(), img)).NotTo(Succeed())
+			}
+			Expect(r.reconcileSnapshot(ctx, logr.Discard(), img)).To(Succeed())
+
+			Expect(resolver.calls.Load()).To(BeEquivalentTo(1))
+			Expect(img.Spec.SnapshotRef).To(Equal(ptr.To("sha256:abc")))
+			Expect(img.Status.ResolvedDigest).To(Equal("sha256:abc"))
+		})
+
+		It("should resolve again if the image reference changed", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			resolver := &fakeImageResolver{digest: "sha256:def"}
+			r.registry = resolver
+
+			img, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Image: "registry/os-image:v2"},
+				Status: providerapi.ImageStatus{
+					ResolvedImage:  "registry/os-image:v1",
+					ResolvedDigest: "sha256:abc",
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.reconcileSnapshot(ctx, logr.Discard(), img)).To(Succeed())
+			Expect(resolver.calls.Load()).To(BeEquivalentTo(1))
+			Expect(img.Spec.SnapshotRef).To(Equal(ptr.To("sha256:def")))
+		})
+	})
+
+	Context("processNextWorkItem", func() {
+		It("should report reconcile errors to the connection accessor", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			conns := &recordingConnAccessor{ConnAccessor: r.conns}
+			r.conns = conns
+			reconcileErr := fmt.Errorf("unable to get io context: %w", rados.ErrNotConnected)
+			r.reconcile = func(ctx context.Context, id string) error {
+				return reconcileErr
+			}
+
+			r.queue.Add("foo")
+			Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+			Expect(conns.observed).To(ConsistOf(MatchError(rados.ErrNotConnected)))
+		})
+
+		It("should fail the image without requeueing if the pool does not exist", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var reconciles int
+			r.reconcile = func(ctx context.Context, id string) error {
+				reconciles++
+				return fmt.Errorf("unable to get io context: %w: pool: %w", ceph.ErrPoolNotFound, rados.ErrNotFound)
+			}
+
+			r.queue.Add("foo")
+			Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+
+			Expect(reconciles).To(Equal(1))
+			Expect(r.queue.Len()).To(BeZero())
+			Expect(r.queue.NumRequeues("foo")).To(BeZero())
+			Expect(r.images.Get(ctx, "foo")).To(HaveField("Status", SatisfyAll(
+				HaveField("State", providerapi.ImageStateFailed),
+				HaveField("Conditions", ConsistOf(SatisfyAll(
+					HaveField("Type", providerapi.ImageConditionReconciled),
+					HaveField("Status", providerapi.ConditionFalse),
+					HaveField("Reason", "PoolNotFound"),
+				))),
+			)))
+		})
+
+		It("should fail the image without requeueing if its spec is invalid", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{ImageFinalizer}},
+				Spec:     providerapi.ImageSpec{Size: 1024, Features: []string{"teleportation"}},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			r.reconcile = func(ctx context.Context, id string) error {
+				return r.reconcileImageWithIOContext(ctx, nil, id)
+			}
+
+			r.queue.Add("foo")
+			Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+
+			Expect(r.queue.NumRequeues("foo")).To(BeZero())
+			Expect(r.images.Get(ctx, "foo")).To(HaveField("Status", SatisfyAll(
+				HaveField("State", providerapi.ImageStateFailed),
+				HaveField("LastError", ContainSubstring("spec.features[0]")),
+				HaveField("Conditions", ConsistOf(HaveField("Reason", "InvalidSpec"))),
+			)))
+		})
+
+		It("should not fail an os image volume while its snapshot is populating", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+			r.registry = &fakeImageResolver{digest: "sha256:abc"}
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{ImageFinalizer}},
+				Spec:     providerapi.ImageSpec{Size: 1024, Image: "registry.example.com/image:latest"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			r.reconcile = func(ctx context.Context, id string) error {
+				img, err := r.images.Get(ctx, id)
+				if err != nil {
+					return err
+				}
+				if err := validateImageSpec(img); err != nil {
+					return err
+				}
+				if err := r.reconcileSnapshot(ctx, logr.Discard(), img); err != nil {
+					return err
+				}
+				_, err = r.getPopulatedSnapshot(ctx, logr.Discard(), img, *img.Spec.SnapshotRef)
+				return err
+			}
+
+			for range 2 {
+				r.queue.Add("foo")
+				Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+			}
+
+			Expect(r.snapshots.Get(ctx, "sha256:abc")).To(HaveField("Status.State",
+				Not(BeElementOf(providerapi.SnapshotStateReady, providerapi.SnapshotStatePopulated))))
+			Expect(r.images.Get(ctx, "foo")).To(SatisfyAll(
+				HaveField("Spec.SnapshotRef", Equal(ptr.To("sha256:abc"))),
+				HaveField("Status.State", providerapi.ImageStatePending),
+			))
+		})
+
+		It("should accept os image volumes whose snapshot was resolved before the digest was pinned", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.snapshots.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "sha256:abc"},
+				Source:   providerapi.SnapshotSource{IronCoreImage: "registry.example.com/image@sha256:abc"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			img, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{ImageFinalizer}},
+				Spec: providerapi.ImageSpec{
+					Size:        1024,
+					Image:       "registry.example.com/image:latest",
+					SnapshotRef: ptr.To("sha256:abc"),
+				},
+				Status: providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(validateImageSpec(img)).To(MatchError(ErrInvalidImageSpec))
+
+			img, err = r.backfillResolvedImage(ctx, logr.Discard(), img)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(validateImageSpec(img)).To(Succeed())
+			Expect(r.images.Get(ctx, "foo")).To(HaveField("Status", SatisfyAll(
+				HaveField("ResolvedImage", "registry.example.com/image:latest"),
+				HaveField("ResolvedDigest", "sha256:abc"),
+			)))
+
+			By("not taking a snapshot of another source as resolved")
+			other := &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "bar"},
+				Spec: providerapi.ImageSpec{
+					Size:        1024,
+					Image:       "registry.example.com/other:latest",
+					SnapshotRef: ptr.To("sha256:abc"),
+				},
+			}
+			other, err = r.backfillResolvedImage(ctx, logr.Discard(), other)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(validateImageSpec(other)).To(MatchError(ErrInvalidImageSpec))
+		})
+
+		It("should fail the image without requeueing if the image cannot be resolved", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+			r.registry = errImageResolver{err: fmt.Errorf("registry.example.com/image:latest: %w", errdefs.ErrNotFound)}
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Image: "registry.example.com/image:latest"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			r.reconcile = func(ctx context.Context, id string) error {
+				img, err := r.images.Get(ctx, id)
+				if err != nil {
+					return err
+				}
+				return r.reconcileSnapshot(ctx, logr.Discard(), img)
+			}
+
+			r.queue.Add("foo")
+			Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+
+			Expect(r.queue.NumRequeues("foo")).To(BeZero())
+			Expect(r.images.Get(ctx, "foo")).To(HaveField("Status", SatisfyAll(
+				HaveField("State", providerapi.ImageStateFailed),
+				HaveField("Conditions", ConsistOf(SatisfyAll(
+					HaveField("Type", providerapi.ImageConditionReconciled),
+					HaveField("Status", providerapi.ConditionFalse),
+					HaveField("Reason", "ImageNotFound"),
+				))),
+			)))
+		})
+
+		It("should requeue the image if the registry is unavailable", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+			r.registry = errImageResolver{err: remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusBadGateway}}
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Image: "registry.example.com/image:latest"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			r.reconcile = func(ctx context.Context, id string) error {
+				img, err := r.images.Get(ctx, id)
+				if err != nil {
+					return err
+				}
+				return r.reconcileSnapshot(ctx, logr.Discard(), img)
+			}
+
+			r.queue.Add("foo")
+			Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+
+			Expect(r.queue.NumRequeues("foo")).To(Equal(1))
+			Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.State", providerapi.ImageStatePending))
+		})
+	})
+
+	Context("handleMissingParentSnapshot", func() {
+		var r *ImageReconciler
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Size: 1024, SnapshotRef: ptr.To("snap")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reset a snapshot of an os image for repopulation", func(ctx SpecContext) {
+			snapshot, err := r.snapshots.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "snap"},
+				Source:   providerapi.SnapshotSource{IronCoreImage: "registry.example.com/image:latest"},
+				Status:   providerapi.SnapshotStatus{State: providerapi.SnapshotStateReady, PopulateProgress: 100},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			err = r.handleMissingParentSnapshot(ctx, logr.Discard(), img, snapshot, SnapshotIDToRBDID("snap"), ImageSnapshotVersion)
+			Expect(err).To(MatchError(errSnapshotParentNotFound))
+
+			// The snapshot reconciler populates the pending snapshot again once it observes the update.
+			Expect(r.snapshots.Get(ctx, "snap")).To(HaveField("Status", SatisfyAll(
+				HaveField("State", providerapi.SnapshotStatePending),
+				HaveField("PopulateProgress", BeZero()),
+			)))
+			Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.Conditions", ConsistOf(SatisfyAll(
+				HaveField("Type", providerapi.ImageConditionSnapshotReady),
+				HaveField("Status", providerapi.ConditionFalse),
+				HaveField("Reason", "SnapshotParentNotFound"),
+			))))
+		})
+
+		It("should reset a snapshot of a url for repopulation", func(ctx SpecContext) {
+			snapshot, err := r.snapshots.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "snap"},
+				Source:   providerapi.SnapshotSource{URL: "https://example.com/disk.raw"},
+				Status:   providerapi.SnapshotStatus{State: providerapi.SnapshotStateReady},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			err = r.handleMissingParentSnapshot(ctx, logr.Discard(), img, snapshot, SnapshotIDToRBDID("snap"), ImageSnapshotVersion)
+			Expect(err).To(MatchError(errSnapshotParentNotFound))
+
+			Expect(r.snapshots.Get(ctx, "snap")).To(HaveField("Status.State", providerapi.SnapshotStatePending))
+		})
+
+		It("should fail a snapshot of a volume", func(ctx SpecContext) {
+			snapshot, err := r.snapshots.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "snap"},
+				Source:   providerapi.SnapshotSource{VolumeImageID: "bar"},
+				Status:   providerapi.SnapshotStatus{State: providerapi.SnapshotStateReady},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			err = r.handleMissingParentSnapshot(ctx, logr.Discard(), img, snapshot, ImageIDToRBDID("bar"), "snap")
+			Expect(err).To(MatchError(errSnapshotParentNotFound))
+
+			Expect(r.snapshots.Get(ctx, "snap")).To(HaveField("Status.State", providerapi.SnapshotStateFailed))
+		})
+	})
+
+	Context("Start", func() {
+		It("should reconcile existing images of a replay source right away", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{WorkerSize: 1})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			r.imageEvents, err = replay.NewSource(r.imageEvents, r.images.List)
+			Expect(err).NotTo(HaveOccurred())
+
+			reconciled := make(chan string, 1)
+			r.reconcile = func(ctx context.Context, id string) error {
+				reconciled <- id
+				return nil
+			}
+
+			startCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() { done <- r.Start(startCtx) }()
+
+			Eventually(reconciled).Should(Receive(Equal("foo")))
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("should let in-flight reconciles finish when stopped", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{WorkerSize: 1, ShutdownGracePeriod: time.Minute})
+			Expect(err).NotTo(HaveOccurred())
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			var reconcileErr atomic.Value
+			var reconciled atomic.Int32
+			r.reconcile = func(ctx context.Context, id string) error {
+				if reconciled.Add(1) == 1 {
+					close(started)
+				}
+				<-release
+				reconcileErr.Store(fmt.Sprint(ctx.Err()))
+				return nil
+			}
+
+			startCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() { done <- r.Start(startCtx) }()
+
+			r.queue.Add("foo")
+			Eventually(started).Should(BeClosed())
+			r.queue.Add("bar")
+
+			cancel()
+			Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+			close(release)
+
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(reconcileErr.Load()).To(Equal("<nil>"))
+			Expect(reconciled.Load()).To(BeEquivalentTo(1))
+		})
+
+		It("should cancel in-flight reconciles after the grace period", func(ctx SpecContext) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{WorkerSize: 1, ShutdownGracePeriod: 10 * time.Millisecond})
+			Expect(err).NotTo(HaveOccurred())
+
+			started := make(chan struct{})
+			r.reconcile = func(ctx context.Context, id string) error {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			startCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() { done <- r.Start(startCtx) }()
+
+			r.queue.Add("foo")
+			Eventually(started).Should(BeClosed())
+			cancel()
+
+			Eventually(done).Should(Receive(BeNil()))
+		})
+	})
+})
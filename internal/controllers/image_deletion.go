@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ImageDeletionPolicy decides how an image is deleted whose snapshots have been cloned.
+type ImageDeletionPolicy string
+
+const (
+	// ImageDeletionPolicyFlatten flattens the clones of the image before it is removed.
+	ImageDeletionPolicyFlatten ImageDeletionPolicy = "Flatten"
+	// ImageDeletionPolicyBlock keeps the image until its clones are gone.
+	ImageDeletionPolicyBlock ImageDeletionPolicy = "Block"
+)
+
+// ErrImageHasChildren is returned while the deletion of an image is blocked by its clones.
+var ErrImageHasChildren = errors.New("image has child clones")
+
+// imageChildLister lists the clones of an rbd image.
+type imageChildLister interface {
+	ListChildrenAttributes() ([]librbd.ImageSpec, error)
+}
+
+// liveImageChildren returns the clones of the image that are not in the trash. Trashed clones cannot be opened by
+// name and are removed once their trash retention has passed.
+func liveImageChildren(img imageChildLister) ([]librbd.ImageSpec, error) {
+	specs, err := img.ListChildrenAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list children: %w", err)
+	}
+
+	var children []librbd.ImageSpec
+	for _, spec := range specs {
+		if !spec.Trash {
+			children = append(children, spec)
+		}
+	}
+	return children, nil
+}
+
+// imageChildren returns the clones of the image that are not in the trash as pool/image names.
+func imageChildren(img imageChildLister) ([]string, error) {
+	specs, err := liveImageChildren(img)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		children = append(children, path.Join(spec.PoolName, spec.ImageName))
+	}
+	return children, nil
+}
+
+func (r *ImageReconciler) checkImageChildren(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	img, err := openImage(ioCtx, RBDImageName(image))
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	defer closeImage(log, img)
+
+	return r.checkImageChildrenOf(log, img, image)
+}
+
+// checkImageChildrenOf refuses the deletion of an image with clones, unless the clones are flattened as part of the
+// deletion according to the deletion policy. The deletion is retried until the clones are gone.
+func (r *ImageReconciler) checkImageChildrenOf(log logr.Logger, img imageChildLister, image *providerapi.Image) error {
+	children, err := imageChildren(img)
+	if err != nil {
+		return err
+	}
+	if len(children) == 0 {
+		return nil
+	}
+
+	if r.deletionPolicy == ImageDeletionPolicyFlatten {
+		log.V(1).Info("Flattening clones before deleting image", "Children", children)
+		return nil
+	}
+
+	log.Info("Not deleting image with clones", "Children", children)
+	r.Eventf(image.Metadata, corev1.EventTypeWarning, "ImageDeletionBlocked", "Image has clones: %s", strings.Join(children, ", "))
+	return fmt.Errorf("%w: %s", ErrImageHasChildren, strings.Join(children, ", "))
+}
+
+// deletionGraceRemaining returns the time left of the deletion grace period of the deleted image. The rbd image of
+// the image is only removed once no time is left.
+func (r *ImageReconciler) deletionGraceRemaining(image *providerapi.Image) time.Duration {
+	if r.deletionGracePeriod == 0 || image.DeletedAt == nil {
+		return 0
+	}
+	return image.DeletedAt.Add(r.deletionGracePeriod).Sub(r.now())
+}
@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+type fakeImageChildLister struct {
+	children []librbd.ImageSpec
+	err      error
+}
+
+func (l *fakeImageChildLister) ListChildrenAttributes() ([]librbd.ImageSpec, error) {
+	return l.children, l.err
+}
+
+var _ = Describe("Image deletion", func() {
+	image := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}}
+
+	It("should reject an unsupported deletion policy", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{DeletionPolicy: "Orphan"})
+		Expect(err).To(MatchError(ContainSubstring("unsupported image deletion policy")))
+	})
+
+	It("should default to flattening the clones", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.deletionPolicy).To(Equal(ImageDeletionPolicyFlatten))
+	})
+
+	It("should delete an image without clones", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{DeletionPolicy: ImageDeletionPolicyBlock})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.checkImageChildrenOf(logr.Discard(), &fakeImageChildLister{}, image)).To(Succeed())
+	})
+
+	It("should block the deletion of an image with clones", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{DeletionPolicy: ImageDeletionPolicyBlock})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.checkImageChildrenOf(logr.Discard(), &fakeImageChildLister{children: []librbd.ImageSpec{
+			{PoolName: "pool", ImageName: "img_bar"},
+			{PoolName: "other", ImageName: "img_baz"},
+		}}, image)
+		Expect(err).To(MatchError(ErrImageHasChildren))
+		Expect(err).To(MatchError(ContainSubstring("pool/img_bar, other/img_baz")))
+
+		_, terminal := terminalErrorReason(err)
+		Expect(terminal).To(BeFalse())
+	})
+
+	It("should delete an image with clones when flattening them", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{DeletionPolicy: ImageDeletionPolicyFlatten})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.checkImageChildrenOf(logr.Discard(), &fakeImageChildLister{children: []librbd.ImageSpec{
+			{PoolName: "pool", ImageName: "img_bar"},
+		}}, image)).To(Succeed())
+	})
+
+	It("should not block the deletion by clones in the trash", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{DeletionPolicy: ImageDeletionPolicyBlock})
+		Expect(err).NotTo(HaveOccurred())
+
+		lister := &fakeImageChildLister{children: []librbd.ImageSpec{
+			{PoolName: "pool", ImageName: "img_bar", Trash: true},
+			{PoolName: "pool", ImageName: "img_baz"},
+		}}
+		Expect(imageChildren(lister)).To(Equal([]string{"pool/img_baz"}))
+
+		lister.children = lister.children[:1]
+		Expect(r.checkImageChildrenOf(logr.Discard(), lister, image)).To(Succeed())
+	})
+
+	It("should fail if the clones cannot be listed", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.checkImageChildrenOf(logr.Discard(), &fakeImageChildLister{err: errors.New("foo")}, image)).
+			To(MatchError(ContainSubstring("unable to list children")))
+	})
+
+	Context("deletion grace period", func() {
+		var (
+			r       *ImageReconciler
+			remover *fakeRBDImageRemover
+			now     time.Time
+		)
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{DeletionGracePeriod: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.queue.ShutDown)
+			remover = &fakeRBDImageRemover{}
+			r.rbdRemover = remover
+			now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			r.now = func() time.Time { return now }
+
+			_, err = r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo", DeletedAt: ptr.To(now), Finalizers: []string{ImageFinalizer}},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should retain the image within the grace period", func(ctx SpecContext) {
+			now = now.Add(10 * time.Minute)
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.deletionGraceRemaining(img)).To(Equal(50 * time.Minute))
+			Expect(r.deleteImage(ctx, logr.Discard(), nil, img)).To(Succeed())
+			Expect(remover.removed).To(BeEmpty())
+			Expect(remover.trashed).To(BeEmpty())
+
+			img, err = r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Finalizers).To(ConsistOf(ImageFinalizer))
+		})
+
+		It("should remove the rbd image after the grace period", func(ctx SpecContext) {
+			now = now.Add(time.Hour)
+			img, err := r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.deletionGraceRemaining(img)).To(BeZero())
+			// Without an io context, the deletion fails opening the rbd image instead of retaining it.
+			Expect(r.deleteImage(ctx, logr.Discard(), nil, img)).To(MatchError(librbd.ErrNoIOContext))
+		})
+
+		It("should reject a negative grace period", func() {
+			_, err := newTestImageReconciler(ImageReconcilerOptions{DeletionGracePeriod: -time.Minute})
+			Expect(err).To(MatchError(ContainSubstring("deletion grace period must not be negative")))
+		})
+	})
+})
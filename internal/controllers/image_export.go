@@ -0,0 +1,320 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	ironcoreimage "github.com/ironcore-dev/ironcore-image"
+	"github.com/ironcore-dev/ironcore-image/oci/image"
+	"github.com/ironcore-dev/ironcore-image/oci/imageutil"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// exportChunkSize is the size of the reads of allocated extents when exporting images.
+const exportChunkSize = 4 * 1024 * 1024
+
+// ExportSnapshotName is the name of the temporary rbd snapshot images are exported from.
+const ExportSnapshotName = "ironcore-export"
+
+// exportDeletionRequeueDelay is the delay after which the deletion of an image is retried while it is exported.
+const exportDeletionRequeueDelay = 5 * time.Second
+
+// ErrImageNotExportable is returned if an image cannot be exported in its current state.
+var ErrImageNotExportable = errors.New("image is not exportable")
+
+// sparseImage is the subset of rbd image operations used to read the allocated contents of an image.
+type sparseImage interface {
+	io.ReaderAt
+	GetSize() (uint64, error)
+	DiffIterate(config librbd.DiffIterateConfig) error
+	Close() error
+}
+
+// rbdImageReader opens snapshots of existing rbd images to read their contents.
+type rbdImageReader interface {
+	// OpenSnapshotReader creates the snapshot of the rbd image, replacing a stale one, and opens it for reading. The
+	// snapshot is removed once the reader is closed.
+	OpenSnapshotReader(pool, imageName, snapName string) (sparseImage, error)
+}
+
+type connImageReader struct {
+	conns     ceph.ConnAccessor
+	namespace string
+}
+
+func (o *connImageReader) OpenSnapshotReader(pool, imageName, snapName string) (sparseImage, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(o.conns, pool, o.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+
+	img, err := librbd.OpenImage(ioCtx, imageName, librbd.NoSnapshot)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to open image %s: %w", imageName, err)
+	}
+
+	snapImg, err := openTemporarySnapshot(ioCtx, img, snapName)
+	if err != nil {
+		_ = img.Close()
+		release()
+		return nil, err
+	}
+	return &snapshotImage{Image: snapImg, head: img, snapName: snapName, release: release}, nil
+}
+
+func openTemporarySnapshot(ioCtx *rados.IOContext, img *librbd.Image, snapName string) (*librbd.Image, error) {
+	// A snapshot left behind by an interrupted export may not match the current contents of the image.
+	if err := removeSnapshot(img.GetSnapshot(snapName)); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return nil, fmt.Errorf("failed to remove stale snapshot %s: %w", snapName, err)
+	}
+
+	snapshot, err := img.CreateSnapshot(snapName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot %s: %w", snapName, err)
+	}
+
+	snapImg, err := librbd.OpenImageReadOnly(ioCtx, img.GetName(), snapName)
+	if err != nil {
+		_ = snapshot.Remove()
+		return nil, fmt.Errorf("failed to open snapshot %s: %w", snapName, err)
+	}
+	return snapImg, nil
+}
+
+// snapshotImage is an rbd snapshot opened for reading, which is removed together with the io context it was opened
+// on once closed.
+type snapshotImage struct {
+	*librbd.Image
+	head     *librbd.Image
+	snapName string
+	release  func()
+}
+
+func (i *snapshotImage) Close() error {
+	defer i.release()
+
+	var errs []error
+	if err := i.Image.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close snapshot: %w", err))
+	}
+	if err := i.head.GetSnapshot(i.snapName).Remove(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove snapshot %s: %w", i.snapName, err))
+	}
+	if err := i.head.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close image: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// ioContextImage is an rbd image releasing the io context it was opened on once closed.
+type ioContextImage struct {
+	*librbd.Image
+	release func()
+}
+
+func (i *ioContextImage) Close() error {
+	defer i.release()
+	return i.Image.Close()
+}
+
+// imageSinkFunc creates the image sink to push exported os images with.
+type imageSinkFunc func() (image.Sink, error)
+
+func registrySinkFunc(auth RegistryAuth) imageSinkFunc {
+	return func() (image.Sink, error) {
+		return newOsImageSink(auth)
+	}
+}
+
+// ExportImage pushes the contents of the available image as os image with a rootfs layer to the given reference and
+// records the digest of the pushed manifest, e.g. to promote a prepared image to a golden image other images are
+// created from. The contents are read from a temporary rbd snapshot, so that the image stays in use and the pushed
+// layer is a consistent point-in-time copy. Only the allocated extents of the snapshot are read, but the layer is
+// pushed uncompressed with the full size of the image. The deletion of the image is deferred until the export is
+// done. Images are not exported while the maintenance mode is on.
+func (r *ImageReconciler) ExportImage(ctx context.Context, id, ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("must specify image reference")
+	}
+
+	img, err := r.startExport(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer r.finishExport(id)
+
+	log := r.log.WithValues("imageId", id, "Reference", ref)
+
+	dgst, err := r.exportImage(ctx, img, ref)
+	if err != nil {
+		r.Eventf(img.Metadata, corev1.EventTypeWarning, "ExportImageFailed", "Failed to export image to %s: %s", ref, err)
+		return "", err
+	}
+
+	if err := r.recordExport(ctx, id, &providerapi.ImageExport{
+		Reference:  ref,
+		Digest:     dgst,
+		ExportedAt: r.now(),
+	}); err != nil {
+		return "", err
+	}
+
+	log.Info("Exported image", "Digest", dgst)
+	r.Eventf(img.Metadata, corev1.EventTypeNormal, "ExportImageSucceeded", "Exported image to %s@%s", ref, dgst)
+	return dgst, nil
+}
+
+// startExport checks that the image is exportable and marks it as exported, serialized with its reconciles so that
+// an image whose deletion started is not exported.
+func (r *ImageReconciler) startExport(ctx context.Context, id string) (*providerapi.Image, error) {
+	r.imageMu.Lock(id)
+	defer r.imageMu.Unlock(id)
+
+	if r.maintenance.paused() {
+		return nil, fmt.Errorf("%w: maintenance mode is on", ErrImageNotExportable)
+	}
+
+	img, err := r.images.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+	if img.DeletedAt != nil || img.Status.State != providerapi.ImageStateAvailable {
+		return nil, fmt.Errorf("%w: image %s is not available", ErrImageNotExportable, id)
+	}
+	if img.Spec.Encryption != nil && img.Spec.Encryption.Type == providerapi.EncryptionTypeEncrypted {
+		return nil, fmt.Errorf("%w: image %s is encrypted", ErrImageNotExportable, id)
+	}
+
+	r.exportsMu.Lock()
+	defer r.exportsMu.Unlock()
+	if r.exports.Has(id) {
+		return nil, fmt.Errorf("%w: image %s is already being exported", ErrImageNotExportable, id)
+	}
+	r.exports.Insert(id)
+	return img, nil
+}
+
+func (r *ImageReconciler) finishExport(id string) {
+	r.exportsMu.Lock()
+	defer r.exportsMu.Unlock()
+	r.exports.Delete(id)
+}
+
+func (r *ImageReconciler) isExporting(id string) bool {
+	r.exportsMu.Lock()
+	defer r.exportsMu.Unlock()
+	return r.exports.Has(id)
+}
+
+// recordExport sets the export on the latest version of the image, which may have been reconciled while it was
+// exported.
+func (r *ImageReconciler) recordExport(ctx context.Context, id string, export *providerapi.ImageExport) error {
+	r.imageMu.Lock(id)
+	defer r.imageMu.Unlock(id)
+
+	img, err := r.images.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get image: %w", err)
+	}
+	img.Status.LastExport = export
+	if _, err := r.images.Update(ctx, img); err != nil {
+		return fmt.Errorf("failed to update image export: %w", err)
+	}
+	return nil
+}
+
+func (r *ImageReconciler) exportImage(ctx context.Context, img *providerapi.Image, ref string) (string, error) {
+	rootFS, err := os.CreateTemp("", "image-export-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create rootfs file: %w", err)
+	}
+	defer func() {
+		_ = rootFS.Close()
+		_ = os.Remove(rootFS.Name())
+	}()
+
+	pool, rbdName := r.imagePool(img), RBDImageName(img)
+	rbdImg, err := r.rbdReader.OpenSnapshotReader(pool, rbdName, ExportSnapshotName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open snapshot of rbd image %s/%s: %w", pool, rbdName, err)
+	}
+	err = writeSparse(rootFS, rbdImg)
+	if closeErr := rbdImg.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close rbd image: %w", closeErr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read rbd image %s/%s: %w", pool, rbdName, err)
+	}
+
+	ociImg, err := imageutil.NewJSONConfigBuilder(
+		ironcoreimage.Config{},
+		imageutil.WithMediaType(ironcoreimage.ConfigMediaType),
+	).FileLayer(
+		rootFS.Name(),
+		imageutil.WithMediaType(ironcoreimage.RootFSLayerMediaType),
+	).Complete()
+	if err != nil {
+		return "", fmt.Errorf("failed to build os image: %w", err)
+	}
+
+	sink, err := r.newImageSink()
+	if err != nil {
+		return "", fmt.Errorf("failed to create os image sink: %w", err)
+	}
+	if err := sink.Push(ironcoreimage.SetupContext(ctx), ref, ociImg); err != nil {
+		return "", fmt.Errorf("failed to push os image: %w", classifyRegistryError(err))
+	}
+	return ociImg.Descriptor().Digest.String(), nil
+}
+
+// writeSparse copies the allocated extents of the image to the file at their offsets and truncates the file to the
+// size of the image, so that unallocated regions become holes of the file.
+func writeSparse(f *os.File, img sparseImage) error {
+	size, err := img.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get image size: %w", err)
+	}
+
+	// The extents are collected before reading them, as the image must not be read from within the callback.
+	type extent struct{ offset, length uint64 }
+	var extents []extent
+	if err := img.DiffIterate(librbd.DiffIterateConfig{
+		Offset:        0,
+		Length:        size,
+		IncludeParent: librbd.IncludeParent,
+		Callback: func(offset, length uint64, exists int, _ interface{}) int {
+			if exists != 0 {
+				extents = append(extents, extent{offset, length})
+			}
+			return 0
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to iterate allocated extents: %w", err)
+	}
+
+	buf := make([]byte, exportChunkSize)
+	for _, e := range extents {
+		section := io.NewSectionReader(img, int64(e.offset), int64(e.length))
+		if _, err := io.CopyBuffer(io.NewOffsetWriter(f, int64(e.offset)), section, buf); err != nil {
+			return fmt.Errorf("failed to copy extent at offset %d: %w", e.offset, err)
+		}
+	}
+
+	if err := f.Truncate(int64(size)); err != nil {
+		return fmt.Errorf("failed to truncate rootfs file: %w", err)
+	}
+	return nil
+}
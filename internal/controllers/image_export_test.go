@@ -0,0 +1,329 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	ironcoreimage "github.com/ironcore-dev/ironcore-image"
+	"github.com/ironcore-dev/ironcore-image/oci/image"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+)
+
+// fakeSparseImage is an rbd image of the given size with data only in its extents, keyed by their offset.
+type fakeSparseImage struct {
+	size    uint64
+	extents map[uint64][]byte
+	reads   []string
+	closed  bool
+}
+
+func (i *fakeSparseImage) GetSize() (uint64, error) {
+	return i.size, nil
+}
+
+func (i *fakeSparseImage) DiffIterate(config librbd.DiffIterateConfig) error {
+	for _, offset := range slices.Sorted(maps.Keys(i.extents)) {
+		config.Callback(offset, uint64(len(i.extents[offset])), 1, config.Data)
+	}
+	return nil
+}
+
+func (i *fakeSparseImage) ReadAt(p []byte, off int64) (int, error) {
+	i.reads = append(i.reads, fmt.Sprintf("%d+%d", off, len(p)))
+	for start, data := range i.extents {
+		if uint64(off) >= start && uint64(off) < start+uint64(len(data)) {
+			return copy(p, data[uint64(off)-start:]), nil
+		}
+	}
+	return 0, fmt.Errorf("read of unallocated offset %d", off)
+}
+
+func (i *fakeSparseImage) Close() error {
+	i.closed = true
+	return nil
+}
+
+// fakeImageReader serves the images keyed by pool/image and records the snapshots they were read from.
+type fakeImageReader struct {
+	images    map[string]*fakeSparseImage
+	snapNames []string
+}
+
+func (r *fakeImageReader) OpenSnapshotReader(pool, imageName, snapName string) (sparseImage, error) {
+	img, ok := r.images[pool+"/"+imageName]
+	if !ok {
+		return nil, fmt.Errorf("failed to open image %s: %w", imageName, librbd.ErrNotFound)
+	}
+	r.snapNames = append(r.snapNames, snapName)
+	return img, nil
+}
+
+// testRegistry is an in-memory registry implementing the parts of the distribution api used to push and pull
+// images with monolithic blob uploads.
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	uploads   int
+	manifests map[string]testManifest
+}
+
+type testManifest struct {
+	mediaType string
+	data      []byte
+}
+
+func newTestRegistry() *testRegistry {
+	return &testRegistry{
+		blobs:     make(map[digest.Digest][]byte),
+		manifests: make(map[string]testManifest),
+	}
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if req.URL.Path == "/v2/" {
+		return
+	}
+
+	name, rest, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/")
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	kind, ref, _ := strings.Cut(rest, "/")
+
+	switch {
+	case kind == "blobs" && req.Method == http.MethodPost && ref == "uploads/":
+		reg.uploads++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", name, reg.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case kind == "blobs" && req.Method == http.MethodPut && strings.HasPrefix(ref, "uploads/"):
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dgst := digest.Digest(req.URL.Query().Get("digest"))
+		if digest.FromBytes(data) != dgst {
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		reg.blobs[dgst] = data
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	case kind == "blobs" && (req.Method == http.MethodHead || req.Method == http.MethodGet):
+		data, ok := reg.blobs[digest.Digest(ref)]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		reg.serveContent(w, req, "application/octet-stream", data)
+	case kind == "manifests" && req.Method == http.MethodPut:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dgst := digest.FromBytes(data)
+		manifest := testManifest{mediaType: req.Header.Get("Content-Type"), data: data}
+		reg.manifests[ref] = manifest
+		reg.manifests[dgst.String()] = manifest
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	case kind == "manifests" && (req.Method == http.MethodHead || req.Method == http.MethodGet):
+		manifest, ok := reg.manifests[ref]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		reg.serveContent(w, req, manifest.mediaType, manifest.data)
+	default:
+		http.Error(w, "unsupported request", http.StatusMethodNotAllowed)
+	}
+}
+
+func (reg *testRegistry) serveContent(w http.ResponseWriter, req *http.Request, mediaType string, data []byte) {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+var _ = Describe("ExportImage", func() {
+	var (
+		r        *ImageReconciler
+		rbdImg   *fakeSparseImage
+		reader   *fakeImageReader
+		server   *httptest.Server
+		resolver = docker.NewResolver(docker.ResolverOptions{
+			Hosts: docker.ConfigureDefaultRegistries(docker.WithPlainHTTP(docker.MatchLocalhost)),
+		})
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		rbdImg = &fakeSparseImage{
+			size: 64,
+			extents: map[uint64][]byte{
+				8:  []byte("golden"),
+				40: []byte("image"),
+			},
+		}
+		reader = &fakeImageReader{images: map[string]*fakeSparseImage{"pool/img_foo": rbdImg}}
+		r.rbdReader = reader
+
+		server = httptest.NewServer(newTestRegistry())
+		DeferCleanup(server.Close)
+		r.newImageSink = func() (image.Sink, error) {
+			return &registrySink{resolver: resolver}, nil
+		}
+
+		_, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should push the image and record the digest", func(ctx SpecContext) {
+		ref := strings.TrimPrefix(server.URL, "http://") + "/golden:latest"
+
+		dgst, err := r.ExportImage(ctx, "foo", ref)
+		Expect(err).NotTo(HaveOccurred())
+		By("reading a temporary snapshot")
+		Expect(reader.snapNames).To(ConsistOf(ExportSnapshotName))
+		Expect(rbdImg.closed).To(BeTrue())
+		By("reading only the allocated extents")
+		Expect(rbdImg.reads).To(ConsistOf(HavePrefix("8+"), HavePrefix("40+")))
+
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Status.LastExport).To(SatisfyAll(
+			HaveField("Reference", ref),
+			HaveField("Digest", dgst),
+		))
+
+		By("pulling the pushed image")
+		pushed, err := (&registrySource{resolver: resolver}).Resolve(ctx, ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed.Descriptor().Digest.String()).To(Equal(dgst))
+
+		osImg, err := ironcoreimage.ResolveImage(ctx, pushed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(osImg.RootFS).NotTo(BeNil())
+		rc, err := osImg.RootFS.Content(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = rc.Close() }()
+		rootFS, err := io.ReadAll(rc)
+		Expect(err).NotTo(HaveOccurred())
+
+		expected := make([]byte, 64)
+		copy(expected[8:], "golden")
+		copy(expected[40:], "image")
+		Expect(rootFS).To(Equal(expected))
+	})
+
+	It("should reject images that are not available", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "bar"},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.ExportImage(ctx, "bar", "registry.example.com/golden:latest")
+		Expect(err).To(MatchError(ErrImageNotExportable))
+	})
+
+	It("should reject exports while the maintenance mode is on", func(ctx SpecContext) {
+		r.maintenance = newMaintenanceBacklog(maintenance.NewMode(logr.Discard(), true), time.Hour, r.queue)
+
+		_, err := r.ExportImage(ctx, "foo", "registry.example.com/golden:latest")
+		Expect(err).To(MatchError(ErrImageNotExportable))
+		Expect(reader.snapNames).To(BeEmpty())
+		Expect(r.isExporting("foo")).To(BeFalse())
+	})
+
+	It("should reject exports of an image that is already being exported", func(ctx SpecContext) {
+		r.exports.Insert("foo")
+
+		_, err := r.ExportImage(ctx, "foo", "registry.example.com/golden:latest")
+		Expect(err).To(MatchError(ContainSubstring("already being exported")))
+		Expect(reader.snapNames).To(BeEmpty())
+	})
+
+	It("should defer the deletion of an image while it is exported", func(ctx SpecContext) {
+		r.exports.Insert("foo")
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		img.Finalizers = []string{r.finalizer}
+
+		By("returning before the rbd image is touched")
+		Expect(r.deleteImage(ctx, r.log, nil, img)).To(Succeed())
+		Expect(img.Finalizers).To(ConsistOf(r.finalizer))
+		By("retrying the deletion after a delay")
+		Expect(r.queue.Len()).To(BeZero())
+	})
+
+	It("should keep the image status if the push fails", func(ctx SpecContext) {
+		server.Close()
+		ref := strings.TrimPrefix(server.URL, "http://") + "/golden:latest"
+
+		_, err := r.ExportImage(ctx, "foo", ref)
+		Expect(err).To(HaveOccurred())
+
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Status.LastExport).To(BeNil())
+	})
+})
+
+var _ = Describe("writeSparse", func() {
+	It("should leave unallocated regions as holes", func() {
+		img := &fakeSparseImage{
+			size:    3*exportChunkSize + 16,
+			extents: map[uint64][]byte{exportChunkSize: bytes.Repeat([]byte{1}, exportChunkSize+8)},
+		}
+		f, err := os.Create(filepath.Join(GinkgoT().TempDir(), "rootfs"))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = f.Close() }()
+
+		Expect(writeSparse(f, img)).To(Succeed())
+		Expect(img.reads).To(HaveLen(2))
+
+		data, err := os.ReadFile(f.Name())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveLen(3*exportChunkSize + 16))
+		Expect(data[:exportChunkSize]).To(Equal(make([]byte, exportChunkSize)))
+		Expect(data[exportChunkSize : 2*exportChunkSize+8]).To(Equal(bytes.Repeat([]byte{1}, exportChunkSize+8)))
+		Expect(data[2*exportChunkSize+8:]).To(Equal(make([]byte, exportChunkSize+8)))
+	})
+})
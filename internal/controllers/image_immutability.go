@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// immutableFieldChangedReason is the reason of the Reconciled condition of available images whose spec changes fields
+// that are immutable once provisioned.
+const immutableFieldChangedReason = "ImmutableFieldChanged"
+
+// enforceImmutableFields checks the spec of the available image against the state it was provisioned with, see
+// providerapi.ValidateProvisionedImage, and reports whether it violates it. Violating images keep their state and rbd
+// image, the violation is recorded as Reconciled condition and they are not reconciled further until their spec is
+// reverted. The returned image replaces the given one.
+func (r *ImageReconciler) enforceImmutableFields(ctx context.Context, log logr.Logger, img *providerapi.Image) (*providerapi.Image, bool, error) {
+	size, err := r.provisionedImageSize(img)
+	if err != nil {
+		return nil, false, err
+	}
+
+	errs := providerapi.ValidateProvisionedImage(img, size)
+	if len(errs) == 0 {
+		condition, ok := img.Status.GetCondition(providerapi.ImageConditionReconciled)
+		if !ok || condition.Reason != immutableFieldChangedReason {
+			return img, false, nil
+		}
+
+		img.Status.RemoveCondition(providerapi.ImageConditionReconciled)
+		img.Status.LastError = ""
+		if img, err = r.images.Update(ctx, img); err != nil {
+			return nil, false, fmt.Errorf("failed to clear immutable field violation: %w", err)
+		}
+		log.V(1).Info("Image spec no longer changes immutable fields")
+		return img, false, nil
+	}
+
+	message := errs.ToAggregate().Error()
+	log.Info("Refusing to reconcile image changing immutable fields", "Error", message)
+	changed := img.Status.SetCondition(providerapi.ImageCondition{
+		Type:    providerapi.ImageConditionReconciled,
+		Status:  providerapi.ConditionFalse,
+		Reason:  immutableFieldChangedReason,
+		Message: message,
+	})
+	if !changed && img.Status.ReconciledSpecHash == "" {
+		return img, true, nil
+	}
+
+	img.Status.LastError = message
+	// Without the hash of the last reconciled spec, reverting the spec reconciles the image and clears the condition.
+	img.Status.ReconciledSpecHash = ""
+	if img, err = r.images.Update(ctx, img); err != nil {
+		return nil, false, fmt.Errorf("failed to record immutable field violation: %w", err)
+	}
+	if changed {
+		r.Eventf(img.Metadata, corev1.EventTypeWarning, immutableFieldChangedReason, "Refusing to reconcile image: %s", message)
+	}
+	return img, true, nil
+}
+
+// needsSnapshotRefBackfill reports whether the available image was provisioned from a snapshot before the snapshot
+// was recorded in its status, see backfillSnapshotRef.
+func needsSnapshotRefBackfill(img *providerapi.Image) bool {
+	return img.Status.State == providerapi.ImageStateAvailable && img.Status.SnapshotRef == "" && img.Spec.SnapshotRef != nil
+}
+
+// backfillSnapshotRef records the snapshot of available images provisioned before it was recorded in their status,
+// so that changes of their snapshotRef are refused from then on. The returned image replaces the given one.
+func (r *ImageReconciler) backfillSnapshotRef(ctx context.Context, log logr.Logger, img *providerapi.Image) (*providerapi.Image, error) {
+	if !needsSnapshotRefBackfill(img) {
+		return img, nil
+	}
+
+	img.Status.SnapshotRef = *img.Spec.SnapshotRef
+	img, err := r.images.Update(ctx, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to backfill snapshot ref: %w", err)
+	}
+	log.V(1).Info("Backfilled snapshot ref of provisioned image", "snapshotRef", img.Status.SnapshotRef)
+	return img, nil
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("immutable fields", func() {
+	const gib = 1024 * 1024 * 1024
+
+	var (
+		r     *ImageReconciler
+		conns *countingConnAccessor
+		img   *providerapi.Image
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		conns = &countingConnAccessor{}
+		r.conns = conns
+
+		img, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{ImageFinalizer}},
+			Spec:     providerapi.ImageSpec{Size: 2 * gib, SnapshotRef: ptr.To("snap")},
+			Status: providerapi.ImageStatus{
+				State:              providerapi.ImageStateAvailable,
+				Size:               2 * gib,
+				SnapshotRef:        "snap",
+				ReconciledSpecHash: "hash",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	expectViolation := func(ctx SpecContext, field string) {
+		GinkgoHelper()
+		stored, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Status.State).To(Equal(providerapi.ImageStateAvailable))
+		Expect(stored.Status.ReconciledSpecHash).To(BeEmpty())
+		Expect(stored.Status.Conditions).To(ConsistOf(SatisfyAll(
+			HaveField("Type", providerapi.ImageConditionReconciled),
+			HaveField("Status", providerapi.ConditionFalse),
+			HaveField("Reason", immutableFieldChangedReason),
+			HaveField("Message", ContainSubstring(field)),
+		)))
+	}
+
+	It("should refuse to shrink an available image", func(ctx SpecContext) {
+		img.Spec.Size = gib
+		_, err := r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(Succeed())
+		Expect(conns.calls).To(BeZero())
+		expectViolation(ctx, "spec.size")
+	})
+
+	It("should refuse to change the snapshot of an available image", func(ctx SpecContext) {
+		img.Spec.SnapshotRef = ptr.To("other")
+		_, err := r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(Succeed())
+		Expect(conns.calls).To(BeZero())
+		expectViolation(ctx, "spec.snapshotRef")
+	})
+
+	It("should refuse to change the snapshot of an image provisioned before the snapshot was recorded", func(ctx SpecContext) {
+		var err error
+		img.Status.SnapshotRef = ""
+		img.Status.ReconciledSpecHash, err = r.imageSpecHash(img)
+		Expect(err).NotTo(HaveOccurred())
+		img, err = r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.isImageReconciled(ctx, "foo")).To(BeFalse())
+
+		img, err = r.backfillSnapshotRef(ctx, logr.Discard(), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.SnapshotRef", "snap"))
+		Expect(r.isImageReconciled(ctx, "foo")).To(BeTrue())
+
+		img.Spec.SnapshotRef = ptr.To("other")
+		_, err = r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(Succeed())
+		Expect(conns.calls).To(BeZero())
+		expectViolation(ctx, "spec.snapshotRef")
+	})
+
+	It("should allow growing an available image", func(ctx SpecContext) {
+		img.Spec.Size = 4 * gib
+		_, violated, err := r.enforceImmutableFields(ctx, logr.Discard(), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violated).To(BeFalse())
+	})
+
+	It("should clear the violation once the spec is reverted", func(ctx SpecContext) {
+		img.Spec.Size = gib
+		img, violated, err := r.enforceImmutableFields(ctx, logr.Discard(), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violated).To(BeTrue())
+
+		img.Spec.Size = 2 * gib
+		img, violated, err = r.enforceImmutableFields(ctx, logr.Discard(), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violated).To(BeFalse())
+		Expect(img.Status.Conditions).To(BeEmpty())
+		Expect(img.Status.LastError).To(BeEmpty())
+	})
+})
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/utils/ptr"
+)
+
+// ErrImageAlreadyImported is returned if the rbd image to import is already tracked by an image.
+var ErrImageAlreadyImported = errors.New("rbd image is already tracked by an image")
+
+// ImageImport identifies an existing rbd image to register as an image.
+type ImageImport struct {
+	// ID is the id of the image to create.
+	ID string
+	// Pool is the pool of the rbd image. Defaults to the pool of the reconciler.
+	Pool string
+	// RBDName is the name of the rbd image.
+	RBDName string
+}
+
+// rbdImageSizer reads the size of existing rbd images.
+type rbdImageSizer interface {
+	ImageSize(pool, imageName string) (uint64, error)
+}
+
+// ImportImage registers an existing rbd image as an available image without creating it, e.g. to migrate volumes
+// into the provider. The rbd image is kept as is and managed like any other image afterwards, i.e. it is removed
+// once the image is deleted.
+func (r *ImageReconciler) ImportImage(ctx context.Context, imp ImageImport) (*providerapi.Image, error) {
+	if imp.ID == "" {
+		return nil, fmt.Errorf("must specify image id")
+	}
+	if err := validateRBDName(imp.RBDName); err != nil {
+		return nil, err
+	}
+	pool := imp.Pool
+	if pool == "" {
+		pool = r.pool
+	}
+
+	log := r.log.WithValues("imageId", imp.ID, "Pool", pool, "RBDName", imp.RBDName)
+
+	if _, err := r.images.Get(ctx, imp.ID); !errors.Is(err, store.ErrNotFound) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image: %w", err)
+		}
+		return nil, fmt.Errorf("image %s %w", imp.ID, store.ErrAlreadyExists)
+	}
+
+	images, err := r.images.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	for _, other := range images {
+		if r.imagePool(other) == pool && RBDImageName(other) == imp.RBDName {
+			return nil, fmt.Errorf("%w %s: %s/%s", ErrImageAlreadyImported, other.ID, pool, imp.RBDName)
+		}
+	}
+
+	size, err := r.rbdImages.ImageSize(pool, imp.RBDName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get size of rbd image %s/%s: %w", pool, imp.RBDName, err)
+	}
+
+	img, err := r.createAvailableImage(ctx, log, &providerapi.Image{
+		Metadata: apiutils.Metadata{ID: imp.ID},
+		Spec: providerapi.ImageSpec{
+			Size:    size,
+			Pool:    pool,
+			RBDName: imp.RBDName,
+		},
+		Status: providerapi.ImageStatus{
+			Pool:    pool,
+			RBDName: imp.RBDName,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Imported rbd image", "Size", size)
+	return img, nil
+}
+
+// createAvailableImage creates the image for an existing rbd image in state available, with the access to the rbd
+// image. The pool and name of the rbd image are taken from the status of the image.
+func (r *ImageReconciler) createAvailableImage(ctx context.Context, log logr.Logger, img *providerapi.Image) (*providerapi.Image, error) {
+	img.Finalizers = []string{r.finalizer}
+	img.Status.State = providerapi.ImageStateAvailable
+	img.Status.Size = img.Spec.Size
+	img.Status.CreatedAt = ptr.To(r.now())
+
+	user, key, err := r.imageCredentials(ctx, log, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+	img.Status.Access = r.imageAccess(img, user, key)
+
+	img, err = r.images.Create(ctx, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image: %w", err)
+	}
+	return img, nil
+}
+
+type connImageSizer struct {
+	conns     ceph.ConnAccessor
+	namespace string
+}
+
+func (s *connImageSizer) ImageSize(pool, imageName string) (uint64, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(s.conns, pool, s.namespace)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	img, err := librbd.OpenImageReadOnly(ioCtx, imageName, librbd.NoSnapshot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open image %s: %w", imageName, err)
+	}
+	defer func() { _ = img.Close() }()
+
+	return img.GetSize()
+}
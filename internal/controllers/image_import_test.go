@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/round"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeImageSizer map[string]uint64
+
+func (s fakeImageSizer) ImageSize(pool, imageName string) (uint64, error) {
+	size, ok := s[pool+"/"+imageName]
+	if !ok {
+		return 0, fmt.Errorf("failed to open image %s: %w", imageName, librbd.ErrNotFound)
+	}
+	return size, nil
+}
+
+var _ = Describe("ImportImage", func() {
+	var r *ImageReconciler
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		r.cephClient = &fakeCephClient{response: []byte(`{"key":"secret"}`)}
+		r.rbdImages = fakeImageSizer{
+			"pool/legacy":  1024 * 1024 * 1024,
+			"other/legacy": 2 * 1024 * 1024 * 1024,
+		}
+	})
+
+	It("should register an existing rbd image as an available image", func(ctx SpecContext) {
+		img, err := r.ImportImage(ctx, ImageImport{ID: "foo", RBDName: "legacy"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(img.Finalizers).To(ConsistOf(ImageFinalizer))
+		Expect(img.Spec.Size).To(BeEquivalentTo(1024 * 1024 * 1024))
+		Expect(img.Status.State).To(Equal(providerapi.ImageStateAvailable))
+		Expect(img.Status.Size).To(BeEquivalentTo(1024 * 1024 * 1024))
+		Expect(RBDImageName(img)).To(Equal("legacy"))
+		Expect(img.Status.Access).To(SatisfyAll(
+			HaveField("Monitors", "10.0.0.1:6789"),
+			HaveField("Handle", "pool/legacy"),
+			HaveField("User", "volumes"),
+			HaveField("UserKey", "secret"),
+		))
+
+		stored, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Status.State).To(Equal(providerapi.ImageStateAvailable))
+	})
+
+	It("should not round up the size of an imported rbd image", func(ctx SpecContext) {
+		r.sizeRounding = round.Strategy{Mode: round.ModeUp, Alignment: 4 * 1024 * 1024 * 1024}
+
+		img, err := r.ImportImage(ctx, ImageImport{ID: "foo", RBDName: "legacy"})
+		Expect(err).NotTo(HaveOccurred())
+
+		rbdImage := &fakeImageResizer{size: 1024 * 1024 * 1024}
+		Expect(r.resizeImage(ctx, logr.Discard(), rbdImage, img)).To(Succeed())
+		Expect(rbdImage.resizes).To(BeEmpty())
+	})
+
+	It("should import an rbd image of another pool without migrating it", func(ctx SpecContext) {
+		img, err := r.ImportImage(ctx, ImageImport{ID: "foo", Pool: "other", RBDName: "legacy"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.imagePool(img)).To(Equal("other"))
+		Expect(r.desiredImagePool(img)).To(Equal("other"))
+		Expect(img.Status.Access.Handle).To(Equal("other/legacy"))
+	})
+
+	It("should reject importing an rbd image twice", func(ctx SpecContext) {
+		_, err := r.ImportImage(ctx, ImageImport{ID: "foo", RBDName: "legacy"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.ImportImage(ctx, ImageImport{ID: "bar", RBDName: "legacy"})
+		Expect(err).To(MatchError(ErrImageAlreadyImported))
+
+		_, err = r.ImportImage(ctx, ImageImport{ID: "foo", Pool: "other", RBDName: "legacy"})
+		Expect(err).To(MatchError(store.ErrAlreadyExists))
+
+		images, err := r.images.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(HaveLen(1))
+	})
+
+	It("should reject importing an rbd image tracked by a created image", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "bar"},
+			Spec:     providerapi.ImageSpec{RBDName: "legacy"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.ImportImage(ctx, ImageImport{ID: "foo", RBDName: "legacy"})
+		Expect(err).To(MatchError(ErrImageAlreadyImported))
+	})
+
+	It("should fail if the rbd image does not exist", func(ctx SpecContext) {
+		_, err := r.ImportImage(ctx, ImageImport{ID: "foo", RBDName: "missing"})
+		Expect(err).To(MatchError(librbd.ErrNotFound))
+
+		_, err = r.images.Get(ctx, "foo")
+		Expect(err).To(MatchError(store.ErrNotFound))
+	})
+
+	It("should reject rbd image names managed by the provider", func(ctx SpecContext) {
+		_, err := r.ImportImage(ctx, ImageImport{ID: "foo", RBDName: ImageIDToRBDID("bar")})
+		Expect(err).To(MatchError(ErrInvalidRBDName))
+	})
+})
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// LabelMetadataPrefix is the prefix of the rbd image metadata keys the exported labels of images are stored under, so
+// that they neither clash with the metadata of librbd nor with the one of the provider.
+const LabelMetadataPrefix = "ironcore.label."
+
+func labelMetadataKey(label string) string {
+	return LabelMetadataPrefix + label
+}
+
+// exportedLabels returns the labels of the image that are exported to its rbd image.
+func (r *ImageReconciler) exportedLabels(image *providerapi.Image) map[string]string {
+	labels := make(map[string]string)
+	for _, key := range r.exportedLabelKeys {
+		if value, ok := image.Labels[key]; ok {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// diffLabels returns the label metadata to set and to remove so the current metadata matches the desired labels.
+func diffLabels(current, desired map[string]string) (set map[string]string, remove []string) {
+	set = make(map[string]string)
+	for label, value := range desired {
+		if key := labelMetadataKey(label); current[key] != value {
+			set[key] = value
+		}
+	}
+
+	for key := range current {
+		if !strings.HasPrefix(key, LabelMetadataPrefix) {
+			continue
+		}
+		if _, ok := desired[strings.TrimPrefix(key, LabelMetadataPrefix)]; !ok {
+			remove = append(remove, key)
+		}
+	}
+	slices.Sort(remove)
+	return set, remove
+}
+
+// syncImageLabels writes the exported labels of the image as rbd image metadata and removes the metadata of labels
+// that are no longer set or exported, e.g. the ones a clone inherited from its parent.
+func (r *ImageReconciler) syncImageLabels(log logr.Logger, md imageMetadata, image *providerapi.Image) error {
+	current, err := md.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list image metadata: %w", err)
+	}
+
+	set, remove := diffLabels(current, r.exportedLabels(image))
+	if len(set) == 0 && len(remove) == 0 {
+		log.V(2).Info("No update needed: Image labels unchanged")
+		return nil
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(set)) {
+		if err := md.SetMetadata(key, set[key]); err != nil {
+			return fmt.Errorf("failed to set label (%s): %w", key, err)
+		}
+	}
+	for _, key := range remove {
+		if err := md.RemoveMetadata(key); err != nil {
+			return fmt.Errorf("failed to remove label (%s): %w", key, err)
+		}
+	}
+	log.V(1).Info("Updated image labels", "changed", len(set), "removed", len(remove))
+	return nil
+}
+
+// setImageLabels exports the labels of a newly created image to its rbd image.
+func (r *ImageReconciler) setImageLabels(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	img, err := openImage(ioCtx, RBDImageName(image))
+	if err != nil {
+		return err
+	}
+	defer closeImage(log, img)
+
+	return r.syncImageLabels(log, img, image)
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("image labels", func() {
+	var (
+		r   *ImageReconciler
+		md  fakeImageMetadata
+		img *providerapi.Image
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{ExportedLabels: []string{"team", "env"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		md = fakeImageMetadata{
+			WWNKey:                        "wwn",
+			LimitMetadataPrefix + "limit": "1",
+		}
+		img = &providerapi.Image{
+			Metadata: apiutils.Metadata{
+				ID:     "foo",
+				Labels: map[string]string{"team": "storage", "env": "prod", "internal": "secret"},
+			},
+		}
+	})
+
+	It("should write the exported labels as rbd image metadata", func() {
+		Expect(r.syncImageLabels(logr.Discard(), md, img)).To(Succeed())
+		Expect(md).To(Equal(fakeImageMetadata{
+			WWNKey:                        "wwn",
+			LimitMetadataPrefix + "limit": "1",
+			LabelMetadataPrefix + "team":  "storage",
+			LabelMetadataPrefix + "env":   "prod",
+		}))
+	})
+
+	It("should propagate label updates and removals", func() {
+		Expect(r.syncImageLabels(logr.Discard(), md, img)).To(Succeed())
+
+		img.Labels = map[string]string{"team": "compute"}
+		Expect(r.syncImageLabels(logr.Discard(), md, img)).To(Succeed())
+		Expect(md).To(Equal(fakeImageMetadata{
+			WWNKey:                        "wwn",
+			LimitMetadataPrefix + "limit": "1",
+			LabelMetadataPrefix + "team":  "compute",
+		}))
+	})
+
+	It("should remove labels that are no longer exported", func() {
+		md[LabelMetadataPrefix+"internal"] = "inherited"
+		Expect(r.syncImageLabels(logr.Discard(), md, img)).To(Succeed())
+		Expect(md).NotTo(HaveKey(LabelMetadataPrefix + "internal"))
+	})
+
+	It("should change the spec hash when an exported label changes", func() {
+		before, err := r.imageSpecHash(img)
+		Expect(err).NotTo(HaveOccurred())
+
+		img.Labels["internal"] = "other"
+		unexported, err := r.imageSpecHash(img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unexported).To(Equal(before))
+
+		img.Labels["env"] = "staging"
+		after, err := r.imageSpecHash(img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).NotTo(Equal(before))
+	})
+
+	It("should reject empty label keys", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{ExportedLabels: []string{""}})
+		Expect(err).To(MatchError(ContainSubstring("exported label keys must not be empty")))
+	})
+})
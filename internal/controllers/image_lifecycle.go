@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// ImageLifecycleEventType is the lifecycle transition an image went through.
+type ImageLifecycleEventType string
+
+const (
+	// ImageLifecycleCreated is emitted once the reconciler took over the image by adding its finalizer.
+	ImageLifecycleCreated ImageLifecycleEventType = "Created"
+	// ImageLifecyclePopulating is emitted once the rbd image of the image was created and is being provisioned.
+	ImageLifecyclePopulating ImageLifecycleEventType = "Populating"
+	// ImageLifecycleAvailable is emitted once the image became available.
+	ImageLifecycleAvailable ImageLifecycleEventType = "Available"
+	// ImageLifecycleResized is emitted once the rbd image of an available image was resized to its requested size.
+	ImageLifecycleResized ImageLifecycleEventType = "Resized"
+	// ImageLifecycleFailed is emitted once the reconciler gave up on the image.
+	ImageLifecycleFailed ImageLifecycleEventType = "Failed"
+	// ImageLifecycleDeleted is emitted once the rbd image of a deleted image was removed and its finalizer released.
+	ImageLifecycleDeleted ImageLifecycleEventType = "Deleted"
+)
+
+// ImageLifecycleEvent is a lifecycle transition of an image.
+type ImageLifecycleEvent struct {
+	Type ImageLifecycleEventType
+	// Image is the image as stored after the transition. It must not be modified.
+	Image *providerapi.Image
+	Time  time.Time
+}
+
+// ImageLifecycleSink receives the lifecycle transitions of the images. Each transition is emitted once, after it was
+// persisted in the image store. Emit is called from the reconcile workers and must not block.
+type ImageLifecycleSink interface {
+	Emit(evt ImageLifecycleEvent)
+}
+
+// ImageLifecycleSinkFunc is a function implementing ImageLifecycleSink.
+type ImageLifecycleSinkFunc func(evt ImageLifecycleEvent)
+
+func (f ImageLifecycleSinkFunc) Emit(evt ImageLifecycleEvent) {
+	f(evt)
+}
+
+// emitLifecycleEvent emits the lifecycle transition of the image to the lifecycle sink, if any.
+func (r *ImageReconciler) emitLifecycleEvent(img *providerapi.Image, typ ImageLifecycleEventType) {
+	if r.lifecycleSink == nil {
+		return
+	}
+	r.lifecycleSink.Emit(ImageLifecycleEvent{
+		Type:  typ,
+		Image: img,
+		Time:  r.now(),
+	})
+}
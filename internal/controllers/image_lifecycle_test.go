@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Image lifecycle", func() {
+	var (
+		r      *ImageReconciler
+		events []ImageLifecycleEvent
+	)
+
+	BeforeEach(func() {
+		events = nil
+
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{
+			LifecycleSink: ImageLifecycleSinkFunc(func(evt ImageLifecycleEvent) {
+				events = append(events, evt)
+			}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+
+		r.reconcile = func(ctx context.Context, id string) error {
+			return r.reconcileImageWithIOContext(ctx, nil, id)
+		}
+	})
+
+	reconcileAll := func(ctx context.Context, times int) {
+		for range times {
+			r.queue.Add("foo")
+			Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+		}
+	}
+
+	It("should emit each transition once", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Size: 1024, Features: []string{"teleportation"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconcileAll(ctx, 3)
+
+		Expect(events).To(HaveExactElements(
+			SatisfyAll(
+				HaveField("Type", ImageLifecycleCreated),
+				HaveField("Image.Finalizers", ConsistOf(ImageFinalizer)),
+			),
+			SatisfyAll(
+				HaveField("Type", ImageLifecycleFailed),
+				HaveField("Image.Status.State", providerapi.ImageStateFailed),
+			),
+		))
+		Expect(events[0].Image.ID).To(Equal("foo"))
+		Expect(events[1].Time).NotTo(BeZero())
+	})
+
+	It("should not emit a failure of an image that is gone", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{ImageFinalizer}},
+			Spec:     providerapi.ImageSpec{Size: 1024, Features: []string{"teleportation"}},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.images.Delete(ctx, "foo")).To(Succeed())
+
+		_, err = r.markImageFailed(ctx, "foo", "", ErrInvalidImageSpec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+})
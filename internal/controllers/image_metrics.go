@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type imageMetrics struct {
+	provisioningDuration prometheus.Histogram
+}
+
+func newImageMetrics() imageMetrics {
+	return imageMetrics{
+		provisioningDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "cephlet_image_provisioning_duration_seconds",
+			Help:    "Time from the start of provisioning an image until it is available.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		}),
+	}
+}
+
+// RegisterMetrics registers the image metrics: the provisioning latency.
+func (r *ImageReconciler) RegisterMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(r.metrics.provisioningDuration)
+}
+
+// recordProvisioningDuration stores and observes the provisioning duration of an image becoming available.
+// Images provisioned before their provisioning start was recorded are measured from their creation.
+func (r *ImageReconciler) recordProvisioningDuration(img *providerapi.Image) {
+	if img.Status.ProvisioningDuration != 0 {
+		return
+	}
+
+	createdAt := img.CreatedAt
+	if img.Status.CreatedAt != nil {
+		createdAt = *img.Status.CreatedAt
+	}
+	img.Status.ProvisioningDuration = r.now().Sub(createdAt)
+	r.metrics.provisioningDuration.Observe(img.Status.ProvisioningDuration.Seconds())
+}
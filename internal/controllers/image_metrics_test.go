@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Image metrics", func() {
+	var (
+		r   *ImageReconciler
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		now = time.Unix(1700000000, 0)
+		r.now = func() time.Time { return now }
+	})
+
+	It("should record the provisioning start when adding the finalizer", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(Succeed())
+
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Finalizers).To(ContainElement(ImageFinalizer))
+		Expect(img.Status.CreatedAt).To(HaveValue(BeTemporally("==", now)))
+	})
+
+	It("should populate and observe the provisioning duration once the image is available", func() {
+		img := &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Status:   providerapi.ImageStatus{CreatedAt: ptr.To(now.Add(-time.Minute))},
+		}
+
+		r.recordProvisioningDuration(img)
+		Expect(img.Status.ProvisioningDuration).To(Equal(time.Minute))
+
+		metric := &dto.Metric{}
+		Expect(r.metrics.provisioningDuration.Write(metric)).To(Succeed())
+		Expect(metric.GetHistogram().GetSampleCount()).To(BeEquivalentTo(1))
+		Expect(metric.GetHistogram().GetSampleSum()).To(Equal(time.Minute.Seconds()))
+
+		By("not recording the duration again")
+		duration := img.Status.ProvisioningDuration
+		r.recordProvisioningDuration(img)
+		Expect(img.Status.ProvisioningDuration).To(Equal(duration))
+		Expect(r.metrics.provisioningDuration.Write(metric)).To(Succeed())
+		Expect(metric.GetHistogram().GetSampleCount()).To(BeEquivalentTo(1))
+	})
+
+	It("should measure images without a recorded provisioning start from their creation", func() {
+		img := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo", CreatedAt: now.Add(-time.Hour)}}
+
+		r.recordProvisioningDuration(img)
+		Expect(img.Status.ProvisioningDuration).To(Equal(time.Hour))
+	})
+})
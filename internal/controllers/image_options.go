@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// ImageFormat is the rbd image format images are created with.
+type ImageFormat uint64
+
+const (
+	// ImageFormatV1 is the legacy rbd image format. It supports neither image features nor cloning.
+	ImageFormatV1 ImageFormat = 1
+	// ImageFormatV2 is the rbd image format supporting image features like layering, which cloning relies on.
+	ImageFormatV2 ImageFormat = 2
+)
+
+// ErrIncompatibleImageFormat is returned if an image requests features the configured image format doesn't support.
+var ErrIncompatibleImageFormat = errors.New("incompatible image format")
+
+// validateImageFormat checks that the image can be created with the image format.
+func validateImageFormat(format ImageFormat, image *providerapi.Image) error {
+	if format != ImageFormatV1 {
+		return nil
+	}
+
+	spec := image.Spec
+	switch {
+	case len(spec.Features) > 0:
+		return fmt.Errorf("%w: image format %d does not support image features, got %v", ErrIncompatibleImageFormat, format, spec.Features)
+	case spec.SnapshotRef != nil || spec.TemplateRef != nil:
+		return fmt.Errorf("%w: image format %d does not support cloning images", ErrIncompatibleImageFormat, format)
+	case spec.DataPool != "":
+		return fmt.Errorf("%w: image format %d does not support a data pool", ErrIncompatibleImageFormat, format)
+	case spec.StripeUnit != 0:
+		return fmt.Errorf("%w: image format %d does not support striping", ErrIncompatibleImageFormat, format)
+	default:
+		return nil
+	}
+}
+
+// imageFeatures maps the feature names accepted in the image spec to the corresponding librbd feature bits.
+var imageFeatures = map[string]uint64{
+	providerapi.ImageFeatureLayering:      librbd.FeatureLayering,
+	providerapi.ImageFeatureStriping:      librbd.FeatureStripingV2,
+	providerapi.ImageFeatureExclusiveLock: librbd.FeatureExclusiveLock,
+	providerapi.ImageFeatureObjectMap:     librbd.FeatureObjectMap,
+	providerapi.ImageFeatureFastDiff:      librbd.FeatureFastDiff,
+	providerapi.ImageFeatureDeepFlatten:   librbd.FeatureDeepFlatten,
+	providerapi.ImageFeatureJournaling:    librbd.FeatureJournaling,
+}
+
+func imageFeatureBits(features []string) (uint64, error) {
+	var bits uint64
+	for _, feature := range features {
+		bit, ok := imageFeatures[feature]
+		if !ok {
+			return 0, fmt.Errorf("unknown image feature %q", feature)
+		}
+		bits |= bit
+	}
+	return bits, nil
+}
+
+// imageObjectOrder validates the requested object size and striping of an image and returns the
+// object order (log2 of the object size). An order of 0 means the librbd default is used.
+func imageObjectOrder(spec providerapi.ImageSpec) (uint64, error) {
+	objectSize := spec.ObjectSizeBytes
+	if objectSize != 0 && objectSize&(objectSize-1) != 0 {
+		return 0, fmt.Errorf("object size %d must be a power of two", objectSize)
+	}
+
+	if (spec.StripeUnit == 0) != (spec.StripeCount == 0) {
+		return 0, fmt.Errorf("stripe unit and stripe count must be specified together")
+	}
+
+	if spec.StripeUnit != 0 {
+		if objectSize == 0 {
+			return 0, fmt.Errorf("object size must be specified when striping is configured")
+		}
+		if objectSize%spec.StripeUnit != 0 {
+			return 0, fmt.Errorf("stripe unit %d must evenly divide object size %d", spec.StripeUnit, objectSize)
+		}
+	}
+
+	if objectSize == 0 {
+		return 0, nil
+	}
+	return uint64(bits.TrailingZeros64(objectSize)), nil
+}
+
+// imageDataPool returns the pool storing the data objects of the image. The image metadata always resides in the
+// reconciler pool, the data may be placed in a distinct (e.g. erasure-coded) pool.
+func (r *ImageReconciler) imageDataPool(image *providerapi.Image) string {
+	if image.Spec.DataPool != "" {
+		return image.Spec.DataPool
+	}
+	return r.pool
+}
+
+func (r *ImageReconciler) newImageOptions(image *providerapi.Image) (*librbd.ImageOptions, error) {
+	options := librbd.NewRbdImageOptions()
+	if err := r.configureImageOptions(options, image); err != nil {
+		options.Destroy()
+		return nil, err
+	}
+	return options, nil
+}
+
+// imageOptionSetter is the subset of rbd image options operations used to configure the options of an image.
+type imageOptionSetter interface {
+	SetString(option librbd.ImageOption, value string) error
+	SetUint64(option librbd.ImageOption, value uint64) error
+}
+
+func (r *ImageReconciler) configureImageOptions(options imageOptionSetter, image *providerapi.Image) error {
+	if err := validateImageFormat(r.imageFormat, image); err != nil {
+		return err
+	}
+
+	if err := options.SetUint64(librbd.ImageOptionFormat, uint64(r.imageFormat)); err != nil {
+		return fmt.Errorf("failed to set image format: %w", err)
+	}
+
+	dataPool := r.imageDataPool(image)
+	if dataPool != r.pool {
+		if _, err := r.cephClient.GetPoolByName(dataPool); err != nil {
+			return fmt.Errorf("failed to look up data pool %s: %w", dataPool, err)
+		}
+	}
+
+	// Images of format 1 have no separate data pool, their data always resides in the reconciler pool.
+	if r.imageFormat != ImageFormatV1 {
+		if err := options.SetString(librbd.ImageOptionDataPool, dataPool); err != nil {
+			return fmt.Errorf("failed to set data pool: %w", err)
+		}
+	}
+
+	if len(image.Spec.Features) > 0 {
+		features, err := imageFeatureBits(image.Spec.Features)
+		if err != nil {
+			return err
+		}
+		if err := options.SetUint64(librbd.ImageOptionFeatures, features); err != nil {
+			return fmt.Errorf("failed to set image features: %w", err)
+		}
+	}
+
+	order, err := imageObjectOrder(image.Spec)
+	if err != nil {
+		return err
+	}
+	if order != 0 {
+		if err := options.SetUint64(librbd.ImageOptionOrder, order); err != nil {
+			return fmt.Errorf("failed to set object order: %w", err)
+		}
+	}
+
+	if image.Spec.StripeUnit != 0 {
+		if err := options.SetUint64(librbd.ImageOptionStripeUnit, image.Spec.StripeUnit); err != nil {
+			return fmt.Errorf("failed to set stripe unit: %w", err)
+		}
+		if err := options.SetUint64(librbd.ImageOptionStripeCount, image.Spec.StripeCount); err != nil {
+			return fmt.Errorf("failed to set stripe count: %w", err)
+		}
+	}
+
+	return nil
+}
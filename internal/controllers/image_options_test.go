@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	librbd "github.com/ceph/go-ceph/rbd"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Image options", func() {
+	Context("imageFeatureBits", func() {
+		It("should return no bits for empty features", func() {
+			bits, err := imageFeatureBits(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bits).To(BeZero())
+		})
+
+		It("should combine multiple features", func() {
+			bits, err := imageFeatureBits([]string{"layering", "exclusive-lock", "object-map", "fast-diff"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bits).To(Equal(librbd.FeatureLayering | librbd.FeatureExclusiveLock | librbd.FeatureObjectMap | librbd.FeatureFastDiff))
+		})
+
+		It("should reject unknown features", func() {
+			_, err := imageFeatureBits([]string{"layering", "foo"})
+			Expect(err).To(MatchError(ContainSubstring(`unknown image feature "foo"`)))
+		})
+	})
+})
+
+var _ = Describe("Image data pool", func() {
+	var r *ImageReconciler
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{Pool: "rbd"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should fall back to the reconciler pool", func() {
+		Expect(r.imageDataPool(&providerapi.Image{})).To(Equal("rbd"))
+	})
+
+	It("should use a distinct data pool if specified", func() {
+		Expect(r.imageDataPool(&providerapi.Image{Spec: providerapi.ImageSpec{DataPool: "rbd-ec"}})).To(Equal("rbd-ec"))
+	})
+})
+
+var _ = Describe("Image geometry", func() {
+	It("should use the librbd default when no object size is set", func() {
+		Expect(imageObjectOrder(providerapi.ImageSpec{})).To(BeZero())
+	})
+
+	It("should derive the object order from the object size", func() {
+		Expect(imageObjectOrder(providerapi.ImageSpec{ObjectSizeBytes: 8 * 1024 * 1024})).To(Equal(uint64(23)))
+	})
+
+	It("should reject an object size that is not a power of two", func() {
+		_, err := imageObjectOrder(providerapi.ImageSpec{ObjectSizeBytes: 3 * 1024 * 1024})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should accept a stripe unit evenly dividing the object size", func() {
+		Expect(imageObjectOrder(providerapi.ImageSpec{
+			ObjectSizeBytes: 4 * 1024 * 1024,
+			StripeUnit:      64 * 1024,
+			StripeCount:     16,
+		})).To(Equal(uint64(22)))
+	})
+
+	It("should reject a stripe unit not dividing the object size", func() {
+		_, err := imageObjectOrder(providerapi.ImageSpec{
+			ObjectSizeBytes: 4 * 1024 * 1024,
+			StripeUnit:      3 * 1024,
+			StripeCount:     16,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// fakeImageOptions records the rbd image options set on it.
+type fakeImageOptions map[librbd.ImageOption]any
+
+func (o fakeImageOptions) SetString(option librbd.ImageOption, value string) error {
+	o[option] = value
+	return nil
+}
+
+func (o fakeImageOptions) SetUint64(option librbd.ImageOption, value uint64) error {
+	o[option] = value
+	return nil
+}
+
+var _ = Describe("Image format", func() {
+	It("should create images of format 2 by default", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		options := fakeImageOptions{}
+		Expect(r.configureImageOptions(options, &providerapi.Image{
+			Spec: providerapi.ImageSpec{Features: []string{providerapi.ImageFeatureLayering}},
+		})).To(Succeed())
+		Expect(options).To(HaveKeyWithValue(librbd.ImageOptionFormat, uint64(ImageFormatV2)))
+		Expect(options).To(HaveKeyWithValue(librbd.ImageOptionFeatures, librbd.FeatureLayering))
+	})
+
+	It("should create images of format 1 without a data pool if configured", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{ImageFormat: ImageFormatV1})
+		Expect(err).NotTo(HaveOccurred())
+
+		options := fakeImageOptions{}
+		Expect(r.configureImageOptions(options, &providerapi.Image{})).To(Succeed())
+		Expect(options).To(Equal(fakeImageOptions{librbd.ImageOptionFormat: uint64(ImageFormatV1)}))
+	})
+
+	DescribeTable("should reject images of format 1 requesting unsupported features",
+		func(spec providerapi.ImageSpec) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{ImageFormat: ImageFormatV1})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = r.configureImageOptions(fakeImageOptions{}, &providerapi.Image{Spec: spec})
+			Expect(err).To(MatchError(ErrIncompatibleImageFormat))
+
+			reason, terminal := terminalErrorReason(err)
+			Expect(terminal).To(BeTrue())
+			Expect(reason).To(Equal("IncompatibleImageFormat"))
+		},
+		Entry("layering", providerapi.ImageSpec{Features: []string{providerapi.ImageFeatureLayering}}),
+		Entry("clone of a snapshot", providerapi.ImageSpec{SnapshotRef: ptr.To("foo")}),
+		Entry("clone of a template", providerapi.ImageSpec{TemplateRef: ptr.To("foo")}),
+		Entry("data pool", providerapi.ImageSpec{DataPool: "rbd-ec"}),
+	)
+
+	It("should reject an unsupported image format", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{ImageFormat: 3})
+		Expect(err).To(MatchError(ContainSubstring("unsupported image format 3")))
+	})
+})
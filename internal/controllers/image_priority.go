@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"container/heap"
+	"sync"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// priorityAging is the number of images enqueued after a queued image that raise its priority by one, so that images
+// of a low priority are not starved by a steady stream of images of a higher priority.
+const priorityAging = 64
+
+// imagePriorityIndex maps image ids to the priority of their image.
+type imagePriorityIndex struct {
+	mu      sync.RWMutex
+	byImage map[string]int32
+}
+
+func newImagePriorityIndex() *imagePriorityIndex {
+	return &imagePriorityIndex{byImage: make(map[string]int32)}
+}
+
+// set records the priority of the image, replacing any previous priority.
+func (i *imagePriorityIndex) set(img *providerapi.Image) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if img.Spec.Priority == 0 {
+		delete(i.byImage, img.ID)
+		return
+	}
+	i.byImage[img.ID] = img.Spec.Priority
+}
+
+// delete removes the image from the index.
+func (i *imagePriorityIndex) delete(imageID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.byImage, imageID)
+}
+
+// priorityOf returns the priority of the image, 0 for images that are not indexed.
+func (i *imagePriorityIndex) priorityOf(imageID string) int32 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.byImage[imageID]
+}
+
+// newImageWorkqueue creates the rate limited workqueue of image ids, handing out the ids of images of a higher
+// priority first.
+func newImageWorkqueue(priorities *imagePriorityIndex) workqueue.TypedRateLimitingInterface[string] {
+	return workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.DefaultTypedControllerRateLimiter[string](),
+		workqueue.TypedRateLimitingQueueConfig[string]{
+			DelayingQueue: workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[string]{
+				Queue: workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[string]{
+					Queue: newImagePriorityQueue(priorities),
+				}),
+			}),
+		},
+	)
+}
+
+// imagePriorityQueue orders queued image ids by the priority of their image, higher priorities first and images of
+// the same priority in the order they were enqueued. Queued images age by one priority per priorityAging images
+// enqueued after them. It backs a workqueue, which serializes the calls to it.
+type imagePriorityQueue struct {
+	priorities *imagePriorityIndex
+	seq        int64
+	items      priorityHeap
+	byID       map[string]*priorityItem
+}
+
+func newImagePriorityQueue(priorities *imagePriorityIndex) *imagePriorityQueue {
+	return &imagePriorityQueue{
+		priorities: priorities,
+		byID:       make(map[string]*priorityItem),
+	}
+}
+
+// Touch re-ranks a queued image, as its priority may have changed since it was enqueued.
+func (q *imagePriorityQueue) Touch(id string) {
+	item, ok := q.byID[id]
+	if !ok {
+		return
+	}
+	item.rank = q.rank(id, item.seq)
+	heap.Fix(&q.items, item.index)
+}
+
+func (q *imagePriorityQueue) Push(id string) {
+	q.seq++
+	item := &priorityItem{id: id, seq: q.seq, rank: q.rank(id, q.seq)}
+	q.byID[id] = item
+	heap.Push(&q.items, item)
+}
+
+func (q *imagePriorityQueue) Len() int {
+	return len(q.items)
+}
+
+func (q *imagePriorityQueue) Pop() string {
+	item := heap.Pop(&q.items).(*priorityItem)
+	delete(q.byID, item.id)
+	return item.id
+}
+
+// rank orders an image enqueued as seq-th image, as its priority rises by one per priorityAging images enqueued
+// after it, the rank is static while it is queued.
+func (q *imagePriorityQueue) rank(id string, seq int64) int64 {
+	return int64(q.priorities.priorityOf(id))*priorityAging - seq
+}
+
+type priorityItem struct {
+	id    string
+	seq   int64
+	rank  int64
+	index int
+}
+
+// priorityHeap is a max-heap of priority items by rank, items of the same rank are ordered by their sequence.
+type priorityHeap []*priorityItem
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank > h[j].rank
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *priorityHeap) Push(x any) {
+	item := x.(*priorityItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *priorityHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
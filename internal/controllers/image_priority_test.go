@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("image priority queue", func() {
+	var r *ImageReconciler
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+	})
+
+	index := func(id string, priority int32) {
+		r.indexImage(event.Event[*providerapi.Image]{
+			Type: event.TypeUpdated,
+			Object: &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: id},
+				Spec:     providerapi.ImageSpec{Priority: priority},
+			},
+		})
+	}
+
+	next := func() string {
+		id, shutdown := r.queue.Get()
+		Expect(shutdown).To(BeFalse())
+		r.queue.Done(id)
+		return id
+	}
+
+	It("should hand out a high priority image enqueued after a backlog first", func() {
+		for i := range 10 {
+			r.queue.Add(fmt.Sprintf("data-%d", i))
+		}
+		index("boot", 10)
+		r.queue.Add("boot")
+
+		Expect(next()).To(Equal("boot"))
+		for i := range 10 {
+			Expect(next()).To(Equal(fmt.Sprintf("data-%d", i)))
+		}
+	})
+
+	It("should re-rank a queued image whose priority changed", func() {
+		r.queue.Add("foo")
+		r.queue.Add("bar")
+		index("bar", 1)
+		r.queue.Add("bar")
+
+		Expect(next()).To(Equal("bar"))
+		Expect(next()).To(Equal("foo"))
+	})
+
+	It("should not starve low priority images", func() {
+		r.queue.Add("data")
+
+		var handedOut int
+		for i := 0; ; i++ {
+			id := fmt.Sprintf("boot-%d", i)
+			index(id, 1)
+			r.queue.Add(id)
+
+			handedOut++
+			if next() == "data" {
+				break
+			}
+			Expect(handedOut).To(BeNumerically("<=", priorityAging+1))
+		}
+	})
+
+	It("should forget the priority of deleted images", func() {
+		index("foo", 5)
+		r.indexImage(event.Event[*providerapi.Image]{
+			Type:   event.TypeDeleted,
+			Object: &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}},
+		})
+		Expect(r.imagePriorities.priorityOf("foo")).To(BeZero())
+	})
+})
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// resyncImages enqueues all images of the store, so that images whose events were missed are reconciled.
+func (r *ImageReconciler) resyncImages(ctx context.Context) error {
+	count := 0
+	if err := listPages(ctx, r.images, func(imgs []*providerapi.Image) error {
+		for _, img := range imgs {
+			r.queue.Add(img.ID)
+		}
+		count += len(imgs)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+	r.log.V(2).Info("Resynced images", "Count", count)
+	return nil
+}
+
+func (r *ImageReconciler) startResync(ctx context.Context) {
+	ticker := time.NewTicker(r.resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.resyncImages(ctx); err != nil {
+				r.log.Error(err, "Failed to resync images")
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/paging"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Image resync", func() {
+	It("should reject a negative resync period", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{ResyncPeriod: -time.Second})
+		Expect(err).To(MatchError(ContainSubstring("resync period must not be negative")))
+	})
+
+	It("should enqueue all images after a resync tick", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{ResyncPeriod: 10 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+
+		for _, id := range []string{"foo", "bar", "baz"} {
+			_, err := r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: id}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(r.queue.Len()).To(BeZero())
+
+		go r.startResync(ctx)
+
+		Eventually(r.queue.Len).Should(Equal(3))
+		var ids []string
+		for r.queue.Len() > 0 {
+			id, _ := r.queue.Get()
+			r.queue.Done(id)
+			ids = append(ids, id)
+		}
+		Expect(ids).To(ConsistOf("foo", "bar", "baz"))
+	})
+
+	It("should enqueue the images page by page", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+
+		for i := range paging.DefaultLimit + 1 {
+			_, err := r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: strconv.Itoa(i)}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(r.resyncImages(ctx)).To(Succeed())
+		Expect(r.queue.Len()).To(Equal(paging.DefaultLimit + 1))
+		Expect(r.images.(*memoryStore[*providerapi.Image]).pages).To(Equal(2))
+	})
+})
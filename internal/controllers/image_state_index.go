@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+)
+
+// imageStateIndex maps image states to the IDs of the images in that state.
+type imageStateIndex struct {
+	mu      sync.RWMutex
+	byState map[providerapi.ImageState]map[string]struct{}
+	byImage map[string]providerapi.ImageState
+}
+
+func newImageStateIndex() *imageStateIndex {
+	return &imageStateIndex{
+		byState: make(map[providerapi.ImageState]map[string]struct{}),
+		byImage: make(map[string]providerapi.ImageState),
+	}
+}
+
+// set records the state of the image, replacing any previous state.
+func (i *imageStateIndex) set(img *providerapi.Image) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(img.ID)
+
+	state := img.Status.State
+	imageIDs, ok := i.byState[state]
+	if !ok {
+		imageIDs = make(map[string]struct{})
+		i.byState[state] = imageIDs
+	}
+	imageIDs[img.ID] = struct{}{}
+	i.byImage[img.ID] = state
+}
+
+// delete removes the image from the index.
+func (i *imageStateIndex) delete(imageID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(imageID)
+}
+
+func (i *imageStateIndex) remove(imageID string) {
+	state, ok := i.byImage[imageID]
+	if !ok {
+		return
+	}
+
+	delete(i.byImage, imageID)
+	delete(i.byState[state], imageID)
+	if len(i.byState[state]) == 0 {
+		delete(i.byState, state)
+	}
+}
+
+// imagesIn returns the sorted IDs of the images in the state.
+func (i *imageStateIndex) imagesIn(state providerapi.ImageState) []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	imageIDs := make([]string, 0, len(i.byState[state]))
+	for imageID := range i.byState[state] {
+		imageIDs = append(imageIDs, imageID)
+	}
+	slices.Sort(imageIDs)
+	return imageIDs
+}
+
+// ListImagesByState returns the images in the state. The index is maintained from the image events once the
+// reconciler is started, images whose state changed since they were indexed are left out.
+func (r *ImageReconciler) ListImagesByState(ctx context.Context, state providerapi.ImageState) ([]*providerapi.Image, error) {
+	var images []*providerapi.Image
+	for _, imageID := range r.imageStates.imagesIn(state) {
+		img, err := r.images.Get(ctx, imageID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get image %s: %w", imageID, err)
+		}
+		if img.Status.State != state {
+			continue
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
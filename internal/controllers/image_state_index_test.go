@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListImagesByState", func() {
+	var r *ImageReconciler
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		for id, state := range map[string]providerapi.ImageState{
+			"available-1": providerapi.ImageStateAvailable,
+			"available-2": providerapi.ImageStateAvailable,
+			"pending":     providerapi.ImageStatePending,
+			"failed":      providerapi.ImageStateFailed,
+		} {
+			img, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: id},
+				Status:   providerapi.ImageStatus{State: state},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			r.indexImage(event.Event[*providerapi.Image]{Type: event.TypeCreated, Object: img})
+		}
+	})
+
+	imageIDs := func(images []*providerapi.Image) []string {
+		ids := make([]string, 0, len(images))
+		for _, img := range images {
+			ids = append(ids, img.ID)
+		}
+		return ids
+	}
+
+	DescribeTable("should list the images in the state",
+		func(ctx SpecContext, state providerapi.ImageState, expected []string) {
+			images, err := r.ListImagesByState(ctx, state)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(imageIDs(images)).To(Equal(expected))
+		},
+		Entry("available", providerapi.ImageStateAvailable, []string{"available-1", "available-2"}),
+		Entry("pending", providerapi.ImageStatePending, []string{"pending"}),
+		Entry("failed", providerapi.ImageStateFailed, []string{"failed"}),
+		Entry("validated", providerapi.ImageStateValidated, []string{}),
+	)
+
+	It("should move images whose state changed", func(ctx SpecContext) {
+		img, err := r.images.Get(ctx, "pending")
+		Expect(err).NotTo(HaveOccurred())
+		img.Status.State = providerapi.ImageStateAvailable
+		img, err = r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+		r.indexImage(event.Event[*providerapi.Image]{Type: event.TypeUpdated, Object: img})
+
+		Expect(r.ListImagesByState(ctx, providerapi.ImageStatePending)).To(BeEmpty())
+		images, err := r.ListImagesByState(ctx, providerapi.ImageStateAvailable)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imageIDs(images)).To(Equal([]string{"available-1", "available-2", "pending"}))
+	})
+
+	It("should not list deleted images", func(ctx SpecContext) {
+		img, err := r.images.Get(ctx, "failed")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.images.Delete(ctx, "failed")).To(Succeed())
+		r.indexImage(event.Event[*providerapi.Image]{Type: event.TypeDeleted, Object: img})
+
+		Expect(r.ListImagesByState(ctx, providerapi.ImageStateFailed)).To(BeEmpty())
+		Expect(r.imageStates.imagesIn(providerapi.ImageStateFailed)).To(BeEmpty())
+	})
+
+	It("should leave out images whose state changed since they were indexed", func(ctx SpecContext) {
+		img, err := r.images.Get(ctx, "available-1")
+		Expect(err).NotTo(HaveOccurred())
+		img.Status.State = providerapi.ImageStateFailed
+		_, err = r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+
+		images, err := r.ListImagesByState(ctx, providerapi.ImageStateAvailable)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imageIDs(images)).To(Equal([]string{"available-2"}))
+	})
+})
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TemplateSnapshotName is the name of the protected rbd snapshot of a template the images referencing it are
+// cloned from.
+const TemplateSnapshotName = "ironcore-template"
+
+// rbdTemplateSnapshots manages the protected rbd snapshots of templates.
+type rbdTemplateSnapshots interface {
+	// EnsureSnapshot creates and protects the snapshot of the rbd image unless it exists and protects an existing
+	// unprotected one. It reports whether it created the snapshot.
+	EnsureSnapshot(log logr.Logger, pool, imageName, snapName string) (bool, error)
+	// RemoveSnapshot flattens the clones of the snapshot of the rbd image and removes the snapshot, if it exists.
+	RemoveSnapshot(log logr.Logger, pool, imageName, snapName string) error
+}
+
+type connTemplateSnapshots struct {
+	conns     ceph.ConnAccessor
+	namespace string
+}
+
+func (s *connTemplateSnapshots) EnsureSnapshot(log logr.Logger, pool, imageName, snapName string) (bool, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(s.conns, pool, s.namespace)
+	if err != nil {
+		return false, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	exists, protected, err := snapshotExistsAndProtected(log, ioCtx, imageName, snapName)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case !exists:
+		return true, createSnapshot(log, ioCtx, snapName, imageName)
+	case !protected:
+		return false, protectSnapshot(log, ioCtx, imageName, snapName)
+	default:
+		return false, nil
+	}
+}
+
+func (s *connTemplateSnapshots) RemoveSnapshot(log logr.Logger, pool, imageName, snapName string) error {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(s.conns, pool, s.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	exists, _, err := snapshotExistsAndProtected(log, ioCtx, imageName, snapName)
+	if err != nil || !exists {
+		return err
+	}
+
+	if err := flattenSnapshotChildren(log, s.conns, s.namespace, ioCtx, imageName, snapName); err != nil {
+		return err
+	}
+
+	img, err := openImage(ioCtx, imageName)
+	if err != nil {
+		return err
+	}
+	defer closeImage(log, img)
+
+	if err := removeSnapshot(img.GetSnapshot(snapName)); err != nil {
+		return err
+	}
+	log.V(1).Info("Removed snapshot", "ImageName", imageName, "SnapName", snapName)
+	return nil
+}
+
+// flattenSnapshotChildren flattens the clones of the snapshot of the rbd image.
+func flattenSnapshotChildren(log logr.Logger, conns ceph.ConnAccessor, namespace string, ioCtx *rados.IOContext, imageName, snapName string) error {
+	img, err := librbd.OpenImageReadOnly(ioCtx, imageName, snapName)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot %s@%s: %w", imageName, snapName, err)
+	}
+	defer closeImage(log, img)
+
+	return flattenChildImages(log, conns, namespace, img)
+}
+
+// templateParent is the rbd snapshot of a template images are cloned from.
+type templateParent struct {
+	pool      string
+	imageName string
+	snapName  string
+}
+
+// prepareTemplateClone returns the rbd snapshot to clone the image from, creating it on the first clone of the
+// template. It returns nil and records the reason in the image conditions while the template is not available.
+func (r *ImageReconciler) prepareTemplateClone(ctx context.Context, log logr.Logger, image *providerapi.Image, templateRef string) (*templateParent, error) {
+	template, err := r.images.Get(ctx, templateRef)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("failed to get template: %w", err)
+		}
+		log.V(1).Info("Template not found", "templateId", templateRef)
+		image.Status.SetCondition(providerapi.ImageCondition{
+			Type:    providerapi.ImageConditionTemplateReady,
+			Status:  providerapi.ConditionFalse,
+			Reason:  "TemplateNotFound",
+			Message: fmt.Sprintf("template %s not found", templateRef),
+		})
+		r.requeueWaitingImage(log, image)
+		return nil, nil
+	}
+
+	if template.DeletedAt != nil || template.Status.State != providerapi.ImageStateAvailable {
+		log.V(1).Info("Template is not available", "templateId", templateRef, "state", template.Status.State)
+		image.Status.SetCondition(providerapi.ImageCondition{
+			Type:    providerapi.ImageConditionTemplateReady,
+			Status:  providerapi.ConditionFalse,
+			Reason:  "TemplateNotAvailable",
+			Message: fmt.Sprintf("template %s is in state %s", templateRef, template.Status.State),
+		})
+		r.requeueWaitingImage(log, image)
+		return nil, nil
+	}
+
+	if template.Status.Size > image.Spec.Size {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "ImageSizeIsSmallerThanTemplateSize", "image %s size is smaller than template size: %d < %d", image.ID, image.Spec.Size, template.Status.Size)
+		return nil, fmt.Errorf("image %s size is smaller than template size: (%d < %d)", image.ID, image.Spec.Size, template.Status.Size)
+	}
+
+	parent := &templateParent{
+		pool:      r.imagePool(template),
+		imageName: RBDImageName(template),
+		snapName:  TemplateSnapshotName,
+	}
+	created, err := r.templateSnapshots.EnsureSnapshot(log, parent.pool, parent.imageName, parent.snapName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure template snapshot: %w", err)
+	}
+	if created {
+		log.V(1).Info("Created template snapshot", "templateId", templateRef)
+		r.Eventf(template.Metadata, corev1.EventTypeNormal, "CreatedTemplateSnapshot", "Created snapshot %s to clone images from", parent.snapName)
+	}
+
+	image.Status.RemoveCondition(providerapi.ImageConditionTemplateReady)
+	return parent, nil
+}
+
+func (r *ImageReconciler) createImageFromTemplate(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image, templateRef string, options *librbd.ImageOptions) (_ bool, retErr error) {
+	ctx, span := r.startSpan(ctx, "createImageFromTemplate", r.imageSpanAttributes(image)...)
+	defer func() { endSpan(span, retErr) }()
+
+	parent, err := r.prepareTemplateClone(ctx, log, image, templateRef)
+	if err != nil || parent == nil {
+		return false, err
+	}
+
+	img, err := r.cloneImage(log, ioCtx, image, parent.pool, parent.imageName, parent.snapName, options)
+	if err != nil {
+		return false, err
+	}
+	closeImage(log, img)
+
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "CreateImageFromTemplateSucceeded", "Created image from template %s. bytes: %d", templateRef, image.Spec.Size)
+	return true, nil
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+// fakeTemplateSnapshots records the template snapshots as pool/image@snapshot.
+type fakeTemplateSnapshots struct {
+	snapshots map[string]bool
+	created   int
+}
+
+func (f *fakeTemplateSnapshots) EnsureSnapshot(_ logr.Logger, pool, imageName, snapName string) (bool, error) {
+	key := pool + "/" + imageName + "@" + snapName
+	if f.snapshots[key] {
+		return false, nil
+	}
+	f.snapshots[key] = true
+	f.created++
+	return true, nil
+}
+
+func (f *fakeTemplateSnapshots) RemoveSnapshot(_ logr.Logger, pool, imageName, snapName string) error {
+	delete(f.snapshots, pool+"/"+imageName+"@"+snapName)
+	return nil
+}
+
+var _ = Describe("Template clones", func() {
+	var (
+		r         *ImageReconciler
+		snapshots *fakeTemplateSnapshots
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		snapshots = &fakeTemplateSnapshots{snapshots: map[string]bool{}}
+		r.templateSnapshots = snapshots
+
+		_, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "template"},
+			Spec:     providerapi.ImageSpec{Size: 1024},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable, Size: 1024},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	cloneOf := func(id string) *providerapi.Image {
+		return &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: id},
+			Spec:     providerapi.ImageSpec{Size: 2048, TemplateRef: ptr.To("template")},
+		}
+	}
+
+	It("should create the template snapshot on the first clone", func(ctx SpecContext) {
+		parent, err := r.prepareTemplateClone(ctx, logr.Discard(), cloneOf("foo"), "template")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parent).To(Equal(&templateParent{pool: "pool", imageName: "img_template", snapName: TemplateSnapshotName}))
+		Expect(snapshots.snapshots).To(HaveKey("pool/img_template@" + TemplateSnapshotName))
+		Expect(snapshots.created).To(Equal(1))
+	})
+
+	It("should reuse the template snapshot on subsequent clones", func(ctx SpecContext) {
+		for _, id := range []string{"foo", "bar"} {
+			parent, err := r.prepareTemplateClone(ctx, logr.Discard(), cloneOf(id), "template")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parent.snapName).To(Equal(TemplateSnapshotName))
+		}
+		Expect(snapshots.created).To(Equal(1))
+	})
+
+	It("should wait for the template to become available", func(ctx SpecContext) {
+		template, err := r.images.Get(ctx, "template")
+		Expect(err).NotTo(HaveOccurred())
+		template.Status.State = providerapi.ImageStatePending
+		_, err = r.images.Update(ctx, template)
+		Expect(err).NotTo(HaveOccurred())
+
+		img := cloneOf("foo")
+		parent, err := r.prepareTemplateClone(ctx, logr.Discard(), img, "template")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parent).To(BeNil())
+		Expect(snapshots.created).To(BeZero())
+		Expect(img.Status.Conditions).To(ContainElement(SatisfyAll(
+			HaveField("Type", providerapi.ImageConditionTemplateReady),
+			HaveField("Reason", "TemplateNotAvailable"),
+		)))
+	})
+
+	It("should report a missing template", func(ctx SpecContext) {
+		img := cloneOf("foo")
+		parent, err := r.prepareTemplateClone(ctx, logr.Discard(), img, "missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parent).To(BeNil())
+		Expect(img.Status.Conditions).To(ContainElement(HaveField("Reason", "TemplateNotFound")))
+	})
+
+	It("should index the clones of a template", func() {
+		r.indexImage(event.Event[*providerapi.Image]{Type: event.TypeCreated, Object: cloneOf("foo")})
+		Expect(r.templateImages.imagesFor("template")).To(ConsistOf("foo"))
+	})
+})
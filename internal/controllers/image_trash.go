@@ -0,0 +1,508 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DefaultTrashPurgeInterval = 1 * time.Hour
+
+	// TrashRecordObject is the rados object the pools and names of the rbd images moved to the trash are recorded
+	// in, so that the TrashPurger finds them in any pool and regardless of their name.
+	TrashRecordObject = "ironcore.trash"
+
+	// trashRecordGracePeriod is the time a record is kept even if its rbd image is not in the trash, as the rbd
+	// image is moved to the trash only after it was recorded.
+	trashRecordGracePeriod = 1 * time.Minute
+)
+
+var (
+	// ErrImageNotInTrash is returned if the rbd image of the image to restore is not in the trash, e.g. because it
+	// was removed without trash retention or purged already.
+	ErrImageNotInTrash = errors.New("rbd image is not in the trash")
+	// ErrImageTrashExpired is returned if the retention of the trashed rbd image of the image to restore has passed.
+	ErrImageTrashExpired = errors.New("trash retention of rbd image has passed")
+	// ErrImageNotRecorded is returned if the image of the trashed rbd image to restore was not recorded when it was
+	// deleted, so that its spec, e.g. its encryption, cannot be restored.
+	ErrImageNotRecorded = errors.New("image of trashed rbd image is not recorded")
+)
+
+// rbdImageRemover removes the rbd images of deleted images, either immediately or by moving them to the trash.
+type rbdImageRemover interface {
+	RemoveImage(ioCtx *rados.IOContext, name string) error
+	TrashImage(ioCtx *rados.IOContext, name string, retention time.Duration) error
+}
+
+type librbdImageRemover struct{}
+
+func (librbdImageRemover) RemoveImage(ioCtx *rados.IOContext, name string) error {
+	return librbd.RemoveImage(ioCtx, name)
+}
+
+func (librbdImageRemover) TrashImage(ioCtx *rados.IOContext, name string, retention time.Duration) error {
+	return librbd.GetImage(ioCtx, name).Trash(retention)
+}
+
+// removeRBDImage removes the rbd image of a deleted image. With a trash retention, the rbd image is recorded along with
+// the image and moved to the trash instead, from where it can be restored until the retention has passed and the
+// TrashPurger removes it.
+func (r *ImageReconciler) removeRBDImage(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	name := RBDImageName(image)
+	if r.trashRetention == 0 {
+		if err := r.rbdRemover.RemoveImage(ioCtx, name); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+			return fmt.Errorf("failed to remove rbd image: %w", err)
+		}
+		log.V(2).Info("Rbd image deleted")
+		return nil
+	}
+
+	record := trashRecord{
+		Pool:       r.imagePool(image),
+		Name:       name,
+		RecordedAt: r.now(),
+		Image:      newTrashedImage(image),
+	}
+	if err := r.trashRecords.Record(record); err != nil {
+		return fmt.Errorf("failed to record trashed rbd image: %w", err)
+	}
+	if err := r.rbdRemover.TrashImage(ioCtx, name, r.trashRetention); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to move rbd image to trash: %w", err)
+	}
+	log.V(1).Info("Moved rbd image to trash", "Retention", r.trashRetention)
+	return nil
+}
+
+// rbdImageTrash restores trashed rbd images of a pool.
+type rbdImageTrash interface {
+	ListTrash(pool string) ([]librbd.TrashInfo, error)
+	RestoreTrash(pool, id, name string) error
+}
+
+// RestoreImage restores a deleted image whose rbd image is still in the trash. The image is re-created in state
+// available with the spec and labels it was deleted with and fresh access to the restored rbd image. Only images of
+// the pool of the reconciler with the rbd image name derived from their id can be restored, and only if the image was
+// recorded when its rbd image was trashed.
+func (r *ImageReconciler) RestoreImage(ctx context.Context, id string) (*providerapi.Image, error) {
+	if id == "" {
+		return nil, fmt.Errorf("must specify image id")
+	}
+	rbdName := ImageIDToRBDID(id)
+	log := r.log.WithValues("imageId", id, "Pool", r.pool, "RBDName", rbdName)
+
+	if _, err := r.images.Get(ctx, id); !errors.Is(err, store.ErrNotFound) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image: %w", err)
+		}
+		return nil, fmt.Errorf("image %s %w", id, store.ErrAlreadyExists)
+	}
+
+	infos, err := r.rbdTrash.ListTrash(r.pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rbd trash: %w", err)
+	}
+	idx := slices.IndexFunc(infos, func(info librbd.TrashInfo) bool { return info.Name == rbdName })
+	if idx < 0 {
+		return nil, fmt.Errorf("%w: %s/%s", ErrImageNotInTrash, r.pool, rbdName)
+	}
+	info := infos[idx]
+	if !r.now().Before(info.DefermentEndTime) {
+		return nil, fmt.Errorf("%w: %s/%s expired at %s", ErrImageTrashExpired, r.pool, rbdName, info.DefermentEndTime)
+	}
+
+	// Without the recorded spec, an encrypted image would be restored without its passphrase and its header formatted
+	// again, so images trashed before they were recorded are not restored.
+	records, err := r.trashRecords.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash records: %w", err)
+	}
+	idx = slices.IndexFunc(records, func(record trashRecord) bool {
+		return record.Pool == r.pool && record.Name == rbdName && record.Image != nil
+	})
+	if idx < 0 {
+		return nil, fmt.Errorf("%w: %s/%s", ErrImageNotRecorded, r.pool, rbdName)
+	}
+	trashed := records[idx].Image
+
+	if err := r.rbdTrash.RestoreTrash(r.pool, info.Id, rbdName); err != nil {
+		return nil, fmt.Errorf("failed to restore rbd image from trash: %w", err)
+	}
+	log.V(1).Info("Restored rbd image from trash", "TrashID", info.Id)
+
+	size, err := r.rbdImages.ImageSize(r.pool, rbdName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get size of rbd image %s/%s: %w", r.pool, rbdName, err)
+	}
+
+	img := trashed.image(id)
+	img.Spec.Size = size
+	img.Status.RBDName = rbdName
+	img, err = r.createAvailableImage(ctx, log, img)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reference of the deleted image to its snapshot was dropped.
+	if err := r.addSnapshotRef(ctx, log, img); err != nil {
+		return nil, err
+	}
+
+	log.Info("Restored image", "Size", size)
+	return img, nil
+}
+
+type connImageTrash struct {
+	conns     ceph.ConnAccessor
+	namespace string
+}
+
+func (t *connImageTrash) ListTrash(pool string) ([]librbd.TrashInfo, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(t.conns, pool, t.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return librbd.GetTrashList(ioCtx)
+}
+
+func (t *connImageTrash) RestoreTrash(pool, id, name string) error {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(t.conns, pool, t.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return librbd.TrashRestore(ioCtx, id, name)
+}
+
+func (t *connImageTrash) RemoveTrash(pool, id string) error {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(t.conns, pool, t.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return librbd.TrashRemove(ioCtx, id, false)
+}
+
+// trashRecord is an rbd image moved to the trash by the ImageReconciler.
+type trashRecord struct {
+	Pool       string
+	Name       string
+	RecordedAt time.Time
+	// Image is the deleted image of the rbd image. It is nil for rbd images recorded before images were.
+	Image *trashedImage
+}
+
+// trashedImage is the part of a deleted image needed to restore it, i.e. everything but its state and access.
+type trashedImage struct {
+	Labels         map[string]string           `json:"labels,omitempty"`
+	Annotations    map[string]string           `json:"annotations,omitempty"`
+	Spec           providerapi.ImageSpec       `json:"spec"`
+	Encryption     providerapi.EncryptionState `json:"encryption,omitempty"`
+	WWN            string                      `json:"wwn,omitempty"`
+	SnapshotRef    string                      `json:"snapshotRef,omitempty"`
+	ResolvedImage  string                      `json:"resolvedImage,omitempty"`
+	ResolvedDigest string                      `json:"resolvedDigest,omitempty"`
+}
+
+func newTrashedImage(img *providerapi.Image) *trashedImage {
+	return &trashedImage{
+		Labels:         img.Labels,
+		Annotations:    img.Annotations,
+		Spec:           img.Spec,
+		Encryption:     img.Status.Encryption,
+		WWN:            img.Status.WWN,
+		SnapshotRef:    img.Status.SnapshotRef,
+		ResolvedImage:  img.Status.ResolvedImage,
+		ResolvedDigest: img.Status.ResolvedDigest,
+	}
+}
+
+// image returns the image of the given id to re-create for the trashed image.
+func (t *trashedImage) image(id string) *providerapi.Image {
+	return &providerapi.Image{
+		Metadata: apiutils.Metadata{
+			ID:          id,
+			Labels:      t.Labels,
+			Annotations: t.Annotations,
+		},
+		Spec: t.Spec,
+		Status: providerapi.ImageStatus{
+			Encryption:     t.Encryption,
+			WWN:            t.WWN,
+			SnapshotRef:    t.SnapshotRef,
+			ResolvedImage:  t.ResolvedImage,
+			ResolvedDigest: t.ResolvedDigest,
+		},
+	}
+}
+
+// trashRecords records the rbd images moved to the trash.
+type trashRecords interface {
+	Record(record trashRecord) error
+	List() ([]trashRecord, error)
+	Remove(pool, name string) error
+}
+
+// omapTrashRecords stores the trash records in the omap of the TrashRecordObject, keyed by pool and rbd image name.
+// Records written before images were recorded hold only the RFC3339 time they were recorded at.
+type omapTrashRecords struct {
+	conns     ceph.ConnAccessor
+	pool      string
+	namespace string
+}
+
+func trashRecordKey(pool, name string) string {
+	return pool + "/" + name
+}
+
+// omapTrashRecordValue is the value of a trash record in the omap.
+type omapTrashRecordValue struct {
+	RecordedAt time.Time     `json:"recordedAt"`
+	Image      *trashedImage `json:"image,omitempty"`
+}
+
+func (t *omapTrashRecords) Record(record trashRecord) error {
+	value, err := json.Marshal(omapTrashRecordValue{RecordedAt: record.RecordedAt.UTC(), Image: record.Image})
+	if err != nil {
+		return fmt.Errorf("failed to marshal trash record: %w", err)
+	}
+
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(t.conns, t.pool, t.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return ioCtx.SetOmap(TrashRecordObject, map[string][]byte{
+		trashRecordKey(record.Pool, record.Name): value,
+	})
+}
+
+func parseTrashRecordValue(value []byte) (omapTrashRecordValue, error) {
+	var v omapTrashRecordValue
+	if !strings.HasPrefix(string(value), "{") {
+		recordedAt, err := time.Parse(time.RFC3339, string(value))
+		v.RecordedAt = recordedAt
+		return v, err
+	}
+	err := json.Unmarshal(value, &v)
+	return v, err
+}
+
+func (t *omapTrashRecords) List() ([]trashRecord, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(t.conns, t.pool, t.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	omap, err := ioCtx.GetAllOmapValues(TrashRecordObject, "", "", 100)
+	if err != nil {
+		if errors.Is(err, rados.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	records := make([]trashRecord, 0, len(omap))
+	for key, value := range omap {
+		// Rbd image names cannot contain a slash, pool names may.
+		idx := strings.LastIndex(key, "/")
+		if idx < 0 {
+			continue
+		}
+		v, err := parseTrashRecordValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trash record %s: %w", key, err)
+		}
+		records = append(records, trashRecord{Pool: key[:idx], Name: key[idx+1:], RecordedAt: v.RecordedAt, Image: v.Image})
+	}
+	return records, nil
+}
+
+func (t *omapTrashRecords) Remove(pool, name string) error {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(t.conns, t.pool, t.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return ioCtx.RmOmapKeys(TrashRecordObject, []string{trashRecordKey(pool, name)})
+}
+
+// rbdTrash is the subset of rbd operations on the trash of the pools used to purge expired rbd images.
+type rbdTrash interface {
+	ListTrash(pool string) ([]librbd.TrashInfo, error)
+	RemoveTrash(pool, id string) error
+}
+
+type TrashPurgerOptions struct {
+	// Pool is the pool of the provider the trash records are stored in. Its trash is purged as well.
+	Pool string
+	// Namespace is the rbd namespace within the pools the images are stored in. Defaults to the default namespace.
+	Namespace string
+
+	// Interval is the interval the trash is checked for expired rbd images in.
+	Interval time.Duration
+
+	// Maintenance skips purging the trash while it is on. The trash is always purged if nil.
+	Maintenance *maintenance.Mode
+}
+
+func setTrashPurgerOptionsDefaults(o *TrashPurgerOptions) {
+	if o.Interval == 0 {
+		o.Interval = DefaultTrashPurgeInterval
+	}
+}
+
+// TrashPurger removes the rbd images the ImageReconciler moved to the trash once their retention has passed.
+type TrashPurger struct {
+	log     logr.Logger
+	trash   rbdTrash
+	records trashRecords
+
+	pool        string
+	interval    time.Duration
+	maintenance *maintenance.Mode
+
+	now func() time.Time
+}
+
+func NewTrashPurger(log logr.Logger, conns ceph.ConnAccessor, opts TrashPurgerOptions) (*TrashPurger, error) {
+	if conns == nil {
+		return nil, fmt.Errorf("must specify conns")
+	}
+
+	if opts.Pool == "" {
+		return nil, fmt.Errorf("must specify pool")
+	}
+
+	if err := ceph.ValidateNamespace(opts.Namespace); err != nil {
+		return nil, err
+	}
+
+	if opts.Interval < 0 {
+		return nil, fmt.Errorf("interval must not be negative, got %s", opts.Interval)
+	}
+
+	setTrashPurgerOptionsDefaults(&opts)
+
+	return &TrashPurger{
+		log:         log,
+		trash:       &connImageTrash{conns: conns, namespace: opts.Namespace},
+		records:     &omapTrashRecords{conns: conns, pool: opts.Pool, namespace: opts.Namespace},
+		pool:        opts.Pool,
+		interval:    opts.Interval,
+		maintenance: opts.Maintenance,
+		now:         time.Now,
+	}, nil
+}
+
+// Start purges expired rbd images every interval until ctx is done.
+func (p *TrashPurger) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := p.Purge(ctx); err != nil {
+			p.log.Error(err, "Failed to purge rbd trash")
+		}
+	}, p.interval)
+}
+
+// Purge removes the recorded rbd images from the trash of their pools whose retention has passed, as well as the
+// rbd images with names derived from image ids in the pool of the provider, which were trashed before they were
+// recorded. Trashed rbd images not managed by the provider are left alone. Records of rbd images no longer in the
+// trash, i.e. purged or restored ones, are removed. Nothing is purged while the maintenance mode is on.
+func (p *TrashPurger) Purge(ctx context.Context) error {
+	if p.maintenance.Paused() {
+		p.log.V(1).Info("Maintenance mode on, skipping trash purge")
+		return nil
+	}
+
+	records, err := p.records.List()
+	if err != nil {
+		return fmt.Errorf("failed to list trash records: %w", err)
+	}
+
+	recordsByPool := map[string][]trashRecord{p.pool: nil}
+	for _, record := range records {
+		recordsByPool[record.Pool] = append(recordsByPool[record.Pool], record)
+	}
+
+	var errs []error
+	for _, pool := range slices.Sorted(maps.Keys(recordsByPool)) {
+		if err := p.purgePool(pool, recordsByPool[pool]); err != nil {
+			errs = append(errs, fmt.Errorf("pool %s: %w", pool, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *TrashPurger) purgePool(pool string, records []trashRecord) error {
+	infos, err := p.trash.ListTrash(pool)
+	if err != nil {
+		return fmt.Errorf("failed to list rbd trash: %w", err)
+	}
+
+	recorded := sets.New[string]()
+	for _, record := range records {
+		recorded.Insert(record.Name)
+	}
+
+	now := p.now()
+	trashed := sets.New[string]()
+	for _, info := range infos {
+		if !recorded.Has(info.Name) && (pool != p.pool || !isManagedRBDID(info.Name)) {
+			continue
+		}
+		if now.Before(info.DefermentEndTime) {
+			trashed.Insert(info.Name)
+			p.log.V(1).Info("Trashed rbd image is still within retention", "Pool", pool, "RBDImage", info.Name, "ExpiresAt", info.DefermentEndTime)
+			continue
+		}
+
+		if p.maintenance.Paused() {
+			trashed.Insert(info.Name)
+			continue
+		}
+
+		if err := p.trash.RemoveTrash(pool, info.Id); err != nil {
+			trashed.Insert(info.Name)
+			p.log.Error(err, "Failed to purge trashed rbd image", "Pool", pool, "RBDImage", info.Name, "TrashID", info.Id)
+			continue
+		}
+		p.log.Info("Purged trashed rbd image", "Pool", pool, "RBDImage", info.Name, "TrashID", info.Id)
+	}
+
+	var errs []error
+	for _, record := range records {
+		if trashed.Has(record.Name) || now.Sub(record.RecordedAt) < trashRecordGracePeriod {
+			continue
+		}
+		if err := p.records.Remove(pool, record.Name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove trash record of %s: %w", record.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
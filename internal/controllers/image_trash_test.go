@@ -0,0 +1,368 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+type fakeRBDImageRemover struct {
+	removed []string
+	trashed map[string]time.Duration
+	err     error
+}
+
+func (f *fakeRBDImageRemover) RemoveImage(_ *rados.IOContext, name string) error {
+	f.removed = append(f.removed, name)
+	return f.err
+}
+
+func (f *fakeRBDImageRemover) TrashImage(_ *rados.IOContext, name string, retention time.Duration) error {
+	if f.trashed == nil {
+		f.trashed = map[string]time.Duration{}
+	}
+	f.trashed[name] = retention
+	return f.err
+}
+
+type fakeRBDTrash struct {
+	infos   map[string][]librbd.TrashInfo
+	removed []string
+}
+
+func (t *fakeRBDTrash) ListTrash(pool string) ([]librbd.TrashInfo, error) {
+	return t.infos[pool], nil
+}
+
+func (t *fakeRBDTrash) RemoveTrash(pool, id string) error {
+	t.infos[pool] = slices.DeleteFunc(t.infos[pool], func(info librbd.TrashInfo) bool { return info.Id == id })
+	t.removed = append(t.removed, pool+"/"+id)
+	return nil
+}
+
+type fakeTrashRecords map[string]trashRecord
+
+func (f fakeTrashRecords) Record(record trashRecord) error {
+	f[trashRecordKey(record.Pool, record.Name)] = record
+	return nil
+}
+
+func (f fakeTrashRecords) List() ([]trashRecord, error) {
+	return slices.Collect(maps.Values(f)), nil
+}
+
+func (f fakeTrashRecords) Remove(pool, name string) error {
+	delete(f, trashRecordKey(pool, name))
+	return nil
+}
+
+type fakeImageTrash struct {
+	infos    map[string][]librbd.TrashInfo
+	sizer    fakeImageSizer
+	restored []string
+}
+
+func (t *fakeImageTrash) ListTrash(pool string) ([]librbd.TrashInfo, error) {
+	return t.infos[pool], nil
+}
+
+func (t *fakeImageTrash) RestoreTrash(pool, id, name string) error {
+	t.infos[pool] = slices.DeleteFunc(t.infos[pool], func(info librbd.TrashInfo) bool { return info.Id == id })
+	t.sizer[pool+"/"+name] = 1024
+	t.restored = append(t.restored, id)
+	return nil
+}
+
+var _ = Describe("Trash", func() {
+	Describe("removeRBDImage", func() {
+		var (
+			r       *ImageReconciler
+			remover *fakeRBDImageRemover
+			records fakeTrashRecords
+			image   *providerapi.Image
+		)
+
+		BeforeEach(func() {
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			remover = &fakeRBDImageRemover{}
+			r.rbdRemover = remover
+			records = fakeTrashRecords{}
+			r.trashRecords = records
+			image = &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo", Labels: map[string]string{"class": "fast"}},
+				Spec:     providerapi.ImageSpec{Size: 1024},
+				Status:   providerapi.ImageStatus{RBDName: "img_foo", Encryption: providerapi.EncryptionStateHeaderSet},
+			}
+		})
+
+		It("should remove the rbd image immediately without trash retention", func() {
+			Expect(r.removeRBDImage(logr.Discard(), nil, image)).To(Succeed())
+			Expect(remover.removed).To(ConsistOf("img_foo"))
+			Expect(remover.trashed).To(BeEmpty())
+		})
+
+		It("should move the rbd image to the trash with the trash retention", func() {
+			r.trashRetention = 24 * time.Hour
+
+			Expect(r.removeRBDImage(logr.Discard(), nil, image)).To(Succeed())
+			Expect(remover.trashed).To(HaveKeyWithValue("img_foo", 24*time.Hour))
+			Expect(remover.removed).To(BeEmpty())
+			Expect(records).To(HaveKeyWithValue("pool/img_foo", HaveField("Image", SatisfyAll(
+				HaveField("Labels", HaveKeyWithValue("class", "fast")),
+				HaveField("Spec.Size", BeEquivalentTo(1024)),
+				HaveField("Encryption", providerapi.EncryptionStateHeaderSet),
+			))))
+		})
+
+		It("should not record rbd images removed immediately", func() {
+			Expect(r.removeRBDImage(logr.Discard(), nil, image)).To(Succeed())
+			Expect(records).To(BeEmpty())
+		})
+
+		It("should ignore rbd images that are already gone", func() {
+			r.trashRetention = time.Hour
+			remover.err = librbd.ErrNotFound
+
+			Expect(r.removeRBDImage(logr.Discard(), nil, image)).To(Succeed())
+		})
+
+		It("should reject a negative trash retention", func() {
+			_, err := newTestImageReconciler(ImageReconcilerOptions{TrashRetention: -time.Hour})
+			Expect(err).To(MatchError(ContainSubstring("trash retention must not be negative")))
+		})
+	})
+
+	Describe("TrashPurger", func() {
+		var (
+			now     time.Time
+			trash   *fakeRBDTrash
+			records fakeTrashRecords
+			p       *TrashPurger
+		)
+
+		BeforeEach(func() {
+			now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			trash = &fakeRBDTrash{infos: map[string][]librbd.TrashInfo{}}
+			records = fakeTrashRecords{}
+
+			var err error
+			p, err = NewTrashPurger(logr.Discard(), ceph.StaticConn(&rados.Conn{}), TrashPurgerOptions{Pool: "pool"})
+			Expect(err).NotTo(HaveOccurred())
+			p.trash = trash
+			p.records = records
+			p.now = func() time.Time { return now }
+		})
+
+		It("should purge trashed rbd images after their retention", func(ctx SpecContext) {
+			trash.infos["pool"] = []librbd.TrashInfo{
+				{Id: "1", Name: ImageIDToRBDID("expired"), DefermentEndTime: now.Add(-time.Minute)},
+				{Id: "2", Name: ImageIDToRBDID("retained"), DefermentEndTime: now.Add(time.Hour)},
+			}
+
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(trash.removed).To(ConsistOf("pool/1"))
+
+			now = now.Add(2 * time.Hour)
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(trash.removed).To(ConsistOf("pool/1", "pool/2"))
+		})
+
+		It("should purge recorded rbd images of any pool and name", func(ctx SpecContext) {
+			Expect(records.Record(trashRecord{Pool: "other", Name: "legacy", RecordedAt: now.Add(-2 * time.Hour)})).To(Succeed())
+			trash.infos["other"] = []librbd.TrashInfo{
+				{Id: "1", Name: "legacy", DefermentEndTime: now.Add(-time.Minute)},
+				{Id: "2", Name: ImageIDToRBDID("unrecorded"), DefermentEndTime: now.Add(-time.Minute)},
+			}
+
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(trash.removed).To(ConsistOf("other/1"))
+			Expect(records).To(BeEmpty())
+		})
+
+		It("should keep the records of rbd images within retention", func(ctx SpecContext) {
+			Expect(records.Record(trashRecord{Pool: "other", Name: "legacy", RecordedAt: now.Add(-2 * time.Hour)})).To(Succeed())
+			trash.infos["other"] = []librbd.TrashInfo{
+				{Id: "1", Name: "legacy", DefermentEndTime: now.Add(time.Hour)},
+			}
+
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(trash.removed).To(BeEmpty())
+			Expect(records).To(HaveKey("other/legacy"))
+		})
+
+		It("should keep recent records of rbd images not yet in the trash", func(ctx SpecContext) {
+			Expect(records.Record(trashRecord{Pool: "other", Name: "legacy", RecordedAt: now})).To(Succeed())
+
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(records).To(HaveKey("other/legacy"))
+
+			now = now.Add(2 * trashRecordGracePeriod)
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(records).To(BeEmpty())
+		})
+
+		It("should not purge trashed rbd images not managed by the provider", func(ctx SpecContext) {
+			trash.infos["pool"] = []librbd.TrashInfo{
+				{Id: "1", Name: "foreign", DefermentEndTime: now.Add(-time.Hour)},
+			}
+
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(trash.removed).To(BeEmpty())
+		})
+
+		It("should not purge while the maintenance mode is on", func(ctx SpecContext) {
+			mode := maintenance.NewMode(logr.Discard(), true)
+			p.maintenance = mode
+			trash.infos["pool"] = []librbd.TrashInfo{
+				{Id: "1", Name: ImageIDToRBDID("expired"), DefermentEndTime: now.Add(-time.Minute)},
+			}
+
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(trash.removed).To(BeEmpty())
+
+			mode.Resume()
+			Expect(p.Purge(ctx)).To(Succeed())
+			Expect(trash.removed).To(ConsistOf("pool/1"))
+		})
+	})
+
+	Describe("RestoreImage", func() {
+		var (
+			now     time.Time
+			r       *ImageReconciler
+			trash   *fakeImageTrash
+			records fakeTrashRecords
+		)
+
+		BeforeEach(func() {
+			now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+			var err error
+			r, err = newTestImageReconciler(ImageReconcilerOptions{TrashRetention: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			r.cephClient = &fakeCephClient{response: []byte(`{"key":"secret"}`)}
+			r.now = func() time.Time { return now }
+
+			sizer := fakeImageSizer{}
+			r.rbdImages = sizer
+			trash = &fakeImageTrash{
+				sizer: sizer,
+				infos: map[string][]librbd.TrashInfo{"pool": {
+					{Id: "1", Name: ImageIDToRBDID("foo"), DefermentEndTime: now.Add(time.Minute)},
+					{Id: "2", Name: ImageIDToRBDID("expired"), DefermentEndTime: now.Add(-time.Minute)},
+				}},
+			}
+			r.rbdTrash = trash
+
+			records = fakeTrashRecords{}
+			r.trashRecords = records
+			Expect(records.Record(trashRecord{
+				Pool:       "pool",
+				Name:       ImageIDToRBDID("foo"),
+				RecordedAt: now.Add(-time.Minute),
+				Image: &trashedImage{
+					Labels: map[string]string{"class": "fast"},
+					Spec: providerapi.ImageSpec{
+						Size:        512,
+						SnapshotRef: ptr.To("snap"),
+						Encryption: &providerapi.EncryptionSpec{
+							Type:                providerapi.EncryptionTypeEncrypted,
+							EncryptedPassphrase: []byte("passphrase"),
+						},
+					},
+					Encryption:  providerapi.EncryptionStateHeaderSet,
+					SnapshotRef: "snap",
+				},
+			})).To(Succeed())
+		})
+
+		It("should restore a trashed image as an available image", func(ctx SpecContext) {
+			_, err := r.snapshots.Create(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "snap"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			img, err := r.RestoreImage(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trash.restored).To(ConsistOf("1"))
+
+			Expect(img.Finalizers).To(ConsistOf(ImageFinalizer))
+			Expect(img.Spec.Size).To(BeEquivalentTo(1024))
+			Expect(img.Status.State).To(Equal(providerapi.ImageStateAvailable))
+			Expect(img.Status.CreatedAt).To(HaveValue(Equal(now)))
+			Expect(RBDImageName(img)).To(Equal(ImageIDToRBDID("foo")))
+			Expect(img.Status.Access).To(SatisfyAll(
+				HaveField("Handle", "pool/"+ImageIDToRBDID("foo")),
+				HaveField("User", "volumes"),
+				HaveField("UserKey", "secret"),
+			))
+
+			_, err = r.images.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should restore the spec, labels and encryption of the trashed image", func(ctx SpecContext) {
+			_, err := r.snapshots.Create(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "snap"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			img, err := r.RestoreImage(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(img.Labels).To(HaveKeyWithValue("class", "fast"))
+			Expect(img.Spec.Encryption).To(HaveValue(HaveField("EncryptedPassphrase", []byte("passphrase"))))
+			Expect(img.Status.Encryption).To(Equal(providerapi.EncryptionStateHeaderSet))
+			Expect(img.Spec.SnapshotRef).To(HaveValue(Equal("snap")))
+			Expect(img.Status.SnapshotRef).To(Equal("snap"))
+
+			snapshot, err := r.snapshots.Get(ctx, "snap")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshot.Status.ImageRefs).To(ConsistOf("foo"))
+		})
+
+		It("should reject restoring an image that was not recorded", func(ctx SpecContext) {
+			Expect(records.Remove("pool", ImageIDToRBDID("foo"))).To(Succeed())
+
+			_, err := r.RestoreImage(ctx, "foo")
+			Expect(err).To(MatchError(ErrImageNotRecorded))
+			Expect(trash.restored).To(BeEmpty())
+		})
+
+		It("should reject restoring an image whose trash retention has passed", func(ctx SpecContext) {
+			_, err := r.RestoreImage(ctx, "expired")
+			Expect(err).To(MatchError(ErrImageTrashExpired))
+			Expect(trash.restored).To(BeEmpty())
+
+			_, err = r.images.Get(ctx, "expired")
+			Expect(err).To(MatchError(store.ErrNotFound))
+		})
+
+		It("should reject restoring an image that is not in the trash", func(ctx SpecContext) {
+			_, err := r.RestoreImage(ctx, "purged")
+			Expect(err).To(MatchError(ErrImageNotInTrash))
+		})
+
+		It("should reject restoring an image that exists", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.RestoreImage(ctx, "foo")
+			Expect(err).To(MatchError(store.ErrAlreadyExists))
+			Expect(trash.restored).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// limitMetadataKeyPrefix is the prefix of the metadata keys of all limits managed by the provider.
+const limitMetadataKeyPrefix = LimitMetadataPrefix + "rbd_qos_"
+
+// ErrInvalidQoS is returned if the QoS of an image cannot be applied.
+var ErrInvalidQoS = errors.New("invalid qos")
+
+// imageLimits returns the limits to apply to the image: the limits of its QoS, overridden by its raw limits.
+func imageLimits(image *providerapi.Image) (providerapi.Limits, error) {
+	qos := image.Spec.QoS
+	if qos == nil {
+		return image.Spec.Limits, nil
+	}
+	if err := qos.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQoS, err)
+	}
+
+	limits := qos.Limits()
+	maps.Copy(limits, image.Spec.Limits)
+	return limits, nil
+}
+
+// imageMetadata is the subset of rbd image metadata operations used to apply limits.
+type imageMetadata interface {
+	ListMetadata() (map[string]string, error)
+	SetMetadata(key, value string) error
+	RemoveMetadata(key string) error
+}
+
+func limitMetadataKey(limit providerapi.LimitType) string {
+	return LimitMetadataPrefix + string(limit)
+}
+
+// diffLimits returns the limit metadata to set and to remove so the current metadata matches the desired limits.
+func diffLimits(current map[string]string, desired providerapi.Limits) (set map[string]string, remove []string) {
+	set = make(map[string]string)
+	for limit, value := range desired {
+		key := limitMetadataKey(limit)
+		if v := strconv.FormatInt(value, 10); current[key] != v {
+			set[key] = v
+		}
+	}
+
+	for key := range current {
+		if !strings.HasPrefix(key, limitMetadataKeyPrefix) {
+			continue
+		}
+		if _, ok := desired[providerapi.LimitType(strings.TrimPrefix(key, LimitMetadataPrefix))]; !ok {
+			remove = append(remove, key)
+		}
+	}
+	return set, remove
+}
+
+// syncImageLimits re-applies changed limits of an image and clears removed ones.
+func (r *ImageReconciler) syncImageLimits(log logr.Logger, md imageMetadata, image *providerapi.Image) error {
+	current, err := md.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list image metadata: %w", err)
+	}
+
+	limits, err := imageLimits(image)
+	if err != nil {
+		return err
+	}
+
+	set, remove := diffLimits(current, limits)
+	if len(set) == 0 && len(remove) == 0 {
+		log.V(2).Info("No update needed: Image limits unchanged")
+		return nil
+	}
+
+	if err := applyLimits(log, md, current, set, remove); err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "UpdateImageLimitFailed", "Failed to update image limits: %s", err)
+		return err
+	}
+
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "UpdatedImageLimitsSucceeded", "Updated image limits. changed: %d removed: %d", len(set), len(remove))
+	log.V(1).Info("Updated image limits", "changed", len(set), "removed", len(remove))
+	return nil
+}
+
+// applyLimits sets and removes the limit metadata as a whole. If any key fails, the keys applied before are restored
+// to their values in current, so that the image isn't left with a partial QoS config.
+func applyLimits(log logr.Logger, md imageMetadata, current, set map[string]string, remove []string) error {
+	var applied []string
+	rollback := func(err error) error {
+		if restoreErr := restoreLimits(md, current, applied); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore limits: %w", restoreErr))
+		}
+		log.V(1).Info("Restored image limits after failing to apply them", "restored", len(applied))
+		return err
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(set)) {
+		if err := md.SetMetadata(key, set[key]); err != nil {
+			return rollback(fmt.Errorf("failed to set limit (%s): %w", key, err))
+		}
+		applied = append(applied, key)
+		log.V(3).Info("Updated image limit", "key", key, "value", set[key])
+	}
+
+	for _, key := range remove {
+		if err := md.RemoveMetadata(key); err != nil {
+			return rollback(fmt.Errorf("failed to remove limit (%s): %w", key, err))
+		}
+		applied = append(applied, key)
+		log.V(3).Info("Removed image limit", "key", key)
+	}
+	return nil
+}
+
+// restoreLimits restores the keys to their values in current, removing the keys which were not set.
+func restoreLimits(md imageMetadata, current map[string]string, keys []string) error {
+	var errs []error
+	for _, key := range keys {
+		if value, ok := current[key]; ok {
+			if err := md.SetMetadata(key, value); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore limit (%s): %w", key, err))
+			}
+			continue
+		}
+		if err := md.RemoveMetadata(key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove limit (%s): %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
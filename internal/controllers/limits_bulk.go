@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// ImageErrors is the error of an operation on many images. It maps the ids of the images the operation failed for
+// to their errors, the operation succeeded for all other images.
+type ImageErrors map[string]error
+
+func (e ImageErrors) Error() string {
+	var sb strings.Builder
+	for i, id := range e.IDs() {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		fmt.Fprintf(&sb, "image %s: %s", id, e[id])
+	}
+	return sb.String()
+}
+
+// IDs returns the sorted ids of the images the operation failed for.
+func (e ImageErrors) IDs() []string {
+	return slices.Sorted(maps.Keys(e))
+}
+
+// Unwrap returns the errors of the images, so that errors.Is and errors.As match any of them.
+func (e ImageErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, id := range e.IDs() {
+		errs = append(errs, e[id])
+	}
+	return errs
+}
+
+// SetImagesLimits sets the limits of the given available images on their rbd images on a single io context, e.g.
+// after the limits of many images were changed at once. Failing images don't stop the others, the returned error is
+// an ImageErrors naming the images the limits could not be set for.
+func (r *ImageReconciler) SetImagesLimits(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ioCtx, release, err := r.openIOContext(r.pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return r.setImagesLimits(ctx, ioCtx, ids)
+}
+
+func (r *ImageReconciler) setImagesLimits(ctx context.Context, ioCtx *rados.IOContext, ids []string) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	errs := make(ImageErrors)
+	for _, id := range ids {
+		if err := r.setImageLimitsOf(ctx, log.WithValues("imageId", id), ioCtx, id); err != nil {
+			errs[id] = err
+		}
+	}
+	if len(errs) > 0 {
+		log.V(1).Info("Failed to set the limits of some images", "failed", len(errs), "total", len(ids))
+		return errs
+	}
+	return nil
+}
+
+func (r *ImageReconciler) setImageLimitsOf(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, id string) error {
+	r.imageMu.Lock(id)
+	defer r.imageMu.Unlock(id)
+
+	img, err := r.images.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get image: %w", err)
+	}
+	if img.DeletedAt != nil || img.Status.State != providerapi.ImageStateAvailable {
+		return errors.New("image is not available")
+	}
+
+	if pool := r.imagePool(img); pool != r.pool {
+		poolIOCtx, release, err := r.openIOContext(pool)
+		if err != nil {
+			return fmt.Errorf("unable to get io context for pool %s: %w", pool, err)
+		}
+		defer release()
+		ioCtx = poolIOCtx
+	}
+
+	return r.setImageLimits(log, ioCtx, img)
+}
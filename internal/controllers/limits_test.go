@@ -0,0 +1,269 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"maps"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeImageMetadata map[string]string
+
+func (m fakeImageMetadata) ListMetadata() (map[string]string, error) {
+	return maps.Clone(m), nil
+}
+
+func (m fakeImageMetadata) SetMetadata(key, value string) error {
+	m[key] = value
+	return nil
+}
+
+func (m fakeImageMetadata) RemoveMetadata(key string) error {
+	delete(m, key)
+	return nil
+}
+
+// failingImageMetadata fails the failAt-th update of the metadata, counting from 1.
+type failingImageMetadata struct {
+	fakeImageMetadata
+	failAt  int
+	updates int
+}
+
+func (m *failingImageMetadata) fail() error {
+	m.updates++
+	if m.updates == m.failAt {
+		return errors.New("metadata update failed")
+	}
+	return nil
+}
+
+func (m *failingImageMetadata) SetMetadata(key, value string) error {
+	if err := m.fail(); err != nil {
+		return err
+	}
+	return m.fakeImageMetadata.SetMetadata(key, value)
+}
+
+func (m *failingImageMetadata) RemoveMetadata(key string) error {
+	if err := m.fail(); err != nil {
+		return err
+	}
+	return m.fakeImageMetadata.RemoveMetadata(key)
+}
+
+var _ = Describe("syncImageLimits", func() {
+	var (
+		r  *ImageReconciler
+		md fakeImageMetadata
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		md = fakeImageMetadata{
+			WWNKey:                    "wwn",
+			"conf_rbd_qos_iops_limit": "100",
+			"conf_rbd_cache":          "false",
+			"conf_rbd_qos_bps_limit":  "1024",
+		}
+	})
+
+	availableImage := func(limits providerapi.Limits) *providerapi.Image {
+		return &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Limits: limits},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+		}
+	}
+
+	It("should add a new limit", func() {
+		img := availableImage(providerapi.Limits{
+			providerapi.IOPSLimit:     100,
+			providerapi.BPSLimit:      1024,
+			providerapi.ReadIOPSLimit: 50,
+		})
+
+		Expect(r.syncImageLimits(logr.Discard(), md, img)).To(Succeed())
+		Expect(md).To(HaveKeyWithValue("conf_rbd_qos_read_iops_limit", "50"))
+		Expect(md).To(HaveLen(5))
+	})
+
+	It("should change an existing limit", func() {
+		img := availableImage(providerapi.Limits{
+			providerapi.IOPSLimit: 200,
+			providerapi.BPSLimit:  1024,
+		})
+
+		Expect(r.syncImageLimits(logr.Discard(), md, img)).To(Succeed())
+		Expect(md).To(HaveKeyWithValue("conf_rbd_qos_iops_limit", "200"))
+		Expect(md).To(HaveKeyWithValue("conf_rbd_qos_bps_limit", "1024"))
+	})
+
+	It("should remove a limit no longer in the spec and keep unrelated metadata", func() {
+		img := availableImage(providerapi.Limits{providerapi.IOPSLimit: 100})
+
+		Expect(r.syncImageLimits(logr.Discard(), md, img)).To(Succeed())
+		Expect(md).To(Equal(fakeImageMetadata{
+			WWNKey:                    "wwn",
+			"conf_rbd_qos_iops_limit": "100",
+			"conf_rbd_cache":          "false",
+		}))
+	})
+
+	DescribeTable("should restore the prior limits if applying a limit fails",
+		func(failAt int) {
+			prior := maps.Clone(md)
+			failing := &failingImageMetadata{fakeImageMetadata: md, failAt: failAt}
+			img := availableImage(providerapi.Limits{
+				providerapi.IOPSLimit:      200,
+				providerapi.ReadIOPSLimit:  50,
+				providerapi.WriteIOPSLimit: 50,
+				providerapi.ReadBPSLimit:   512,
+			})
+
+			Expect(r.syncImageLimits(logr.Discard(), failing, img)).To(MatchError(ContainSubstring("metadata update failed")))
+			Expect(md).To(Equal(prior))
+		},
+		Entry("first key", 1),
+		Entry("third key", 3),
+		Entry("removed key", 5),
+	)
+
+	It("should not touch unchanged limits", func() {
+		set, remove := diffLimits(md, providerapi.Limits{
+			providerapi.IOPSLimit: 100,
+			providerapi.BPSLimit:  1024,
+		})
+		Expect(set).To(BeEmpty())
+		Expect(remove).To(BeEmpty())
+	})
+})
+
+var _ = Describe("imageLimits", func() {
+	imageWithQoS := func(qos *providerapi.QoS, limits providerapi.Limits) *providerapi.Image {
+		return &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{QoS: qos, Limits: limits},
+		}
+	}
+
+	It("should map the qos onto the rbd qos metadata keys", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		md := fakeImageMetadata{}
+
+		img := imageWithQoS(&providerapi.QoS{
+			IOPS:      100,
+			IOPSBurst: 200,
+			BPS:       1024,
+			BPSBurst:  4096,
+		}, nil)
+
+		Expect(r.syncImageLimits(logr.Discard(), md, img)).To(Succeed())
+		Expect(md).To(Equal(fakeImageMetadata{
+			"conf_rbd_qos_iops_limit": "100",
+			"conf_rbd_qos_iops_burst": "200",
+			"conf_rbd_qos_bps_limit":  "1024",
+			"conf_rbd_qos_bps_burst":  "4096",
+		}))
+	})
+
+	It("should leave unset qos fields out and let the raw limits take precedence", func() {
+		limits, err := imageLimits(imageWithQoS(&providerapi.QoS{IOPS: 100, BPS: 1024}, providerapi.Limits{
+			providerapi.IOPSLimit:              150,
+			providerapi.IOPSBurstDurationLimit: 10,
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(providerapi.Limits{
+			providerapi.IOPSLimit:              150,
+			providerapi.IOPSBurstDurationLimit: 10,
+			providerapi.BPSLimit:               1024,
+		}))
+	})
+
+	It("should return the raw limits of an image without qos", func() {
+		limits, err := imageLimits(imageWithQoS(nil, providerapi.Limits{providerapi.IOPSLimit: 100}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(providerapi.Limits{providerapi.IOPSLimit: 100}))
+	})
+
+	DescribeTable("should reject an invalid qos",
+		func(qos providerapi.QoS) {
+			_, err := imageLimits(imageWithQoS(&qos, nil))
+			Expect(err).To(MatchError(ErrInvalidQoS))
+
+			reason, terminal := terminalErrorReason(err)
+			Expect(terminal).To(BeTrue())
+			Expect(reason).To(Equal("InvalidQoS"))
+		},
+		Entry("iops burst below average", providerapi.QoS{IOPS: 200, IOPSBurst: 100}),
+		Entry("bps burst below average", providerapi.QoS{BPS: 2048, BPSBurst: 1024}),
+		Entry("negative limit", providerapi.QoS{IOPS: -1}),
+	)
+})
+
+var _ = Describe("setImagesLimits", func() {
+	It("should report the result of every image", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, img := range []*providerapi.Image{
+			{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+			},
+			{
+				Metadata: apiutils.Metadata{ID: "bar"},
+				Spec:     providerapi.ImageSpec{Limits: providerapi.Limits{providerapi.IOPSLimit: 100}},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+			},
+			{
+				Metadata: apiutils.Metadata{ID: "qux"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			},
+		} {
+			_, err := r.images.Create(ctx, img)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// Without an io context, opening the rbd image of bar fails.
+		err = r.setImagesLimits(ctx, nil, []string{"foo", "bar", "baz", "qux"})
+
+		var imageErrs ImageErrors
+		Expect(errors.As(err, &imageErrs)).To(BeTrue())
+		Expect(imageErrs.IDs()).To(Equal([]string{"bar", "baz", "qux"}))
+		Expect(imageErrs).To(SatisfyAll(
+			HaveKeyWithValue("bar", MatchError(librbd.ErrNoIOContext)),
+			HaveKeyWithValue("baz", MatchError(store.ErrNotFound)),
+			HaveKeyWithValue("qux", MatchError("image is not available")),
+		))
+		Expect(err).To(MatchError(store.ErrNotFound))
+		Expect(err.Error()).To(HavePrefix("image bar: "))
+		Expect(err.Error()).To(ContainSubstring("; image qux: image is not available"))
+	})
+
+	It("should succeed if the limits of all images were set", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.setImagesLimits(ctx, nil, []string{"foo"})).To(Succeed())
+	})
+})
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maintenanceBacklog defers the items of a queue while the maintenance mode is on and requeues them once it is
+// turned off, so that the backlog is drained right away instead of after the requeue interval.
+type maintenanceBacklog struct {
+	mode     *maintenance.Mode
+	interval time.Duration
+	queue    workqueue.TypedDelayingInterface[string]
+
+	mu  sync.Mutex
+	ids sets.Set[string]
+}
+
+func newMaintenanceBacklog(mode *maintenance.Mode, interval time.Duration, queue workqueue.TypedDelayingInterface[string]) *maintenanceBacklog {
+	b := &maintenanceBacklog{
+		mode:     mode,
+		interval: interval,
+		queue:    queue,
+		ids:      sets.New[string](),
+	}
+	mode.OnResume(b.drain)
+	return b
+}
+
+// deferIfPaused requeues the item after the requeue interval and reports true if the maintenance mode is on.
+func (b *maintenanceBacklog) deferIfPaused(log logr.Logger, id string) bool {
+	if !b.mode.Paused() {
+		return false
+	}
+
+	b.mu.Lock()
+	b.ids.Insert(id)
+	b.mu.Unlock()
+
+	log.V(1).Info("Maintenance mode on, deferring reconciliation", "RequeueAfter", b.interval)
+	b.queue.AddAfter(id, b.interval)
+	return true
+}
+
+// paused reports whether the maintenance mode is on.
+func (b *maintenanceBacklog) paused() bool {
+	return b.mode.Paused()
+}
+
+func (b *maintenanceBacklog) drain() {
+	b.mu.Lock()
+	ids := b.ids
+	b.ids = sets.New[string]()
+	b.mu.Unlock()
+
+	for id := range ids {
+		b.queue.Add(id)
+	}
+}
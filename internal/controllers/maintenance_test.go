@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("maintenance mode", func() {
+	var (
+		r     *ImageReconciler
+		mode  *maintenance.Mode
+		conns *countingConnAccessor
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		mode = maintenance.NewMode(logr.Discard(), true)
+
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{
+			Maintenance:                mode,
+			MaintenanceRequeueInterval: time.Hour,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+		conns = &countingConnAccessor{}
+		r.conns = conns
+
+		_, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Size: 1024 * 1024 * 1024},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should not touch rbd while paused and reconcile the backlog once resumed", func(ctx SpecContext) {
+		r.queue.Add("foo")
+		Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+		Expect(conns.calls).To(BeZero())
+		By("deferring the image")
+		Expect(r.queue.Len()).To(BeZero())
+
+		mode.Resume()
+		Expect(r.queue.Len()).To(Equal(1))
+		Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+		Expect(conns.calls).To(Equal(1))
+	})
+
+	It("should defer images reconciled in batches", func(ctx SpecContext) {
+		Expect(r.reconcileBatchImage(ctx, logr.Discard(), nil, "foo")).To(Succeed())
+		Expect(conns.calls).To(BeZero())
+
+		mode.Resume()
+		Expect(r.queue.Len()).To(Equal(1))
+	})
+
+	It("should reject a negative requeue interval", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{MaintenanceRequeueInterval: -time.Second})
+		Expect(err).To(MatchError(ContainSubstring("maintenance requeue interval must not be negative")))
+	})
+})
+
+var _ = Describe("maintenance backlog", func() {
+	It("should not defer items without maintenance mode", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+
+		Expect(r.maintenance.deferIfPaused(logr.Discard(), "foo")).To(BeFalse())
+	})
+})
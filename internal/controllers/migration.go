@@ -0,0 +1,356 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// errImageInUse is returned when migrating an image a client has open.
+var errImageInUse = errors.New("image is in use")
+
+// imageMigrator is the subset of rbd operations used to migrate an image to another pool.
+type imageMigrator interface {
+	// Copy copies the image including its metadata into the target pool and verifies the contents of the copy. The
+	// image holds its exclusive lock from checking that no client has it open until commit returned, so that it is not
+	// written meanwhile. It returns an error wrapping errImageInUse if a client has the image open.
+	Copy(log logr.Logger, pool, targetPool, imageName string, commit func() error) error
+	Remove(pool, imageName string) error
+	// Snapshots returns the names of the rbd snapshots of the image, e.g. of the snapshot templates are cloned from.
+	Snapshots(pool, imageName string) ([]string, error)
+}
+
+// imagePool returns the pool the rbd image of the image is stored in.
+func (r *ImageReconciler) imagePool(img *providerapi.Image) string {
+	if img.Status.Pool != "" {
+		return img.Status.Pool
+	}
+	return r.pool
+}
+
+// desiredImagePool returns the pool the rbd image of the image should be stored in.
+func (r *ImageReconciler) desiredImagePool(img *providerapi.Image) string {
+	if img.Spec.Pool != "" {
+		return img.Spec.Pool
+	}
+	return r.pool
+}
+
+// setMigratingCondition records the migration state and persists it if it changed.
+func (r *ImageReconciler) setMigratingCondition(ctx context.Context, img *providerapi.Image, status providerapi.ConditionStatus, reason, message string) error {
+	if !img.Status.SetCondition(providerapi.ImageCondition{
+		Type:    providerapi.ImageConditionMigrating,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}) {
+		return nil
+	}
+	if _, err := r.images.Update(ctx, img); err != nil {
+		return fmt.Errorf("failed to update migration condition: %w", err)
+	}
+	return nil
+}
+
+// migrateImageIfRequested copies an available image into the pool requested in its spec. The image in the current
+// pool is only removed once the copy is verified and the image refers to the target pool. The previous pool is
+// recorded until the image is removed from it, so that a failed removal is retried. Failed migrations are recorded in
+// the Migrating condition and retried on the next reconcile of the image.
+func (r *ImageReconciler) migrateImageIfRequested(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
+	if err := r.removeMigrationSource(ctx, log, img); err != nil {
+		return err
+	}
+
+	pool, targetPool := r.imagePool(img), r.desiredImagePool(img)
+	if pool == targetPool {
+		return nil
+	}
+
+	log = log.WithValues("Pool", pool, "TargetPool", targetPool)
+	imageName := RBDImageName(img)
+
+	snapshots, err := r.snapshots.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Source.VolumeImageID == img.ID {
+			log.V(1).Info("Not migrating image with snapshots", "SnapshotID", snapshot.ID)
+			return r.setMigratingCondition(ctx, img, providerapi.ConditionFalse, "HasSnapshots",
+				fmt.Sprintf("image has snapshots, e.g. %s", snapshot.ID))
+		}
+	}
+
+	// Clones, e.g. of templates, refer to a snapshot of the rbd image in its current pool, so that neither the copy
+	// would be used by them nor could the rbd image be removed from its current pool.
+	rbdSnapshots, err := r.migrator.Snapshots(pool, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to list rbd snapshots: %w", err)
+	}
+	if len(rbdSnapshots) > 0 {
+		log.V(1).Info("Not migrating image with rbd snapshots", "Snapshots", rbdSnapshots)
+		return r.setMigratingCondition(ctx, img, providerapi.ConditionFalse, "HasSnapshots",
+			fmt.Sprintf("rbd image has snapshots, e.g. %s", rbdSnapshots[0]))
+	}
+
+	if err := r.setMigratingCondition(ctx, img, providerapi.ConditionTrue, "Copying",
+		fmt.Sprintf("copying image from pool %s to pool %s", pool, targetPool)); err != nil {
+		return err
+	}
+
+	log.Info("Migrating image")
+	var commitErr error
+	err = r.migrator.Copy(log, pool, targetPool, imageName, func() error {
+		img.Status.Pool = targetPool
+		img.Status.MigrationSourcePool = pool
+		if img.Status.Access != nil {
+			img.Status.Access.Handle = ceph.ImageSpec(targetPool, r.namespace, imageName)
+		}
+		img.Status.RemoveCondition(providerapi.ImageConditionMigrating)
+		if _, err := r.images.Update(ctx, img); err != nil {
+			commitErr = fmt.Errorf("failed to update pool of image: %w", err)
+			return commitErr
+		}
+		return nil
+	})
+	switch {
+	case commitErr != nil:
+		// The stored image still refers to the current pool, the copy is replaced on the next attempt.
+		return commitErr
+	case errors.Is(err, errImageInUse):
+		log.V(1).Info("Not migrating image in use")
+		return r.setMigratingCondition(ctx, img, providerapi.ConditionFalse, "InUse", "image is in use")
+	case err != nil:
+		log.Error(err, "Failed to copy image, keeping the image in its current pool")
+		r.Eventf(img.Metadata, corev1.EventTypeWarning, "MigrateImageFailed", "Failed to copy image to pool %s: %s", targetPool, err)
+		return r.setMigratingCondition(ctx, img, providerapi.ConditionFalse, "CopyFailed", err.Error())
+	}
+
+	if err := r.removeMigrationSource(ctx, log, img); err != nil {
+		return err
+	}
+
+	r.Eventf(img.Metadata, corev1.EventTypeNormal, "MigrateImageSucceeded", "Migrated image from pool %s to pool %s", pool, targetPool)
+	log.Info("Migrated image")
+	return nil
+}
+
+// removeMigrationSource removes the rbd image from the pool the image was migrated from, if any.
+func (r *ImageReconciler) removeMigrationSource(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
+	pool := img.Status.MigrationSourcePool
+	if pool == "" {
+		return nil
+	}
+
+	if err := r.migrator.Remove(pool, RBDImageName(img)); err != nil {
+		r.Eventf(img.Metadata, corev1.EventTypeWarning, "MigrateImageFailed", "Failed to remove image from previous pool %s: %s", pool, err)
+		return fmt.Errorf("failed to remove image from previous pool %s: %w", pool, err)
+	}
+
+	img.Status.MigrationSourcePool = ""
+	if _, err := r.images.Update(ctx, img); err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	log.V(1).Info("Removed image from previous pool", "PreviousPool", pool)
+	return nil
+}
+
+type connImageMigrator struct {
+	conns     ceph.ConnAccessor
+	namespace string
+}
+
+func (m *connImageMigrator) Copy(log logr.Logger, pool, targetPool, imageName string, commit func() error) error {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(m.conns, pool, m.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	targetIOCtx, releaseTarget, err := ceph.OpenNamespacedIOContext(m.conns, targetPool, m.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context for pool %s: %w", targetPool, err)
+	}
+	defer releaseTarget()
+
+	img, err := openImage(ioCtx, imageName)
+	if err != nil {
+		return err
+	}
+	defer closeImage(log, img)
+
+	if err := lockImageForMigration(log, img); err != nil {
+		return err
+	}
+	defer releaseImageLock(log, img)
+
+	// A copy left behind by a previous attempt is incomplete.
+	if err := librbd.RemoveImage(targetIOCtx, imageName); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to remove previous copy: %w", err)
+	}
+
+	if err := img.Copy(targetIOCtx, imageName); err != nil {
+		removeIncompleteCopy(log, targetIOCtx, imageName)
+		return fmt.Errorf("failed to copy image: %w", err)
+	}
+
+	if err := verifyImageCopy(log, img, targetIOCtx, imageName); err != nil {
+		removeIncompleteCopy(log, targetIOCtx, imageName)
+		return err
+	}
+
+	if err := commit(); err != nil {
+		removeIncompleteCopy(log, targetIOCtx, imageName)
+		return err
+	}
+	return nil
+}
+
+// lockImageForMigration acquires the exclusive lock of the image, so that no client writes to it while it is
+// migrated, and checks that no client has it open. Images without the exclusive-lock feature cannot be locked and are
+// not migrated.
+func lockImageForMigration(log logr.Logger, img *librbd.Image) error {
+	features, err := img.GetFeatures()
+	if err != nil {
+		return fmt.Errorf("failed to get image features: %w", err)
+	}
+	if features&librbd.FeatureExclusiveLock == 0 {
+		return fmt.Errorf("image without %s feature cannot be locked for migration", providerapi.ImageFeatureExclusiveLock)
+	}
+
+	// Acquiring the lock explicitly keeps it from being handed over to other clients until it is released.
+	if err := img.LockAcquire(librbd.LockModeExclusive); err != nil {
+		return fmt.Errorf("%w: failed to acquire exclusive lock: %w", errImageInUse, err)
+	}
+
+	watchers, err := img.ListWatchers()
+	if err != nil {
+		releaseImageLock(log, img)
+		return fmt.Errorf("failed to list watchers of image: %w", err)
+	}
+	// The image opened here registers a watcher itself.
+	if len(watchers) > 1 {
+		releaseImageLock(log, img)
+		return errImageInUse
+	}
+	return nil
+}
+
+func releaseImageLock(log logr.Logger, img *librbd.Image) {
+	if err := img.LockRelease(); err != nil {
+		log.Error(err, "Failed to release exclusive lock of image")
+	}
+}
+
+// verifyImageCopy checks the size and contents of the copy and copies the metadata, e.g. the wwn and limits, of the
+// image.
+func verifyImageCopy(log logr.Logger, img *librbd.Image, targetIOCtx *rados.IOContext, imageName string) error {
+	target, err := openImage(targetIOCtx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to open copy: %w", err)
+	}
+	defer closeImage(log, target)
+
+	size, err := img.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get image size: %w", err)
+	}
+	targetSize, err := target.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get size of copy: %w", err)
+	}
+	if size != targetSize {
+		return fmt.Errorf("size of copy %d does not match image size %d", targetSize, size)
+	}
+
+	if err := compareImageContents(img, target, size); err != nil {
+		return err
+	}
+
+	metadata, err := img.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list image metadata: %w", err)
+	}
+	for key, value := range metadata {
+		if err := target.SetMetadata(key, value); err != nil {
+			return fmt.Errorf("failed to copy metadata %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// migrationCompareChunkSize is the size of the chunks the contents of an image and its copy are compared in.
+const migrationCompareChunkSize = 4 * 1024 * 1024
+
+// compareImageContents compares the first size bytes of the image and its copy.
+func compareImageContents(img, target io.ReaderAt, size uint64) error {
+	buf, targetBuf := make([]byte, migrationCompareChunkSize), make([]byte, migrationCompareChunkSize)
+	for off := uint64(0); off < size; off += migrationCompareChunkSize {
+		n := min(size-off, migrationCompareChunkSize)
+		if _, err := img.ReadAt(buf[:n], int64(off)); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read image at offset %d: %w", off, err)
+		}
+		if _, err := target.ReadAt(targetBuf[:n], int64(off)); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read copy at offset %d: %w", off, err)
+		}
+		if !bytes.Equal(buf[:n], targetBuf[:n]) {
+			return fmt.Errorf("contents of copy differ from the image in the chunk at offset %d", off)
+		}
+	}
+	return nil
+}
+
+func removeIncompleteCopy(log logr.Logger, ioCtx *rados.IOContext, imageName string) {
+	if err := librbd.RemoveImage(ioCtx, imageName); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		log.Error(err, "Failed to remove incomplete copy")
+	}
+}
+
+func (m *connImageMigrator) Remove(pool, imageName string) error {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(m.conns, pool, m.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	if err := librbd.RemoveImage(ioCtx, imageName); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to remove image: %w", err)
+	}
+	return nil
+}
+
+func (m *connImageMigrator) Snapshots(pool, imageName string) ([]string, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(m.conns, pool, m.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	img, err := openImage(ioCtx, imageName)
+	if err != nil {
+		return nil, err
+	}
+	defer closeImage(logr.Discard(), img)
+
+	infos, err := img.GetSnapshotNames()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeImageMigrator struct {
+	// images are the pools the images are stored in.
+	images map[string][]string
+	// snapshots are the rbd snapshots of the images.
+	snapshots map[string][]string
+	inUse     bool
+	copyErr   error
+	removeErr error
+}
+
+func (m *fakeImageMigrator) Copy(log logr.Logger, pool, targetPool, imageName string, commit func() error) error {
+	if m.inUse {
+		return errImageInUse
+	}
+	if m.copyErr != nil {
+		return m.copyErr
+	}
+	m.images[imageName] = append(m.images[imageName], targetPool)
+	if err := commit(); err != nil {
+		_ = m.remove(targetPool, imageName)
+		return err
+	}
+	return nil
+}
+
+func (m *fakeImageMigrator) Remove(pool, imageName string) error {
+	if m.removeErr != nil {
+		return m.removeErr
+	}
+	return m.remove(pool, imageName)
+}
+
+func (m *fakeImageMigrator) Snapshots(pool, imageName string) ([]string, error) {
+	return m.snapshots[imageName], nil
+}
+
+func (m *fakeImageMigrator) remove(pool, imageName string) error {
+	var pools []string
+	for _, p := range m.images[imageName] {
+		if p != pool {
+			pools = append(pools, p)
+		}
+	}
+	m.images[imageName] = pools
+	return nil
+}
+
+var _ = Describe("migrateImageIfRequested", func() {
+	var (
+		r        *ImageReconciler
+		migrator *fakeImageMigrator
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{Pool: "pool"})
+		Expect(err).NotTo(HaveOccurred())
+
+		migrator = &fakeImageMigrator{images: map[string][]string{ImageIDToRBDID("foo"): {"pool"}}}
+		r.migrator = migrator
+	})
+
+	createImage := func(ctx SpecContext, targetPool string) *providerapi.Image {
+		img, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Pool: targetPool},
+			Status: providerapi.ImageStatus{
+				State:  providerapi.ImageStateAvailable,
+				Access: &providerapi.ImageAccess{Handle: "pool/" + ImageIDToRBDID("foo")},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return img
+	}
+
+	It("should not migrate images in the requested pool", func(ctx SpecContext) {
+		img := createImage(ctx, "")
+
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(Succeed())
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.Conditions", BeEmpty()))
+	})
+
+	It("should copy the image to the target pool and remove it from the previous pool", func(ctx SpecContext) {
+		img := createImage(ctx, "fast")
+
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(Succeed())
+
+		Expect(migrator.images).To(HaveKeyWithValue(ImageIDToRBDID("foo"), []string{"fast"}))
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Status.Pool).To(Equal("fast"))
+		Expect(img.Status.Access.Handle).To(Equal("fast/" + ImageIDToRBDID("foo")))
+		Expect(img.Status.Conditions).To(BeEmpty())
+		Expect(r.imagePool(img)).To(Equal("fast"))
+	})
+
+	It("should keep the image in its pool if the copy fails", func(ctx SpecContext) {
+		migrator.copyErr = errors.New("copy failed")
+		img := createImage(ctx, "fast")
+
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(Succeed())
+
+		Expect(migrator.images).To(HaveKeyWithValue(ImageIDToRBDID("foo"), []string{"pool"}))
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Status.Pool).To(BeEmpty())
+		Expect(img.Status.Access.Handle).To(Equal("pool/" + ImageIDToRBDID("foo")))
+		Expect(img.Status.Conditions).To(ConsistOf(SatisfyAll(
+			HaveField("Type", providerapi.ImageConditionMigrating),
+			HaveField("Status", providerapi.ConditionFalse),
+			HaveField("Reason", "CopyFailed"),
+			HaveField("Message", "copy failed"),
+		)))
+	})
+
+	It("should record the previous pool until the image is removed from it", func(ctx SpecContext) {
+		migrator.removeErr = errors.New("remove failed")
+		img := createImage(ctx, "fast")
+
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(MatchError(ContainSubstring("remove failed")))
+
+		Expect(migrator.images).To(HaveKeyWithValue(ImageIDToRBDID("foo"), []string{"pool", "fast"}))
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Status.Pool).To(Equal("fast"))
+		Expect(img.Status.MigrationSourcePool).To(Equal("pool"))
+
+		By("retrying the removal on the next reconcile")
+		migrator.removeErr = nil
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(Succeed())
+
+		Expect(migrator.images).To(HaveKeyWithValue(ImageIDToRBDID("foo"), []string{"fast"}))
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.MigrationSourcePool", BeEmpty()))
+	})
+
+	It("should not migrate an image in use", func(ctx SpecContext) {
+		migrator.inUse = true
+		img := createImage(ctx, "fast")
+
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(Succeed())
+
+		Expect(migrator.images).To(HaveKeyWithValue(ImageIDToRBDID("foo"), []string{"pool"}))
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.Conditions", ConsistOf(
+			HaveField("Reason", "InUse"),
+		)))
+	})
+
+	It("should not migrate an image with snapshots", func(ctx SpecContext) {
+		_, err := r.snapshots.Create(ctx, &providerapi.Snapshot{
+			Metadata: apiutils.Metadata{ID: "snap"},
+			Source:   providerapi.SnapshotSource{VolumeImageID: "foo"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		img := createImage(ctx, "fast")
+
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(Succeed())
+
+		Expect(migrator.images).To(HaveKeyWithValue(ImageIDToRBDID("foo"), []string{"pool"}))
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.Conditions", ConsistOf(
+			HaveField("Reason", "HasSnapshots"),
+		)))
+	})
+
+	It("should not migrate a template with clones", func(ctx SpecContext) {
+		migrator.snapshots = map[string][]string{ImageIDToRBDID("foo"): {TemplateSnapshotName}}
+		img := createImage(ctx, "fast")
+
+		Expect(r.migrateImageIfRequested(ctx, logr.Discard(), img)).To(Succeed())
+
+		Expect(migrator.images).To(HaveKeyWithValue(ImageIDToRBDID("foo"), []string{"pool"}))
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.Conditions", ConsistOf(SatisfyAll(
+			HaveField("Reason", "HasSnapshots"),
+			HaveField("Message", ContainSubstring(TemplateSnapshotName)),
+		))))
+	})
+})
+
+var _ = Describe("compareImageContents", func() {
+	var data []byte
+
+	BeforeEach(func() {
+		data = make([]byte, 2*migrationCompareChunkSize+512)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+	})
+
+	It("should accept an identical copy", func() {
+		copied := bytes.Clone(data)
+		Expect(compareImageContents(bytes.NewReader(data), bytes.NewReader(copied), uint64(len(data)))).To(Succeed())
+	})
+
+	It("should reject a copy differing in content", func() {
+		copied := bytes.Clone(data)
+		copied[len(copied)-1]++
+		err := compareImageContents(bytes.NewReader(data), bytes.NewReader(copied), uint64(len(data)))
+		Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("offset %d", 2*migrationCompareChunkSize))))
+	})
+})
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ErrPoolMirroringNotConfigured is returned if mirroring is requested for an image in a pool without mirroring.
+var ErrPoolMirroringNotConfigured = errors.New("mirroring is not configured for pool")
+
+// imageMirror is the subset of rbd image mirroring operations used to enable mirroring.
+type imageMirror interface {
+	MirrorEnable(mode librbd.ImageMirrorMode) error
+	GetMirrorImageInfo() (*librbd.MirrorImageInfo, error)
+}
+
+func imageMirrorMode(mode providerapi.MirroringMode) (librbd.ImageMirrorMode, error) {
+	switch mode {
+	case providerapi.MirroringModeJournal:
+		return librbd.ImageMirrorModeJournal, nil
+	case providerapi.MirroringModeSnapshot:
+		return librbd.ImageMirrorModeSnapshot, nil
+	default:
+		return 0, fmt.Errorf("unsupported mirroring mode %q", mode)
+	}
+}
+
+func (r *ImageReconciler) setImageMirroring(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	if image.Spec.Mirroring == nil {
+		return nil
+	}
+
+	poolMode, err := librbd.GetMirrorMode(ioCtx)
+	if err != nil {
+		return fmt.Errorf("failed to get pool mirroring mode: %w", err)
+	}
+
+	img, err := openImage(ioCtx, RBDImageName(image))
+	if err != nil {
+		return err
+	}
+	defer closeImage(log, img)
+
+	return r.enableImageMirroring(log, poolMode, img, image)
+}
+
+// enableImageMirroring enables mirroring of the image in the requested mode and records the mirroring status.
+// In pool mirroring mode, images with the journaling feature are mirrored by ceph without being enabled.
+func (r *ImageReconciler) enableImageMirroring(log logr.Logger, poolMode librbd.MirrorMode, img imageMirror, image *providerapi.Image) error {
+	mode, err := imageMirrorMode(image.Spec.Mirroring.Mode)
+	if err != nil {
+		return err
+	}
+
+	switch poolMode {
+	case librbd.MirrorModeImage:
+	case librbd.MirrorModePool:
+		if mode != librbd.ImageMirrorModeJournal {
+			return fmt.Errorf("%s mirroring requires pool %s to mirror in image mode", mode, r.imagePool(image))
+		}
+		if !slices.Contains(image.Spec.Features, "journaling") {
+			return fmt.Errorf("journal mirroring requires the journaling image feature")
+		}
+	default:
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "MirroringNotConfigured", "Mirroring is not configured for pool %s", r.imagePool(image))
+		return fmt.Errorf("%w %s", ErrPoolMirroringNotConfigured, r.imagePool(image))
+	}
+
+	info, err := img.GetMirrorImageInfo()
+	if err != nil {
+		return fmt.Errorf("failed to get image mirroring info: %w", err)
+	}
+
+	if info.State != librbd.MirrorImageEnabled && poolMode == librbd.MirrorModeImage {
+		log.V(1).Info("Enabling image mirroring", "mode", mode)
+		if err := img.MirrorEnable(mode); err != nil {
+			r.Eventf(image.Metadata, corev1.EventTypeWarning, "EnableMirroringFailed", "Failed to enable image mirroring: %s", err)
+			return fmt.Errorf("failed to enable image mirroring: %w", err)
+		}
+		if info, err = img.GetMirrorImageInfo(); err != nil {
+			return fmt.Errorf("failed to get image mirroring info: %w", err)
+		}
+		r.Eventf(image.Metadata, corev1.EventTypeNormal, "EnabledMirroring", "Enabled %s mirroring", mode)
+	}
+
+	image.Status.Mirroring = &providerapi.MirroringStatus{
+		Mode:    image.Spec.Mirroring.Mode,
+		State:   info.State.String(),
+		Primary: info.Primary,
+	}
+	return nil
+}
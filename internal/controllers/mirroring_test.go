@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeImageMirror struct {
+	info    librbd.MirrorImageInfo
+	enabled []librbd.ImageMirrorMode
+}
+
+func (m *fakeImageMirror) MirrorEnable(mode librbd.ImageMirrorMode) error {
+	m.enabled = append(m.enabled, mode)
+	m.info.State = librbd.MirrorImageEnabled
+	m.info.Primary = true
+	return nil
+}
+
+func (m *fakeImageMirror) GetMirrorImageInfo() (*librbd.MirrorImageInfo, error) {
+	info := m.info
+	return &info, nil
+}
+
+var _ = Describe("enableImageMirroring", func() {
+	var (
+		r      *ImageReconciler
+		mirror *fakeImageMirror
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		mirror = &fakeImageMirror{info: librbd.MirrorImageInfo{State: librbd.MirrorImageDisabled}}
+	})
+
+	mirroredImage := func(mode providerapi.MirroringMode) *providerapi.Image {
+		return &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Mirroring: &providerapi.MirroringSpec{Mode: mode}},
+		}
+	}
+
+	It("should enable snapshot mirroring and record the mirroring status", func() {
+		img := mirroredImage(providerapi.MirroringModeSnapshot)
+
+		Expect(r.enableImageMirroring(logr.Discard(), librbd.MirrorModeImage, mirror, img)).To(Succeed())
+		Expect(mirror.enabled).To(ConsistOf(librbd.ImageMirrorModeSnapshot))
+		Expect(img.Status.Mirroring).To(Equal(&providerapi.MirroringStatus{
+			Mode:    providerapi.MirroringModeSnapshot,
+			State:   "enabled",
+			Primary: true,
+		}))
+	})
+
+	It("should not enable mirroring again", func() {
+		mirror.info = librbd.MirrorImageInfo{State: librbd.MirrorImageEnabled, Primary: true}
+		img := mirroredImage(providerapi.MirroringModeSnapshot)
+
+		Expect(r.enableImageMirroring(logr.Discard(), librbd.MirrorModeImage, mirror, img)).To(Succeed())
+		Expect(mirror.enabled).To(BeEmpty())
+		Expect(img.Status.Mirroring).To(HaveField("State", "enabled"))
+	})
+
+	It("should fail if mirroring is not configured for the pool", func() {
+		img := mirroredImage(providerapi.MirroringModeSnapshot)
+
+		Expect(r.enableImageMirroring(logr.Discard(), librbd.MirrorModeDisabled, mirror, img)).To(MatchError(ErrPoolMirroringNotConfigured))
+		Expect(mirror.enabled).To(BeEmpty())
+		Expect(img.Status.Mirroring).To(BeNil())
+	})
+
+	It("should reject snapshot mirroring in pool mirroring mode", func() {
+		img := mirroredImage(providerapi.MirroringModeSnapshot)
+
+		Expect(r.enableImageMirroring(logr.Discard(), librbd.MirrorModePool, mirror, img)).To(HaveOccurred())
+		Expect(mirror.enabled).To(BeEmpty())
+	})
+
+	It("should rely on pool mirroring for journaled images", func() {
+		mirror.info = librbd.MirrorImageInfo{State: librbd.MirrorImageEnabled, Primary: true}
+		img := mirroredImage(providerapi.MirroringModeJournal)
+		img.Spec.Features = []string{"exclusive-lock", "journaling"}
+
+		Expect(r.enableImageMirroring(logr.Discard(), librbd.MirrorModePool, mirror, img)).To(Succeed())
+		Expect(mirror.enabled).To(BeEmpty())
+		Expect(img.Status.Mirroring).To(HaveField("Mode", providerapi.MirroringModeJournal))
+	})
+
+	It("should reject unknown mirroring modes", func() {
+		Expect(r.enableImageMirroring(logr.Discard(), librbd.MirrorModeImage, mirror, mirroredImage("bogus"))).To(HaveOccurred())
+	})
+})
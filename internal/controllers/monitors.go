@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+)
+
+// DefaultMonitorRefreshInterval is the interval the monitors are refreshed in from the monitor source.
+const DefaultMonitorRefreshInterval = time.Minute
+
+// MonitorSource provides the current ceph monitors, e.g. from the rook mon endpoint ConfigMap.
+type MonitorSource interface {
+	// Monitors returns the comma-separated host:port addresses of the monitors.
+	Monitors(ctx context.Context) (string, error)
+}
+
+// parseMonitors validates a comma-separated list of host:port monitor addresses and returns the single
+// endpoints. IPv6 addresses have to be bracketed, e.g. [fd00::1]:6789, and are returned bracketed.
+func parseMonitors(monitors string) ([]string, error) {
+	entries := strings.Split(monitors, ",")
+	endpoints := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return nil, fmt.Errorf("monitor %d is empty", i)
+		}
+
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			return nil, fmt.Errorf("monitor %q is not a valid host:port address: %w", entry, err)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("monitor %q has no host", entry)
+		}
+		if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+			return nil, fmt.Errorf("monitor %q has invalid port %q", entry, port)
+		}
+
+		endpoints = append(endpoints, net.JoinHostPort(host, port))
+	}
+	return endpoints, nil
+}
+
+// currentMonitors returns the monitors handed out in the access of available images.
+func (r *ImageReconciler) currentMonitors() (string, []string) {
+	r.monitorsMu.RLock()
+	defer r.monitorsMu.RUnlock()
+	return r.monitors, slices.Clone(r.monitorEndpoints)
+}
+
+// imageAccess returns the access of the image with the current monitors.
+func (r *ImageReconciler) imageAccess(img *providerapi.Image, user, key string) *providerapi.ImageAccess {
+	monitors, monitorEndpoints := r.currentMonitors()
+	return &providerapi.ImageAccess{
+		Monitors:         monitors,
+		MonitorEndpoints: monitorEndpoints,
+		Handle:           ceph.ImageSpec(r.imagePool(img), r.namespace, RBDImageName(img)),
+		User:             user,
+		UserKey:          key,
+	}
+}
+
+// setMonitors replaces the monitors handed out in the access of images and reports whether they changed.
+func (r *ImageReconciler) setMonitors(monitors string) (bool, error) {
+	endpoints, err := parseMonitors(monitors)
+	if err != nil {
+		return false, err
+	}
+
+	r.monitorsMu.Lock()
+	defer r.monitorsMu.Unlock()
+	if slices.Equal(r.monitorEndpoints, endpoints) {
+		return false, nil
+	}
+	r.monitors = strings.Join(endpoints, ",")
+	r.monitorEndpoints = endpoints
+	return true, nil
+}
+
+// refreshMonitors reads the monitors from the monitor source. Images that are already available keep their access.
+func (r *ImageReconciler) refreshMonitors(ctx context.Context) error {
+	monitors, err := r.monitorSource.Monitors(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get monitors: %w", err)
+	}
+
+	changed, err := r.setMonitors(monitors)
+	if err != nil {
+		return fmt.Errorf("invalid monitors from monitor source: %w", err)
+	}
+	if changed {
+		r.log.Info("Updated monitors", "Monitors", monitors)
+	}
+	return nil
+}
+
+// startMonitorRefresh refreshes the monitors periodically until the context is done. The current monitors are
+// kept if a refresh fails.
+func (r *ImageReconciler) startMonitorRefresh(ctx context.Context) {
+	ticker := time.NewTicker(r.monitorRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refreshMonitors(ctx); err != nil {
+				r.log.Error(err, "Failed to refresh monitors, keeping the current monitors")
+			}
+		}
+	}
+}
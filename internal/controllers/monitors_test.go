@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/rook"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("parseMonitors", func() {
+	DescribeTable("should accept valid monitors",
+		func(monitors string, expected []string) {
+			Expect(parseMonitors(monitors)).To(Equal(expected))
+		},
+		Entry("single monitor", "10.0.0.1:6789", []string{"10.0.0.1:6789"}),
+		Entry("multiple monitors", "10.0.0.1:6789,10.0.0.2:6789", []string{"10.0.0.1:6789", "10.0.0.2:6789"}),
+		Entry("whitespace", " 10.0.0.1:6789 ,\t10.0.0.2:3300 ", []string{"10.0.0.1:6789", "10.0.0.2:3300"}),
+		Entry("hostname", "mon-a.ceph.svc:6789", []string{"mon-a.ceph.svc:6789"}),
+		Entry("ipv6 monitor", "[fd00::1]:6789", []string{"[fd00::1]:6789"}),
+		Entry("multiple ipv6 monitors", "[fd00::1]:6789,[fd00::2]:3300", []string{"[fd00::1]:6789", "[fd00::2]:3300"}),
+		Entry("mixed monitors", "10.0.0.1:6789, [fd00::1]:6789,mon-c.ceph.svc:3300",
+			[]string{"10.0.0.1:6789", "[fd00::1]:6789", "mon-c.ceph.svc:3300"}),
+	)
+
+	DescribeTable("should reject invalid monitors",
+		func(monitors, expectedErr string) {
+			_, err := parseMonitors(monitors)
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("empty entry", "10.0.0.1:6789,,10.0.0.2:6789", "monitor 1 is empty"),
+		Entry("trailing comma", "10.0.0.1:6789,", "monitor 1 is empty"),
+		Entry("missing port", "10.0.0.1", "not a valid host:port address"),
+		Entry("non-numeric port", "10.0.0.1:abc", "invalid port"),
+		Entry("port out of range", "10.0.0.1:70000", "invalid port"),
+		Entry("zero port", "10.0.0.1:0", "invalid port"),
+		Entry("missing host", ":6789", "has no host"),
+		Entry("unbracketed ipv6", "fd00::1:6789", "not a valid host:port address"),
+		Entry("ipv6 without port", "[fd00::1]", "not a valid host:port address"),
+	)
+
+	It("should provide the parsed monitors to the image reconciler", func() {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{Monitors: "10.0.0.1:6789, [fd00::1]:6789"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.monitors).To(Equal("10.0.0.1:6789,[fd00::1]:6789"))
+		Expect(r.monitorEndpoints).To(Equal([]string{"10.0.0.1:6789", "[fd00::1]:6789"}))
+	})
+
+	It("should fail constructing the image reconciler with invalid monitors", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{Monitors: "10.0.0.1:abc"})
+		Expect(err).To(MatchError(ContainSubstring("invalid monitors")))
+	})
+})
+
+var _ = Describe("monitor refresh", func() {
+	var (
+		ctx       context.Context
+		k8sClient client.Client
+		configMap *corev1.ConfigMap
+		r         *ImageReconciler
+	)
+
+	csiClusterConfig := func(monitors string) string {
+		return `[{"clusterID":"other","monitors":["10.1.0.1:6789"]},{"clusterID":"rook-ceph","monitors":[` + monitors + `]}]`
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "rook-ceph", Name: rook.MonitorConfigMapNameDefaultValue},
+			Data: map[string]string{
+				rook.MonitorConfigMapDataKeyDefaultValue: csiClusterConfig(`"10.0.0.1:6789","10.0.0.2:6789"`),
+			},
+		}
+		k8sClient = fake.NewClientBuilder().WithObjects(configMap).Build()
+
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{
+			Monitors: "10.0.0.9:6789",
+			MonitorSource: &rook.MonitorConfigMapSource{
+				Client:    k8sClient,
+				ConfigMap: client.ObjectKeyFromObject(configMap),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should hand out the monitors of the changed config map to new images", func() {
+		img := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}}
+
+		Expect(r.refreshMonitors(ctx)).To(Succeed())
+		oldAccess := r.imageAccess(img, "user", "key")
+		Expect(oldAccess.Monitors).To(Equal("10.0.0.1:6789,10.0.0.2:6789"))
+		Expect(oldAccess.MonitorEndpoints).To(Equal([]string{"10.0.0.1:6789", "10.0.0.2:6789"}))
+
+		configMap.Data[rook.MonitorConfigMapDataKeyDefaultValue] = csiClusterConfig(`"10.0.0.2:6789","10.0.0.3:6789"`)
+		Expect(k8sClient.Update(ctx, configMap)).To(Succeed())
+		Expect(r.refreshMonitors(ctx)).To(Succeed())
+
+		newAccess := r.imageAccess(img, "user", "key")
+		Expect(newAccess.Monitors).To(Equal("10.0.0.2:6789,10.0.0.3:6789"))
+		Expect(newAccess.MonitorEndpoints).To(Equal([]string{"10.0.0.2:6789", "10.0.0.3:6789"}))
+		Expect(oldAccess.Monitors).To(Equal("10.0.0.1:6789,10.0.0.2:6789"), "existing access must not change")
+	})
+
+	It("should read the monitors of the data key", func() {
+		configMap.Data[rook.MonitorDataKey] = "a=10.0.0.4:6789,b=[fd00::1]:6789"
+		Expect(k8sClient.Update(ctx, configMap)).To(Succeed())
+		r.monitorSource = &rook.MonitorConfigMapSource{
+			Client:    k8sClient,
+			ConfigMap: client.ObjectKeyFromObject(configMap),
+			DataKey:   rook.MonitorDataKey,
+		}
+
+		Expect(r.refreshMonitors(ctx)).To(Succeed())
+		monitors, _ := r.currentMonitors()
+		Expect(monitors).To(Equal("10.0.0.4:6789,[fd00::1]:6789"))
+	})
+
+	It("should keep the current monitors if the config map is invalid", func() {
+		Expect(r.refreshMonitors(ctx)).To(Succeed())
+
+		configMap.Data[rook.MonitorConfigMapDataKeyDefaultValue] = csiClusterConfig(`"10.0.0.1"`)
+		Expect(k8sClient.Update(ctx, configMap)).To(Succeed())
+
+		Expect(r.refreshMonitors(ctx)).To(MatchError(ContainSubstring("invalid monitors")))
+		monitors, _ := r.currentMonitors()
+		Expect(monitors).To(Equal("10.0.0.1:6789,10.0.0.2:6789"))
+	})
+
+	It("should fail if the cluster is missing from the config map", func() {
+		r.monitorSource = &rook.MonitorConfigMapSource{
+			Client:    k8sClient,
+			ConfigMap: client.ObjectKeyFromObject(configMap),
+			ClusterID: "missing",
+		}
+
+		Expect(r.refreshMonitors(ctx)).To(MatchError(ContainSubstring("cluster missing not found")))
+	})
+
+	It("should not require monitors if a monitor source is specified", func() {
+		_, err := NewImageReconciler(r.log, r.conns, r.images, r.snapshots, r.EventRecorder, r.imageEvents, r.snapshotEvents,
+			r.keyEncryption, ImageReconcilerOptions{
+				Pool:          "pool",
+				Client:        "client.volumes",
+				MonitorSource: r.monitorSource,
+			})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,247 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DefaultOrphanImageGCInterval    = 10 * time.Minute
+	DefaultOrphanImageGCGracePeriod = 1 * time.Hour
+)
+
+// rbdPool is the subset of rbd operations on a pool used to collect orphaned images.
+type rbdPool interface {
+	ListImages() ([]string, error)
+	ImageCreatedAt(name string) (time.Time, error)
+	RemoveImage(name string) error
+}
+
+type OrphanImageCollectorOptions struct {
+	Pool string
+	// Namespace is the rbd namespace within the pool the images are stored in. Defaults to the default namespace.
+	Namespace string
+
+	// Interval is the interval the pool is checked for orphaned rbd images in.
+	Interval time.Duration
+
+	// GracePeriod is the minimum age of an rbd image without store entry before it is removed.
+	GracePeriod time.Duration
+
+	// Maintenance skips collecting orphaned rbd images while it is on. They are always collected if nil.
+	Maintenance *maintenance.Mode
+}
+
+func setOrphanImageCollectorOptionsDefaults(o *OrphanImageCollectorOptions) {
+	if o.Interval == 0 {
+		o.Interval = DefaultOrphanImageGCInterval
+	}
+	if o.GracePeriod == 0 {
+		o.GracePeriod = DefaultOrphanImageGCGracePeriod
+	}
+}
+
+// OrphanImageCollector removes rbd images of the pool which have no corresponding image or snapshot in the store,
+// e.g. because the provider crashed after creating the rbd image but before recording it.
+type OrphanImageCollector struct {
+	log logr.Logger
+	rbd rbdPool
+
+	images    store.Store[*providerapi.Image]
+	snapshots store.Store[*providerapi.Snapshot]
+
+	interval    time.Duration
+	gracePeriod time.Duration
+	maintenance *maintenance.Mode
+
+	now func() time.Time
+}
+
+func NewOrphanImageCollector(
+	log logr.Logger,
+	conns ceph.ConnAccessor,
+	images store.Store[*providerapi.Image],
+	snapshots store.Store[*providerapi.Snapshot],
+	opts OrphanImageCollectorOptions,
+) (*OrphanImageCollector, error) {
+	if conns == nil {
+		return nil, fmt.Errorf("must specify conns")
+	}
+
+	if images == nil {
+		return nil, fmt.Errorf("must specify image store")
+	}
+
+	if snapshots == nil {
+		return nil, fmt.Errorf("must specify snapshot store")
+	}
+
+	if opts.Pool == "" {
+		return nil, fmt.Errorf("must specify pool")
+	}
+
+	if err := ceph.ValidateNamespace(opts.Namespace); err != nil {
+		return nil, err
+	}
+
+	setOrphanImageCollectorOptionsDefaults(&opts)
+
+	return &OrphanImageCollector{
+		log:         log,
+		rbd:         &connRBDPool{conns: conns, pool: opts.Pool, namespace: opts.Namespace},
+		images:      images,
+		snapshots:   snapshots,
+		interval:    opts.Interval,
+		gracePeriod: opts.GracePeriod,
+		maintenance: opts.Maintenance,
+		now:         time.Now,
+	}, nil
+}
+
+// Start collects orphaned rbd images every interval until ctx is done.
+func (c *OrphanImageCollector) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.Collect(ctx); err != nil {
+			c.log.Error(err, "Failed to collect orphaned rbd images")
+		}
+	}, c.interval)
+}
+
+// Collect removes all rbd images without store entry that are older than the grace period. Nothing is removed while
+// the maintenance mode is on.
+func (c *OrphanImageCollector) Collect(ctx context.Context) error {
+	if c.maintenance.Paused() {
+		c.log.V(1).Info("Maintenance mode on, skipping orphaned rbd image collection")
+		return nil
+	}
+
+	// The rbd images have to be listed before the store: an rbd image is only created once its store entry exists,
+	// so every rbd image listed here that is still in use has an entry in the subsequent store listing.
+	names, err := c.rbd.ListImages()
+	if err != nil {
+		return fmt.Errorf("failed to list rbd images: %w", err)
+	}
+
+	inUse, err := c.inUseRBDIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := c.now()
+	for _, name := range names {
+		if !isManagedRBDID(name) || inUse.Has(name) {
+			continue
+		}
+
+		createdAt, err := c.rbd.ImageCreatedAt(name)
+		if err != nil {
+			c.log.Error(err, "Failed to get creation time of rbd image", "RBDImage", name)
+			continue
+		}
+		if age := now.Sub(createdAt); age < c.gracePeriod {
+			c.log.V(1).Info("Rbd image without store entry is still within grace period", "RBDImage", name, "Age", age)
+			continue
+		}
+
+		if c.maintenance.Paused() {
+			c.log.V(1).Info("Maintenance mode on, stopping orphaned rbd image collection")
+			return nil
+		}
+
+		c.log.Info("Removing orphaned rbd image", "RBDImage", name, "CreatedAt", createdAt)
+		if err := c.rbd.RemoveImage(name); err != nil {
+			c.log.Error(err, "Failed to remove orphaned rbd image", "RBDImage", name)
+			continue
+		}
+		c.log.Info("Removed orphaned rbd image", "RBDImage", name)
+	}
+	return nil
+}
+
+func isManagedRBDID(name string) bool {
+	return strings.HasPrefix(name, ImageRBDIDPrefix) || strings.HasPrefix(name, SnapshotRBDIDPrefix)
+}
+
+func (c *OrphanImageCollector) inUseRBDIDs(ctx context.Context) (sets.Set[string], error) {
+	inUse := sets.New[string]()
+	if err := listPages(ctx, c.images, func(images []*providerapi.Image) error {
+		for _, img := range images {
+			inUse.Insert(ImageIDToRBDID(img.ID))
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	if err := listPages(ctx, c.snapshots, func(snapshots []*providerapi.Snapshot) error {
+		for _, snapshot := range snapshots {
+			inUse.Insert(SnapshotIDToRBDID(snapshot.ID))
+			// The rbd image of a deleted volume is kept under its image rbd id as long as snapshots refer to it.
+			inUse.Insert(ImageIDToRBDID(snapshot.ID))
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	return inUse, nil
+}
+
+type connRBDPool struct {
+	conns     ceph.ConnAccessor
+	pool      string
+	namespace string
+}
+
+func (p *connRBDPool) ListImages() ([]string, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(p.conns, p.pool, p.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return librbd.GetImageNames(ioCtx)
+}
+
+func (p *connRBDPool) ImageCreatedAt(name string) (time.Time, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(p.conns, p.pool, p.namespace)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	img, err := librbd.OpenImageReadOnly(ioCtx, name, librbd.NoSnapshot)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open rbd image: %w", err)
+	}
+	defer func() { _ = img.Close() }()
+
+	ts, err := img.GetCreateTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get create timestamp: %w", err)
+	}
+	return time.Unix(ts.Sec, ts.Nsec), nil
+}
+
+func (p *connRBDPool) RemoveImage(name string) error {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(p.conns, p.pool, p.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return librbd.RemoveImage(ioCtx, name)
+}
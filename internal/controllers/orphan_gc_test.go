@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeRBDPool struct {
+	createdAt map[string]time.Time
+	removed   []string
+}
+
+func (p *fakeRBDPool) ListImages() ([]string, error) {
+	return slices.Sorted(maps.Keys(p.createdAt)), nil
+}
+
+func (p *fakeRBDPool) ImageCreatedAt(name string) (time.Time, error) {
+	createdAt, ok := p.createdAt[name]
+	if !ok {
+		return time.Time{}, errors.New("rbd image not found")
+	}
+	return createdAt, nil
+}
+
+func (p *fakeRBDPool) RemoveImage(name string) error {
+	delete(p.createdAt, name)
+	p.removed = append(p.removed, name)
+	return nil
+}
+
+var _ = Describe("OrphanImageCollector", func() {
+	var (
+		now       time.Time
+		pool      *fakeRBDPool
+		images    *memoryStore[*providerapi.Image]
+		snapshots *memoryStore[*providerapi.Snapshot]
+		c         *OrphanImageCollector
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		pool = &fakeRBDPool{createdAt: map[string]time.Time{}}
+		images = newMemoryStore[*providerapi.Image]()
+		snapshots = newMemoryStore[*providerapi.Snapshot]()
+
+		var err error
+		c, err = NewOrphanImageCollector(logr.Discard(), ceph.StaticConn(&rados.Conn{}), images, snapshots, OrphanImageCollectorOptions{
+			Pool:        "pool",
+			GracePeriod: time.Hour,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		c.rbd = pool
+		c.now = func() time.Time { return now }
+	})
+
+	It("should remove orphaned rbd images older than the grace period", func(ctx SpecContext) {
+		pool.createdAt[ImageIDToRBDID("orphan")] = now.Add(-2 * time.Hour)
+		pool.createdAt[SnapshotIDToRBDID("orphan-snapshot")] = now.Add(-2 * time.Hour)
+
+		Expect(c.Collect(ctx)).To(Succeed())
+		Expect(pool.removed).To(ConsistOf(ImageIDToRBDID("orphan"), SnapshotIDToRBDID("orphan-snapshot")))
+	})
+
+	It("should not remove rbd images in use", func(ctx SpecContext) {
+		_, err := images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "image"}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = snapshots.Create(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "snapshot"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		pool.createdAt[ImageIDToRBDID("image")] = now.Add(-2 * time.Hour)
+		pool.createdAt[SnapshotIDToRBDID("snapshot")] = now.Add(-2 * time.Hour)
+		// rbd image of a deleted volume kept for its snapshot
+		pool.createdAt[ImageIDToRBDID("snapshot")] = now.Add(-2 * time.Hour)
+
+		Expect(c.Collect(ctx)).To(Succeed())
+		Expect(pool.removed).To(BeEmpty())
+	})
+
+	It("should not remove orphaned rbd images within the grace period", func(ctx SpecContext) {
+		pool.createdAt[ImageIDToRBDID("orphan")] = now.Add(-time.Minute)
+
+		Expect(c.Collect(ctx)).To(Succeed())
+		Expect(pool.removed).To(BeEmpty())
+	})
+
+	It("should not remove orphaned rbd images while the maintenance mode is on", func(ctx SpecContext) {
+		mode := maintenance.NewMode(logr.Discard(), true)
+		c.maintenance = mode
+		pool.createdAt[ImageIDToRBDID("orphan")] = now.Add(-2 * time.Hour)
+
+		Expect(c.Collect(ctx)).To(Succeed())
+		Expect(pool.removed).To(BeEmpty())
+
+		mode.Resume()
+		Expect(c.Collect(ctx)).To(Succeed())
+		Expect(pool.removed).To(ConsistOf(ImageIDToRBDID("orphan")))
+	})
+
+	It("should ignore rbd images not managed by the provider", func(ctx SpecContext) {
+		pool.createdAt["foreign"] = now.Add(-2 * time.Hour)
+
+		Expect(c.Collect(ctx)).To(Succeed())
+		Expect(pool.removed).To(BeEmpty())
+	})
+
+	It("should collect in the configured rbd namespace", func() {
+		c, err := NewOrphanImageCollector(logr.Discard(), ceph.StaticConn(&rados.Conn{}), images, snapshots, OrphanImageCollectorOptions{
+			Pool:      "pool",
+			Namespace: "tenant",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.rbd.(*connRBDPool).namespace).To(Equal("tenant"))
+	})
+})
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+)
+
+// poolSlotRequeueDelay is the delay images waiting for a reconcile slot of their target pool are requeued after.
+const poolSlotRequeueDelay = 5 * time.Second
+
+// errPoolSlotsBusy signals the image has to be retried once a reconcile slot of its target pool is free.
+var errPoolSlotsBusy = errors.New("all reconcile slots of the pool are busy")
+
+// acquirePoolSlot acquires a reconcile slot of the target pool of the image without waiting for it, so that busy
+// pools don't block workers other pools could use. It returns errPoolSlotsBusy if all slots are taken. The returned
+// func releases the slot again.
+func (r *ImageReconciler) acquirePoolSlot(ctx context.Context, id string) (func(), error) {
+	if r.poolSlots == nil {
+		return func() {}, nil
+	}
+
+	img, err := r.images.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("failed to fetch image from store: %w", err)
+	}
+
+	pool := r.desiredImagePool(img)
+	if !r.poolSlots.TryAcquire(pool) {
+		return nil, fmt.Errorf("%w: %s", errPoolSlotsBusy, pool)
+	}
+	return func() { r.poolSlots.Release(pool) }, nil
+}
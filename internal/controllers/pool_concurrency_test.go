@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PoolConcurrency", func() {
+	It("should bound the concurrent reconciles of one pool while other pools proceed", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{PoolConcurrency: 1})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+
+		for id, pool := range map[string]string{"a1": "a", "a2": "a", "b1": "b"} {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: id},
+				Spec:     providerapi.ImageSpec{Pool: pool},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var (
+			mu         sync.Mutex
+			running    = map[string]int{}
+			maxRunning = map[string]int{}
+			unblock    = make(chan struct{})
+			bDone      = make(chan struct{})
+			returned   = make(chan struct{}, 3)
+		)
+		runningIn := func(pool string) int {
+			mu.Lock()
+			defer mu.Unlock()
+			return running[pool]
+		}
+		r.reconcile = func(ctx context.Context, id string) error {
+			img, err := r.images.Get(ctx, id)
+			Expect(err).NotTo(HaveOccurred())
+			pool := img.Spec.Pool
+
+			mu.Lock()
+			running[pool]++
+			maxRunning[pool] = max(maxRunning[pool], running[pool])
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				running[pool]--
+				mu.Unlock()
+			}()
+
+			if pool == "b" {
+				close(bDone)
+				return nil
+			}
+			<-unblock
+			return nil
+		}
+
+		r.queue.Add("a1")
+		r.queue.Add("a2")
+		r.queue.Add("b1")
+
+		var wg sync.WaitGroup
+		for range 3 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				r.processNextWorkItem(ctx, ctx, logr.Discard())
+				returned <- struct{}{}
+			}()
+		}
+
+		Eventually(bDone).Should(BeClosed())
+		Eventually(func() int { return runningIn("a") }).Should(Equal(1))
+		Consistently(func() int { return runningIn("a") }).Should(Equal(1))
+		// The worker of the busy pool doesn't wait for a slot but requeues its image.
+		Eventually(returned).Should(HaveLen(2))
+
+		close(unblock)
+		wg.Wait()
+
+		Expect(maxRunning).To(Equal(map[string]int{"a": 1, "b": 1}))
+		Expect(r.poolSlots.Len()).To(BeZero())
+	})
+
+	It("should reject a negative pool concurrency", func() {
+		_, err := newTestImageReconciler(ImageReconcilerOptions{PoolConcurrency: -1})
+		Expect(err).To(MatchError(ContainSubstring("pool concurrency must not be negative")))
+	})
+})
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RBD image name", func() {
+	var r *ImageReconciler
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		r.rbdImages = fakeImageSizer{"pool/existing-disk": 1024}
+		DeferCleanup(r.queue.ShutDown)
+	})
+
+	It("should derive the rbd image name from the image id by default", func() {
+		Expect(RBDImageName(&providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}})).To(Equal(ImageIDToRBDID("foo")))
+	})
+
+	DescribeTable("validateRBDName",
+		func(name string, valid bool) {
+			if valid {
+				Expect(validateRBDName(name)).To(Succeed())
+			} else {
+				Expect(validateRBDName(name)).To(MatchError(ErrInvalidRBDName))
+			}
+		},
+		Entry("custom name", "external-disk.01", true),
+		Entry("pool separator", "pool/disk", false),
+		Entry("snapshot separator", "disk@snap", false),
+		Entry("image prefix", ImageIDToRBDID("foo"), false),
+		Entry("snapshot prefix", SnapshotIDToRBDID("foo"), false),
+	)
+
+	It("should keep the custom rbd name the image was created with", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Size: 1024, RBDName: "external-disk"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(Succeed())
+
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Finalizers).To(ContainElement(ImageFinalizer))
+		Expect(img.Status.RBDName).To(Equal("external-disk"))
+		Expect(RBDImageName(img)).To(Equal("external-disk"))
+
+		By("removing the rbd image under the stored name although the requested name changed")
+		img.Spec.RBDName = "renamed-disk"
+		Expect(RBDImageName(img)).To(Equal("external-disk"))
+	})
+
+	It("should fail images whose custom rbd name is used by an existing rbd image", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Size: 1024, RBDName: "existing-disk"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		r.reconcile = func(ctx context.Context, id string) error {
+			return r.reconcileImageWithIOContext(ctx, nil, id)
+		}
+		r.queue.Add("foo")
+		Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Finalizers).To(BeEmpty())
+		Expect(img.Status.RBDName).To(BeEmpty())
+		Expect(img.Status).To(SatisfyAll(
+			HaveField("State", providerapi.ImageStateFailed),
+			HaveField("LastError", ContainSubstring("rbd image pool/existing-disk already exists")),
+		))
+	})
+
+	It("should fail images whose custom rbd name is already used", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Status:   providerapi.ImageStatus{RBDName: "external-disk"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "bar"},
+			Spec:     providerapi.ImageSpec{Size: 1024, RBDName: "external-disk"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		r.reconcile = func(ctx context.Context, id string) error {
+			return r.reconcileImageWithIOContext(ctx, nil, id)
+		}
+		r.queue.Add("bar")
+		Expect(r.processNextWorkItem(ctx, ctx, logr.Discard())).To(BeTrue())
+
+		Expect(r.queue.NumRequeues("bar")).To(BeZero())
+		img, err := r.images.Get(ctx, "bar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Finalizers).To(BeEmpty())
+		Expect(img.Status.RBDName).To(BeEmpty())
+		Expect(img.Status).To(SatisfyAll(
+			HaveField("State", providerapi.ImageStateFailed),
+			HaveField("Conditions", ConsistOf(SatisfyAll(
+				HaveField("Type", providerapi.ImageConditionReconciled),
+				HaveField("Reason", "InvalidRBDName"),
+			))),
+		))
+	})
+})
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// imageSpecHash returns the hash of the spec of the image and of its labels exported to the rbd image. Without exported
+// labels, it is the hash of the spec alone.
+func (r *ImageReconciler) imageSpecHash(img *providerapi.Image) (string, error) {
+	var v any = img.Spec
+	if labels := r.exportedLabels(img); len(labels) > 0 {
+		v = struct {
+			Spec   providerapi.ImageSpec `json:"spec"`
+			Labels map[string]string     `json:"labels"`
+		}{img.Spec, labels}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal image spec: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// isImageReconciled reports whether the image is available and was fully reconciled with its current spec, so that
+// reconciling it again, e.g. on resync, has nothing to do and is skipped before opening an io context.
+func (r *ImageReconciler) isImageReconciled(ctx context.Context, id string) bool {
+	img, err := r.images.Get(ctx, id)
+	if err != nil {
+		// Errors are left to the reconcile.
+		return false
+	}
+	if img.DeletedAt != nil || !r.hasFinalizer(img) || img.Status.State != providerapi.ImageStateAvailable ||
+		img.Status.ReconciledSpecHash == "" || needsSnapshotRefBackfill(img) {
+		return false
+	}
+
+	hash, err := r.imageSpecHash(img)
+	return err == nil && hash == img.Status.ReconciledSpecHash
+}
+
+// recordReconciledSpec stores the hash of the spec the available image was reconciled with. The spec hash is kept
+// while a requested migration is pending, so that the migration is retried.
+func (r *ImageReconciler) recordReconciledSpec(ctx context.Context, img *providerapi.Image) error {
+	if r.imagePool(img) != r.desiredImagePool(img) {
+		return nil
+	}
+
+	hash, err := r.imageSpecHash(img)
+	if err != nil {
+		return err
+	}
+	if img.Status.ReconciledSpecHash == hash {
+		return nil
+	}
+
+	// The image was possibly updated while reconciling it. If its spec changed meanwhile, its hash differs from the
+	// recorded one and the image is reconciled again.
+	current, err := r.images.Get(ctx, img.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get image: %w", err)
+	}
+	current.Status.ReconciledSpecHash = hash
+	if _, err := r.images.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update reconciled spec hash: %w", err)
+	}
+	return nil
+}
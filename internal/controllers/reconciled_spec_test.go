@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+// countingConnAccessor counts the requests of the rados connection, which is never available.
+type countingConnAccessor struct {
+	calls int
+}
+
+func (a *countingConnAccessor) Acquire() (*rados.Conn, func(), error) {
+	a.calls++
+	return nil, nil, rados.ErrNotConnected
+}
+
+func (a *countingConnAccessor) ObserveError(error) {}
+
+var _ = Describe("reconciled spec", func() {
+	var (
+		r     *ImageReconciler
+		conns *countingConnAccessor
+		img   *providerapi.Image
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		conns = &countingConnAccessor{}
+		r.conns = conns
+
+		img = &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{ImageFinalizer}},
+			Spec: providerapi.ImageSpec{
+				Size:   1024 * 1024 * 1024,
+				Limits: providerapi.Limits{providerapi.IOPSLimit: 100},
+			},
+			Status: providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+		}
+		img.Status.ReconciledSpecHash, err = r.imageSpecHash(img)
+		Expect(err).NotTo(HaveOccurred())
+		img, err = r.images.Create(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should not touch rbd when re-reconciling an unchanged image", func(ctx SpecContext) {
+		Expect(r.reconcileImage(ctx, "foo")).To(Succeed())
+		Expect(conns.calls).To(BeZero())
+	})
+
+	It("should reconcile an image whose spec changed", func(ctx SpecContext) {
+		img.Spec.Limits[providerapi.IOPSLimit] = 200
+		_, err := r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImage(ctx, "foo")).To(MatchError(rados.ErrNotConnected))
+		Expect(conns.calls).To(Equal(1))
+	})
+
+	It("should reconcile an image that is being deleted", func(ctx SpecContext) {
+		img.DeletedAt = ptr.To(time.Now())
+		_, err := r.images.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImage(ctx, "foo")).To(MatchError(rados.ErrNotConnected))
+		Expect(conns.calls).To(Equal(1))
+	})
+
+	It("should keep the spec hash while a migration is pending", func(ctx SpecContext) {
+		img.Spec.Pool = "other"
+		Expect(r.recordReconciledSpec(ctx, img)).To(Succeed())
+
+		stored, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Status.ReconciledSpecHash).To(Equal(img.Status.ReconciledSpecHash))
+	})
+
+	It("should record the hash of the reconciled spec", func(ctx SpecContext) {
+		img.Spec.Size *= 2
+		Expect(r.recordReconciledSpec(ctx, img)).To(Succeed())
+
+		stored, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := r.imageSpecHash(img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Status.ReconciledSpecHash).To(Equal(hash))
+	})
+})
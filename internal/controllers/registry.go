@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/ironcore-dev/ironcore-image/oci/image"
+	"github.com/ironcore-dev/ironcore-image/oci/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var (
+	ErrImageUnauthorized = errors.New("unauthorized to access image")
+	ErrImageNotFound     = errors.New("image not found")
+)
+
+// RegistryAuth configures the credentials used to pull os images from private registries.
+// Username and Password take precedence over DockerConfigPath. Without any credentials,
+// the default docker configuration is used.
+type RegistryAuth struct {
+	Username string
+	Password string
+	// DockerConfigPath is the path of a docker config file holding the registry credentials.
+	DockerConfigPath string
+}
+
+func (a RegistryAuth) isZero() bool {
+	return a == RegistryAuth{}
+}
+
+func (a RegistryAuth) credentials() (func(string) (string, string, error), error) {
+	if a.Username != "" || a.Password != "" {
+		return func(string) (string, string, error) {
+			return a.Username, a.Password, nil
+		}, nil
+	}
+	return remote.DockerCredentialFunc(a.DockerConfigPath)
+}
+
+// newOsImageSource creates the image source to resolve and pull os images with the given credentials.
+func newOsImageSource(auth RegistryAuth, platform *ocispec.Platform) (image.Source, error) {
+	if auth.isZero() {
+		return createOsImageSource(platform)
+	}
+
+	credentials, err := auth.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry credentials: %w", err)
+	}
+
+	return &registrySource{
+		resolver: docker.NewResolver(docker.ResolverOptions{
+			Credentials: credentials,
+		}),
+		platform: platform,
+	}, nil
+}
+
+type registrySource struct {
+	resolver remotes.Resolver
+	platform *ocispec.Platform
+}
+
+func (s *registrySource) Resolve(ctx context.Context, ref string) (image.Image, error) {
+	_, desc, err := s.resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", ref, err)
+	}
+
+	fetcher, err := s.resolver.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("error getting fetcher for %s: %w", ref, err)
+	}
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest:
+		return remote.Image(fetcher, desc), nil
+	case ocispec.MediaTypeImageIndex:
+		rc, err := fetcher.Fetch(ctx, desc)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching index blob: %w", err)
+		}
+		defer func() { _ = rc.Close() }()
+
+		var index ocispec.Index
+		if err := json.NewDecoder(rc).Decode(&index); err != nil {
+			return nil, fmt.Errorf("error decoding image index manifest: %w", err)
+		}
+
+		manifest := matchPlatform(index.Manifests, s.platform)
+		if manifest == nil {
+			return nil, fmt.Errorf("no matching platform found in index for platform %+v", s.platform)
+		}
+		return remote.Image(fetcher, *manifest), nil
+	default:
+		return nil, fmt.Errorf("unsupported media type: %s", desc.MediaType)
+	}
+}
+
+// newOsImageSink creates the image sink to push os images with the given credentials.
+func newOsImageSink(auth RegistryAuth) (image.Sink, error) {
+	credentials, err := auth.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry credentials: %w", err)
+	}
+
+	return &registrySink{
+		resolver: docker.NewResolver(docker.ResolverOptions{
+			Credentials: credentials,
+		}),
+	}, nil
+}
+
+type registrySink struct {
+	resolver remotes.Resolver
+}
+
+// Push pushes the config, the layers and the manifest of the image. Blobs already present in the registry are
+// skipped.
+func (s *registrySink) Push(ctx context.Context, ref string, img image.Image) error {
+	pusher, err := s.resolver.Pusher(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("error getting pusher for %s: %w", ref, err)
+	}
+
+	layers, err := image.AsWriteLayers(ctx, img)
+	if err != nil {
+		return fmt.Errorf("error transforming image to write layers: %w", err)
+	}
+
+	for _, layer := range layers {
+		if err := pushLayer(ctx, pusher, layer); err != nil {
+			return fmt.Errorf("error pushing layer %s: %w", layer.Descriptor().Digest, err)
+		}
+	}
+	return nil
+}
+
+func pushLayer(ctx context.Context, pusher remotes.Pusher, layer image.Layer) error {
+	w, err := pusher.Push(ctx, layer.Descriptor())
+	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting writer: %w", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	rc, err := layer.Content(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting layer content: %w", err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	if err := content.Copy(ctx, w, rc, layer.Descriptor().Size, layer.Descriptor().Digest); err != nil {
+		return fmt.Errorf("error copying layer: %w", err)
+	}
+	return nil
+}
+
+func matchPlatform(manifests []ocispec.Descriptor, platform *ocispec.Platform) *ocispec.Descriptor {
+	if platform == nil {
+		if len(manifests) > 0 {
+			return &manifests[0]
+		}
+		return nil
+	}
+
+	for _, manifest := range manifests {
+		if manifest.Platform != nil && manifest.Platform.OS == platform.OS && manifest.Platform.Architecture == platform.Architecture {
+			return &manifest
+		}
+	}
+	return nil
+}
+
+// ResolveError is returned if an os image reference cannot be resolved.
+type ResolveError struct {
+	// Permanent reports whether resolving cannot succeed without changing the image reference.
+	Permanent bool
+	// Reason is a short machine-readable description of the failure.
+	Reason string
+	Err    error
+}
+
+func (e *ResolveError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// newResolveError classifies a failure to resolve an image reference. Missing images and invalid references
+// are permanent, all other failures, e.g. unreachable registries or missing credentials, are retried.
+func newResolveError(err error) *ResolveError {
+	switch {
+	case errors.Is(err, ErrImageNotFound), errdefs.IsNotFound(err):
+		return &ResolveError{Permanent: true, Reason: "ImageNotFound", Err: err}
+	case errdefs.IsInvalidArgument(err):
+		return &ResolveError{Permanent: true, Reason: "InvalidImageReference", Err: err}
+	case errors.Is(err, ErrImageUnauthorized):
+		return &ResolveError{Reason: "ImageUnauthorized", Err: err}
+	default:
+		return &ResolveError{Reason: "RegistryUnavailable", Err: err}
+	}
+}
+
+// classifyRegistryError marks registry errors with ErrImageUnauthorized or ErrImageNotFound
+// so that callers can tell missing credentials apart from missing images.
+func classifyRegistryError(err error) error {
+	var statusErr remoteerrors.ErrUnexpectedStatus
+	switch {
+	case errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden):
+		return fmt.Errorf("%w: %w", ErrImageUnauthorized, err)
+	case errdefs.IsNotFound(err):
+		return fmt.Errorf("%w: %w", ErrImageNotFound, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd/errdefs"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type unauthorizedImageResolver struct{}
+
+func (unauthorizedImageResolver) Resolve(ctx context.Context, platform *ocispec.Platform, ref string) (string, error) {
+	return "", classifyRegistryError(remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"})
+}
+
+type errImageResolver struct {
+	err error
+}
+
+func (r errImageResolver) Resolve(ctx context.Context, platform *ocispec.Platform, ref string) (string, error) {
+	return "", classifyRegistryError(r.err)
+}
+
+var _ = Describe("Registry", func() {
+	Context("RegistryAuth", func() {
+		It("should forward username and password", func() {
+			credentials, err := RegistryAuth{Username: "user", Password: "pass"}.credentials()
+			Expect(err).NotTo(HaveOccurred())
+
+			username, password, err := credentials("registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("pass"))
+		})
+
+		It("should read credentials from a docker config", func() {
+			configPath := filepath.Join(GinkgoT().TempDir(), "config.json")
+			Expect(os.WriteFile(configPath, []byte(`{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`), 0600)).To(Succeed())
+
+			credentials, err := RegistryAuth{DockerConfigPath: configPath}.credentials()
+			Expect(err).NotTo(HaveOccurred())
+
+			username, password, err := credentials("registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("pass"))
+		})
+	})
+
+	Context("classifyRegistryError", func() {
+		It("should classify unauthorized errors", func() {
+			err := classifyRegistryError(fmt.Errorf("error resolving: %w", remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusForbidden}))
+			Expect(err).To(MatchError(ErrImageUnauthorized))
+			Expect(err).NotTo(MatchError(ErrImageNotFound))
+		})
+
+		It("should classify not found errors", func() {
+			err := classifyRegistryError(fmt.Errorf("registry/image:latest: %w", errdefs.ErrNotFound))
+			Expect(err).To(MatchError(ErrImageNotFound))
+			Expect(err).NotTo(MatchError(ErrImageUnauthorized))
+		})
+
+		It("should keep other errors unchanged", func() {
+			err := errors.New("connection refused")
+			Expect(classifyRegistryError(err)).To(Equal(err))
+		})
+	})
+
+	It("should surface unauthorized errors when reconciling the image snapshot", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		r.registry = unauthorizedImageResolver{}
+
+		img := &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Image: "registry.example.com/private:latest"},
+		}
+		Expect(r.reconcileSnapshot(ctx, logr.Discard(), img)).To(MatchError(ErrImageUnauthorized))
+	})
+
+	DescribeTable("should classify resolve errors when reconciling the image snapshot",
+		func(ctx SpecContext, image string, resolveErr error, reason string, permanent bool) {
+			r, err := newTestImageReconciler(ImageReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			r.registry = errImageResolver{err: resolveErr}
+
+			img := &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Spec:     providerapi.ImageSpec{Image: image},
+			}
+			err = r.reconcileSnapshot(ctx, logr.Discard(), img)
+
+			var resolveError *ResolveError
+			Expect(errors.As(err, &resolveError)).To(BeTrue())
+			Expect(resolveError.Reason).To(Equal(reason))
+			Expect(resolveError.Permanent).To(Equal(permanent))
+
+			terminalReason, terminal := terminalErrorReason(fmt.Errorf("failed to reconcile snapshot: %w", err))
+			Expect(terminal).To(Equal(permanent))
+			if permanent {
+				Expect(terminalReason).To(Equal(reason))
+			}
+		},
+		Entry("invalid reference", "@@@", nil, "InvalidImageReference", true),
+		Entry("missing manifest", "registry.example.com/image:latest",
+			fmt.Errorf("registry.example.com/image:latest: %w", errdefs.ErrNotFound), "ImageNotFound", true),
+		Entry("invalid argument", "registry.example.com/image:latest",
+			fmt.Errorf("invalid reference: %w", errdefs.ErrInvalidArgument), "InvalidImageReference", true),
+		Entry("unauthorized", "registry.example.com/image:latest",
+			remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized}, "ImageUnauthorized", false),
+		Entry("server error", "registry.example.com/image:latest",
+			remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusServiceUnavailable}, "RegistryUnavailable", false),
+		Entry("network error", "registry.example.com/image:latest",
+			errors.New("dial tcp: connection refused"), "RegistryUnavailable", false),
+	)
+})
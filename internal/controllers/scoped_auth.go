@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/logging"
+)
+
+// rbdImageIDReader reads the ids of rbd images, which prefix the rados objects of their header and data, as well as
+// the parents clones read from.
+type rbdImageIDReader interface {
+	ImageID(pool, imageName string) (string, error)
+	// ImageParents returns the parent chain of the rbd image, starting with its direct parent.
+	ImageParents(pool, imageName string) ([]librbd.ImageSpec, error)
+}
+
+type connImageIDReader struct {
+	conns     ceph.ConnAccessor
+	namespace string
+}
+
+func (r *connImageIDReader) ImageID(pool, imageName string) (string, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(r.conns, pool, r.namespace)
+	if err != nil {
+		return "", fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	img, err := librbd.OpenImageReadOnly(ioCtx, imageName, librbd.NoSnapshot)
+	if err != nil {
+		return "", fmt.Errorf("failed to open image %s: %w", imageName, err)
+	}
+	defer func() { _ = img.Close() }()
+
+	return img.GetId()
+}
+
+func (r *connImageIDReader) ImageParents(pool, imageName string) ([]librbd.ImageSpec, error) {
+	var parents []librbd.ImageSpec
+	spec := librbd.ImageSpec{PoolName: pool, PoolNamespace: r.namespace, ImageName: imageName}
+	for {
+		parent, err := r.imageParent(spec)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return parents, nil
+		}
+		parents = append(parents, *parent)
+		spec = *parent
+	}
+}
+
+// imageParent returns the parent of the rbd image, nil if it has none. Parents are opened by their id, as they may
+// have been moved to the trash.
+func (r *connImageIDReader) imageParent(spec librbd.ImageSpec) (*librbd.ImageSpec, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(r.conns, spec.PoolName, spec.PoolNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	var img *librbd.Image
+	if spec.ImageID != "" {
+		img, err = librbd.OpenImageByIdReadOnly(ioCtx, spec.ImageID, librbd.NoSnapshot)
+	} else {
+		img, err = librbd.OpenImageReadOnly(ioCtx, spec.ImageName, librbd.NoSnapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", spec.ImageName, err)
+	}
+	defer func() { _ = img.Close() }()
+
+	parent, err := img.GetParent()
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get parent of image %s: %w", spec.ImageName, err)
+	}
+	return &parent.Image, nil
+}
+
+// imageCredentials returns the credentials handed out in the access of the image: the credentials of a client scoped
+// to the image with scoped credentials, otherwise the ones of the shared client.
+func (r *ImageReconciler) imageCredentials(ctx context.Context, log logr.Logger, image *providerapi.Image) (string, string, error) {
+	if !r.scopedCredentials {
+		return r.fetchAuth(ctx, log)
+	}
+
+	pool := r.imagePool(image)
+	rbdName := RBDImageName(image)
+	rbdID, err := r.rbdImageIDs.ImageID(pool, rbdName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get id of rbd image: %w", err)
+	}
+	parents, err := r.rbdImageIDs.ImageParents(pool, rbdName)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get parents of rbd image: %w", err)
+	}
+	return r.fetchScopedAuth(ctx, log, r.scopedClient(image), scopedCaps(pool, r.namespace, rbdID, rbdName, image.Spec.ReadOnly, parents))
+}
+
+// scopedClient returns the name of the client scoped to the image.
+func (r *ImageReconciler) scopedClient(image *providerapi.Image) string {
+	return r.client + "." + image.ID
+}
+
+// scopedCaps returns the caps of a client scoped to an rbd image: the rbd profile on the monitors and access to the
+// rados objects of the rbd image only, read-only if requested. Clones read the data they don't have from their
+// parents, so the client may read the rados objects of the parent chain as well.
+func scopedCaps(pool, namespace, rbdID, rbdName string, readOnly bool, parents []librbd.ImageSpec) []string {
+	scope := capsScope(pool, namespace)
+	perm := "rwx"
+	if readOnly {
+		perm = "rx"
+	}
+
+	osdCaps := []string{
+		fmt.Sprintf("allow rx %s object_prefix rbd_id.%s", scope, rbdName),
+	}
+	osdCaps = append(osdCaps, imageObjectCaps(perm, scope, rbdID)...)
+	for _, parent := range parents {
+		osdCaps = append(osdCaps, imageObjectCaps("rx", capsScope(parent.PoolName, parent.PoolNamespace), parent.ImageID)...)
+	}
+	return []string{
+		"mon", "profile rbd",
+		"osd", strings.Join(osdCaps, ", "),
+	}
+}
+
+func capsScope(pool, namespace string) string {
+	scope := "pool=" + pool
+	if namespace != "" {
+		scope += " namespace=" + namespace
+	}
+	return scope
+}
+
+// imageObjectCaps returns the caps to the header, data and object map objects of the rbd image with the id.
+func imageObjectCaps(perm, scope, rbdID string) []string {
+	var caps []string
+	for _, prefix := range []string{"rbd_header.", "rbd_data.", "rbd_object_map."} {
+		caps = append(caps, fmt.Sprintf("allow %s %s object_prefix %s%s", perm, scope, prefix, rbdID))
+	}
+	return caps
+}
+
+type scopedAuthEntry struct {
+	Entity string            `json:"entity"`
+	Key    string            `json:"key"`
+	Caps   map[string]string `json:"caps"`
+}
+
+// hasCaps reports whether the client has exactly the caps, given as pairs of service and cap.
+func (e *scopedAuthEntry) hasCaps(caps []string) bool {
+	want := make(map[string]string, len(caps)/2)
+	for i := 0; i+1 < len(caps); i += 2 {
+		want[caps[i]] = caps[i+1]
+	}
+	return maps.Equal(e.Caps, want)
+}
+
+// fetchScopedAuth returns the credentials of the client with the caps. The client is created if it doesn't exist,
+// and its caps are updated if they differ, e.g. because a clone was flattened or the caps of the provider changed.
+func (r *ImageReconciler) fetchScopedAuth(ctx context.Context, log logr.Logger, client string, caps []string) (_ string, _ string, retErr error) {
+	ctx, span := r.startSpan(ctx, "fetchScopedAuth")
+	defer func() { endSpan(span, retErr) }()
+
+	log = log.WithName(logging.LoggerName(logging.ComponentAuth))
+	if credentials, ok := r.authCache.get(client); ok {
+		log.V(3).Info("Using cached client credentials", "name", client)
+		return credentials.user, credentials.key, nil
+	}
+
+	entry, err := r.scopedAuthCommand(ctx, map[string]any{
+		"prefix": "auth get",
+		"entity": client,
+		"format": "json",
+	})
+	switch {
+	case errors.Is(err, rados.ErrNotFound):
+		log.V(3).Info("Create scoped client", "name", client)
+		entry, err = r.scopedAuthCommand(ctx, map[string]any{
+			"prefix": "auth get-or-create",
+			"entity": client,
+			"caps":   caps,
+			"format": "json",
+		})
+		if err != nil {
+			return "", "", err
+		}
+	case err != nil:
+		return "", "", err
+	case !entry.hasCaps(caps):
+		log.V(1).Info("Update caps of scoped client", "name", client)
+		cmd, err := json.Marshal(map[string]any{
+			"prefix": "auth caps",
+			"entity": client,
+			"caps":   caps,
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("unable to marshal command: %w", err)
+		}
+		if _, err := r.monCommand(ctx, cmd); err != nil {
+			return "", "", fmt.Errorf("failed to update caps of scoped client %s: %w", client, err)
+		}
+	}
+
+	credentials := cephCredentials{
+		user: strings.TrimPrefix(client, "client."),
+		key:  entry.Key,
+	}
+	r.authCache.set(client, credentials)
+
+	return credentials.user, credentials.key, nil
+}
+
+// scopedAuthCommand executes the auth command and returns the client entry of its response.
+func (r *ImageReconciler) scopedAuthCommand(ctx context.Context, command map[string]any) (*scopedAuthEntry, error) {
+	cmd, err := json.Marshal(command)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal command: %w", err)
+	}
+
+	data, err := r.monCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var response []scopedAuthEntry
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal response: %w", err)
+	}
+	if len(response) == 0 || response[0].Key == "" {
+		return nil, fmt.Errorf("no key returned for client %s", command["entity"])
+	}
+	return &response[0], nil
+}
+
+// removeImageCredentials removes the client scoped to the image, if scoped credentials are enabled.
+func (r *ImageReconciler) removeImageCredentials(ctx context.Context, log logr.Logger, image *providerapi.Image) error {
+	if !r.scopedCredentials {
+		return nil
+	}
+
+	client := r.scopedClient(image)
+	cmd, err := json.Marshal(map[string]string{
+		"prefix": "auth rm",
+		"entity": client,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal command: %w", err)
+	}
+
+	// Removing a client that doesn't exist succeeds, so deleting the image can be retried.
+	if _, err := r.monCommand(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to remove scoped client %s: %w", client, err)
+	}
+	r.authCache.remove(client)
+	log.V(1).Info("Removed scoped client", "name", client)
+	return nil
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeImageIDReader struct {
+	ids     map[string]string
+	parents map[string][]librbd.ImageSpec
+}
+
+func (f fakeImageIDReader) ImageID(pool, imageName string) (string, error) {
+	return f.ids[pool+"/"+imageName], nil
+}
+
+func (f fakeImageIDReader) ImageParents(pool, imageName string) ([]librbd.ImageSpec, error) {
+	return f.parents[pool+"/"+imageName], nil
+}
+
+var _ = Describe("Scoped credentials", func() {
+	var (
+		r      *ImageReconciler
+		client *fakeCephClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{ScopedCredentials: true, Namespace: "tenant"})
+		Expect(err).NotTo(HaveOccurred())
+		client = &fakeCephClient{
+			response: []byte(`[{"entity":"client.volumes.foo","key":"secret"}]`),
+			errs:     map[string]error{"auth get": rados.ErrNotFound},
+		}
+		r.cephClient = client
+		r.rbdImageIDs = fakeImageIDReader{ids: map[string]string{"pool/img_foo": "1a2b3c"}}
+	})
+
+	lastCommand := func() map[string]any {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		Expect(client.commands).NotTo(BeEmpty())
+
+		var cmd map[string]any
+		Expect(json.Unmarshal(client.commands[len(client.commands)-1], &cmd)).To(Succeed())
+		return cmd
+	}
+
+	It("should create a read-only client scoped to the rbd image of a read-only image", func(ctx SpecContext) {
+		img := &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{RBDName: "img_foo", ReadOnly: true},
+		}
+
+		user, key, err := r.imageCredentials(ctx, logr.Discard(), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal("volumes.foo"))
+		Expect(key).To(Equal("secret"))
+
+		cmd := lastCommand()
+		Expect(cmd).To(HaveKeyWithValue("prefix", "auth get-or-create"))
+		Expect(cmd).To(HaveKeyWithValue("entity", "client.volumes.foo"))
+		Expect(cmd).To(HaveKeyWithValue("caps", ConsistOf(
+			"mon", "profile rbd",
+			"osd", "allow rx pool=pool namespace=tenant object_prefix rbd_id.img_foo, "+
+				"allow rx pool=pool namespace=tenant object_prefix rbd_header.1a2b3c, "+
+				"allow rx pool=pool namespace=tenant object_prefix rbd_data.1a2b3c, "+
+				"allow rx pool=pool namespace=tenant object_prefix rbd_object_map.1a2b3c",
+		)))
+	})
+
+	It("should grant write access to the rbd image of a writable image", func() {
+		Expect(scopedCaps("pool", "", "1a2b3c", "img_foo", false, nil)).To(Equal([]string{
+			"mon", "profile rbd",
+			"osd", "allow rx pool=pool object_prefix rbd_id.img_foo, " +
+				"allow rwx pool=pool object_prefix rbd_header.1a2b3c, " +
+				"allow rwx pool=pool object_prefix rbd_data.1a2b3c, " +
+				"allow rwx pool=pool object_prefix rbd_object_map.1a2b3c",
+		}))
+	})
+
+	It("should grant read access to the parent chain of a clone", func() {
+		parents := []librbd.ImageSpec{
+			{PoolName: "pool", PoolNamespace: "tenant", ImageName: "img_snap", ImageID: "4d5e"},
+			{PoolName: "images", ImageName: "os", ImageID: "6f7a"},
+		}
+		Expect(scopedCaps("pool", "tenant", "1a2b3c", "img_foo", false, parents)).To(Equal([]string{
+			"mon", "profile rbd",
+			"osd", "allow rx pool=pool namespace=tenant object_prefix rbd_id.img_foo, " +
+				"allow rwx pool=pool namespace=tenant object_prefix rbd_header.1a2b3c, " +
+				"allow rwx pool=pool namespace=tenant object_prefix rbd_data.1a2b3c, " +
+				"allow rwx pool=pool namespace=tenant object_prefix rbd_object_map.1a2b3c, " +
+				"allow rx pool=pool namespace=tenant object_prefix rbd_header.4d5e, " +
+				"allow rx pool=pool namespace=tenant object_prefix rbd_data.4d5e, " +
+				"allow rx pool=pool namespace=tenant object_prefix rbd_object_map.4d5e, " +
+				"allow rx pool=images object_prefix rbd_header.6f7a, " +
+				"allow rx pool=images object_prefix rbd_data.6f7a, " +
+				"allow rx pool=images object_prefix rbd_object_map.6f7a",
+		}))
+	})
+
+	It("should update the caps of an existing client if they differ", func(ctx SpecContext) {
+		delete(client.errs, "auth get")
+		client.responses = map[string][]byte{
+			"auth get": []byte(`[{"entity":"client.volumes.foo","key":"secret","caps":{"mon":"profile rbd","osd":"allow rx pool=other"}}]`),
+		}
+		img := &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{RBDName: "img_foo"},
+		}
+
+		_, key, err := r.imageCredentials(ctx, logr.Discard(), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal("secret"))
+
+		cmd := lastCommand()
+		Expect(cmd).To(HaveKeyWithValue("prefix", "auth caps"))
+		Expect(cmd).To(HaveKeyWithValue("entity", "client.volumes.foo"))
+		Expect(cmd).To(HaveKeyWithValue("caps", ContainElement(ContainSubstring("allow rwx pool=pool namespace=tenant object_prefix rbd_data.1a2b3c"))))
+	})
+
+	It("should keep the caps of an existing client if they match", func(ctx SpecContext) {
+		delete(client.errs, "auth get")
+		caps := scopedCaps("pool", "tenant", "1a2b3c", "img_foo", false, nil)
+		entry, err := json.Marshal([]scopedAuthEntry{{
+			Entity: "client.volumes.foo",
+			Key:    "secret",
+			Caps:   map[string]string{caps[0]: caps[1], caps[2]: caps[3]},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		client.responses = map[string][]byte{"auth get": entry}
+		img := &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{RBDName: "img_foo"},
+		}
+
+		_, key, err := r.imageCredentials(ctx, logr.Discard(), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal("secret"))
+		Expect(client.commands).To(HaveLen(1))
+		Expect(lastCommand()).To(HaveKeyWithValue("prefix", "auth get"))
+	})
+
+	It("should remove the scoped client with the image", func(ctx SpecContext) {
+		img := &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}}
+
+		Expect(r.removeImageCredentials(ctx, logr.Discard(), img)).To(Succeed())
+		Expect(lastCommand()).To(Equal(map[string]any{"prefix": "auth rm", "entity": "client.volumes.foo"}))
+	})
+})
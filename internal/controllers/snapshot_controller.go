@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"slices"
 	"sync"
 	"time"
@@ -16,32 +17,69 @@ import (
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/go-logr/logr"
 	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/layercache"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
 	"github.com/ironcore-dev/ceph-provider/internal/rater"
 	"github.com/ironcore-dev/ceph-provider/internal/round"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	ironcoreimage "github.com/ironcore-dev/ironcore-image"
+	"github.com/ironcore-dev/ironcore-image/oci/image"
 	"github.com/ironcore-dev/provider-utils/eventutils/event"
 	"github.com/ironcore-dev/provider-utils/storeutils/store"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/client-go/util/workqueue"
 )
 
 type SnapshotReconcilerOptions struct {
-	Pool                string
+	Pool string
+	// Namespace is the rbd namespace within the pool the images are stored in. Defaults to the default namespace.
+	Namespace           string
 	PopulatorBufferSize int64
 	WorkerSize          int
+	RegistryAuth        RegistryAuth
+	// PopulateProgressInterval is the interval the progress of populating a snapshot is reported in.
+	// Defaults to DefaultPopulateProgressInterval.
+	PopulateProgressInterval time.Duration
+	// HTTPClient is the client snapshots are populated from URLs with. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// S3Endpoint is the http(s) endpoint snapshots with s3://bucket/key URLs are fetched from, path-style.
+	S3Endpoint string
+	// LayerCache caches the root fs layers of ironcore images, so that populating snapshots of the same layer again
+	// doesn't fetch it from the registry. Layers are always fetched if nil.
+	LayerCache *layercache.Cache
+	// Maintenance pauses the reconciliation of snapshots while it is on, e.g. during ceph maintenance. Snapshots are
+	// always reconciled if nil.
+	Maintenance *maintenance.Mode
+	// MaintenanceRequeueInterval is the interval snapshots are requeued in while the maintenance mode is on.
+	// Defaults to maintenance.DefaultRequeueInterval.
+	MaintenanceRequeueInterval time.Duration
+	// PopulateConcurrency is the number of snapshots populated from ironcore images or URLs at once, so that their
+	// downloads and writes don't saturate the registry bandwidth or the osds. Snapshots waiting for a slot are
+	// requeued and don't block a worker. A value of 0 only bounds the populations by the worker size.
+	PopulateConcurrency int
 }
 
+const DefaultPopulateProgressInterval = 5 * time.Second
+
+// populateSlotRequeueDelay is the delay snapshots waiting for a populate slot are requeued after.
+const populateSlotRequeueDelay = 5 * time.Second
+
+// errPopulateSlotsBusy signals the snapshot has to be retried once a populate slot is free.
+var errPopulateSlotsBusy = errors.New("all populate slots are busy")
+
 func NewSnapshotReconciler(
 	log logr.Logger,
-	conn *rados.Conn,
+	conns ceph.ConnAccessor,
 	store store.Store[*providerapi.Snapshot],
 	images store.Store[*providerapi.Image],
 	events event.Source[*providerapi.Snapshot],
 	opts SnapshotReconcilerOptions,
 ) (*SnapshotReconciler, error) {
-	if conn == nil {
-		return nil, fmt.Errorf("must specify conn")
+	if conns == nil {
+		return nil, fmt.Errorf("must specify conns")
 	}
 
 	if store == nil {
@@ -60,40 +98,108 @@ func NewSnapshotReconciler(
 		return nil, fmt.Errorf("must specify pool")
 	}
 
+	if err := ceph.ValidateNamespace(opts.Namespace); err != nil {
+		return nil, err
+	}
+
 	if opts.PopulatorBufferSize == 0 {
 		opts.PopulatorBufferSize = 5 * 1024 * 1024
 	}
 
+	if opts.WorkerSize < 0 {
+		return nil, fmt.Errorf("worker size must be greater than 0, got %d", opts.WorkerSize)
+	}
+
 	if opts.WorkerSize == 0 {
-		opts.WorkerSize = 15
-	}
-
-	return &SnapshotReconciler{
-		log:                 log,
-		conn:                conn,
-		queue:               workqueue.NewTypedRateLimitingQueue[string](workqueue.DefaultTypedControllerRateLimiter[string]()),
-		store:               store,
-		images:              images,
-		events:              events,
-		pool:                opts.Pool,
-		populatorBufferSize: opts.PopulatorBufferSize,
-		workerSize:          opts.WorkerSize,
-	}, nil
+		opts.WorkerSize = DefaultWorkerSize
+	}
+
+	if opts.PopulateProgressInterval < 0 {
+		return nil, fmt.Errorf("populate progress interval must not be negative, got %s", opts.PopulateProgressInterval)
+	}
+
+	if opts.PopulateProgressInterval == 0 {
+		opts.PopulateProgressInterval = DefaultPopulateProgressInterval
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	if opts.MaintenanceRequeueInterval < 0 {
+		return nil, fmt.Errorf("maintenance requeue interval must not be negative, got %s", opts.MaintenanceRequeueInterval)
+	}
+
+	if opts.MaintenanceRequeueInterval == 0 {
+		opts.MaintenanceRequeueInterval = maintenance.DefaultRequeueInterval
+	}
+
+	if opts.PopulateConcurrency < 0 {
+		return nil, fmt.Errorf("populate concurrency must not be negative, got %d", opts.PopulateConcurrency)
+	}
+
+	var populateSlots chan struct{}
+	if opts.PopulateConcurrency > 0 {
+		populateSlots = make(chan struct{}, opts.PopulateConcurrency)
+	}
+
+	queue := workqueue.NewTypedRateLimitingQueue[string](workqueue.DefaultTypedControllerRateLimiter[string]())
+	r := &SnapshotReconciler{
+		log:                      log,
+		conns:                    conns,
+		queue:                    queue,
+		maintenance:              newMaintenanceBacklog(opts.Maintenance, opts.MaintenanceRequeueInterval, queue),
+		store:                    store,
+		images:                   images,
+		events:                   events,
+		pool:                     opts.Pool,
+		namespace:                opts.Namespace,
+		populatorBufferSize:      opts.PopulatorBufferSize,
+		populateProgressInterval: opts.PopulateProgressInterval,
+		workerSize:               opts.WorkerSize,
+		registryAuth:             opts.RegistryAuth,
+		metrics:                  newSnapshotMetrics(),
+		httpClient:               opts.HTTPClient,
+		s3Endpoint:               opts.S3Endpoint,
+		layerCache:               opts.LayerCache,
+		populateSlots:            populateSlots,
+
+		createVolumeImageSnapshot: flushAndCreateSnapshot,
+	}
+	r.populateSource = r.populateSnapshotSource
+	return r, nil
 }
 
 type SnapshotReconciler struct {
 	log   logr.Logger
-	conn  *rados.Conn
+	conns ceph.ConnAccessor
 	queue workqueue.TypedRateLimitingInterface[string]
 
+	maintenance *maintenanceBacklog
+
 	store  store.Store[*providerapi.Snapshot]
 	images store.Store[*providerapi.Image]
 	events event.Source[*providerapi.Snapshot]
 
 	pool                string
+	namespace           string
 	populatorBufferSize int64
+	registryAuth        RegistryAuth
+
+	populateProgressInterval time.Duration
 
 	workerSize int
+
+	metrics snapshotMetrics
+
+	httpClient *http.Client
+	s3Endpoint string
+	layerCache *layercache.Cache
+	// populateSlots bounds the concurrent populations, it is nil without populate concurrency.
+	populateSlots chan struct{}
+
+	populateSource            func(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot) error
+	createVolumeImageSnapshot func(log logr.Logger, ioCtx *rados.IOContext, snapshotName, imageName string) error
 }
 
 func (r *SnapshotReconciler) Start(ctx context.Context) error {
@@ -135,10 +241,23 @@ func (r *SnapshotReconciler) processNextWorkItem(ctx context.Context, log logr.L
 	}
 	defer r.queue.Done(id)
 
+	if r.maintenance.deferIfPaused(log.WithValues("snapshotId", id), id) {
+		return true
+	}
+
+	r.metrics.activeReconciles.Inc()
+	defer r.metrics.activeReconciles.Dec()
+
 	log = log.WithValues("snapshotId", id)
 	ctx = logr.NewContext(ctx, log)
 
 	if err := r.reconcileSnapshot(ctx, id); err != nil {
+		if errors.Is(err, errPopulateSlotsBusy) {
+			log.V(1).Info("All populate slots are busy, requeueing", "RequeueAfter", populateSlotRequeueDelay)
+			r.queue.AddAfter(id, populateSlotRequeueDelay)
+			return true
+		}
+		r.conns.ObserveError(err)
 		log.Error(err, "failed to reconcile snapshot")
 		r.queue.AddRateLimited(id)
 		return true
@@ -152,12 +271,93 @@ const (
 	SnapshotFinalizer = "snapshot"
 )
 
+var ErrSnapshotInUse = errors.New("snapshot is still in use")
+
+// errSnapshotSourceNotReady signals the snapshot has to be retried once its source is ready.
+var errSnapshotSourceNotReady = errors.New("snapshot source is not ready")
+
+// referencingImages returns the IDs of all images which were cloned from the given snapshot and are not being deleted,
+// as well as the images recorded as references of the snapshot whose deletion has not completed yet. The image backing
+// a snapshot of a deleted volume carries the snapshot ID and is removed together with the snapshot, hence it is not
+// considered a reference.
+func (r *SnapshotReconciler) referencingImages(ctx context.Context, snapshot *providerapi.Snapshot) ([]string, error) {
+	images, err := r.images.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	var ids []string
+	for _, img := range images {
+		if img.ID == snapshot.ID || img.DeletedAt != nil {
+			continue
+		}
+		if snapshotRef := img.Spec.SnapshotRef; snapshotRef != nil && *snapshotRef == snapshot.ID {
+			ids = append(ids, img.ID)
+		}
+	}
+	for _, id := range snapshot.Status.ImageRefs {
+		if id != snapshot.ID {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
+// pruneImageRefs drops the recorded references of images that no longer exist in the store, e.g. because they were
+// removed without completing their deletion, so that they don't keep the snapshot forever.
+func (r *SnapshotReconciler) pruneImageRefs(ctx context.Context, log logr.Logger, snapshot *providerapi.Snapshot) (*providerapi.Snapshot, error) {
+	if snapshot.ReferenceCount() == 0 {
+		return snapshot, nil
+	}
+
+	images, err := r.images.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	existing := sets.New[string]()
+	for _, img := range images {
+		existing.Insert(img.ID)
+	}
+
+	var pruned []string
+	for _, id := range slices.Clone(snapshot.Status.ImageRefs) {
+		if !existing.Has(id) && snapshot.RemoveImageRef(id) {
+			pruned = append(pruned, id)
+		}
+	}
+	if len(pruned) == 0 {
+		return snapshot, nil
+	}
+
+	snapshot, err = r.store.Update(ctx, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune image references: %w", err)
+	}
+	log.V(1).Info("Pruned references of images that no longer exist", "imageIds", pruned)
+	return snapshot, nil
+}
+
 func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot) error {
 	if !slices.Contains(snapshot.Finalizers, SnapshotFinalizer) {
 		log.V(1).Info("snapshot has no finalizer: done")
 		return nil
 	}
 
+	snapshot, err := r.pruneImageRefs(ctx, log, snapshot)
+	if err != nil {
+		return err
+	}
+
+	referencingImages, err := r.referencingImages(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	if len(referencingImages) > 0 {
+		log.V(1).Info("Snapshot is still referenced by images", "imageIds", referencingImages)
+		return fmt.Errorf("%w: referenced by images %v", ErrSnapshotInUse, referencingImages)
+	}
+
 	rbdID, snapshotID, err := getSnapshotSourceDetails(snapshot)
 	if err != nil {
 		return fmt.Errorf("failed to get snapshot source details: %w", err)
@@ -182,7 +382,7 @@ func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger
 		}
 	}()
 
-	if err := flattenChildImages(log, r.conn, img); err != nil {
+	if err := flattenChildImages(log, r.conns, r.namespace, img); err != nil {
 		return fmt.Errorf("failed to flatten snapshot child images: %w", err)
 	}
 
@@ -199,7 +399,7 @@ func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger
 	log.V(2).Info("Removed snapshot finalizer")
 
 	// deletes os-image if not referenced by any volume
-	if snapshot.Source.IronCoreImage != "" {
+	if snapshot.Source.PopulatesImage() {
 		log.V(2).Info("Remove ironcore os-image")
 		shouldClose = false
 		if err := img.Close(); err != nil {
@@ -226,11 +426,11 @@ func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger
 
 func (r *SnapshotReconciler) reconcileSnapshot(ctx context.Context, id string) error {
 	log := logr.FromContextOrDiscard(ctx)
-	ioCtx, err := r.conn.OpenIOContext(r.pool)
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(r.conns, r.pool, r.namespace)
 	if err != nil {
 		return fmt.Errorf("unable to get io context: %w", err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
 	log.V(2).Info("Get snapshot from store")
 	snapshot, err := r.store.Get(ctx, id)
@@ -296,29 +496,99 @@ func (r *SnapshotReconciler) reconcileSnapshot(ctx context.Context, id string) e
 	}
 
 	log.V(1).Info("Rbd snapshot does not exist, start reconciliation")
-	switch {
-	case snapshot.Source.IronCoreImage != "":
-		err = r.reconcileIroncoreImageSnapshot(ctx, log, ioCtx, snapshot)
-	case snapshot.Source.VolumeImageID != "":
-		err = r.reconcileVolumeImageSnapshot(ctx, log, ioCtx, snapshot)
+	return r.populateSnapshot(ctx, log, ioCtx, snapshot)
+}
+
+// acquirePopulateSlot acquires a populate slot without waiting for it and reports whether it succeeded. The
+// returned func releases the slot.
+func (r *SnapshotReconciler) acquirePopulateSlot() (func(), bool) {
+	if r.populateSlots == nil {
+		return func() {}, true
+	}
+
+	select {
+	case r.populateSlots <- struct{}{}:
+		return func() { <-r.populateSlots }, true
 	default:
+		return nil, false
+	}
+}
+
+func (r *SnapshotReconciler) populateSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot) error {
+	if !snapshot.Source.PopulatesImage() && snapshot.Source.VolumeImageID == "" {
 		return fmt.Errorf("snapshot source not found")
 	}
+
+	// Snapshots of volume images don't download or write any content, they are not bounded by the populate slots.
+	if snapshot.Source.PopulatesImage() {
+		release, ok := r.acquirePopulateSlot()
+		if !ok {
+			return errPopulateSlotsBusy
+		}
+		defer release()
+	}
+
+	err := r.populateSource(ctx, log, ioCtx, snapshot)
+	if errors.Is(err, errSnapshotSourceNotReady) {
+		log.V(1).Info("Snapshot source is not ready yet", "Reason", err)
+		return err
+	}
 	if err != nil {
 		snapshot.Status.State = providerapi.SnapshotStateFailed
-		if _, updateErr := r.store.Update(ctx, snapshot); updateErr != nil {
+		if updateErr := r.updateSnapshotStatus(ctx, snapshot); updateErr != nil {
 			return errors.Join(err, fmt.Errorf("failed to update snapshot state: %w", updateErr))
 		}
 		return fmt.Errorf("failed to reconcile snapshot: %w", err)
 	}
 
 	snapshot.Status.State = providerapi.SnapshotStateReady
-	if _, err = r.store.Update(ctx, snapshot); err != nil {
+	if err := r.updateSnapshotStatus(ctx, snapshot); err != nil {
 		return fmt.Errorf("failed to update snapshot: %w", err)
 	}
+	if !snapshot.CreatedAt.IsZero() {
+		r.metrics.populateDuration.Observe(time.Since(snapshot.CreatedAt).Seconds())
+	}
 
 	return nil
 }
+
+// updateSnapshotStatus stores the status of the snapshot being populated. Images add their references to the
+// snapshot meanwhile, so on conflicts the status is applied to the latest snapshot, keeping its image references.
+func (r *SnapshotReconciler) updateSnapshotStatus(ctx context.Context, snapshot *providerapi.Snapshot) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.Is(err, store.ErrResourceVersionNotLatest)
+	}, func() error {
+		_, err := r.store.Update(ctx, snapshot)
+		if !errors.Is(err, store.ErrResourceVersionNotLatest) {
+			return err
+		}
+
+		latest, getErr := r.store.Get(ctx, snapshot.ID)
+		if getErr != nil {
+			return getErr
+		}
+		status := snapshot.Status
+		status.ImageRefs = latest.Status.ImageRefs
+		*snapshot = *latest
+		snapshot.Status = status
+		return err
+	})
+}
+
+// populateSnapshotSource populates the rbd image and snapshot of the snapshot from its source.
+func (r *SnapshotReconciler) populateSnapshotSource(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot) error {
+	switch {
+	case snapshot.Source.IronCoreImage != "":
+		return r.reconcileIroncoreImageSnapshot(ctx, log, ioCtx, snapshot)
+	case snapshot.Source.URL != "":
+		return r.reconcileURLSnapshot(ctx, log, ioCtx, snapshot)
+	case snapshot.Source.VolumeImageID != "":
+		return r.reconcileVolumeImageSnapshot(ctx, log, ioCtx, snapshot)
+	default:
+		return fmt.Errorf("snapshot source not found")
+	}
+}
+
 func (r *SnapshotReconciler) reconcileIroncoreImageSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot) error {
 	var platform *ocispec.Platform
 
@@ -339,34 +609,78 @@ func (r *SnapshotReconciler) reconcileIroncoreImageSnapshot(ctx context.Context,
 		}
 	}()
 
+	roundedSize, err := r.populateSnapshotImage(ctx, log, ioCtx, snapshot, rc, snapshotSize)
+	if err != nil {
+		return err
+	}
+
+	snapshot.Status.Digest = digest
+	snapshot.Status.Size = int64(roundedSize)
+	return nil
+}
+
+// populateSnapshotImage creates the rbd image of the snapshot, populates it with the content of rc and creates the
+// rbd snapshot of it. It returns the size of the rbd image.
+func (r *SnapshotReconciler) populateSnapshotImage(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot, rc io.Reader, size uint64) (uint64, error) {
 	options := librbd.NewRbdImageOptions()
 	defer options.Destroy()
 
 	//TODO: different pool for OS images?
 	if err := options.SetString(librbd.RbdImageOptionDataPool, r.pool); err != nil {
-		return fmt.Errorf("failed to set data pool: %w", err)
+		return 0, fmt.Errorf("failed to set data pool: %w", err)
 	}
 	log.V(2).Info("Configured pool", "pool", r.pool)
 
 	rbdImageID := SnapshotIDToRBDID(snapshot.ID)
-	roundedSize := round.OffBytes(snapshotSize)
+	roundedSize := round.OffBytes(size)
 
-	if err = librbd.CreateImage(ioCtx, rbdImageID, roundedSize, options); err != nil {
-		return fmt.Errorf("failed to create os rbd image: %w", err)
+	if err := librbd.CreateImage(ioCtx, rbdImageID, roundedSize, options); err != nil {
+		if !errors.Is(err, librbd.ErrExist) {
+			return 0, fmt.Errorf("failed to create os rbd image: %w", err)
+		}
+		if err := removePartiallyPopulatedImage(log, ioCtx, rbdImageID); err != nil {
+			return 0, err
+		}
+		if err := librbd.CreateImage(ioCtx, rbdImageID, roundedSize, options); err != nil {
+			return 0, fmt.Errorf("failed to create os rbd image: %w", err)
+		}
 	}
 	log.V(2).Info("Created rbd image", "bytes", roundedSize)
 
-	if err := r.prepareSnapshotContent(log, ioCtx, rbdImageID, rc); err != nil {
-		return fmt.Errorf("failed to prepare snapshot content: %w", err)
+	if err := r.prepareSnapshotContent(ctx, log, ioCtx, snapshot, rbdImageID, rc, size); err != nil {
+		return 0, fmt.Errorf("failed to prepare snapshot content: %w", err)
 	}
 
 	log.V(2).Info("Create ironcore image snapshot", "ImageID", rbdImageID)
-	if err := createSnapshot(log, ioCtx, ImageSnapshotVersion, rbdImageID); err != nil {
-		return fmt.Errorf("failed to create ironcore image snapshot: %w", err)
+	if err := createSnapshot(log, ioCtx, ironcoreImageSnapshotName(snapshot), rbdImageID); err != nil {
+		return 0, fmt.Errorf("failed to create ironcore image snapshot: %w", err)
 	}
 
-	snapshot.Status.Digest = digest
-	snapshot.Status.Size = int64(roundedSize)
+	return roundedSize, nil
+}
+
+// removePartiallyPopulatedImage removes the rbd image of a snapshot left behind by an interrupted population or
+// whose rbd snapshot was removed out-of-band. Images that still have snapshots are kept, as they may have clones.
+func removePartiallyPopulatedImage(log logr.Logger, ioCtx *rados.IOContext, rbdImageID string) error {
+	img, err := librbd.OpenImage(ioCtx, rbdImageID, librbd.NoSnapshot)
+	if err != nil {
+		return fmt.Errorf("failed to open existing os rbd image: %w", err)
+	}
+	snapshots, err := img.GetSnapshotNames()
+	if closeErr := img.Close(); closeErr != nil {
+		log.Error(closeErr, "Failed to close rbd image")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots of existing os rbd image: %w", err)
+	}
+	if len(snapshots) > 0 {
+		return fmt.Errorf("os rbd image %s already exists with %d snapshots", rbdImageID, len(snapshots))
+	}
+
+	log.V(1).Info("Removing partially populated rbd image", "ImageID", rbdImageID)
+	if err := librbd.RemoveImage(ioCtx, rbdImageID); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to remove partially populated os rbd image: %w", err)
+	}
 	return nil
 }
 
@@ -376,11 +690,28 @@ func (r *SnapshotReconciler) reconcileVolumeImageSnapshot(ctx context.Context, l
 		if !errors.Is(err, store.ErrNotFound) {
 			return fmt.Errorf("failed to fetch image from store: %w", err)
 		}
-		return nil
+		return fmt.Errorf("source image %s not found", snapshot.Source.VolumeImageID)
+	}
+
+	if img.DeletedAt != nil {
+		return fmt.Errorf("source image %s is being deleted", img.ID)
+	}
+
+	if img.Status.State != providerapi.ImageStateAvailable {
+		return fmt.Errorf("source image %s is in state %s: %w", img.ID, img.Status.State, errSnapshotSourceNotReady)
 	}
 
-	log.V(2).Info("Create volume image snapshot", "ImageID", img.ID)
-	if err := createSnapshot(log, ioCtx, snapshot.ID, ImageIDToRBDID(img.ID)); err != nil {
+	if img.Status.Pool != "" && img.Status.Pool != r.pool {
+		return fmt.Errorf("source image %s was migrated to pool %s, snapshots are only supported in pool %s", img.ID, img.Status.Pool, r.pool)
+	}
+
+	if RBDImageName(img) != ImageIDToRBDID(img.ID) {
+		return fmt.Errorf("source image %s has the custom rbd name %s, snapshots are not supported for custom rbd names", img.ID, RBDImageName(img))
+	}
+
+	// The provider has no access to the guest, so the snapshot is crash-consistent only.
+	log.V(1).Info("Create crash-consistent volume image snapshot", "ImageID", img.ID)
+	if err := r.createVolumeImageSnapshot(log, ioCtx, snapshot.ID, ImageIDToRBDID(img.ID)); err != nil {
 		return fmt.Errorf("failed to create volume image snapshot: %w", err)
 	}
 
@@ -389,14 +720,14 @@ func (r *SnapshotReconciler) reconcileVolumeImageSnapshot(ctx context.Context, l
 }
 
 func (r *SnapshotReconciler) openIroncoreImageSource(ctx context.Context, imageReference string, platform *ocispec.Platform) (io.ReadCloser, uint64, string, error) {
-	osImgSrc, err := createOsImageSource(platform)
+	osImgSrc, err := newOsImageSource(r.registryAuth, platform)
 	if err != nil {
 		return nil, 0, "", fmt.Errorf("failed to create os image source: %w", err)
 	}
 
 	img, err := osImgSrc.Resolve(ctx, imageReference)
 	if err != nil {
-		return nil, 0, "", fmt.Errorf("failed to resolve image ref in os image source: %w", err)
+		return nil, 0, "", fmt.Errorf("failed to resolve image ref in os image source: %w", classifyRegistryError(err))
 	}
 
 	ironcoreImage, err := ironcoreimage.ResolveImage(ctx, img)
@@ -409,7 +740,7 @@ func (r *SnapshotReconciler) openIroncoreImageSource(ctx context.Context, imageR
 		return nil, 0, "", fmt.Errorf("image has no root fs")
 	}
 
-	content, err := rootFS.Content(ctx)
+	content, err := r.openLayer(ctx, rootFS)
 	if err != nil {
 		return nil, 0, "", fmt.Errorf("failed to get root fs content: %w", err)
 	}
@@ -417,14 +748,24 @@ func (r *SnapshotReconciler) openIroncoreImageSource(ctx context.Context, imageR
 	return content, uint64(rootFS.Descriptor().Size), img.Descriptor().Digest.String(), nil
 }
 
-func (r *SnapshotReconciler) prepareSnapshotContent(log logr.Logger, ioCtx *rados.IOContext, imageName string, rc io.ReadCloser) error {
+// openLayer returns the content of the layer, from the layer cache if configured.
+func (r *SnapshotReconciler) openLayer(ctx context.Context, layer image.Layer) (io.ReadCloser, error) {
+	if r.layerCache == nil {
+		return layer.Content(ctx)
+	}
+	return r.layerCache.Open(layer.Descriptor().Digest, func() (io.ReadCloser, error) {
+		return layer.Content(ctx)
+	})
+}
+
+func (r *SnapshotReconciler) prepareSnapshotContent(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot, imageName string, rc io.Reader, size uint64) error {
 	rbdImg, err := openImage(ioCtx, imageName)
 	if err != nil {
 		return err
 	}
 	defer closeImage(log, rbdImg)
 
-	if err := r.populateImage(log, rbdImg, rc); err != nil {
+	if err := r.populateImage(ctx, log, snapshot, rbdImg, rc, size); err != nil {
 		return fmt.Errorf("failed to populate os image: %w", err)
 	}
 	log.V(2).Info("Populated os image on rbd image")
@@ -432,30 +773,62 @@ func (r *SnapshotReconciler) prepareSnapshotContent(log logr.Logger, ioCtx *rado
 	return nil
 }
 
-func (r *SnapshotReconciler) populateImage(log logr.Logger, dst io.WriteCloser, src io.Reader) error {
+// populateImage copies the snapshot content to the rbd image and periodically reports the share of the given
+// size written so far in the snapshot status.
+func (r *SnapshotReconciler) populateImage(ctx context.Context, log logr.Logger, snapshot *providerapi.Snapshot, dst io.WriteCloser, src io.Reader, size uint64) error {
+	defer r.metrics.populateProgress.DeleteLabelValues(snapshot.ID)
+
 	throughputReader := rater.NewRater(src)
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(r.populateProgressInterval)
 	defer ticker.Stop()
 	done := make(chan struct{})
 
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for {
 			select {
 			case <-ticker.C:
 				log.Info("Populating", "rate", throughputReader.String())
+				r.reportPopulateProgress(ctx, log, snapshot, populateProgress(throughputReader.Count(), size))
 			case <-done:
 				return
 			}
 		}
 	}()
-	defer func() { close(done) }()
 
 	buffer := make([]byte, r.populatorBufferSize)
 	_, err := io.CopyBuffer(dst, throughputReader, buffer)
+	close(done)
+	wg.Wait()
 	if err != nil {
 		return fmt.Errorf("failed to populate image: %w", err)
 	}
 	log.Info("Successfully populated image")
 
+	// The completed progress is stored together with the ready state.
+	snapshot.Status.PopulateProgress = 100
 	return nil
 }
+
+// populateProgress returns the percentage of size written. It stays below 100 until populating is done,
+// as the size of the source may differ from the written content.
+func populateProgress(written int64, size uint64) int32 {
+	if written <= 0 || size == 0 {
+		return 0
+	}
+	return int32(min(uint64(written)*100/size, 99))
+}
+
+func (r *SnapshotReconciler) reportPopulateProgress(ctx context.Context, log logr.Logger, snapshot *providerapi.Snapshot, progress int32) {
+	r.metrics.populateProgress.WithLabelValues(snapshot.ID).Set(float64(progress))
+	if snapshot.Status.PopulateProgress == progress {
+		return
+	}
+
+	snapshot.Status.PopulateProgress = progress
+	if err := r.updateSnapshotStatus(ctx, snapshot); err != nil {
+		log.Error(err, "Failed to update snapshot populate progress", "progress", progress)
+	}
+}
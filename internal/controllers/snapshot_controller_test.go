@@ -0,0 +1,269 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/utils/ptr"
+)
+
+func newTestSnapshotReconciler(opts SnapshotReconcilerOptions) (*SnapshotReconciler, error) {
+	snapshots := newMemoryStore[*providerapi.Snapshot]()
+	images := newMemoryStore[*providerapi.Image]()
+
+	snapshotEvents, err := event.NewListWatchSource[*providerapi.Snapshot](snapshots.List, snapshots.Watch, event.ListWatchSourceOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	if opts.Pool == "" {
+		opts.Pool = "pool"
+	}
+
+	return NewSnapshotReconciler(logr.Discard(), ceph.StaticConn(&rados.Conn{}), snapshots, images, snapshotEvents, opts)
+}
+
+// progressRecordingStore records the populate progress of every snapshot update.
+type progressRecordingStore struct {
+	*memoryStore[*providerapi.Snapshot]
+
+	mu       sync.Mutex
+	progress []int32
+}
+
+func (s *progressRecordingStore) Update(ctx context.Context, snapshot *providerapi.Snapshot) (*providerapi.Snapshot, error) {
+	s.mu.Lock()
+	s.progress = append(s.progress, snapshot.Status.PopulateProgress)
+	s.mu.Unlock()
+	return s.memoryStore.Update(ctx, snapshot)
+}
+
+func (s *progressRecordingStore) Progress() []int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.progress)
+}
+
+type discardWriteCloser struct {
+	io.Writer
+}
+
+func (discardWriteCloser) Close() error {
+	return nil
+}
+
+var _ = Describe("SnapshotReconciler", func() {
+	Context("referencingImages", func() {
+		var r *SnapshotReconciler
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			r, err = newTestSnapshotReconciler(SnapshotReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, img := range []*providerapi.Image{
+				{Metadata: apiutils.Metadata{ID: "bar"}, Spec: providerapi.ImageSpec{SnapshotRef: ptr.To("foo")}},
+				{Metadata: apiutils.Metadata{ID: "baz"}, Spec: providerapi.ImageSpec{SnapshotRef: ptr.To("other")}},
+				{Metadata: apiutils.Metadata{ID: "qux", DeletedAt: ptr.To(time.Now())}, Spec: providerapi.ImageSpec{SnapshotRef: ptr.To("foo")}},
+				{Metadata: apiutils.Metadata{ID: "foo"}, Spec: providerapi.ImageSpec{SnapshotRef: ptr.To("foo")}},
+			} {
+				_, err := r.images.Create(ctx, img)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("should report images still cloned from the snapshot", func(ctx SpecContext) {
+			Expect(r.referencingImages(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "foo"}})).To(Equal([]string{"bar"}))
+		})
+
+		It("should report the recorded references until the deletion of the images completed", func(ctx SpecContext) {
+			snapshot := &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "foo"}}
+			snapshot.AddImageRef("qux")
+			snapshot.AddImageRef("bar")
+
+			Expect(r.referencingImages(ctx, snapshot)).To(Equal([]string{"bar", "qux"}))
+		})
+
+		It("should report no references for an orphaned snapshot", func(ctx SpecContext) {
+			Expect(r.referencingImages(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "orphan"}})).To(BeEmpty())
+		})
+
+		It("should prune the references of images that no longer exist", func(ctx SpecContext) {
+			snapshot := &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "foo"}}
+			snapshot.AddImageRef("qux")
+			snapshot.AddImageRef("gone")
+			snapshot, err := r.store.Create(ctx, snapshot)
+			Expect(err).NotTo(HaveOccurred())
+
+			snapshot, err = r.pruneImageRefs(ctx, logr.Discard(), snapshot)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshot.Status.ImageRefs).To(Equal([]string{"qux"}))
+
+			stored, err := r.store.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Status.ImageRefs).To(Equal([]string{"qux"}))
+		})
+	})
+
+	Context("getSnapshotSourceDetails", func() {
+		It("should use the default snapshot name for ironcore images", func() {
+			parentName, snapName, err := getSnapshotSourceDetails(&providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Source:   providerapi.SnapshotSource{IronCoreImage: "registry/image:latest"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parentName).To(Equal(SnapshotIDToRBDID("foo")))
+			Expect(snapName).To(Equal(ImageSnapshotVersion))
+		})
+
+		It("should clone from a custom snapshot name", func() {
+			parentName, snapName, err := getSnapshotSourceDetails(&providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Source:   providerapi.SnapshotSource{IronCoreImage: "registry/image:latest", SnapshotName: "base"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parentName).To(Equal(SnapshotIDToRBDID("foo")))
+			Expect(snapName).To(Equal("base"))
+		})
+
+		It("should use the snapshot id for volume snapshots", func() {
+			parentName, snapName, err := getSnapshotSourceDetails(&providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "foo"},
+				Source:   providerapi.SnapshotSource{VolumeImageID: "bar"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parentName).To(Equal(ImageIDToRBDID("bar")))
+			Expect(snapName).To(Equal("foo"))
+		})
+	})
+	Context("populateSnapshot from a volume image", func() {
+		var (
+			r       *SnapshotReconciler
+			created [][2]string
+		)
+
+		BeforeEach(func() {
+			var err error
+			r, err = newTestSnapshotReconciler(SnapshotReconcilerOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			created = nil
+			r.createVolumeImageSnapshot = func(log logr.Logger, ioCtx *rados.IOContext, snapshotName, imageName string) error {
+				created = append(created, [2]string{snapshotName, imageName})
+				return nil
+			}
+		})
+
+		createSnapshot := func(ctx context.Context, imageID string) *providerapi.Snapshot {
+			snapshot, err := r.store.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: "snap"},
+				Source:   providerapi.SnapshotSource{VolumeImageID: imageID},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return snapshot
+		}
+
+		It("should snapshot a provisioned image and mark the snapshot ready", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "img"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable, Size: 1024},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			snapshot := createSnapshot(ctx, "img")
+
+			Expect(r.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(Succeed())
+
+			Expect(created).To(Equal([][2]string{{"snap", ImageIDToRBDID("img")}}))
+			Expect(r.store.Get(ctx, "snap")).To(HaveField("Status", SatisfyAll(
+				HaveField("State", providerapi.SnapshotStateReady),
+				HaveField("Size", BeEquivalentTo(1024)),
+			)))
+		})
+
+		It("should wait for the source image to be provisioned", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "img"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			snapshot := createSnapshot(ctx, "img")
+
+			Expect(r.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(MatchError(errSnapshotSourceNotReady))
+
+			Expect(created).To(BeEmpty())
+			Expect(r.store.Get(ctx, "snap")).To(HaveField("Status.State", BeEmpty()))
+		})
+
+		It("should fail the snapshot of an image with a custom rbd name", func(ctx SpecContext) {
+			_, err := r.images.Create(ctx, &providerapi.Image{
+				Metadata: apiutils.Metadata{ID: "img"},
+				Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable, RBDName: "external-disk"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			snapshot := createSnapshot(ctx, "img")
+
+			Expect(r.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(MatchError(ContainSubstring("custom rbd name")))
+
+			Expect(created).To(BeEmpty())
+			Expect(r.store.Get(ctx, "snap")).To(HaveField("Status.State", providerapi.SnapshotStateFailed))
+		})
+
+		It("should fail the snapshot if the source image does not exist", func(ctx SpecContext) {
+			snapshot := createSnapshot(ctx, "missing")
+
+			Expect(r.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(HaveOccurred())
+
+			Expect(created).To(BeEmpty())
+			Expect(r.store.Get(ctx, "snap")).To(HaveField("Status.State", providerapi.SnapshotStateFailed))
+		})
+	})
+
+	Context("populateImage", func() {
+		It("should report the populate progress", func(ctx SpecContext) {
+			r, err := newTestSnapshotReconciler(SnapshotReconcilerOptions{PopulateProgressInterval: 10 * time.Millisecond})
+			Expect(err).NotTo(HaveOccurred())
+			snapshots := &progressRecordingStore{memoryStore: r.store.(*memoryStore[*providerapi.Snapshot])}
+			r.store = snapshots
+
+			snapshot, err := r.store.Create(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "snap"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			// The fake populator source advances the progress by the chunks written to it.
+			src, populator := io.Pipe()
+			done := make(chan error)
+			go func() {
+				done <- r.populateImage(ctx, logr.Discard(), snapshot, discardWriteCloser{io.Discard}, src, 100)
+			}()
+
+			Expect(populator.Write(make([]byte, 25))).To(Equal(25))
+			Eventually(snapshots.Progress).Should(ContainElement(int32(25)))
+			Eventually(func() float64 {
+				return testutil.ToFloat64(r.metrics.populateProgress.WithLabelValues("snap"))
+			}).Should(Equal(25.0))
+
+			Expect(populator.Write(make([]byte, 50))).To(Equal(50))
+			Eventually(snapshots.Progress).Should(ContainElement(int32(75)))
+
+			Expect(populator.Write(make([]byte, 25))).To(Equal(25))
+			Expect(populator.Close()).To(Succeed())
+			Eventually(done).Should(Receive(BeNil()))
+
+			Expect(snapshots.Progress()).To(HaveEach(BeNumerically("<=", 99)), "progress stays below 100 until done")
+			Expect(snapshot.Status.PopulateProgress).To(Equal(int32(100)))
+			Expect(testutil.CollectAndCount(r.metrics.populateProgress)).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"sync"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+// snapshotImageIndex maps snapshot IDs to the IDs of the images referencing them. It indexes the templates of
+// images the same way.
+type snapshotImageIndex struct {
+	mu         sync.RWMutex
+	ref        func(img *providerapi.Image) *string
+	bySnapshot map[string]map[string]struct{}
+	byImage    map[string]string
+}
+
+func newSnapshotImageIndex() *snapshotImageIndex {
+	return newImageRefIndex(func(img *providerapi.Image) *string { return img.Spec.SnapshotRef })
+}
+
+// newTemplateImageIndex returns an index of the templates referenced by images.
+func newTemplateImageIndex() *snapshotImageIndex {
+	return newImageRefIndex(func(img *providerapi.Image) *string { return img.Spec.TemplateRef })
+}
+
+func newImageRefIndex(ref func(img *providerapi.Image) *string) *snapshotImageIndex {
+	return &snapshotImageIndex{
+		ref:        ref,
+		bySnapshot: make(map[string]map[string]struct{}),
+		byImage:    make(map[string]string),
+	}
+}
+
+// set records the snapshot referenced by the image, replacing any previous reference.
+func (i *snapshotImageIndex) set(img *providerapi.Image) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(img.ID)
+
+	snapshotRef := i.ref(img)
+	if snapshotRef == nil {
+		return
+	}
+
+	imageIDs, ok := i.bySnapshot[*snapshotRef]
+	if !ok {
+		imageIDs = make(map[string]struct{})
+		i.bySnapshot[*snapshotRef] = imageIDs
+	}
+	imageIDs[img.ID] = struct{}{}
+	i.byImage[img.ID] = *snapshotRef
+}
+
+// delete removes the image from the index.
+func (i *snapshotImageIndex) delete(imageID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(imageID)
+}
+
+func (i *snapshotImageIndex) remove(imageID string) {
+	snapshotID, ok := i.byImage[imageID]
+	if !ok {
+		return
+	}
+
+	delete(i.byImage, imageID)
+	delete(i.bySnapshot[snapshotID], imageID)
+	if len(i.bySnapshot[snapshotID]) == 0 {
+		delete(i.bySnapshot, snapshotID)
+	}
+}
+
+// imagesFor returns the IDs of the images referencing the snapshot.
+func (i *snapshotImageIndex) imagesFor(snapshotID string) []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	imageIDs := make([]string, 0, len(i.bySnapshot[snapshotID]))
+	for imageID := range i.bySnapshot[snapshotID] {
+		imageIDs = append(imageIDs, imageID)
+	}
+	return imageIDs
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	indexedImages    = 5000
+	indexedSnapshots = 5
+)
+
+func newIndexedImage(i int) *providerapi.Image {
+	return &providerapi.Image{
+		Metadata: apiutils.Metadata{ID: fmt.Sprintf("image-%d", i)},
+		Spec:     providerapi.ImageSpec{SnapshotRef: ptr.To(fmt.Sprintf("snapshot-%d", i%indexedSnapshots))},
+	}
+}
+
+var _ = Describe("snapshotImageIndex", func() {
+	var index *snapshotImageIndex
+
+	BeforeEach(func() {
+		index = newSnapshotImageIndex()
+		for i := range indexedImages {
+			index.set(newIndexedImage(i))
+		}
+		index.set(&providerapi.Image{Metadata: apiutils.Metadata{ID: "empty"}})
+	})
+
+	It("should return all images referencing a snapshot", func() {
+		for s := range indexedSnapshots {
+			imageIDs := index.imagesFor(fmt.Sprintf("snapshot-%d", s))
+			Expect(imageIDs).To(HaveLen(indexedImages / indexedSnapshots))
+			for _, imageID := range imageIDs {
+				var i int
+				_, err := fmt.Sscanf(imageID, "image-%d", &i)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(i % indexedSnapshots).To(Equal(s))
+			}
+		}
+		Expect(index.imagesFor("unknown")).To(BeEmpty())
+	})
+
+	It("should move images whose snapshot reference changed", func() {
+		img := newIndexedImage(0)
+		img.Spec.SnapshotRef = ptr.To("other")
+		index.set(img)
+
+		Expect(index.imagesFor("snapshot-0")).NotTo(ContainElement("image-0"))
+		Expect(index.imagesFor("other")).To(ConsistOf("image-0"))
+	})
+
+	It("should drop deleted images", func() {
+		index.delete("image-1")
+		Expect(index.imagesFor("snapshot-1")).NotTo(ContainElement("image-1"))
+		Expect(index.imagesFor("snapshot-1")).To(HaveLen(indexedImages/indexedSnapshots - 1))
+	})
+})
+
+func BenchmarkSnapshotImageIndex(b *testing.B) {
+	index := newSnapshotImageIndex()
+	for i := range indexedImages {
+		index.set(newIndexedImage(i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index.set(newIndexedImage(i % indexedImages))
+		_ = index.imagesFor(fmt.Sprintf("snapshot-%d", i%indexedSnapshots))
+	}
+}
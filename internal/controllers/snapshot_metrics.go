@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const snapshotStateCollectTimeout = 10 * time.Second
+
+var snapshotStates = []providerapi.SnapshotState{
+	providerapi.SnapshotStatePending,
+	providerapi.SnapshotStatePopulated,
+	providerapi.SnapshotStateReady,
+	providerapi.SnapshotStateFailed,
+}
+
+type snapshotMetrics struct {
+	activeReconciles prometheus.Gauge
+	populateDuration prometheus.Histogram
+	populateProgress *prometheus.GaugeVec
+}
+
+func newSnapshotMetrics() snapshotMetrics {
+	return snapshotMetrics{
+		activeReconciles: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cephlet_snapshot_active_reconciles",
+			Help: "Number of snapshots currently being reconciled.",
+		}),
+		populateDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "cephlet_snapshot_populate_duration_seconds",
+			Help:    "Time from the creation of a snapshot until it is populated.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		}),
+		populateProgress: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cephlet_snapshot_populate_progress_percent",
+			Help: "Progress of the snapshots currently being populated from an image.",
+		}, []string{"snapshot"}),
+	}
+}
+
+// RegisterMetrics registers the snapshot metrics: the number of snapshots by state, the queue depth,
+// the number of active reconciles, the populate latency, the populate progress and the metrics of the layer cache.
+func (r *SnapshotReconciler) RegisterMetrics(registerer prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		&snapshotStateCollector{r: r},
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "cephlet_snapshot_queue_depth",
+			Help: "Number of snapshots waiting to be reconciled.",
+		}, func() float64 { return float64(r.queue.Len()) }),
+		r.metrics.activeReconciles,
+		r.metrics.populateDuration,
+		r.metrics.populateProgress,
+	}
+	if r.layerCache != nil {
+		collectors = append(collectors, r.layerCache.Collectors()...)
+	}
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var snapshotStateDesc = prometheus.NewDesc(
+	"cephlet_snapshot_state",
+	"Number of snapshots by state.",
+	[]string{"state"}, nil,
+)
+
+// snapshotStateCollector counts the snapshots in the store by state on every scrape.
+type snapshotStateCollector struct {
+	r *SnapshotReconciler
+}
+
+func (c *snapshotStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- snapshotStateDesc
+}
+
+func (c *snapshotStateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotStateCollectTimeout)
+	defer cancel()
+
+	snapshots, err := c.r.store.List(ctx)
+	if err != nil {
+		c.r.log.Error(err, "Failed to list snapshots for metrics")
+		ch <- prometheus.NewInvalidMetric(snapshotStateDesc, err)
+		return
+	}
+
+	counts := make(map[providerapi.SnapshotState]int, len(snapshotStates))
+	for _, snapshot := range snapshots {
+		state := snapshot.Status.State
+		if state == "" {
+			state = providerapi.SnapshotStatePending
+		}
+		counts[state]++
+	}
+
+	for _, state := range snapshotStates {
+		ch <- prometheus.MustNewConstMetric(snapshotStateDesc, prometheus.GaugeValue, float64(counts[state]), string(state))
+		delete(counts, state)
+	}
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(snapshotStateDesc, prometheus.GaugeValue, float64(count), string(state))
+	}
+}
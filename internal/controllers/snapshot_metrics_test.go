@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var _ = Describe("Snapshot metrics", func() {
+	var (
+		r        *SnapshotReconciler
+		registry *prometheus.Registry
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestSnapshotReconciler(SnapshotReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		registry = prometheus.NewRegistry()
+		Expect(r.RegisterMetrics(registry)).To(Succeed())
+	})
+
+	It("should report the number of snapshots by state", func(ctx SpecContext) {
+		for id, state := range map[string]providerapi.SnapshotState{
+			"a": "",
+			"b": providerapi.SnapshotStateReady,
+			"c": providerapi.SnapshotStateReady,
+			"d": providerapi.SnapshotStateFailed,
+		} {
+			_, err := r.store.Create(ctx, &providerapi.Snapshot{
+				Metadata: apiutils.Metadata{ID: id},
+				Status:   providerapi.SnapshotStatus{State: state},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP cephlet_snapshot_state Number of snapshots by state.
+# TYPE cephlet_snapshot_state gauge
+cephlet_snapshot_state{state="Failed"} 1
+cephlet_snapshot_state{state="Pending"} 1
+cephlet_snapshot_state{state="Populated"} 0
+cephlet_snapshot_state{state="Ready"} 2
+`), "cephlet_snapshot_state")).To(Succeed())
+	})
+
+	It("should report the queue depth", func() {
+		r.queue.Add("a")
+		r.queue.Add("b")
+
+		Expect(testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP cephlet_snapshot_queue_depth Number of snapshots waiting to be reconciled.
+# TYPE cephlet_snapshot_queue_depth gauge
+cephlet_snapshot_queue_depth 2
+`), "cephlet_snapshot_queue_depth")).To(Succeed())
+	})
+
+	It("should observe the populate latency of a snapshot", func(ctx SpecContext) {
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "img"},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		r.createVolumeImageSnapshot = func(log logr.Logger, ioCtx *rados.IOContext, snapshotName, imageName string) error {
+			return nil
+		}
+
+		snapshot, err := r.store.Create(ctx, &providerapi.Snapshot{
+			Metadata: apiutils.Metadata{ID: "snap", CreatedAt: time.Now().Add(-time.Minute)},
+			Source:   providerapi.SnapshotSource{VolumeImageID: "img"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(Succeed())
+		metric := &dto.Metric{}
+		Expect(r.metrics.populateDuration.Write(metric)).To(Succeed())
+		Expect(metric.GetHistogram().GetSampleCount()).To(BeEquivalentTo(1))
+		Expect(metric.GetHistogram().GetSampleSum()).To(BeNumerically(">=", time.Minute.Seconds()))
+	})
+})
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("snapshot populate concurrency", func() {
+	const concurrency = 2
+
+	var (
+		r                   *SnapshotReconciler
+		unblock             chan struct{}
+		populating, maximum atomic.Int32
+	)
+
+	BeforeEach(func() {
+		var err error
+		r, err = newTestSnapshotReconciler(SnapshotReconcilerOptions{PopulateConcurrency: concurrency})
+		Expect(err).NotTo(HaveOccurred())
+
+		unblock = make(chan struct{})
+		populating.Store(0)
+		maximum.Store(0)
+		r.populateSource = func(ctx context.Context, _ logr.Logger, _ *rados.IOContext, snapshot *providerapi.Snapshot) error {
+			if !snapshot.Source.PopulatesImage() {
+				return nil
+			}
+			current := populating.Add(1)
+			defer populating.Add(-1)
+			for {
+				if prev := maximum.Load(); current <= prev || maximum.CompareAndSwap(prev, current) {
+					break
+				}
+			}
+			select {
+			case <-unblock:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+
+	createSnapshot := func(ctx SpecContext, id string, source providerapi.SnapshotSource) *providerapi.Snapshot {
+		snapshot, err := r.store.Create(ctx, &providerapi.Snapshot{
+			Metadata: apiutils.Metadata{ID: id},
+			Source:   source,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return snapshot
+	}
+
+	It("should populate at most the configured number of snapshots at once", func(ctx SpecContext) {
+		const total = 5
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			busy []*providerapi.Snapshot
+		)
+		for i := range total {
+			snapshot := createSnapshot(ctx, fmt.Sprintf("snap-%d", i), providerapi.SnapshotSource{URL: "https://example.com/disk.raw"})
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				if err := r.populateSnapshot(ctx, logr.Discard(), nil, snapshot); err != nil {
+					Expect(err).To(MatchError(errPopulateSlotsBusy))
+					mu.Lock()
+					busy = append(busy, snapshot)
+					mu.Unlock()
+				}
+			}()
+		}
+
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(busy)
+		}).Should(Equal(total - concurrency))
+		Expect(populating.Load()).To(BeEquivalentTo(concurrency))
+
+		By("populating the other snapshots once the slots are free")
+		close(unblock)
+		wg.Wait()
+		for _, snapshot := range busy {
+			Expect(r.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(Succeed())
+		}
+		Expect(maximum.Load()).To(BeEquivalentTo(concurrency))
+
+		snapshots, err := r.store.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshots).To(HaveEach(HaveField("Status.State", providerapi.SnapshotStateReady)))
+	})
+
+	It("should not bound snapshots of volume images", func(ctx SpecContext) {
+		for range concurrency {
+			_, ok := r.acquirePopulateSlot()
+			Expect(ok).To(BeTrue())
+		}
+
+		snapshot := createSnapshot(ctx, "snap", providerapi.SnapshotSource{VolumeImageID: "foo"})
+		Expect(r.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(Succeed())
+	})
+
+	It("should reject a negative concurrency", func() {
+		_, err := newTestSnapshotReconciler(SnapshotReconcilerOptions{PopulateConcurrency: -1})
+		Expect(err).To(MatchError(ContainSubstring("populate concurrency must not be negative")))
+	})
+})
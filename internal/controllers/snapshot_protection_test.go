@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+// fakeSnapshot is an rbd snapshot whose protection fails with protectErr, after which it is protected if
+// protectedOnError is set, as if protected concurrently.
+type fakeSnapshot struct {
+	protected        bool
+	protects         int
+	protectErr       error
+	protectedOnError bool
+}
+
+func (s *fakeSnapshot) IsProtected() (bool, error) {
+	return s.protected, nil
+}
+
+func (s *fakeSnapshot) Protect() error {
+	s.protects++
+	if s.protectErr != nil {
+		s.protected = s.protectedOnError
+		return s.protectErr
+	}
+	if s.protected {
+		return errors.New("snapshot is already protected")
+	}
+	s.protected = true
+	return nil
+}
+
+// fakeParentSnapshots are rbd snapshots keyed by <image>@<snapshot>.
+type fakeParentSnapshots map[string]*fakeSnapshot
+
+func (s fakeParentSnapshots) EnsureProtected(_ logr.Logger, _ *rados.IOContext, imageName, snapName string) (bool, error) {
+	snapshot, ok := s[imageName+"@"+snapName]
+	if !ok {
+		return false, nil
+	}
+	return true, ensureSnapshotProtected(snapshot)
+}
+
+var _ = Describe("ensureSnapshotProtected", func() {
+	It("should protect an unprotected snapshot", func() {
+		snapshot := &fakeSnapshot{}
+		Expect(ensureSnapshotProtected(snapshot)).To(Succeed())
+		Expect(snapshot.protected).To(BeTrue())
+		Expect(snapshot.protects).To(Equal(1))
+	})
+
+	It("should not protect a protected snapshot again", func() {
+		snapshot := &fakeSnapshot{protected: true}
+		Expect(ensureSnapshotProtected(snapshot)).To(Succeed())
+		Expect(snapshot.protects).To(BeZero())
+	})
+
+	It("should succeed if the snapshot was protected concurrently", func() {
+		snapshot := &fakeSnapshot{protectErr: errors.New("device or resource busy"), protectedOnError: true}
+		Expect(ensureSnapshotProtected(snapshot)).To(Succeed())
+	})
+
+	It("should fail if the snapshot could not be protected", func() {
+		protectErr := errors.New("permission denied")
+		snapshot := &fakeSnapshot{protectErr: protectErr}
+		Expect(ensureSnapshotProtected(snapshot)).To(MatchError(protectErr))
+	})
+})
+
+var _ = Describe("createImageFromSnapshot", func() {
+	var (
+		r         *ImageReconciler
+		conns     *countingConnAccessor
+		snapshots fakeParentSnapshots
+		img       *providerapi.Image
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		conns = &countingConnAccessor{}
+		r.conns = conns
+		snapshots = fakeParentSnapshots{}
+		r.parentSnapshots = snapshots
+
+		_, err = r.snapshots.Create(ctx, &providerapi.Snapshot{
+			Metadata: apiutils.Metadata{ID: "snap"},
+			Source:   providerapi.SnapshotSource{VolumeImageID: "bar"},
+			Status:   providerapi.SnapshotStatus{State: providerapi.SnapshotStateReady},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		img = &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Size: 1024 * 1024 * 1024, SnapshotRef: ptr.To("snap")},
+		}
+	})
+
+	It("should protect an unprotected parent snapshot before cloning", func(ctx SpecContext) {
+		parent := &fakeSnapshot{}
+		snapshots[ImageIDToRBDID("bar")+"@snap"] = parent
+
+		_, err := r.createImageFromSnapshot(ctx, logr.Discard(), nil, img, "snap", nil)
+		Expect(err).To(MatchError(rados.ErrNotConnected))
+		Expect(parent.protected).To(BeTrue())
+		By("cloning after protecting the parent")
+		Expect(conns.calls).To(Equal(1))
+	})
+
+	It("should clone from an already protected parent snapshot", func(ctx SpecContext) {
+		parent := &fakeSnapshot{protected: true}
+		snapshots[ImageIDToRBDID("bar")+"@snap"] = parent
+
+		_, err := r.createImageFromSnapshot(ctx, logr.Discard(), nil, img, "snap", nil)
+		Expect(err).To(MatchError(rados.ErrNotConnected))
+		Expect(parent.protects).To(BeZero())
+		Expect(conns.calls).To(Equal(1))
+	})
+
+	It("should not clone from a missing parent snapshot", func(ctx SpecContext) {
+		_, err := r.createImageFromSnapshot(ctx, logr.Discard(), nil, img, "snap", nil)
+		Expect(err).To(MatchError(errSnapshotParentNotFound))
+		Expect(conns.calls).To(BeZero())
+
+		snapshot, err := r.snapshots.Get(ctx, "snap")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.Status.State).To(Equal(providerapi.SnapshotStateFailed))
+	})
+})
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+)
+
+// addSnapshotRef records the image as reference of the snapshot it is created from, so that the snapshot is kept
+// until the deletion of the image has completed. Images sharing a snapshot, e.g. of the same os image digest, are
+// counted individually.
+func (r *ImageReconciler) addSnapshotRef(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
+	snapshotRef := img.Spec.SnapshotRef
+	if snapshotRef == nil || *snapshotRef == img.ID {
+		return nil
+	}
+
+	snapshot, err := r.snapshots.Get(ctx, *snapshotRef)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get snapshot %s: %w", *snapshotRef, err)
+	}
+
+	if !snapshot.AddImageRef(img.ID) {
+		return nil
+	}
+	if _, err := r.snapshots.Update(ctx, snapshot); err != nil {
+		return fmt.Errorf("failed to add image reference to snapshot %s: %w", snapshot.ID, err)
+	}
+	log.V(2).Info("Added image reference to snapshot", "SnapshotID", snapshot.ID, "References", snapshot.ReferenceCount())
+	return nil
+}
+
+// removeSnapshotRef drops the reference of the deleted image to the snapshot it was created from.
+func (r *ImageReconciler) removeSnapshotRef(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
+	snapshotRef := img.Spec.SnapshotRef
+	if snapshotRef == nil {
+		return nil
+	}
+
+	snapshot, err := r.snapshots.Get(ctx, *snapshotRef)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get snapshot %s: %w", *snapshotRef, err)
+	}
+
+	if !snapshot.RemoveImageRef(img.ID) {
+		return nil
+	}
+	if _, err := r.snapshots.Update(ctx, snapshot); err != nil {
+		return fmt.Errorf("failed to remove image reference from snapshot %s: %w", snapshot.ID, err)
+	}
+	log.V(2).Info("Removed image reference from snapshot", "SnapshotID", snapshot.ID, "References", snapshot.ReferenceCount())
+	return nil
+}
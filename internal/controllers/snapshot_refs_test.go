@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Snapshot references", func() {
+	var r *ImageReconciler
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.snapshots.Create(ctx, &providerapi.Snapshot{Metadata: apiutils.Metadata{ID: "sha256:abc"}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	imageOf := func(id string) *providerapi.Image {
+		return &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: id},
+			Spec:     providerapi.ImageSpec{SnapshotRef: ptr.To("sha256:abc")},
+		}
+	}
+
+	referenceCount := func(ctx SpecContext) int {
+		snapshot, err := r.snapshots.Get(ctx, "sha256:abc")
+		Expect(err).NotTo(HaveOccurred())
+		return snapshot.ReferenceCount()
+	}
+
+	It("should count the images sharing a snapshot across their lifecycle", func(ctx SpecContext) {
+		foo, bar := imageOf("foo"), imageOf("bar")
+
+		Expect(r.addSnapshotRef(ctx, logr.Discard(), foo)).To(Succeed())
+		Expect(r.addSnapshotRef(ctx, logr.Discard(), bar)).To(Succeed())
+		// Reconciling an image again doesn't count it twice.
+		Expect(r.addSnapshotRef(ctx, logr.Discard(), foo)).To(Succeed())
+		Expect(referenceCount(ctx)).To(Equal(2))
+
+		Expect(r.removeSnapshotRef(ctx, logr.Discard(), foo)).To(Succeed())
+		Expect(referenceCount(ctx)).To(Equal(1))
+		Expect(r.removeSnapshotRef(ctx, logr.Discard(), foo)).To(Succeed())
+		Expect(referenceCount(ctx)).To(Equal(1))
+
+		Expect(r.removeSnapshotRef(ctx, logr.Discard(), bar)).To(Succeed())
+		Expect(referenceCount(ctx)).To(BeZero())
+	})
+
+	It("should ignore images without or with a missing snapshot", func(ctx SpecContext) {
+		missing := imageOf("foo")
+		missing.Spec.SnapshotRef = ptr.To("sha256:missing")
+
+		Expect(r.addSnapshotRef(ctx, logr.Discard(), &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}})).To(Succeed())
+		Expect(r.addSnapshotRef(ctx, logr.Discard(), missing)).To(Succeed())
+		Expect(r.removeSnapshotRef(ctx, logr.Discard(), missing)).To(Succeed())
+		Expect(referenceCount(ctx)).To(BeZero())
+	})
+
+	It("should keep references added while the snapshot is populated", func(ctx SpecContext) {
+		s, err := newTestSnapshotReconciler(SnapshotReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		s.store = r.snapshots
+
+		snapshot, err := r.snapshots.Get(ctx, "sha256:abc")
+		Expect(err).NotTo(HaveOccurred())
+		snapshot.Source.IronCoreImage = "registry.example.com/os@sha256:abc"
+		snapshot, err = r.snapshots.Update(ctx, snapshot)
+		Expect(err).NotTo(HaveOccurred())
+
+		s.populateSource = func(ctx context.Context, log logr.Logger, _ *rados.IOContext, snapshot *providerapi.Snapshot) error {
+			if err := r.addSnapshotRef(ctx, logr.Discard(), imageOf("foo")); err != nil {
+				return err
+			}
+			s.reportPopulateProgress(ctx, log, snapshot, 50)
+			return r.addSnapshotRef(ctx, logr.Discard(), imageOf("bar"))
+		}
+		Expect(s.populateSnapshot(ctx, logr.Discard(), nil, snapshot)).To(Succeed())
+
+		Expect(r.snapshots.Get(ctx, "sha256:abc")).To(HaveField("Status", SatisfyAll(
+			HaveField("State", providerapi.SnapshotStateReady),
+			HaveField("PopulateProgress", BeEquivalentTo(50)),
+			HaveField("ImageRefs", Equal([]string{"bar", "foo"})),
+		)))
+	})
+})
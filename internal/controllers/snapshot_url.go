@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+var (
+	// ErrUnsupportedImageFormat is returned if the content of a snapshot URL is not a raw disk image.
+	ErrUnsupportedImageFormat = errors.New("unsupported image format")
+	// ErrDigestMismatch is returned if the content of a snapshot URL does not match the expected digest.
+	ErrDigestMismatch = errors.New("digest mismatch")
+)
+
+// imageFormatMagics are the magic bytes of disk image and compression formats that can't be populated as is.
+var imageFormatMagics = []struct {
+	format string
+	magic  []byte
+}{
+	{"qcow2", []byte("QFI\xfb")},
+	{"vmdk", []byte("KDMV")},
+	{"vhdx", []byte("vhdxfile")},
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+const sha256DigestPrefix = "sha256:"
+
+func (r *SnapshotReconciler) reconcileURLSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapshot *providerapi.Snapshot) error {
+	rc, size, err := r.openURLSource(ctx, snapshot.Source.URL)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot source: %w", err)
+	}
+	defer func() {
+		if err := rc.Close(); err != nil {
+			log.Error(err, "failed to close snapshot source")
+		}
+	}()
+
+	content, err := newURLContentReader(rc, snapshot.Source.URLDigest)
+	if err != nil {
+		return err
+	}
+
+	roundedSize, err := r.populateSnapshotImage(ctx, log, ioCtx, snapshot, content, size)
+	if err != nil {
+		return err
+	}
+
+	snapshot.Status.Digest = content.Digest()
+	snapshot.Status.Size = int64(roundedSize)
+	return nil
+}
+
+// resolveSourceURL returns the http(s) URL to fetch the snapshot content from. s3://bucket/key URLs are fetched
+// path-style from the configured s3 endpoint.
+func (r *SnapshotReconciler) resolveSourceURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid snapshot url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return u.String(), nil
+	case "s3":
+		if r.s3Endpoint == "" {
+			return "", fmt.Errorf("no s3 endpoint configured to fetch %s from", rawURL)
+		}
+		return url.JoinPath(r.s3Endpoint, u.Host, u.Path)
+	default:
+		return "", fmt.Errorf("unsupported snapshot url scheme %q", u.Scheme)
+	}
+}
+
+// openURLSource opens the content of the snapshot URL and returns its size.
+func (r *SnapshotReconciler) openURLSource(ctx context.Context, rawURL string) (io.ReadCloser, uint64, error) {
+	sourceURL, err := r.resolveSourceURL(rawURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get %s: %w", sourceURL, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, 0, fmt.Errorf("failed to get %s: unexpected status %s", sourceURL, res.Status)
+	}
+	if res.ContentLength <= 0 {
+		_ = res.Body.Close()
+		return nil, 0, fmt.Errorf("failed to get %s: unknown content length", sourceURL)
+	}
+	return res.Body, uint64(res.ContentLength), nil
+}
+
+// urlContentReader reads the raw disk image of a snapshot URL. It rejects other image formats on the first read and
+// verifies the expected digest, if any, once the content is read completely.
+type urlContentReader struct {
+	r        *bufio.Reader
+	hash     hash.Hash
+	expected string
+
+	checked bool
+}
+
+func newURLContentReader(r io.Reader, expectedDigest string) (*urlContentReader, error) {
+	if expectedDigest != "" {
+		encoded, ok := strings.CutPrefix(expectedDigest, sha256DigestPrefix)
+		if !ok {
+			return nil, fmt.Errorf("unsupported digest %q, only %s digests are supported", expectedDigest, sha256DigestPrefix)
+		}
+		if _, err := hex.DecodeString(encoded); err != nil || len(encoded) != 2*sha256.Size {
+			return nil, fmt.Errorf("invalid digest %q", expectedDigest)
+		}
+	}
+
+	h := sha256.New()
+	return &urlContentReader{
+		r:        bufio.NewReader(io.TeeReader(r, h)),
+		hash:     h,
+		expected: expectedDigest,
+	}, nil
+}
+
+func (c *urlContentReader) Read(p []byte) (int, error) {
+	if !c.checked {
+		if err := c.checkFormat(); err != nil {
+			return 0, err
+		}
+		c.checked = true
+	}
+
+	n, err := c.r.Read(p)
+	if errors.Is(err, io.EOF) && c.expected != "" && c.Digest() != c.expected {
+		return n, fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, c.expected, c.Digest())
+	}
+	return n, err
+}
+
+func (c *urlContentReader) checkFormat() error {
+	header, err := c.r.Peek(8)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read image header: %w", err)
+	}
+
+	for _, f := range imageFormatMagics {
+		if bytes.HasPrefix(header, f.magic) {
+			return fmt.Errorf("%w %s, only raw disk images are supported", ErrUnsupportedImageFormat, f.format)
+		}
+	}
+	return nil
+}
+
+// Digest returns the sha256 digest of the content read so far.
+func (c *urlContentReader) Digest() string {
+	return sha256DigestPrefix + hex.EncodeToString(c.hash.Sum(nil))
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("URL snapshot source", func() {
+	var (
+		r       *SnapshotReconciler
+		content map[string][]byte
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		content = map[string][]byte{
+			"/disk.raw":        bytes.Repeat([]byte{0xeb, 0x63, 0x90, 0x00}, 1024),
+			"/bucket/disk.raw": []byte("raw disk in a bucket"),
+			"/disk.qcow2":      append([]byte("QFI\xfb"), make([]byte, 512)...),
+			"/disk.raw.gz":     {0x1f, 0x8b, 0x08, 0x00},
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			data, ok := content[req.URL.Path]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			_, _ = w.Write(data)
+		}))
+		DeferCleanup(server.Close)
+
+		var err error
+		r, err = newTestSnapshotReconciler(SnapshotReconcilerOptions{
+			HTTPClient: server.Client(),
+			S3Endpoint: server.URL,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	sha256Digest := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	populate := func(ctx SpecContext, snapshot *providerapi.Snapshot) ([]byte, *urlContentReader, error) {
+		rc, size, err := r.openURLSource(ctx, snapshot.Source.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() { _ = rc.Close() }()
+		Expect(size).To(BeEquivalentTo(len(content["/disk.raw"])))
+
+		src, err := newURLContentReader(rc, snapshot.Source.URLDigest)
+		if err != nil {
+			return nil, nil, err
+		}
+		var dst bytes.Buffer
+		err = r.populateImage(ctx, logr.Discard(), snapshot, discardWriteCloser{&dst}, src, size)
+		return dst.Bytes(), src, err
+	}
+
+	It("should populate a raw image served over http and verify its digest", func(ctx SpecContext) {
+		snapshot := &providerapi.Snapshot{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Source: providerapi.SnapshotSource{
+				URL:       server.URL + "/disk.raw",
+				URLDigest: sha256Digest(content["/disk.raw"]),
+			},
+		}
+
+		populated, src, err := populate(ctx, snapshot)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(populated).To(HaveLen(len(content["/disk.raw"])))
+		Expect(populated).To(Equal(content["/disk.raw"]))
+		Expect(src.Digest()).To(Equal(snapshot.Source.URLDigest))
+		Expect(snapshot.Status.PopulateProgress).To(BeEquivalentTo(100))
+	})
+
+	It("should fail if the content does not match the digest", func(ctx SpecContext) {
+		_, _, err := populate(ctx, &providerapi.Snapshot{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Source: providerapi.SnapshotSource{
+				URL:       server.URL + "/disk.raw",
+				URLDigest: sha256Digest([]byte("other")),
+			},
+		})
+		Expect(err).To(MatchError(ErrDigestMismatch))
+	})
+
+	DescribeTable("should reject images that are not raw",
+		func(path, format string) {
+			rc, _, err := r.openURLSource(context.Background(), server.URL+path)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { _ = rc.Close() }()
+
+			src, err := newURLContentReader(rc, "")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.ReadAll(src)
+			Expect(err).To(MatchError(ErrUnsupportedImageFormat))
+			Expect(err).To(MatchError(ContainSubstring(format)))
+		},
+		Entry("qcow2", "/disk.qcow2", "qcow2"),
+		Entry("gzip", "/disk.raw.gz", "gzip"),
+	)
+
+	It("should fetch s3 urls path-style from the s3 endpoint", func(ctx SpecContext) {
+		rc, size, err := r.openURLSource(ctx, "s3://bucket/disk.raw")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = rc.Close() }()
+
+		Expect(size).To(BeEquivalentTo(len(content["/bucket/disk.raw"])))
+		Expect(io.ReadAll(rc)).To(Equal(content["/bucket/disk.raw"]))
+	})
+
+	It("should fail for missing content and unsupported urls", func(ctx SpecContext) {
+		_, _, err := r.openURLSource(ctx, server.URL+"/missing")
+		Expect(err).To(MatchError(ContainSubstring("404")))
+
+		_, _, err = r.openURLSource(ctx, "ftp://example.com/disk.raw")
+		Expect(err).To(MatchError(ContainSubstring(`unsupported snapshot url scheme "ftp"`)))
+	})
+
+	It("should reject unsupported digests", func() {
+		_, err := newURLContentReader(bytes.NewReader(nil), "md5:abc")
+		Expect(err).To(MatchError(ContainSubstring("only sha256: digests are supported")))
+	})
+})
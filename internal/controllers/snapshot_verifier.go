@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const DefaultSnapshotVerifyInterval = 30 * time.Minute
+
+// rbdSnapshotBacking checks the rbd snapshots backing snapshots.
+type rbdSnapshotBacking interface {
+	SnapshotExists(imageName, snapName string) (bool, error)
+}
+
+type SnapshotVerifierOptions struct {
+	Pool string
+	// Namespace is the rbd namespace within the pool the images are stored in. Defaults to the default namespace.
+	Namespace string
+
+	// Interval is the interval the populated snapshots are checked for their rbd images in.
+	Interval time.Duration
+
+	// Maintenance skips verifying the snapshots while it is on. Snapshots are always verified if nil.
+	Maintenance *maintenance.Mode
+}
+
+func setSnapshotVerifierOptionsDefaults(o *SnapshotVerifierOptions) {
+	if o.Interval == 0 {
+		o.Interval = DefaultSnapshotVerifyInterval
+	}
+}
+
+// SnapshotVerifier resets populated snapshots whose rbd image or rbd snapshot is gone, e.g. because it was removed
+// out-of-band, to pending, so that the snapshot reconciler populates them again instead of images silently failing
+// to be cloned from them.
+type SnapshotVerifier struct {
+	log     logr.Logger
+	backing rbdSnapshotBacking
+
+	snapshots store.Store[*providerapi.Snapshot]
+
+	interval    time.Duration
+	maintenance *maintenance.Mode
+}
+
+func NewSnapshotVerifier(
+	log logr.Logger,
+	conns ceph.ConnAccessor,
+	snapshots store.Store[*providerapi.Snapshot],
+	opts SnapshotVerifierOptions,
+) (*SnapshotVerifier, error) {
+	if conns == nil {
+		return nil, fmt.Errorf("must specify conns")
+	}
+
+	if snapshots == nil {
+		return nil, fmt.Errorf("must specify snapshot store")
+	}
+
+	if opts.Pool == "" {
+		return nil, fmt.Errorf("must specify pool")
+	}
+
+	if err := ceph.ValidateNamespace(opts.Namespace); err != nil {
+		return nil, err
+	}
+
+	if opts.Interval < 0 {
+		return nil, fmt.Errorf("snapshot verify interval must not be negative, got %s", opts.Interval)
+	}
+
+	setSnapshotVerifierOptionsDefaults(&opts)
+
+	return &SnapshotVerifier{
+		log:         log,
+		backing:     &connRBDSnapshotBacking{log: log, conns: conns, pool: opts.Pool, namespace: opts.Namespace},
+		snapshots:   snapshots,
+		interval:    opts.Interval,
+		maintenance: opts.Maintenance,
+	}, nil
+}
+
+// Start verifies the populated snapshots every interval until ctx is done.
+func (v *SnapshotVerifier) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := v.Verify(ctx); err != nil {
+			v.log.Error(err, "Failed to verify snapshots")
+		}
+	}, v.interval)
+}
+
+// Verify resets all populated snapshots without rbd image or rbd snapshot to pending. Snapshots of volume images are
+// not verified: their rbd snapshot cannot be populated again once it is gone. Nothing is verified while the
+// maintenance mode is on, as missing rbd snapshots may be unavailable osds.
+func (v *SnapshotVerifier) Verify(ctx context.Context) error {
+	if v.maintenance.Paused() {
+		v.log.V(1).Info("Maintenance mode on, skipping snapshot verification")
+		return nil
+	}
+
+	var populated []*providerapi.Snapshot
+	if err := listPages(ctx, v.snapshots, func(snapshots []*providerapi.Snapshot) error {
+		for _, snapshot := range snapshots {
+			if isPopulatedSnapshot(snapshot) {
+				populated = append(populated, snapshot)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var errs []error
+	for _, snapshot := range populated {
+		if v.maintenance.Paused() {
+			v.log.V(1).Info("Maintenance mode on, stopping snapshot verification")
+			break
+		}
+		if err := v.verifySnapshot(ctx, snapshot); err != nil {
+			errs = append(errs, fmt.Errorf("snapshot %s: %w", snapshot.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isPopulatedSnapshot(snapshot *providerapi.Snapshot) bool {
+	if snapshot.DeletedAt != nil || !snapshot.Source.PopulatesImage() {
+		return false
+	}
+	return snapshot.Status.State == providerapi.SnapshotStateReady || snapshot.Status.State == providerapi.SnapshotStatePopulated
+}
+
+func (v *SnapshotVerifier) verifySnapshot(ctx context.Context, snapshot *providerapi.Snapshot) error {
+	log := v.log.WithValues("snapshotId", snapshot.ID)
+
+	rbdID, snapName, err := getSnapshotSourceDetails(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot source details: %w", err)
+	}
+
+	exists, err := v.backing.SnapshotExists(rbdID, snapName)
+	if err != nil {
+		return fmt.Errorf("failed to check rbd snapshot existence: %w", err)
+	}
+	if exists {
+		log.V(2).Info("Rbd snapshot exists")
+		return nil
+	}
+
+	log.Info("Rbd snapshot of populated snapshot is missing, repopulating", "RBDImage", rbdID, "RBDSnapshot", snapName)
+	snapshot.Status.State = providerapi.SnapshotStatePending
+	snapshot.Status.Digest = ""
+	snapshot.Status.Size = 0
+	snapshot.Status.PopulateProgress = 0
+	if _, err := v.snapshots.Update(ctx, snapshot); err != nil {
+		return fmt.Errorf("failed to update snapshot: %w", err)
+	}
+	return nil
+}
+
+type connRBDSnapshotBacking struct {
+	log       logr.Logger
+	conns     ceph.ConnAccessor
+	pool      string
+	namespace string
+}
+
+func (b *connRBDSnapshotBacking) SnapshotExists(imageName, snapName string) (bool, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(b.conns, b.pool, b.namespace)
+	if err != nil {
+		return false, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	exists, _, err := snapshotExistsAndProtected(b.log, ioCtx, imageName, snapName)
+	return exists, err
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// fakeSnapshotBacking holds the existing rbd snapshots as "image@snapshot".
+type fakeSnapshotBacking struct {
+	snapshots sets.Set[string]
+}
+
+func (b *fakeSnapshotBacking) SnapshotExists(imageName, snapName string) (bool, error) {
+	return b.snapshots.Has(imageName + "@" + snapName), nil
+}
+
+var _ = Describe("SnapshotVerifier", func() {
+	var (
+		backing   *fakeSnapshotBacking
+		snapshots *memoryStore[*providerapi.Snapshot]
+		v         *SnapshotVerifier
+	)
+
+	BeforeEach(func() {
+		backing = &fakeSnapshotBacking{snapshots: sets.New[string]()}
+		snapshots = newMemoryStore[*providerapi.Snapshot]()
+
+		var err error
+		v, err = NewSnapshotVerifier(logr.Discard(), ceph.StaticConn(&rados.Conn{}), snapshots, SnapshotVerifierOptions{Pool: "pool"})
+		Expect(err).NotTo(HaveOccurred())
+		v.backing = backing
+	})
+
+	createSnapshot := func(ctx SpecContext, id string, source providerapi.SnapshotSource, state providerapi.SnapshotState) {
+		GinkgoHelper()
+		_, err := snapshots.Create(ctx, &providerapi.Snapshot{
+			Metadata: apiutils.Metadata{ID: id},
+			Source:   source,
+			Status:   providerapi.SnapshotStatus{State: state, Digest: "sha256:abc", Size: 1024},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	expectState := func(ctx SpecContext, id string, state providerapi.SnapshotState) {
+		GinkgoHelper()
+		snapshot, err := snapshots.Get(ctx, id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.Status.State).To(Equal(state))
+	}
+
+	It("should keep snapshots whose rbd snapshot exists", func(ctx SpecContext) {
+		createSnapshot(ctx, "snap", providerapi.SnapshotSource{URL: "https://example.com/disk.raw"}, providerapi.SnapshotStateReady)
+		backing.snapshots.Insert(SnapshotIDToRBDID("snap") + "@" + ImageSnapshotVersion)
+
+		Expect(v.Verify(ctx)).To(Succeed())
+		expectState(ctx, "snap", providerapi.SnapshotStateReady)
+	})
+
+	It("should reset snapshots whose rbd image was removed to pending", func(ctx SpecContext) {
+		createSnapshot(ctx, "snap", providerapi.SnapshotSource{IronCoreImage: "example.com/image:latest"}, providerapi.SnapshotStateReady)
+		backing.snapshots.Insert(SnapshotIDToRBDID("snap") + "@" + ImageSnapshotVersion)
+		Expect(v.Verify(ctx)).To(Succeed())
+
+		By("removing the rbd image backing the snapshot")
+		backing.snapshots.Delete(SnapshotIDToRBDID("snap") + "@" + ImageSnapshotVersion)
+		Expect(v.Verify(ctx)).To(Succeed())
+
+		snapshot, err := snapshots.Get(ctx, "snap")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshot.Status.State).To(Equal(providerapi.SnapshotStatePending))
+		Expect(snapshot.Status.Digest).To(BeEmpty())
+		Expect(snapshot.Status.Size).To(BeZero())
+	})
+
+	It("should not verify snapshots of volume images, pending or failed snapshots", func(ctx SpecContext) {
+		createSnapshot(ctx, "volume", providerapi.SnapshotSource{VolumeImageID: "image"}, providerapi.SnapshotStateReady)
+		createSnapshot(ctx, "pending", providerapi.SnapshotSource{URL: "https://example.com/disk.raw"}, providerapi.SnapshotStatePending)
+		createSnapshot(ctx, "failed", providerapi.SnapshotSource{URL: "https://example.com/disk.raw"}, providerapi.SnapshotStateFailed)
+
+		Expect(v.Verify(ctx)).To(Succeed())
+		expectState(ctx, "volume", providerapi.SnapshotStateReady)
+		expectState(ctx, "pending", providerapi.SnapshotStatePending)
+		expectState(ctx, "failed", providerapi.SnapshotStateFailed)
+	})
+
+	It("should not verify snapshots while the maintenance mode is on", func(ctx SpecContext) {
+		v.maintenance = maintenance.NewMode(logr.Discard(), true)
+		createSnapshot(ctx, "snap", providerapi.SnapshotSource{URL: "https://example.com/disk.raw"}, providerapi.SnapshotStateReady)
+
+		Expect(v.Verify(ctx)).To(Succeed())
+		expectState(ctx, "snap", providerapi.SnapshotStateReady)
+	})
+
+	It("should reject a negative interval", func() {
+		_, err := NewSnapshotVerifier(logr.Discard(), ceph.StaticConn(&rados.Conn{}), snapshots, SnapshotVerifierOptions{Pool: "pool", Interval: -1})
+		Expect(err).To(MatchError(ContainSubstring("snapshot verify interval must not be negative")))
+	})
+})
@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultThickProvisionProgressInterval is the default interval the thick provisioning progress is reported in.
+	DefaultThickProvisionProgressInterval = 5 * time.Second
+
+	thickProvisionChunkSize = 4 * 1024 * 1024
+)
+
+// imageWriter is the subset of rbd image operations used to thick-provision an image.
+type imageWriter interface {
+	GetSize() (uint64, error)
+	WriteAt(data []byte, off int64) (int, error)
+}
+
+// writableImage is an rbd image opened to thick-provision it.
+type writableImage interface {
+	imageWriter
+	Close() error
+}
+
+// rbdImageWriter opens existing rbd images to write to them.
+type rbdImageWriter interface {
+	OpenImageWriter(pool, imageName string) (writableImage, error)
+}
+
+type connImageWriter struct {
+	conns     ceph.ConnAccessor
+	namespace string
+}
+
+func (o *connImageWriter) OpenImageWriter(pool, imageName string) (writableImage, error) {
+	ioCtx, release, err := ceph.OpenNamespacedIOContext(o.conns, pool, o.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+
+	img, err := librbd.OpenImage(ioCtx, imageName, librbd.NoSnapshot)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to open image %s: %w", imageName, err)
+	}
+	return &ioContextImage{Image: img, release: release}, nil
+}
+
+// thickProvisioning is the allocation of an image running in the background.
+type thickProvisioning struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	size    atomic.Uint64
+	written atomic.Uint64
+	// err is the result of the allocation, it is set once done is closed.
+	err error
+}
+
+func (p *thickProvisioning) progress() int32 {
+	return populateProgress(int64(p.written.Load()), p.size.Load())
+}
+
+// thickProvisionImage fully allocates a newly created empty image and reports whether it is allocated. The
+// allocation runs in the background, so that it neither blocks a worker nor the pool slot of the image. The image is
+// requeued while it is allocated, its reconciles record the progress and it stays pending until it is allocated. An
+// interrupted allocation starts over.
+func (r *ImageReconciler) thickProvisionImage(ctx context.Context, log logr.Logger, image *providerapi.Image) (bool, error) {
+	if !image.Spec.ThickProvision || image.Status.ThickProvisionProgress == 100 {
+		return true, nil
+	}
+	if image.Spec.SnapshotRef != nil || image.Spec.TemplateRef != nil {
+		log.V(1).Info("Thick provisioning is skipped for images cloned from a snapshot or template")
+		return true, nil
+	}
+
+	r.thickProvisionsMu.Lock()
+	p, ok := r.thickProvisions[image.ID]
+	if !ok {
+		r.thickProvisions[image.ID] = r.startThickProvisioning(ctx, log, image)
+		r.thickProvisionsMu.Unlock()
+		return false, nil
+	}
+	r.thickProvisionsMu.Unlock()
+
+	select {
+	case <-p.done:
+	default:
+		r.reportThickProvisionProgress(ctx, log, image, p.progress())
+		return false, nil
+	}
+
+	r.thickProvisionsMu.Lock()
+	delete(r.thickProvisions, image.ID)
+	r.thickProvisionsMu.Unlock()
+
+	if p.err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "ThickProvisionFailed", "Failed to thick-provision image: %s", p.err)
+		return false, p.err
+	}
+
+	// The completed progress is stored before the image is written to by the following steps, e.g. the encryption
+	// header, so that they are not overwritten by a retried allocation.
+	image.Status.ThickProvisionProgress = 100
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return false, fmt.Errorf("failed to update thick provisioning progress: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "ThickProvisionSucceeded", "Thick-provisioned image")
+	return true, nil
+}
+
+// startThickProvisioning starts allocating the image in the background. The allocation outlives the reconcile
+// starting it, it is cancelled by cancelThickProvisioning. r.thickProvisionsMu has to be held.
+func (r *ImageReconciler) startThickProvisioning(ctx context.Context, log logr.Logger, image *providerapi.Image) *thickProvisioning {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	p := &thickProvisioning{cancel: cancel, done: make(chan struct{})}
+	pool, rbdName := r.imagePool(image), RBDImageName(image)
+
+	go func() {
+		defer func() {
+			cancel()
+			close(p.done)
+			r.queue.Add(image.ID)
+		}()
+
+		img, err := r.rbdWriter.OpenImageWriter(pool, rbdName)
+		if err != nil {
+			p.err = err
+			return
+		}
+		defer func() {
+			if err := img.Close(); err != nil {
+				log.Error(err, "Failed to close image")
+			}
+		}()
+
+		p.err = r.allocateImage(ctx, log, img, image.ID, p)
+	}()
+	return p
+}
+
+// cancelThickProvisioning cancels the allocation of the image, if any, and waits for it to stop.
+func (r *ImageReconciler) cancelThickProvisioning(id string) {
+	r.thickProvisionsMu.Lock()
+	p, ok := r.thickProvisions[id]
+	delete(r.thickProvisions, id)
+	r.thickProvisionsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	p.cancel()
+	<-p.done
+}
+
+// stopThickProvisionings cancels all allocations and waits for them to stop.
+func (r *ImageReconciler) stopThickProvisionings() {
+	r.thickProvisionsMu.Lock()
+	ids := slices.Collect(maps.Keys(r.thickProvisions))
+	r.thickProvisionsMu.Unlock()
+
+	for _, id := range ids {
+		r.cancelThickProvisioning(id)
+	}
+}
+
+// allocateImage writes zeros across the whole image. Zeros are written instead of using write same, as librbd
+// turns zeroed write same requests into discards. The image is requeued in the progress interval, so that its
+// reconciles record the progress.
+func (r *ImageReconciler) allocateImage(ctx context.Context, log logr.Logger, img imageWriter, id string, p *thickProvisioning) error {
+	size, err := img.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get image size: %w", err)
+	}
+	p.size.Store(size)
+	log.Info("Thick-provisioning image", "bytes", size)
+
+	ticker := time.NewTicker(r.thickProvisionProgressInterval)
+	defer ticker.Stop()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				r.queue.Add(id)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = writeZeros(ctx, img, size, &p.written)
+	close(done)
+	wg.Wait()
+	if err != nil {
+		return fmt.Errorf("failed to thick-provision image: %w", err)
+	}
+	log.Info("Thick-provisioned image")
+	return nil
+}
+
+func writeZeros(ctx context.Context, img imageWriter, size uint64, written *atomic.Uint64) error {
+	zeros := make([]byte, min(size, thickProvisionChunkSize))
+	for off := uint64(0); off < size; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := img.WriteAt(zeros[:min(size-off, uint64(len(zeros)))], int64(off))
+		if err != nil {
+			return fmt.Errorf("failed to write at offset %d: %w", off, err)
+		}
+		if n == 0 {
+			return fmt.Errorf("failed to write at offset %d: no bytes written", off)
+		}
+		off += uint64(n)
+		written.Store(off)
+	}
+	return nil
+}
+
+func (r *ImageReconciler) reportThickProvisionProgress(ctx context.Context, log logr.Logger, image *providerapi.Image, progress int32) {
+	if image.Status.ThickProvisionProgress == progress {
+		return
+	}
+
+	image.Status.ThickProvisionProgress = progress
+	if _, err := r.images.Update(ctx, image); err != nil {
+		log.Error(err, "Failed to update thick provisioning progress", "progress", progress)
+	}
+}
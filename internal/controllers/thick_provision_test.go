@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+type fakeImageWriter struct {
+	size  uint64
+	delay time.Duration
+
+	mu        sync.Mutex
+	allocated uint64
+	nonZero   bool
+}
+
+func (w *fakeImageWriter) GetSize() (uint64, error) {
+	return w.size, nil
+}
+
+func (w *fakeImageWriter) WriteAt(data []byte, off int64) (int, error) {
+	time.Sleep(w.delay)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	Expect(uint64(off)).To(Equal(w.allocated), "writes must be contiguous")
+	for _, b := range data {
+		if b != 0 {
+			w.nonZero = true
+		}
+	}
+	w.allocated += uint64(len(data))
+	return len(data), nil
+}
+
+func (w *fakeImageWriter) Close() error {
+	return nil
+}
+
+func (w *fakeImageWriter) Allocated() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.allocated
+}
+
+type fakeImageWriterOpener struct {
+	img *fakeImageWriter
+	err error
+}
+
+func (o *fakeImageWriterOpener) OpenImageWriter(pool, imageName string) (writableImage, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	return o.img, nil
+}
+
+var _ = Describe("thick provisioning", func() {
+	const size = 10*thickProvisionChunkSize + 1024
+
+	var (
+		r      *ImageReconciler
+		opener *fakeImageWriterOpener
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{ThickProvisionProgressInterval: time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.queue.ShutDown)
+		DeferCleanup(r.stopThickProvisionings)
+		opener = &fakeImageWriterOpener{img: &fakeImageWriter{size: size}}
+		r.rbdWriter = opener
+
+		_, err = r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{Size: size, ThickProvision: true},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	thickProvision := func(ctx context.Context) (bool, error) {
+		image, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		return r.thickProvisionImage(ctx, logr.Discard(), image)
+	}
+
+	allocationDone := func() bool {
+		r.thickProvisionsMu.Lock()
+		p := r.thickProvisions["foo"]
+		r.thickProvisionsMu.Unlock()
+		Expect(p).NotTo(BeNil())
+		select {
+		case <-p.done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	It("should allocate an empty thick image in the background", func(ctx SpecContext) {
+		Expect(thickProvision(ctx)).To(BeFalse())
+		Eventually(allocationDone).Should(BeTrue())
+		Expect(opener.img.Allocated()).To(Equal(uint64(size)))
+		Expect(opener.img.nonZero).To(BeFalse())
+		Expect(r.queue.Len()).NotTo(BeZero(), "the image must be requeued once allocated")
+
+		Expect(thickProvision(ctx)).To(BeTrue())
+		stored, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Status.ThickProvisionProgress).To(Equal(int32(100)))
+		Expect(stored.Status.State).To(Equal(providerapi.ImageStatePending))
+		Expect(r.thickProvisions).To(BeEmpty())
+	})
+
+	It("should record the allocation progress", func(ctx SpecContext) {
+		opener.img.delay = 5 * time.Millisecond
+
+		Expect(thickProvision(ctx)).To(BeFalse())
+		Eventually(func(g Gomega) {
+			g.Expect(thickProvision(ctx)).To(BeFalse())
+			stored, err := r.images.Get(ctx, "foo")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(stored.Status.ThickProvisionProgress).To(SatisfyAll(BeNumerically(">", 0), BeNumerically("<", 100)))
+		}).Should(Succeed())
+	})
+
+	It("should report a failed allocation and start over", func(ctx SpecContext) {
+		opener.err = errors.New("image busy")
+
+		Expect(thickProvision(ctx)).To(BeFalse())
+		Eventually(allocationDone).Should(BeTrue())
+		_, err := thickProvision(ctx)
+		Expect(err).To(MatchError(ContainSubstring("image busy")))
+
+		opener.err = nil
+		Expect(thickProvision(ctx)).To(BeFalse())
+		Eventually(allocationDone).Should(BeTrue())
+		Expect(thickProvision(ctx)).To(BeTrue())
+	})
+
+	It("should stop allocating once cancelled", func(ctx SpecContext) {
+		opener.img.delay = 5 * time.Millisecond
+
+		Expect(thickProvision(ctx)).To(BeFalse())
+		r.cancelThickProvisioning("foo")
+		Expect(opener.img.Allocated()).To(BeNumerically("<", uint64(size)))
+		Expect(r.thickProvisions).To(BeEmpty())
+	})
+
+	It("should skip images cloned from a snapshot", func(ctx SpecContext) {
+		image, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		image.Spec.SnapshotRef = ptr.To("snap")
+
+		Expect(r.thickProvisionImage(ctx, logr.Discard(), image)).To(BeTrue())
+		Expect(r.thickProvisions).To(BeEmpty())
+	})
+
+	It("should skip images cloned from a template", func(ctx SpecContext) {
+		image, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		image.Spec.TemplateRef = ptr.To("template")
+
+		Expect(r.thickProvisionImage(ctx, logr.Discard(), image)).To(BeTrue())
+		Expect(r.thickProvisions).To(BeEmpty())
+	})
+
+	It("should not allocate an image again", func(ctx SpecContext) {
+		image, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		image.Status.ThickProvisionProgress = 100
+
+		Expect(r.thickProvisionImage(ctx, logr.Discard(), image)).To(BeTrue())
+		Expect(r.thickProvisions).To(BeEmpty())
+	})
+})
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of the reconcilers.
+const tracerName = "github.com/ironcore-dev/ceph-provider/internal/controllers"
+
+// Span attribute keys of the image reconcile spans.
+const (
+	imageIDAttribute    = attribute.Key("image.id")
+	imagePoolAttribute  = attribute.Key("image.pool")
+	imageStateAttribute = attribute.Key("image.state")
+)
+
+// imageSpanAttributes returns the span attributes of the image. The state is the one the span started with.
+func (r *ImageReconciler) imageSpanAttributes(img *providerapi.Image) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		imageIDAttribute.String(img.ID),
+		imagePoolAttribute.String(r.imagePool(img)),
+		imageStateAttribute.String(string(img.Status.State)),
+	}
+}
+
+// startSpan starts a child span of the span in ctx. The spans are no-ops without a configured tracer provider.
+func (r *ImageReconciler) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the error of the traced operation, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		r        *ImageReconciler
+		exporter *tracetest.InMemoryExporter
+	)
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		DeferCleanup(provider.Shutdown)
+
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{TracerProvider: provider})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	spanNamed := func(name string) tracetest.SpanStub {
+		for _, span := range exporter.GetSpans() {
+			if span.Name == name {
+				return span
+			}
+		}
+		Fail("no span named " + name)
+		return tracetest.SpanStub{}
+	}
+
+	It("should trace the snapshot reconcile as child of the image reconcile", func(ctx SpecContext) {
+		r.registry = unauthorizedImageResolver{}
+		_, err := r.images.Create(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{ImageFinalizer}},
+			Spec:     providerapi.ImageSpec{Size: 1024, Image: "registry.example.com/private:latest"},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStatePending},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.reconcileImageWithIOContext(ctx, nil, "foo")).To(MatchError(ErrImageUnauthorized))
+
+		Expect(exporter.GetSpans()).To(HaveLen(2))
+		reconcileImage := spanNamed("reconcileImage")
+		reconcileSnapshot := spanNamed("reconcileSnapshot")
+
+		Expect(reconcileImage.Parent.IsValid()).To(BeFalse())
+		Expect(reconcileSnapshot.Parent.SpanID()).To(Equal(reconcileImage.SpanContext.SpanID()))
+		Expect(reconcileSnapshot.SpanContext.TraceID()).To(Equal(reconcileImage.SpanContext.TraceID()))
+
+		Expect(reconcileImage.Attributes).To(ContainElements(
+			attribute.String("image.id", "foo"),
+			attribute.String("image.pool", "pool"),
+			attribute.String("image.state", string(providerapi.ImageStatePending)),
+		))
+		Expect(reconcileImage.Status.Code).To(Equal(codes.Error))
+		Expect(reconcileSnapshot.Status.Code).To(Equal(codes.Error))
+	})
+
+	It("should trace fetching the credentials", func(ctx SpecContext) {
+		r.cephClient = &fakeCephClient{response: []byte(`{"key":"secret"}`)}
+
+		parentCtx, span := r.startSpan(ctx, "parent")
+		_, _, err := r.fetchAuth(parentCtx, logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		span.End()
+
+		fetchAuth := spanNamed("fetchAuth")
+		Expect(fetchAuth.Parent.SpanID()).To(Equal(spanNamed("parent").SpanContext.SpanID()))
+		Expect(fetchAuth.Status.Code).To(Equal(codes.Unset))
+	})
+
+	It("should not record spans without a configured tracer provider", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, span := r.startSpan(ctx, "reconcileImage")
+		Expect(span.IsRecording()).To(BeFalse())
+		span.End()
+	})
+})
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+)
+
+const maxWWNAttempts = 5
+
+// wwnInUse reports whether another image was assigned or requested the given WWN.
+func (r *ImageReconciler) wwnInUse(ctx context.Context, imageID, wwn string) (bool, error) {
+	images, err := r.images.List(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	for _, img := range images {
+		if img.ID != imageID && img.GetWWN() == wwn {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// assignWWN persists the WWN of the image in its status, so it stays stable across reconciles.
+// A requested WWN already used by another image is regenerated as long as the image is not available yet.
+// Assignments are serialized, so that concurrent reconciles cannot assign the same WWN.
+func (r *ImageReconciler) assignWWN(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
+	if img.Status.WWN != "" {
+		return nil
+	}
+
+	r.wwnMu.Lock()
+	defer r.wwnMu.Unlock()
+
+	wwn := img.Spec.WWN
+	for attempt := 1; ; attempt++ {
+		if wwn == "" {
+			wwn = r.wwnGen.Generate()
+		}
+
+		inUse, err := r.wwnInUse(ctx, img.ID, wwn)
+		if err != nil {
+			return err
+		}
+		if !inUse {
+			break
+		}
+
+		// The WWN of an available image has already been handed out and must not change.
+		if img.Status.State == providerapi.ImageStateAvailable {
+			log.Info("WWN of available image is also used by another image", "WWN", wwn)
+			break
+		}
+
+		if attempt == maxWWNAttempts {
+			return fmt.Errorf("failed to generate a unique wwn after %d attempts", maxWWNAttempts)
+		}
+		log.V(1).Info("WWN already in use, regenerating", "WWN", wwn)
+		wwn = ""
+	}
+
+	img.Status.WWN = wwn
+	if _, err := r.images.Update(ctx, img); err != nil {
+		return fmt.Errorf("failed to persist wwn: %w", err)
+	}
+	log.V(2).Info("Assigned wwn", "WWN", wwn)
+	return nil
+}
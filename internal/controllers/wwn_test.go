@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type sequenceIDGen struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (g *sequenceIDGen) Generate() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id
+}
+
+// rendezvousListStore delays returning the result of every List until n Lists were issued or a timeout passed.
+type rendezvousListStore struct {
+	store.Store[*providerapi.Image]
+	n       int32
+	arrived atomic.Int32
+}
+
+func (s *rendezvousListStore) List(ctx context.Context) ([]*providerapi.Image, error) {
+	images, err := s.Store.List(ctx)
+	s.arrived.Add(1)
+	timeout := time.After(100 * time.Millisecond)
+	for s.arrived.Load() < s.n {
+		select {
+		case <-timeout:
+			return images, err
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return images, err
+}
+
+var _ = Describe("assignWWN", func() {
+	var (
+		r     *ImageReconciler
+		idGen *sequenceIDGen
+	)
+
+	BeforeEach(func() {
+		idGen = &sequenceIDGen{}
+		var err error
+		r, err = newTestImageReconciler(ImageReconcilerOptions{WWNGen: idGen})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	createImage := func(ctx SpecContext, img *providerapi.Image) *providerapi.Image {
+		img, err := r.images.Create(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+		return img
+	}
+
+	It("should persist the requested wwn and keep it stable", func(ctx SpecContext) {
+		img := createImage(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}, Spec: providerapi.ImageSpec{WWN: "wwn-1"}})
+
+		Expect(r.assignWWN(ctx, logr.Discard(), img)).To(Succeed())
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.WWN", "wwn-1"))
+
+		img, err := r.images.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		img.Spec.WWN = "wwn-2"
+		Expect(r.assignWWN(ctx, logr.Discard(), img)).To(Succeed())
+		Expect(img.GetWWN()).To(Equal("wwn-1"))
+	})
+
+	It("should regenerate a wwn already used by another image", func(ctx SpecContext) {
+		createImage(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "bar"}, Status: providerapi.ImageStatus{WWN: "wwn-1"}})
+		img := createImage(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}, Spec: providerapi.ImageSpec{WWN: "wwn-1"}})
+		idGen.ids = []string{"wwn-1", "wwn-2"}
+
+		Expect(r.assignWWN(ctx, logr.Discard(), img)).To(Succeed())
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.WWN", "wwn-2"))
+	})
+
+	It("should fail if no unique wwn can be generated", func(ctx SpecContext) {
+		createImage(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "bar"}, Spec: providerapi.ImageSpec{WWN: "wwn-1"}})
+		img := createImage(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo"}, Spec: providerapi.ImageSpec{WWN: "wwn-1"}})
+		idGen.ids = []string{"wwn-1", "wwn-1", "wwn-1", "wwn-1"}
+
+		Expect(r.assignWWN(ctx, logr.Discard(), img)).To(HaveOccurred())
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.WWN", BeEmpty()))
+	})
+
+	It("should not change the wwn of an available image", func(ctx SpecContext) {
+		createImage(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "bar"}, Status: providerapi.ImageStatus{WWN: "wwn-1"}})
+		img := createImage(ctx, &providerapi.Image{
+			Metadata: apiutils.Metadata{ID: "foo"},
+			Spec:     providerapi.ImageSpec{WWN: "wwn-1"},
+			Status:   providerapi.ImageStatus{State: providerapi.ImageStateAvailable},
+		})
+
+		Expect(r.assignWWN(ctx, logr.Discard(), img)).To(Succeed())
+		Expect(r.images.Get(ctx, "foo")).To(HaveField("Status.WWN", "wwn-1"))
+	})
+
+	It("should assign distinct wwns to images reconciled concurrently", func(ctx SpecContext) {
+		// The first n generated wwns are the same, so that every image first tries the shared wwn. n is below
+		// maxWWNAttempts, so that serialized assignments are able to skip all of them.
+		const n = 4
+		ids := make([]string, 0, 2*n)
+		for range n {
+			ids = append(ids, "wwn-shared")
+		}
+		for i := range n {
+			ids = append(ids, fmt.Sprintf("wwn-%d", i))
+		}
+		idGen.ids = ids
+
+		// Lists wait for each other, so that unserialized assignments would all see the shared wwn unused.
+		r.images = &rendezvousListStore{Store: r.images, n: n}
+
+		var wg sync.WaitGroup
+		for i := range n {
+			img := createImage(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: fmt.Sprintf("img-%d", i)}})
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(r.assignWWN(ctx, logr.Discard(), img)).To(Succeed())
+			}()
+		}
+		wg.Wait()
+
+		images, err := r.images.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		wwns := make(map[string]string)
+		for _, img := range images {
+			Expect(img.Status.WWN).NotTo(BeEmpty())
+			Expect(wwns).NotTo(HaveKey(img.Status.WWN), "wwn %s assigned to %s and %s", img.Status.WWN, wwns[img.Status.WWN], img.ID)
+			wwns[img.Status.WWN] = img.ID
+		}
+	})
+
+	It("should assign stable wwns with a seeded generator", func(ctx SpecContext) {
+		r, err := newTestImageReconciler(ImageReconcilerOptions{WWNGen: strategy.NewSeededWWNGen(42)})
+		Expect(err).NotTo(HaveOccurred())
+		expected := strategy.NewSeededWWNGen(42)
+
+		for _, id := range []string{"foo", "bar"} {
+			img, err := r.images.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: id}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r.assignWWN(ctx, logr.Discard(), img)).To(Succeed())
+			Expect(r.images.Get(ctx, id)).To(HaveField("Status.WWN", expected.Generate()))
+		}
+	})
+})
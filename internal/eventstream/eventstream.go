@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package eventstream streams the events of an event source to consumers outside of its handlers, e.g. components
+// observing the changes of images and snapshots. The volume provider does not stream events itself, the package is
+// meant for tooling embedding the reconcilers, like the library APIs of package controllers.
+package eventstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+)
+
+// DefaultBufferSize is the default number of events buffered for a consumer.
+const DefaultBufferSize = 100
+
+// ErrOverflow is returned by Watch.Err if the consumer fell behind by more than the buffer size. The consumer has to
+// watch again to observe further events, e.g. replaying the current objects to resync.
+var ErrOverflow = errors.New("event stream buffer overflowed")
+
+type Options struct {
+	// BufferSize is the number of events buffered for the consumer. Defaults to DefaultBufferSize.
+	BufferSize int
+}
+
+func setOptionsDefaults(o *Options) {
+	if o.BufferSize == 0 {
+		o.BufferSize = DefaultBufferSize
+	}
+}
+
+// Watch is a stream of the events of a source to a single consumer. Events are delivered in the order of the source.
+// The source is never blocked by the consumer: consumers that fall behind by more than the buffer size are dropped
+// instead, so that a slow consumer doesn't stall the reconcilers sharing the source.
+type Watch[E api.Object] struct {
+	events chan event.Event[E]
+	stop   chan struct{}
+	// stopped is closed once the handler was removed from the source.
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// New registers a watch of the events of the source. The watch is stopped once the context is done.
+func New[E api.Object](ctx context.Context, source event.Source[E], opts Options) (*Watch[E], error) {
+	if source == nil {
+		return nil, fmt.Errorf("must specify source")
+	}
+
+	if opts.BufferSize < 0 {
+		return nil, fmt.Errorf("buffer size must not be negative, got %d", opts.BufferSize)
+	}
+
+	setOptionsDefaults(&opts)
+
+	w := &Watch[E]{
+		events:  make(chan event.Event[E], opts.BufferSize),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	reg, err := source.AddHandler(event.HandlerFunc[E](w.handle))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add handler: %w", err)
+	}
+
+	// The handler is removed outside of handle, as sources may not allow removing handlers while delivering events.
+	go func() {
+		defer close(w.stopped)
+		select {
+		case <-ctx.Done():
+			w.close(ctx.Err())
+		case <-w.stop:
+		}
+		_ = source.RemoveHandler(reg)
+	}()
+
+	return w, nil
+}
+
+// Events returns the events of the source. The channel is closed once the watch is stopped, Err tells why.
+func (w *Watch[E]) Events() <-chan event.Event[E] {
+	return w.events
+}
+
+// Err returns why the watch was stopped: the error of its context, ErrOverflow, or nil if it was stopped via Stop or
+// is still running.
+func (w *Watch[E]) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Stop stops the watch and waits until its handler was removed from the source.
+func (w *Watch[E]) Stop() {
+	w.close(nil)
+	<-w.stopped
+}
+
+func (w *Watch[E]) handle(evt event.Event[E]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	select {
+	case w.events <- evt:
+	default:
+		w.closeLocked(ErrOverflow)
+	}
+}
+
+func (w *Watch[E]) close(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeLocked(err)
+}
+
+func (w *Watch[E]) closeLocked(err error) {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.err = err
+	close(w.events)
+	close(w.stop)
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package eventstream_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/ironcore-dev/ceph-provider/internal/eventstream"
+	"github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/goleak"
+)
+
+type object struct {
+	api.Metadata
+}
+
+type fakeSource struct {
+	mu       sync.Mutex
+	handlers map[int]event.Handler[*object]
+	next     int
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{handlers: map[int]event.Handler[*object]{}}
+}
+
+func (s *fakeSource) AddHandler(handler event.Handler[*object]) (event.HandlerRegistration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	s.handlers[s.next] = handler
+	return s.next, nil
+}
+
+func (s *fakeSource) RemoveHandler(registration event.HandlerRegistration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.handlers, registration.(int))
+	return nil
+}
+
+func (s *fakeSource) numHandlers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.handlers)
+}
+
+func (s *fakeSource) emit(evtType event.Type, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, handler := range s.handlers {
+		handler.Handle(event.Event[*object]{Type: evtType, Object: &object{Metadata: api.Metadata{ID: id}}})
+	}
+}
+
+var _ = Describe("Watch", func() {
+	It("should reject a negative buffer size", func(ctx SpecContext) {
+		_, err := eventstream.New[*object](ctx, newFakeSource(), eventstream.Options{BufferSize: -1})
+		Expect(err).To(MatchError(ContainSubstring("buffer size must not be negative")))
+	})
+
+	It("should deliver the events in order and clean up once the context is done", func(ctx SpecContext) {
+		ignoreCurrent := goleak.IgnoreCurrent()
+		source := newFakeSource()
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		w, err := eventstream.New[*object](watchCtx, source, eventstream.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(source.numHandlers()).To(Equal(1))
+
+		var ids []string
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for evt := range w.Events() {
+				ids = append(ids, evt.Object.ID)
+			}
+		}()
+
+		var expected []string
+		for i := range 3 * eventstream.DefaultBufferSize {
+			id := strconv.Itoa(i)
+			expected = append(expected, id)
+			Eventually(func() int { return len(w.Events()) }).Should(BeNumerically("<", eventstream.DefaultBufferSize))
+			source.emit(event.TypeUpdated, id)
+		}
+		Eventually(func() int { return len(w.Events()) }).Should(BeZero())
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(ids).To(Equal(expected))
+		Expect(w.Err()).To(MatchError(context.Canceled))
+		Eventually(source.numHandlers).Should(BeZero())
+		Expect(goleak.Find(ignoreCurrent)).To(Succeed())
+	})
+
+	It("should drop a consumer that falls behind by more than the buffer size", func(ctx SpecContext) {
+		source := newFakeSource()
+		w, err := eventstream.New[*object](ctx, source, eventstream.Options{BufferSize: 2})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, id := range []string{"foo", "bar", "baz"} {
+			source.emit(event.TypeCreated, id)
+		}
+
+		var ids []string
+		for evt := range w.Events() {
+			ids = append(ids, evt.Object.ID)
+		}
+		Expect(ids).To(Equal([]string{"foo", "bar"}))
+		Expect(w.Err()).To(MatchError(eventstream.ErrOverflow))
+		Eventually(source.numHandlers).Should(BeZero())
+	})
+
+	It("should remove the handler when stopped", func(ctx SpecContext) {
+		source := newFakeSource()
+		w, err := eventstream.New[*object](ctx, source, eventstream.Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		w.Stop()
+		Expect(source.numHandlers()).To(BeZero())
+		Expect(w.Err()).NotTo(HaveOccurred())
+		Eventually(w.Events()).Should(BeClosed())
+	})
+})
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultTimeout  = 5 * time.Second
+)
+
+var ErrNotChecked = errors.New("ceph connectivity not checked yet")
+
+// Conn is the part of the rados connection used to check the ceph connectivity.
+type Conn interface {
+	MonCommand(args []byte) ([]byte, string, error)
+}
+
+type Options struct {
+	// Interval is the interval the ceph connectivity is checked in.
+	Interval time.Duration
+	// Timeout is the time a single check may take before the connection is considered unhealthy.
+	Timeout time.Duration
+}
+
+func setOptionsDefaults(o *Options) {
+	if o.Interval == 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+}
+
+// Checker periodically checks the ceph connectivity by running a cheap mon command.
+type Checker struct {
+	log  logr.Logger
+	conn Conn
+
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.RWMutex
+	lastErr error
+}
+
+func NewChecker(log logr.Logger, conn Conn, opts Options) (*Checker, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("must specify conn")
+	}
+
+	setOptionsDefaults(&opts)
+
+	return &Checker{
+		log:      log,
+		conn:     conn,
+		interval: opts.Interval,
+		timeout:  opts.Timeout,
+		lastErr:  ErrNotChecked,
+	}, nil
+}
+
+// Start checks the ceph connectivity every interval until ctx is done.
+func (c *Checker) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, c.Check, c.interval)
+}
+
+// Check checks the ceph connectivity once and records the result.
+func (c *Checker) Check(ctx context.Context) {
+	err := c.check(ctx)
+	if err != nil {
+		c.log.Error(err, "Ceph connectivity check failed")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+}
+
+func (c *Checker) check(ctx context.Context) error {
+	cmd, err := json.Marshal(map[string]string{
+		"prefix": "fsid",
+		"format": "json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	// MonCommand can't be cancelled, so it is abandoned once the timeout is exceeded.
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := c.conn.MonCommand(cmd)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to run mon command: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to run mon command: %w", ctx.Err())
+	}
+}
+
+// Err returns the result of the last check.
+func (c *Checker) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastErr
+}
+
+// ReadyHandler responds with 503 if the last check failed.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := c.Err(); err != nil {
+			http.Error(w, fmt.Sprintf("ceph unreachable: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprint(w, "ok")
+	})
+}
+
+// LivenessHandler always responds with 200 as a failing ceph connection is no reason to restart.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprint(w, "ok")
+	})
+}
+
+// NewServeMux serves the liveness handler at /healthz and the ready handler of the checker at /readyz.
+func NewServeMux(checker *Checker) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", LivenessHandler())
+	mux.Handle("/readyz", checker.ReadyHandler())
+	return mux
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package health_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/ironcore-dev/ceph-provider/internal/health"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeConn struct {
+	healthy atomic.Bool
+	delay   time.Duration
+}
+
+func (c *fakeConn) MonCommand(args []byte) ([]byte, string, error) {
+	time.Sleep(c.delay)
+	if !c.healthy.Load() {
+		return nil, "", errors.New("connection lost")
+	}
+	return []byte(`{"fsid":"foo"}`), "", nil
+}
+
+var _ = Describe("Checker", func() {
+	var (
+		conn    *fakeConn
+		checker *Checker
+		mux     *http.ServeMux
+	)
+
+	BeforeEach(func() {
+		conn = &fakeConn{}
+		var err error
+		checker, err = NewChecker(logr.Discard(), conn, Options{Timeout: 50 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		mux = NewServeMux(checker)
+	})
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	It("should not be ready before the first check", func() {
+		Expect(get("/readyz")).To(Equal(http.StatusServiceUnavailable))
+		Expect(get("/healthz")).To(Equal(http.StatusOK))
+	})
+
+	It("should flip readiness with the ceph connectivity while staying alive", func(ctx SpecContext) {
+		conn.healthy.Store(true)
+		checker.Check(ctx)
+		Expect(checker.Err()).NotTo(HaveOccurred())
+		Expect(get("/readyz")).To(Equal(http.StatusOK))
+
+		conn.healthy.Store(false)
+		checker.Check(ctx)
+		Expect(checker.Err()).To(MatchError(ContainSubstring("connection lost")))
+		Expect(get("/readyz")).To(Equal(http.StatusServiceUnavailable))
+		Expect(get("/healthz")).To(Equal(http.StatusOK))
+
+		conn.healthy.Store(true)
+		checker.Check(ctx)
+		Expect(get("/readyz")).To(Equal(http.StatusOK))
+	})
+
+	It("should consider a hanging mon command unhealthy", func(ctx SpecContext) {
+		conn.healthy.Store(true)
+		conn.delay = time.Second
+		checker.Check(ctx)
+		Expect(checker.Err()).To(MatchError(ContainSubstring("deadline exceeded")))
+		Expect(get("/readyz")).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should check periodically when started", func(ctx SpecContext) {
+		checker, err := NewChecker(logr.Discard(), conn, Options{Interval: 10 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		conn.healthy.Store(true)
+
+		go checker.Start(ctx)
+		Eventually(checker.Err).ShouldNot(HaveOccurred())
+
+		conn.healthy.Store(false)
+		Eventually(checker.Err).Should(HaveOccurred())
+	})
+})
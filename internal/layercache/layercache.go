@@ -0,0 +1,382 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package layercache caches the content of OCI layers on disk, keyed by their digest.
+package layercache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMaxSize is the default total size of the cached layers in bytes.
+const DefaultMaxSize = 10 << 30
+
+// tmpDirName is the directory layers are written to until their digest is verified.
+const tmpDirName = "tmp"
+
+// ErrDigestMismatch is returned once the content of a layer was read completely if it doesn't match its digest.
+var ErrDigestMismatch = errors.New("layer content does not match its digest")
+
+type Options struct {
+	// Dir is the directory the layers are cached in.
+	Dir string
+	// MaxSize is the total size of the cached layers in bytes, the least recently used layers are evicted beyond it.
+	// Defaults to DefaultMaxSize.
+	MaxSize int64
+}
+
+func setOptionsDefaults(o *Options) {
+	if o.MaxSize == 0 {
+		o.MaxSize = DefaultMaxSize
+	}
+}
+
+// Cache caches the content of layers on disk. Cached layers are evicted least recently used first once the cached
+// layers exceed the max size. Layers are only added to the cache once their content was read completely and matches
+// their digest.
+type Cache struct {
+	log     logr.Logger
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+	// entries are the elements of the cached layers in lru, keyed by digest.
+	entries map[digest.Digest]*list.Element
+	// lru orders the cached layers from the most to the least recently used.
+	lru  *list.List
+	size int64
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+// entry is a cached layer.
+type entry struct {
+	digest digest.Digest
+	size   int64
+}
+
+func New(log logr.Logger, opts Options) (*Cache, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("must specify dir")
+	}
+
+	if opts.MaxSize < 0 {
+		return nil, fmt.Errorf("max size must not be negative, got %d", opts.MaxSize)
+	}
+
+	setOptionsDefaults(&opts)
+
+	c := &Cache{
+		log:     log,
+		dir:     opts.Dir,
+		maxSize: opts.MaxSize,
+		entries: make(map[digest.Digest]*list.Element),
+		lru:     list.New(),
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cephlet_layer_cache_hits_total",
+			Help: "Number of layers read from the layer cache.",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cephlet_layer_cache_misses_total",
+			Help: "Number of layers fetched because they were not in the layer cache.",
+		}),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Collectors returns the metrics of the cache: the hits, the misses and the size of the cached layers.
+func (c *Cache) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.hits,
+		c.misses,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "cephlet_layer_cache_size_bytes",
+			Help: "Total size of the cached layers.",
+		}, func() float64 { return float64(c.Size()) }),
+	}
+}
+
+// Size returns the total size of the cached layers in bytes.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Open returns the content of the layer with the digest. The content is read from the cache if the layer is cached,
+// otherwise it is fetched and added to the cache once it was read completely. Reading the content fails with
+// ErrDigestMismatch at its end if it doesn't match the digest.
+func (c *Cache) Open(dgst digest.Digest, fetch func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid layer digest: %w", err)
+	}
+
+	if rc, ok := c.openCached(dgst); ok {
+		c.hits.Inc()
+		return rc, nil
+	}
+	c.misses.Inc()
+
+	rc, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(c.dir, tmpDirName), "layer-*")
+	if err != nil {
+		c.log.Error(err, "Failed to create temporary layer file, not caching layer", "Digest", dgst)
+		return &verifyingReader{ReadCloser: rc, verifier: dgst.Verifier()}, nil
+	}
+	return &cachingReader{
+		verifyingReader: verifyingReader{ReadCloser: rc, verifier: dgst.Verifier()},
+		c:               c,
+		digest:          dgst,
+		tmp:             tmp,
+	}, nil
+}
+
+func (c *Cache) path(dgst digest.Digest) string {
+	return filepath.Join(c.dir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// openCached opens the cached content of the layer and marks it as most recently used.
+func (c *Cache) openCached(dgst digest.Digest) (io.ReadCloser, bool) {
+	c.mu.Lock()
+	elem, ok := c.entries[dgst]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	path := c.path(dgst)
+	f, err := os.Open(path)
+	if err != nil {
+		c.log.Error(err, "Failed to open cached layer, fetching it", "Digest", dgst)
+		c.evict(dgst)
+		return nil, false
+	}
+	// The modification time orders the cached layers when they are loaded again.
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		c.log.V(1).Info("Failed to touch cached layer", "Digest", dgst, "Error", err)
+	}
+
+	return &verifyingReader{
+		ReadCloser: f,
+		verifier:   dgst.Verifier(),
+		onMismatch: func() { c.evict(dgst) },
+	}, true
+}
+
+// add moves the verified content of the layer into the cache and evicts the least recently used layers beyond the
+// max size. Layers larger than the max size are not cached.
+func (c *Cache) add(dgst digest.Digest, tmpPath string, size int64) error {
+	if size > c.maxSize {
+		return os.Remove(tmpPath)
+	}
+
+	path := c.path(dgst)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[dgst]; ok {
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+	c.entries[dgst] = c.lru.PushFront(&entry{digest: dgst, size: size})
+	c.size += size
+	c.evictLocked()
+	return nil
+}
+
+// evictLocked evicts the least recently used layers until the cached layers fit the max size.
+func (c *Cache) evictLocked() {
+	for c.size > c.maxSize {
+		e := c.lru.Back().Value.(*entry)
+		c.removeLocked(e.digest)
+		if err := os.Remove(c.path(e.digest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.log.Error(err, "Failed to remove evicted layer", "Digest", e.digest)
+		}
+		c.log.V(1).Info("Evicted layer", "Digest", e.digest, "Size", e.size)
+	}
+}
+
+// evict removes the layer from the cache.
+func (c *Cache) evict(dgst digest.Digest) {
+	c.mu.Lock()
+	c.removeLocked(dgst)
+	c.mu.Unlock()
+
+	if err := os.Remove(c.path(dgst)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.log.Error(err, "Failed to remove layer", "Digest", dgst)
+	}
+}
+
+func (c *Cache) removeLocked(dgst digest.Digest) {
+	elem, ok := c.entries[dgst]
+	if !ok {
+		return
+	}
+	delete(c.entries, dgst)
+	c.lru.Remove(elem)
+	c.size -= elem.Value.(*entry).size
+}
+
+// load indexes the layers cached by a previous run, ordered by their modification time, and removes leftover
+// temporary files.
+func (c *Cache) load() error {
+	tmpDir := filepath.Join(c.dir, tmpDirName)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return fmt.Errorf("failed to remove temporary layer files: %w", err)
+	}
+	if err := os.MkdirAll(tmpDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create layer cache dir: %w", err)
+	}
+
+	type cachedLayer struct {
+		entry
+		modTime time.Time
+	}
+	var layers []cachedLayer
+	for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA384, digest.SHA512} {
+		files, err := os.ReadDir(filepath.Join(c.dir, algorithm.String()))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to list cached layers: %w", err)
+		}
+
+		for _, file := range files {
+			dgst := digest.NewDigestFromEncoded(algorithm, file.Name())
+			info, err := file.Info()
+			if err != nil || dgst.Validate() != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			layers = append(layers, cachedLayer{entry: entry{digest: dgst, size: info.Size()}, modTime: info.ModTime()})
+		}
+	}
+
+	slices.SortFunc(layers, func(a, b cachedLayer) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, layer := range layers {
+		e := layer.entry
+		c.entries[e.digest] = c.lru.PushFront(&e)
+		c.size += e.size
+	}
+	c.evictLocked()
+	return nil
+}
+
+// verifyingReader verifies the content read against its digest once it was read completely.
+type verifyingReader struct {
+	io.ReadCloser
+	verifier digest.Verifier
+	// onMismatch is called if the content doesn't match its digest.
+	onMismatch func()
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	_, _ = r.verifier.Write(p[:n])
+	if errors.Is(err, io.EOF) && !r.verifier.Verified() {
+		if r.onMismatch != nil {
+			r.onMismatch()
+		}
+		return n, ErrDigestMismatch
+	}
+	return n, err
+}
+
+// cachingReader writes the fetched content of a layer to a temporary file, which is added to the cache once the
+// content was read completely and verified.
+type cachingReader struct {
+	verifyingReader
+	c      *Cache
+	digest digest.Digest
+	tmp    *os.File
+	size   int64
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.verifyingReader.Read(p)
+	if r.tmp != nil && n > 0 {
+		if _, werr := r.tmp.Write(p[:n]); werr != nil {
+			r.c.log.Error(werr, "Failed to write layer to cache, not caching layer", "Digest", r.digest)
+			r.discard()
+		}
+		r.size += int64(n)
+	}
+
+	switch {
+	case errors.Is(err, io.EOF):
+		r.commit()
+	case err != nil:
+		r.discard()
+	}
+	return n, err
+}
+
+// commit adds the completely read and verified layer to the cache.
+func (r *cachingReader) commit() {
+	if r.tmp == nil {
+		return
+	}
+	tmpPath := r.tmp.Name()
+	err := r.tmp.Close()
+	r.tmp = nil
+	if err == nil {
+		err = r.c.add(r.digest, tmpPath, r.size)
+	}
+	if err != nil {
+		r.c.log.Error(err, "Failed to add layer to cache", "Digest", r.digest)
+		_ = os.Remove(tmpPath)
+	}
+}
+
+// discard stops caching the layer, e.g. because its content doesn't match its digest.
+func (r *cachingReader) discard() {
+	if r.tmp == nil {
+		return
+	}
+	_ = r.tmp.Close()
+	_ = os.Remove(r.tmp.Name())
+	r.tmp = nil
+}
+
+// Close closes the fetched content. Layers which were not read completely are not cached.
+func (r *cachingReader) Close() error {
+	r.discard()
+	return r.verifyingReader.Close()
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package layercache_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/internal/layercache"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// registry serves layer contents and counts how often they were fetched.
+type registry struct {
+	layers  map[digest.Digest]string
+	fetches int
+}
+
+func (r *registry) add(content string) digest.Digest {
+	dgst := digest.FromString(content)
+	r.layers[dgst] = content
+	return dgst
+}
+
+func (r *registry) fetch(dgst digest.Digest) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		r.fetches++
+		return io.NopCloser(strings.NewReader(r.layers[dgst])), nil
+	}
+}
+
+var _ = Describe("Cache", func() {
+	var (
+		dir string
+		reg *registry
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		reg = &registry{layers: map[digest.Digest]string{}}
+	})
+
+	newCache := func(maxSize int64) *layercache.Cache {
+		c, err := layercache.New(logr.Discard(), layercache.Options{Dir: dir, MaxSize: maxSize})
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+
+	read := func(c *layercache.Cache, dgst digest.Digest) (string, error) {
+		rc, err := c.Open(dgst, reg.fetch(dgst))
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(rc.Close()).To(Succeed()) }()
+		data, err := io.ReadAll(rc)
+		return string(data), err
+	}
+
+	metric := func(c *layercache.Cache, index int) float64 {
+		return testutil.ToFloat64(c.Collectors()[index])
+	}
+
+	It("should read a layer populated a second time from the cache", func() {
+		c := newCache(0)
+		dgst := reg.add("rootfs")
+
+		Expect(read(c, dgst)).To(Equal("rootfs"))
+		Expect(read(c, dgst)).To(Equal("rootfs"))
+
+		Expect(reg.fetches).To(Equal(1))
+		Expect(metric(c, 0)).To(Equal(1.0))
+		Expect(metric(c, 1)).To(Equal(1.0))
+		Expect(c.Size()).To(Equal(int64(len("rootfs"))))
+	})
+
+	It("should keep the cached layers across restarts", func() {
+		dgst := reg.add("rootfs")
+		Expect(read(newCache(0), dgst)).To(Equal("rootfs"))
+
+		c := newCache(0)
+		Expect(read(c, dgst)).To(Equal("rootfs"))
+		Expect(reg.fetches).To(Equal(1))
+	})
+
+	It("should not cache layers that were not read completely", func() {
+		c := newCache(0)
+		dgst := reg.add("rootfs")
+
+		rc, err := c.Open(dgst, reg.fetch(dgst))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = rc.Read(make([]byte, 2))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rc.Close()).To(Succeed())
+
+		Expect(read(c, dgst)).To(Equal("rootfs"))
+		Expect(reg.fetches).To(Equal(2))
+		Expect(os.ReadDir(filepath.Join(dir, "tmp"))).To(BeEmpty())
+	})
+
+	It("should neither return nor cache content not matching its digest", func() {
+		c := newCache(0)
+		dgst := digest.FromString("rootfs")
+		reg.layers[dgst] = "tampered"
+
+		_, err := read(c, dgst)
+		Expect(err).To(MatchError(layercache.ErrDigestMismatch))
+		Expect(c.Size()).To(BeZero())
+
+		_, err = read(c, dgst)
+		Expect(err).To(MatchError(layercache.ErrDigestMismatch))
+		Expect(reg.fetches).To(Equal(2))
+	})
+
+	It("should evict a cached layer whose content was modified", func() {
+		c := newCache(0)
+		dgst := reg.add("rootfs")
+		Expect(read(c, dgst)).To(Equal("rootfs"))
+
+		Expect(os.WriteFile(filepath.Join(dir, "sha256", dgst.Encoded()), []byte("corrupt"), 0o600)).To(Succeed())
+		_, err := read(c, dgst)
+		Expect(err).To(MatchError(layercache.ErrDigestMismatch))
+
+		Expect(read(c, dgst)).To(Equal("rootfs"))
+		Expect(reg.fetches).To(Equal(2))
+	})
+
+	It("should evict the least recently used layers beyond the max size", func() {
+		c := newCache(8)
+		foo, bar, baz := reg.add("foo-"), reg.add("bar-"), reg.add("baz-")
+
+		Expect(read(c, foo)).To(Equal("foo-"))
+		Expect(read(c, bar)).To(Equal("bar-"))
+		// Reading foo again makes bar the least recently used layer.
+		Expect(read(c, foo)).To(Equal("foo-"))
+		Expect(read(c, baz)).To(Equal("baz-"))
+		Expect(c.Size()).To(Equal(int64(8)))
+		Expect(reg.fetches).To(Equal(3))
+
+		Expect(read(c, foo)).To(Equal("foo-"))
+		Expect(read(c, baz)).To(Equal("baz-"))
+		Expect(reg.fetches).To(Equal(3))
+		Expect(read(c, bar)).To(Equal("bar-"))
+		Expect(reg.fetches).To(Equal(4))
+	})
+
+	It("should not cache layers larger than the max size", func() {
+		c := newCache(4)
+		dgst := reg.add(string(bytes.Repeat([]byte("x"), 5)))
+
+		Expect(read(c, dgst)).To(HaveLen(5))
+		Expect(read(c, dgst)).To(HaveLen(5))
+		Expect(reg.fetches).To(Equal(2))
+		Expect(c.Size()).To(BeZero())
+	})
+
+	It("should reject an invalid configuration", func() {
+		_, err := layercache.New(logr.Discard(), layercache.Options{})
+		Expect(err).To(MatchError(ContainSubstring("must specify dir")))
+
+		_, err = layercache.New(logr.Discard(), layercache.Options{Dir: dir, MaxSize: -1})
+		Expect(err).To(MatchError(ContainSubstring("max size must not be negative")))
+	})
+})
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// Components whose verbosity can be set independently of the other loggers.
+const (
+	ComponentImage    = "image"
+	ComponentSnapshot = "snapshot"
+	ComponentAuth     = "auth"
+	ComponentBucket   = "bucket"
+)
+
+// componentLoggerNames are the names of the loggers of the components.
+var componentLoggerNames = map[string]string{
+	ComponentImage:    "image-reconciler",
+	ComponentSnapshot: "snapshot-reconciler",
+	ComponentAuth:     "auth",
+	ComponentBucket:   "bucket-server",
+}
+
+// LoggerName returns the name of the logger of the component.
+func LoggerName(component string) string {
+	return componentLoggerNames[component]
+}
+
+// Components returns the known log components.
+func Components() []string {
+	components := make([]string, 0, len(componentLoggerNames))
+	for component := range componentLoggerNames {
+		components = append(components, component)
+	}
+	slices.Sort(components)
+	return components
+}
+
+// Options configures the verbosity of the loggers.
+type Options struct {
+	// Verbosity is the V-level enabled for all loggers without a component verbosity.
+	Verbosity int
+	// ComponentVerbosity are the V-levels enabled for the loggers of the components, keyed by component.
+	ComponentVerbosity map[string]int
+}
+
+// Validate checks that the component verbosity only refers to known components.
+func (o *Options) Validate() error {
+	for component, verbosity := range o.ComponentVerbosity {
+		if _, ok := componentLoggerNames[component]; !ok {
+			return fmt.Errorf("unknown log component %q", component)
+		}
+		if verbosity < 0 {
+			return fmt.Errorf("verbosity of log component %s must not be negative, got %d", component, verbosity)
+		}
+	}
+	return nil
+}
+
+// maxVerbosity returns the highest V-level enabled by any logger.
+func (o *Options) maxVerbosity() int {
+	verbosity := o.Verbosity
+	for _, v := range o.ComponentVerbosity {
+		verbosity = max(verbosity, v)
+	}
+	return verbosity
+}
+
+// ApplyToZap takes the verbosity from the level of the zap options and raises the level so that the zap logger
+// enables the highest component verbosity. The zap options are not changed without a component verbosity.
+func (o *Options) ApplyToZap(zapOpts *zap.Options) {
+	switch {
+	case zapOpts.Level != nil:
+		o.Verbosity = zapVerbosity(zapOpts.Level)
+	case zapOpts.Development:
+		o.Verbosity = -int(zapcore.DebugLevel)
+	default:
+		o.Verbosity = 0
+	}
+
+	if len(o.ComponentVerbosity) == 0 {
+		return
+	}
+	zapOpts.Level = zapcore.Level(-o.maxVerbosity())
+}
+
+// zapVerbosity returns the highest V-level enabled by the zap level, i.e. the negated lowest enabled zap level.
+func zapVerbosity(level zapcore.LevelEnabler) int {
+	for verbosity := -math.MinInt8; verbosity > 0; verbosity-- {
+		if level.Enabled(zapcore.Level(-verbosity)) {
+			return verbosity
+		}
+	}
+	return 0
+}
+
+// New returns a logger enabling the verbosity of the options. Loggers named after a component enable the verbosity of
+// the component, including their named sub-loggers. The sink of log has to enable the highest verbosity of the
+// options, see ApplyToZap.
+func New(log logr.Logger, opts Options) (logr.Logger, error) {
+	if err := opts.Validate(); err != nil {
+		return logr.Logger{}, err
+	}
+	if len(opts.ComponentVerbosity) == 0 {
+		return log, nil
+	}
+
+	levels := make(map[string]int, len(opts.ComponentVerbosity))
+	for component, verbosity := range opts.ComponentVerbosity {
+		levels[componentLoggerNames[component]] = verbosity
+	}
+	return logr.New(&verbositySink{
+		// Calls to the wrapped sink are one frame deeper.
+		sink:      log.WithCallDepth(1).GetSink(),
+		verbosity: opts.Verbosity,
+		levels:    levels,
+	}), nil
+}
+
+// verbositySink gates the V-levels of the wrapped sink by the verbosity of its logger.
+type verbositySink struct {
+	sink      logr.LogSink
+	verbosity int
+	// levels are the V-levels of the loggers, keyed by logger name.
+	levels map[string]int
+}
+
+var _ logr.CallDepthLogSink = &verbositySink{}
+
+// Init does nothing, the wrapped sink is initialized by its logger already.
+func (s *verbositySink) Init(logr.RuntimeInfo) {}
+
+func (s *verbositySink) Enabled(level int) bool {
+	return level <= s.verbosity && s.sink.Enabled(level)
+}
+
+func (s *verbositySink) Info(level int, msg string, keysAndValues ...any) {
+	s.sink.Info(level, msg, keysAndValues...)
+}
+
+func (s *verbositySink) Error(err error, msg string, keysAndValues ...any) {
+	s.sink.Error(err, msg, keysAndValues...)
+}
+
+func (s *verbositySink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &verbositySink{
+		sink:      s.sink.WithValues(keysAndValues...),
+		verbosity: s.verbosity,
+		levels:    s.levels,
+	}
+}
+
+func (s *verbositySink) WithName(name string) logr.LogSink {
+	verbosity := s.verbosity
+	if v, ok := s.levels[name]; ok {
+		verbosity = v
+	}
+	return &verbositySink{
+		sink:      s.sink.WithName(name),
+		verbosity: verbosity,
+		levels:    s.levels,
+	}
+}
+
+func (s *verbositySink) WithCallDepth(depth int) logr.LogSink {
+	sink, ok := s.sink.(logr.CallDepthLogSink)
+	if !ok {
+		return s
+	}
+	return &verbositySink{
+		sink:      sink.WithCallDepth(depth),
+		verbosity: s.verbosity,
+		levels:    s.levels,
+	}
+}
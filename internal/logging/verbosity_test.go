@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package logging_test
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/ironcore-dev/ceph-provider/internal/logging"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Verbosity", func() {
+	var (
+		messages []string
+		base     logr.Logger
+	)
+
+	BeforeEach(func() {
+		messages = nil
+		base = funcr.New(func(prefix, args string) {
+			messages = append(messages, prefix)
+		}, funcr.Options{Verbosity: 10})
+	})
+
+	It("should let a component logger log at its own verbosity independent of the root", func() {
+		log, err := logging.New(base, logging.Options{
+			Verbosity:          1,
+			ComponentVerbosity: map[string]int{logging.ComponentSnapshot: 3},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshotLog := log.WithName(logging.LoggerName(logging.ComponentSnapshot))
+		imageLog := log.WithName(logging.LoggerName(logging.ComponentImage))
+
+		log.V(2).Info("root")
+		imageLog.V(2).Info("image")
+		snapshotLog.V(3).Info("snapshot")
+		snapshotLog.WithName("sub").WithValues("foo", "bar").V(3).Info("sub")
+		snapshotLog.V(4).Info("too verbose")
+
+		Expect(messages).To(Equal([]string{"snapshot-reconciler", "snapshot-reconciler/sub"}))
+		Expect(log.V(1).Enabled()).To(BeTrue())
+		Expect(imageLog.V(2).Enabled()).To(BeFalse())
+	})
+
+	It("should let a component logger log less than the root", func() {
+		log, err := logging.New(base, logging.Options{
+			Verbosity:          3,
+			ComponentVerbosity: map[string]int{logging.ComponentAuth: 0},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		log.WithName("image-reconciler").WithName(logging.LoggerName(logging.ComponentAuth)).V(1).Info("auth")
+		log.WithName("image-reconciler").V(3).Info("image")
+
+		Expect(messages).To(Equal([]string{"image-reconciler"}))
+	})
+
+	It("should reject unknown components", func() {
+		_, err := logging.New(base, logging.Options{ComponentVerbosity: map[string]int{"foo": 1}})
+		Expect(err).To(MatchError(ContainSubstring(`unknown log component "foo"`)))
+	})
+
+	It("should raise the zap level to the highest component verbosity", func() {
+		opts := logging.Options{ComponentVerbosity: map[string]int{logging.ComponentBucket: 4}}
+		zapOpts := zap.Options{Development: true}
+		opts.ApplyToZap(&zapOpts)
+
+		Expect(opts.Verbosity).To(Equal(1))
+		Expect(zapOpts.Level.Enabled(zapcore.Level(-4))).To(BeTrue())
+		Expect(zapOpts.Level.Enabled(zapcore.Level(-5))).To(BeFalse())
+	})
+
+	It("should keep the zap level without component verbosity", func() {
+		opts := logging.Options{}
+		zapOpts := zap.Options{Level: zapcore.Level(-2)}
+		opts.ApplyToZap(&zapOpts)
+
+		Expect(opts.Verbosity).To(Equal(2))
+		Expect(zapOpts.Level).To(Equal(zapcore.Level(-2)))
+	})
+})
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package maintenance
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DefaultRequeueInterval is the default interval items are requeued in while the maintenance mode is on.
+const DefaultRequeueInterval = 1 * time.Minute
+
+const (
+	// PauseSignal turns the maintenance mode on.
+	PauseSignal = syscall.SIGUSR1
+	// ResumeSignal turns the maintenance mode off.
+	ResumeSignal = syscall.SIGUSR2
+)
+
+// Mode pauses the mutations of rbd images and snapshots while it is on, e.g. during ceph upgrades or rebalancing,
+// without stopping the provider. A nil Mode is never on.
+type Mode struct {
+	log logr.Logger
+
+	mu       sync.Mutex
+	paused   bool
+	onResume []func()
+}
+
+// NewMode returns a maintenance mode that is on if paused is set.
+func NewMode(log logr.Logger, paused bool) *Mode {
+	return &Mode{
+		log:    log,
+		paused: paused,
+	}
+}
+
+// Paused reports whether the maintenance mode is on.
+func (m *Mode) Paused() bool {
+	if m == nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
+
+// Pause turns the maintenance mode on.
+func (m *Mode) Pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.paused {
+		m.paused = true
+		m.log.Info("Maintenance mode on, pausing reconciliation")
+	}
+}
+
+// Resume turns the maintenance mode off and calls the functions registered with OnResume, so that the items deferred
+// while paused are reconciled right away.
+func (m *Mode) Resume() {
+	m.mu.Lock()
+	if !m.paused {
+		m.mu.Unlock()
+		return
+	}
+	m.paused = false
+	onResume := m.onResume
+	m.mu.Unlock()
+
+	m.log.Info("Maintenance mode off, resuming reconciliation")
+	for _, fn := range onResume {
+		fn()
+	}
+}
+
+// OnResume registers fn to be called whenever the maintenance mode is turned off.
+func (m *Mode) OnResume(fn func()) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onResume = append(m.onResume, fn)
+}
+
+// WatchSignals turns the maintenance mode on upon PauseSignal and off upon ResumeSignal until ctx is done. The
+// signals are subscribed to before it returns.
+func (m *Mode) WatchSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, PauseSignal, ResumeSignal)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == PauseSignal {
+					m.Pause()
+				} else {
+					m.Resume()
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package maintenance_test
+
+import (
+	"syscall"
+
+	"github.com/go-logr/logr"
+	. "github.com/ironcore-dev/ceph-provider/internal/maintenance"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mode", func() {
+	It("should never be paused if nil", func() {
+		var mode *Mode
+		Expect(mode.Paused()).To(BeFalse())
+	})
+
+	It("should call the resume functions once resumed", func() {
+		mode := NewMode(logr.Discard(), true)
+		var resumed int
+		mode.OnResume(func() { resumed++ })
+
+		Expect(mode.Paused()).To(BeTrue())
+		mode.Resume()
+		Expect(mode.Paused()).To(BeFalse())
+		Expect(resumed).To(Equal(1))
+
+		By("not calling them again if not paused")
+		mode.Resume()
+		Expect(resumed).To(Equal(1))
+
+		mode.Pause()
+		Expect(mode.Paused()).To(BeTrue())
+		mode.Resume()
+		Expect(resumed).To(Equal(2))
+	})
+
+	It("should be paused and resumed by signals", func(ctx SpecContext) {
+		mode := NewMode(logr.Discard(), false)
+
+		mode.WatchSignals(ctx)
+
+		Expect(syscall.Kill(syscall.Getpid(), PauseSignal)).To(Succeed())
+		Eventually(mode.Paused).Should(BeTrue())
+
+		Expect(syscall.Kill(syscall.Getpid(), ResumeSignal)).To(Succeed())
+		Eventually(mode.Paused).Should(BeFalse())
+	})
+})
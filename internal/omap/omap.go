@@ -5,13 +5,17 @@ package omap
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/ceph/go-ceph/rados"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/paging"
+	"github.com/ironcore-dev/ceph-provider/internal/schema"
 	utilssync "github.com/ironcore-dev/ceph-provider/internal/sync"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
@@ -23,17 +27,22 @@ type CreateStrategy[E apiutils.Object] interface {
 	PrepareForCreate(obj E)
 }
 
-var ErrResourceVersionNotLatest = errors.New("resourceVersion is not latest")
+// ErrResourceVersionNotLatest is returned by Update if the object was updated since it was read. Callers have to read
+// the object again and retry.
+var ErrResourceVersionNotLatest = store.ErrResourceVersionNotLatest
 
 type Options[E apiutils.Object] struct {
 	OmapName       string
 	NewFunc        func() E
 	CreateStrategy CreateStrategy[E]
+	// Migrations upgrade stored objects of older schema versions when they are read. Objects are stored in the
+	// current schema version of the migrations.
+	Migrations schema.Migrations
 }
 
-func New[E apiutils.Object](conn *rados.Conn, pool string, opts Options[E]) (*Store[E], error) {
-	if conn == nil {
-		return nil, fmt.Errorf("must specify conn")
+func New[E apiutils.Object](conns ceph.ConnAccessor, pool string, opts Options[E]) (*Store[E], error) {
+	if conns == nil {
+		return nil, fmt.Errorf("must specify conns")
 	}
 
 	if pool == "" {
@@ -48,29 +57,43 @@ func New[E apiutils.Object](conn *rados.Conn, pool string, opts Options[E]) (*St
 		return nil, fmt.Errorf("must specify opts.NewFunc")
 	}
 
+	if err := opts.Migrations.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid opts.Migrations: %w", err)
+	}
+
 	return &Store[E]{
 		idMu: utilssync.NewMutexMap[string](),
 
-		conn:     conn,
-		pool:     pool,
+		openIOContext: func() (omapIOContext, func(), error) {
+			return ceph.OpenIOContext(conns, pool)
+		},
 		omapName: opts.OmapName,
 
 		watches: sets.New[*watch[E]](),
 
 		newFunc:        opts.NewFunc,
 		createStrategy: opts.CreateStrategy,
+		migrations:     opts.Migrations,
 	}, nil
 }
 
+// omapIOContext is the subset of the io context operations the store performs on its omap.
+type omapIOContext interface {
+	GetAllOmapValues(oid, startAfter, filterPrefix string, iteratorSize int64) (map[string][]byte, error)
+	GetOmapValues(oid, startAfter, filterPrefix string, maxReturn int64) (map[string][]byte, error)
+	SetOmap(oid string, pairs map[string][]byte) error
+	RmOmapKeys(oid string, keys []string) error
+}
+
 type Store[E apiutils.Object] struct {
 	idMu *utilssync.MutexMap[string]
 
-	conn     *rados.Conn
-	pool     string
-	omapName string
+	openIOContext func() (omapIOContext, func(), error)
+	omapName      string
 
 	newFunc        func() E
 	createStrategy CreateStrategy[E]
+	migrations     schema.Migrations
 
 	watchesMu sync.RWMutex
 	watches   sets.Set[*watch[E]]
@@ -92,7 +115,7 @@ func (s *Store[E]) watchHandlers() []*watch[E] {
 	return s.watches.UnsortedList()
 }
 
-func (s *Store[E]) getSingleOmapValue(ioCtx *rados.IOContext, omapName, key string) ([]byte, error) {
+func (s *Store[E]) getSingleOmapValue(ioCtx omapIOContext, omapName, key string) ([]byte, error) {
 	omap, err := ioCtx.GetAllOmapValues(omapName, "", key, 10)
 	if err != nil {
 		return nil, err
@@ -106,7 +129,7 @@ func (s *Store[E]) getSingleOmapValue(ioCtx *rados.IOContext, omapName, key stri
 	return value, nil
 }
 
-func (s *Store[E]) deleteOmapValue(ioCtx *rados.IOContext, omapName, key string) error {
+func (s *Store[E]) deleteOmapValue(ioCtx omapIOContext, omapName, key string) error {
 	if err := ioCtx.RmOmapKeys(omapName, []string{key}); err != nil {
 		return fmt.Errorf("unable to delete mapping omap value: %w", err)
 	}
@@ -114,7 +137,7 @@ func (s *Store[E]) deleteOmapValue(ioCtx *rados.IOContext, omapName, key string)
 	return nil
 }
 
-func (s *Store[E]) setOmapValue(ioCtx *rados.IOContext, omapName, key string, value []byte) error {
+func (s *Store[E]) setOmapValue(ioCtx omapIOContext, omapName, key string, value []byte) error {
 	if err := ioCtx.SetOmap(omapName, map[string][]byte{
 		key: value,
 	}); err != nil {
@@ -128,11 +151,11 @@ func (s *Store[E]) Create(ctx context.Context, obj E) (E, error) {
 	s.idMu.Lock(obj.GetID())
 	defer s.idMu.Unlock(obj.GetID())
 
-	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	ioCtx, release, err := s.openIOContext()
 	if err != nil {
 		return utils.Zero[E](), fmt.Errorf("unable to get io context: %w", err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
 	_, err = s.get(ioCtx, obj.GetID())
 	switch {
@@ -167,11 +190,11 @@ func (s *Store[E]) Delete(ctx context.Context, id string) error {
 	s.idMu.Lock(id)
 	defer s.idMu.Unlock(id)
 
-	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	ioCtx, release, err := s.openIOContext()
 	if err != nil {
 		return fmt.Errorf("unable to get io context: %w", err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
 	obj, err := s.get(ioCtx, id)
 	if err != nil {
@@ -202,7 +225,7 @@ func (s *Store[E]) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-func (s *Store[E]) delete(ioCtx *rados.IOContext, id string) error {
+func (s *Store[E]) delete(ioCtx omapIOContext, id string) error {
 	if err := s.deleteOmapValue(ioCtx, s.omapName, id); err != nil {
 		return fmt.Errorf("failed to delete object from omap: %w", err)
 	}
@@ -210,11 +233,11 @@ func (s *Store[E]) delete(ioCtx *rados.IOContext, id string) error {
 }
 
 func (s *Store[E]) Get(ctx context.Context, id string) (E, error) {
-	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	ioCtx, release, err := s.openIOContext()
 	if err != nil {
 		return utils.Zero[E](), fmt.Errorf("unable to get io context: %w", err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
 	return s.get(ioCtx, id)
 }
@@ -223,17 +246,23 @@ func (s *Store[E]) Update(ctx context.Context, obj E) (E, error) {
 	s.idMu.Lock(obj.GetID())
 	defer s.idMu.Unlock(obj.GetID())
 
-	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	ioCtx, release, err := s.openIOContext()
 	if err != nil {
 		return utils.Zero[E](), fmt.Errorf("unable to get io context: %w", err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
 	oldObj, err := s.get(ioCtx, obj.GetID())
 	if err != nil {
 		return utils.Zero[E](), err
 	}
 
+	// Releasing the last finalizer is checked as well, so that it doesn't drop finalizers added concurrently.
+	if oldObj.GetResourceVersion() != obj.GetResourceVersion() {
+		return utils.Zero[E](), fmt.Errorf("failed to update object %q at resourceVersion %d, latest is %d: %w",
+			obj.GetID(), obj.GetResourceVersion(), oldObj.GetResourceVersion(), ErrResourceVersionNotLatest)
+	}
+
 	if obj.GetDeletedAt() != nil && len(obj.GetFinalizers()) == 0 {
 		if err := s.delete(ioCtx, obj.GetID()); err != nil {
 			return utils.Zero[E](), fmt.Errorf("failed to delete object metadata: %w", err)
@@ -241,9 +270,6 @@ func (s *Store[E]) Update(ctx context.Context, obj E) (E, error) {
 		return obj, nil
 	}
 
-	if oldObj.GetResourceVersion() != obj.GetResourceVersion() {
-		return utils.Zero[E](), fmt.Errorf("failed to update object: %w", ErrResourceVersionNotLatest)
-	}
 	obj.IncrementResourceVersion()
 
 	obj, err = s.set(ioCtx, obj)
@@ -291,11 +317,11 @@ func (s *Store[E]) Watch(ctx context.Context) (store.Watch[E], error) {
 }
 
 func (s *Store[E]) List(ctx context.Context) ([]E, error) {
-	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	ioCtx, release, err := s.openIOContext()
 	if err != nil {
 		return nil, fmt.Errorf("unable to get io context: %w", err)
 	}
-	defer ioCtx.Destroy()
+	defer release()
 
 	omap, err := ioCtx.GetAllOmapValues(s.omapName, "", "", 10)
 	if err != nil {
@@ -305,11 +331,51 @@ func (s *Store[E]) List(ctx context.Context) ([]E, error) {
 		return nil, err
 	}
 
+	return s.decodeObjects(omap)
+}
+
+var _ paging.Lister[apiutils.Object] = &Store[apiutils.Object]{}
+
+// ListPage lists a page of the objects, ordered by their ID.
+func (s *Store[E]) ListPage(ctx context.Context, opts paging.Options) (paging.Page[E], error) {
+	ioCtx, release, err := s.openIOContext()
+	if err != nil {
+		return paging.Page[E]{}, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer release()
+
+	return paging.ListPage(opts, func(startAfter string, limit int64) ([]string, []E, error) {
+		omap, err := ioCtx.GetOmapValues(s.omapName, startAfter, "", limit)
+		if err != nil {
+			if errors.Is(err, rados.ErrNotFound) {
+				return nil, nil, nil
+			}
+			return nil, nil, err
+		}
+		return s.decodeSorted(omap)
+	})
+}
+
+// decodeSorted decodes the objects of the omap, ordered by their ID.
+func (s *Store[E]) decodeSorted(omap map[string][]byte) ([]string, []E, error) {
+	ids := slices.Sorted(maps.Keys(omap))
+	objs := make([]E, 0, len(ids))
+	for _, id := range ids {
+		obj, err := s.decode(omap[id])
+		if err != nil {
+			return nil, nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return ids, objs, nil
+}
+
+func (s *Store[E]) decodeObjects(omap map[string][]byte) ([]E, error) {
 	var objs []E
 	for _, v := range omap {
-		obj := s.newFunc()
-		if err := json.Unmarshal(v, &obj); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal object: %w", err)
+		obj, err := s.decode(v)
+		if err != nil {
+			return nil, err
 		}
 
 		objs = append(objs, obj)
@@ -318,8 +384,8 @@ func (s *Store[E]) List(ctx context.Context) ([]E, error) {
 	return objs, nil
 }
 
-func (s *Store[E]) set(ioCtx *rados.IOContext, obj E) (E, error) {
-	data, err := json.Marshal(obj)
+func (s *Store[E]) set(ioCtx omapIOContext, obj E) (E, error) {
+	data, err := s.migrations.Encode(obj)
 	if err != nil {
 		return utils.Zero[E](), fmt.Errorf("failed to marshal obj: %w", err)
 	}
@@ -331,7 +397,7 @@ func (s *Store[E]) set(ioCtx *rados.IOContext, obj E) (E, error) {
 	return obj, nil
 }
 
-func (s *Store[E]) get(ioCtx *rados.IOContext, id string) (E, error) {
+func (s *Store[E]) get(ioCtx omapIOContext, id string) (E, error) {
 	data, err := s.getSingleOmapValue(ioCtx, s.omapName, id)
 	if err != nil {
 		if !errors.Is(err, rados.ErrNotFound) {
@@ -341,10 +407,15 @@ func (s *Store[E]) get(ioCtx *rados.IOContext, id string) (E, error) {
 		return utils.Zero[E](), fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
 	}
 
+	return s.decode(data)
+}
+
+// decode unmarshals a stored object, migrating it to the current schema version. Migrated objects are stored in the
+// current schema version once they are updated.
+func (s *Store[E]) decode(data []byte) (E, error) {
 	obj := s.newFunc()
-	if err := json.Unmarshal(data, obj); err != nil {
+	if _, err := s.migrations.Decode(data, obj); err != nil {
 		return utils.Zero[E](), fmt.Errorf("failed to unmarshal object: %w", err)
 	}
-
 	return obj, nil
 }
@@ -0,0 +1,253 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package omap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ceph/go-ceph/rados"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/schema"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	Context("decodeObjects", func() {
+		var (
+			s    *Store[*providerapi.Image]
+			omap map[string][]byte
+		)
+
+		BeforeEach(func() {
+			var err error
+			s, err = New(ceph.StaticConn(&rados.Conn{}), "pool", Options[*providerapi.Image]{
+				OmapName: "images",
+				NewFunc:  func() *providerapi.Image { return &providerapi.Image{} },
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			omap = make(map[string][]byte)
+			for id, labels := range map[string]map[string]string{
+				"foo": {"image-digest": "sha256:a", "arch": "amd64"},
+				"bar": {"image-digest": "sha256:a", "arch": "arm64"},
+				"baz": {"image-digest": "sha256:b"},
+				"qux": nil,
+			} {
+				data, err := json.Marshal(&providerapi.Image{Metadata: apiutils.Metadata{ID: id, Labels: labels}})
+				Expect(err).NotTo(HaveOccurred())
+				omap[id] = data
+			}
+		})
+
+		ids := func(images []*providerapi.Image) []string {
+			var res []string
+			for _, image := range images {
+				res = append(res, image.ID)
+			}
+			return res
+		}
+
+		It("should decode all objects", func() {
+			images, err := s.decodeObjects(omap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ids(images)).To(ConsistOf("foo", "bar", "baz", "qux"))
+		})
+
+		It("should decode the objects of a page ordered by id", func() {
+			ids, images, err := s.decodeSorted(omap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ids).To(Equal([]string{"bar", "baz", "foo", "qux"}))
+			Expect(images).To(HaveExactElements(
+				HaveField("ID", "bar"), HaveField("ID", "baz"), HaveField("ID", "foo"), HaveField("ID", "qux"),
+			))
+		})
+	})
+
+	Context("migrations", func() {
+		var s *Store[*providerapi.Image]
+
+		BeforeEach(func() {
+			var err error
+			s, err = New(ceph.StaticConn(&rados.Conn{}), "pool", Options[*providerapi.Image]{
+				OmapName: "images",
+				NewFunc:  func() *providerapi.Image { return &providerapi.Image{} },
+				Migrations: schema.Migrations{
+					// Version 2 renamed spec.osImage to spec.image.
+					2: func(obj map[string]any) error {
+						if spec, ok := obj["spec"].(map[string]any); ok {
+							spec["image"] = spec["osImage"]
+							delete(spec, "osImage")
+						}
+						return nil
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should migrate v1 objects on load", func() {
+			images, err := s.decodeObjects(map[string][]byte{
+				"foo": []byte(`{"metadata":{"id":"foo"},"spec":{"osImage":"registry/os:latest"}}`),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(images).To(ConsistOf(HaveField("Spec.Image", "registry/os:latest")))
+		})
+
+		It("should refuse migrations with gaps", func() {
+			_, err := New(ceph.StaticConn(&rados.Conn{}), "pool", Options[*providerapi.Image]{
+				OmapName:   "images",
+				NewFunc:    func() *providerapi.Image { return &providerapi.Image{} },
+				Migrations: schema.Migrations{3: func(map[string]any) error { return nil }},
+			})
+			Expect(err).To(MatchError(ContainSubstring("missing migration to schema version 2")))
+		})
+	})
+
+	Context("Update", func() {
+		var s *Store[*providerapi.Image]
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			s, err = New(ceph.StaticConn(&rados.Conn{}), "pool", Options[*providerapi.Image]{
+				OmapName: "images",
+				NewFunc:  func() *providerapi.Image { return &providerapi.Image{} },
+			})
+			Expect(err).NotTo(HaveOccurred())
+			ioCtx := &fakeOmapIOContext{}
+			s.openIOContext = func() (omapIOContext, func(), error) { return ioCtx, func() {}, nil }
+
+			_, err = s.Create(ctx, &providerapi.Image{Metadata: apiutils.Metadata{ID: "foo", Finalizers: []string{"bar"}}})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should let only one of two writers of the same version update the object", func(ctx SpecContext) {
+			img, err := s.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+
+			var (
+				wg        sync.WaitGroup
+				conflicts atomic.Int32
+				updated   atomic.Int32
+			)
+			for _, state := range []providerapi.ImageState{providerapi.ImageStateAvailable, providerapi.ImageStateFailed} {
+				writer := *img
+				writer.Status.State = state
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					_, err := s.Update(ctx, &writer)
+					switch {
+					case err == nil:
+						updated.Add(1)
+					case errors.Is(err, store.ErrResourceVersionNotLatest):
+						conflicts.Add(1)
+					default:
+						Fail(fmt.Sprintf("unexpected error: %v", err))
+					}
+				}()
+			}
+			wg.Wait()
+
+			Expect(updated.Load()).To(BeEquivalentTo(1))
+			Expect(conflicts.Load()).To(BeEquivalentTo(1))
+
+			stored, err := s.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.ResourceVersion).To(Equal(img.ResourceVersion + 1))
+		})
+
+		It("should not release the last finalizer of a stale object", func(ctx SpecContext) {
+			Expect(s.Delete(ctx, "foo")).To(Succeed())
+			stale, err := s.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+
+			latest := *stale
+			latest.Finalizers = append(latest.Finalizers, "baz")
+			_, err = s.Update(ctx, &latest)
+			Expect(err).NotTo(HaveOccurred())
+
+			stale.Finalizers = nil
+			_, err = s.Update(ctx, stale)
+			Expect(err).To(MatchError(store.ErrResourceVersionNotLatest))
+
+			stored, err := s.Get(ctx, "foo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Finalizers).To(ConsistOf("bar", "baz"))
+		})
+	})
+})
+
+// fakeOmapIOContext keeps the omaps of rados objects in memory, it is safe for concurrent use.
+type fakeOmapIOContext struct {
+	mu    sync.Mutex
+	omaps map[string]map[string][]byte
+}
+
+func (f *fakeOmapIOContext) GetAllOmapValues(oid, startAfter, filterPrefix string, _ int64) (map[string][]byte, error) {
+	return f.GetOmapValues(oid, startAfter, filterPrefix, -1)
+}
+
+func (f *fakeOmapIOContext) GetOmapValues(oid, startAfter, filterPrefix string, maxReturn int64) (map[string][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	omap, ok := f.omaps[oid]
+	if !ok {
+		return nil, rados.ErrNotFound
+	}
+
+	res := make(map[string][]byte)
+	for _, key := range slices.Sorted(maps.Keys(omap)) {
+		if key <= startAfter || !strings.HasPrefix(key, filterPrefix) {
+			continue
+		}
+		if maxReturn >= 0 && int64(len(res)) >= maxReturn {
+			break
+		}
+		res[key] = slices.Clone(omap[key])
+	}
+	return res, nil
+}
+
+func (f *fakeOmapIOContext) SetOmap(oid string, pairs map[string][]byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.omaps == nil {
+		f.omaps = make(map[string]map[string][]byte)
+	}
+	if f.omaps[oid] == nil {
+		f.omaps[oid] = make(map[string][]byte)
+	}
+	for key, value := range pairs {
+		f.omaps[oid][key] = slices.Clone(value)
+	}
+	return nil
+}
+
+func (f *fakeOmapIOContext) RmOmapKeys(oid string, keys []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	omap, ok := f.omaps[oid]
+	if !ok {
+		return rados.ErrNotFound
+	}
+	for _, key := range keys {
+		delete(omap, key)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package paging lists the objects of a store page by page, so that large stores aren't loaded at once.
+package paging
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+)
+
+// DefaultLimit is the default number of objects of a page.
+const DefaultLimit = 500
+
+// Options select the page to list.
+type Options struct {
+	// Limit is the maximum number of objects of the page. Defaults to DefaultLimit.
+	Limit int64
+	// Continue is the token of the page to list, as returned with the previous page. The first page is listed if
+	// empty.
+	Continue string
+}
+
+// Page is a page of objects ordered by their key.
+type Page[E any] struct {
+	Items []E
+	// Continue is the token of the next page. It is empty if the page is the last one.
+	Continue string
+}
+
+// Lister lists the objects of a store page by page. Pages continue after the last key of the previous page, so that
+// objects inserted or removed while paging don't shift the remaining pages.
+type Lister[E any] interface {
+	ListPage(ctx context.Context, opts Options) (Page[E], error)
+}
+
+// FetchFunc returns up to limit keys and objects after the key startAfter, ordered by key. All keys are returned if
+// startAfter is empty.
+type FetchFunc[E any] func(startAfter string, limit int64) (keys []string, items []E, err error)
+
+// ListPage lists the page selected by the options from the objects returned by fetch.
+func ListPage[E any](opts Options, fetch FetchFunc[E]) (Page[E], error) {
+	if opts.Limit < 0 {
+		return Page[E]{}, fmt.Errorf("limit must not be negative, got %d", opts.Limit)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+
+	startAfter, err := decodeContinue(opts.Continue)
+	if err != nil {
+		return Page[E]{}, err
+	}
+
+	// One more object than the limit is fetched to tell whether the page is the last one.
+	keys, items, err := fetch(startAfter, opts.Limit+1)
+	if err != nil {
+		return Page[E]{}, err
+	}
+	if int64(len(items)) <= opts.Limit {
+		return Page[E]{Items: items}, nil
+	}
+	return Page[E]{
+		Items:    items[:opts.Limit],
+		Continue: encodeContinue(keys[opts.Limit-1]),
+	}, nil
+}
+
+// Each calls fn with the objects of each page of the lister until the last page was listed.
+func Each[E any](ctx context.Context, lister Lister[E], limit int64, fn func(items []E) error) error {
+	opts := Options{Limit: limit}
+	for {
+		page, err := lister.ListPage(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if err := fn(page.Items); err != nil {
+			return err
+		}
+		if page.Continue == "" {
+			return nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+func encodeContinue(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeContinue(token string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || (token != "" && len(key) == 0) {
+		return "", fmt.Errorf("invalid continue token %q", token)
+	}
+	return string(key), nil
+}
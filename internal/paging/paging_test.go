@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package paging_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/ironcore-dev/ceph-provider/internal/paging"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// sortedStore is a store whose objects are their keys, listed in key order like an omap.
+type sortedStore struct {
+	keys []string
+}
+
+func (s *sortedStore) insert(keys ...string) {
+	for _, key := range keys {
+		if i, found := slices.BinarySearch(s.keys, key); !found {
+			s.keys = slices.Insert(s.keys, i, key)
+		}
+	}
+}
+
+func (s *sortedStore) fetch(startAfter string, limit int64) ([]string, []string, error) {
+	i, found := slices.BinarySearch(s.keys, startAfter)
+	if found {
+		i++
+	}
+	keys := s.keys[i:min(i+int(limit), len(s.keys))]
+	return keys, keys, nil
+}
+
+func (s *sortedStore) ListPage(_ context.Context, opts paging.Options) (paging.Page[string], error) {
+	return paging.ListPage(opts, s.fetch)
+}
+
+var _ = Describe("ListPage", func() {
+	var s *sortedStore
+
+	BeforeEach(func() {
+		s = &sortedStore{}
+		s.insert("a", "c", "e", "g", "i")
+	})
+
+	It("should page through all objects and end with an empty continue token", func(ctx SpecContext) {
+		page, err := s.ListPage(ctx, paging.Options{Limit: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(Equal([]string{"a", "c"}))
+		Expect(page.Continue).NotTo(BeEmpty())
+
+		page, err = s.ListPage(ctx, paging.Options{Limit: 2, Continue: page.Continue})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(Equal([]string{"e", "g"}))
+
+		page, err = s.ListPage(ctx, paging.Options{Limit: 2, Continue: page.Continue})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(Equal([]string{"i"}))
+		Expect(page.Continue).To(BeEmpty())
+	})
+
+	It("should end with an empty continue token if the last page is full", func(ctx SpecContext) {
+		page, err := s.ListPage(ctx, paging.Options{Limit: 5})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(HaveLen(5))
+		Expect(page.Continue).To(BeEmpty())
+	})
+
+	It("should not skip or repeat objects when objects are inserted while paging", func(ctx SpecContext) {
+		page, err := s.ListPage(ctx, paging.Options{Limit: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(Equal([]string{"a", "c"}))
+
+		// Objects inserted before the continue token are listed with the next full listing only.
+		s.insert("b", "f")
+
+		page, err = s.ListPage(ctx, paging.Options{Limit: 2, Continue: page.Continue})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(Equal([]string{"e", "f"}))
+	})
+
+	It("should list all pages", func(ctx SpecContext) {
+		var pages [][]string
+		Expect(paging.Each[string](ctx, s, 2, func(items []string) error {
+			pages = append(pages, items)
+			return nil
+		})).To(Succeed())
+		Expect(pages).To(Equal([][]string{{"a", "c"}, {"e", "g"}, {"i"}}))
+	})
+
+	It("should stop listing on the first error", func(ctx SpecContext) {
+		calls := 0
+		err := paging.Each[string](ctx, s, 2, func([]string) error {
+			calls++
+			return errors.New("boom")
+		})
+		Expect(err).To(MatchError("boom"))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("should default the limit", func(ctx SpecContext) {
+		s.keys = nil
+		for i := range paging.DefaultLimit + 1 {
+			s.insert(strings.Repeat("x", i+1))
+		}
+
+		page, err := s.ListPage(ctx, paging.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(HaveLen(paging.DefaultLimit))
+		Expect(page.Continue).NotTo(BeEmpty())
+	})
+
+	It("should reject an invalid continue token", func(ctx SpecContext) {
+		_, err := s.ListPage(ctx, paging.Options{Continue: "!"})
+		Expect(err).To(MatchError(ContainSubstring("invalid continue token")))
+	})
+})
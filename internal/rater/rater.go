@@ -6,6 +6,7 @@ package rater
 import (
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,7 +18,7 @@ func NewRater(r io.Reader) *Rater {
 
 type Rater struct {
 	r          io.Reader
-	count      int64
+	count      atomic.Int64
 	start, end time.Time
 }
 
@@ -27,7 +28,7 @@ func (r *Rater) Read(b []byte) (n int, err error) {
 	}
 
 	n, err = r.r.Read(b)
-	r.count += int64(n)
+	r.count.Add(int64(n))
 	if err == io.EOF {
 		r.end = time.Now()
 	}
@@ -42,9 +43,14 @@ func (r *Rater) Rate() (n int64, d time.Duration) {
 		end = time.Now()
 	}
 	if start.IsZero() {
-		return r.count, 0
+		return r.Count(), 0
 	}
-	return r.count, end.Sub(r.start)
+	return r.Count(), end.Sub(r.start)
+}
+
+// Count returns the number of bytes read so far. It is safe to call while reading.
+func (r *Rater) Count() int64 {
+	return r.count.Load()
 }
 
 func (r *Rater) String() string {
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package reconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	DefaultInitialBackoff = 1 * time.Second
+	DefaultMaxBackoff     = 1 * time.Minute
+)
+
+var ErrNotConnected = errors.New("not connected")
+
+// connectionErrnos are the errnos ceph reports once the connection to the cluster is lost. ETIMEDOUT is not among
+// them, as ceph reports it for single operations timing out, e.g. on an unresponsive osd, while the connection is
+// still usable by all other operations.
+var connectionErrnos = map[syscall.Errno]struct{}{
+	syscall.ENOTCONN:     {},
+	syscall.ESHUTDOWN:    {},
+	syscall.ECONNREFUSED: {},
+	syscall.ECONNRESET:   {},
+}
+
+// IsConnectionError reports whether the error signals a lost connection to the ceph cluster.
+func IsConnectionError(err error) bool {
+	var codeErr interface{ ErrorCode() int }
+	if !errors.As(err, &codeErr) {
+		return false
+	}
+
+	code := codeErr.ErrorCode()
+	if code < 0 {
+		code = -code
+	}
+	_, ok := connectionErrnos[syscall.Errno(code)]
+	return ok
+}
+
+type Options struct {
+	// InitialBackoff is the delay after the first failed reconnect attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponentially growing delay between reconnect attempts.
+	MaxBackoff time.Duration
+}
+
+func setOptionsDefaults(o *Options) {
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = DefaultInitialBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+}
+
+// Manager keeps a connection established and re-establishes it with exponential backoff
+// once a connection error is observed.
+type Manager[C any] struct {
+	log logr.Logger
+
+	connect  func(ctx context.Context) (C, error)
+	shutdown func(conn C)
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	mu      sync.Mutex
+	current *lease[C]
+
+	reconnect chan struct{}
+}
+
+// lease tracks the borrowers of a connection. A connection replaced after a connection error is only shut down once
+// its last borrower released it, as borrowers may still use resources opened on it.
+type lease[C any] struct {
+	conn      C
+	borrowers int
+	stale     bool
+}
+
+func NewManager[C any](
+	log logr.Logger,
+	connect func(ctx context.Context) (C, error),
+	shutdown func(conn C),
+	opts Options,
+) (*Manager[C], error) {
+	if connect == nil {
+		return nil, fmt.Errorf("must specify connect")
+	}
+
+	if shutdown == nil {
+		return nil, fmt.Errorf("must specify shutdown")
+	}
+
+	setOptionsDefaults(&opts)
+
+	return &Manager[C]{
+		log:            log,
+		connect:        connect,
+		shutdown:       shutdown,
+		initialBackoff: opts.InitialBackoff,
+		maxBackoff:     opts.MaxBackoff,
+		reconnect:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Connect establishes the initial connection.
+func (m *Manager[C]) Connect(ctx context.Context) error {
+	conn, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.setConn(conn)
+	return nil
+}
+
+// Acquire returns the current connection or ErrNotConnected while it is being re-established. The connection is not
+// shut down before the returned release func is called.
+func (m *Manager[C]) Acquire() (C, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := m.current
+	if l == nil {
+		var zero C
+		return zero, nil, ErrNotConnected
+	}
+
+	l.borrowers++
+	var once sync.Once
+	return l.conn, func() { once.Do(func() { m.release(l) }) }, nil
+}
+
+func (m *Manager[C]) release(l *lease[C]) {
+	m.mu.Lock()
+	l.borrowers--
+	drained := l.stale && l.borrowers == 0
+	m.mu.Unlock()
+
+	if drained {
+		m.shutdown(l.conn)
+	}
+}
+
+// ObserveError triggers a reconnect if the error signals a lost connection.
+func (m *Manager[C]) ObserveError(err error) {
+	if err == nil || !IsConnectionError(err) {
+		return
+	}
+
+	m.mu.Lock()
+	l := m.current
+	if l == nil {
+		m.mu.Unlock()
+		return
+	}
+
+	m.log.Info("Connection lost, reconnecting", "Error", err)
+	m.current = nil
+	l.stale = true
+	drained := l.borrowers == 0
+	select {
+	case m.reconnect <- struct{}{}:
+	default:
+	}
+	m.mu.Unlock()
+
+	if drained {
+		m.shutdown(l.conn)
+	}
+}
+
+// Start re-establishes the connection whenever a connection error was observed until ctx is done.
+// The connection is left open once ctx is done, as in-flight operations may still use it.
+func (m *Manager[C]) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.reconnect:
+			if err := m.reconnectWithBackoff(ctx); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (m *Manager[C]) reconnectWithBackoff(ctx context.Context) error {
+	backoff := m.initialBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := m.connect(ctx)
+		if err == nil {
+			m.log.Info("Reconnected", "Attempt", attempt)
+			m.setConn(conn)
+			return nil
+		}
+		m.log.Error(err, "Failed to reconnect", "Attempt", attempt, "Backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, m.maxBackoff)
+	}
+}
+
+func (m *Manager[C]) setConn(conn C) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.current = &lease[C]{conn: conn}
+}
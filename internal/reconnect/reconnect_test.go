@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package reconnect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/ironcore-dev/ceph-provider/internal/reconnect"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// errnoError mimics the errors returned by go-ceph.
+type errnoError int
+
+func (e errnoError) Error() string  { return fmt.Sprintf("errno %d", int(e)) }
+func (e errnoError) ErrorCode() int { return int(e) }
+
+type fakeConn struct {
+	id int
+}
+
+type fakeCluster struct {
+	mu sync.Mutex
+
+	failures int
+	attempts []time.Time
+	shutdown []*fakeConn
+}
+
+func (c *fakeCluster) connect(ctx context.Context) (*fakeConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts = append(c.attempts, time.Now())
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("cluster unreachable")
+	}
+	return &fakeConn{id: len(c.attempts)}, nil
+}
+
+func (c *fakeCluster) shutdownConn(conn *fakeConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.shutdown = append(c.shutdown, conn)
+}
+
+func (c *fakeCluster) Attempts() []time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Time(nil), c.attempts...)
+}
+
+func (c *fakeCluster) Shutdown() []*fakeConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*fakeConn(nil), c.shutdown...)
+}
+
+var _ = Describe("IsConnectionError", func() {
+	DescribeTable("should classify errors",
+		func(err error, expected bool) {
+			Expect(IsConnectionError(err)).To(Equal(expected))
+		},
+		Entry("not connected", errnoError(-int(syscall.ENOTCONN)), true),
+		Entry("wrapped connection reset", fmt.Errorf("failed: %w", errnoError(-int(syscall.ECONNRESET))), true),
+		Entry("timeout", errnoError(-int(syscall.ETIMEDOUT)), false),
+		Entry("not found", errnoError(-int(syscall.ENOENT)), false),
+		Entry("plain error", errors.New("foo"), false),
+	)
+})
+
+var _ = Describe("Manager", func() {
+	var (
+		cluster *fakeCluster
+		manager *Manager[*fakeConn]
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		cluster = &fakeCluster{}
+		var err error
+		manager, err = NewManager(logr.Discard(), cluster.connect, cluster.shutdownConn, Options{
+			InitialBackoff: 20 * time.Millisecond,
+			MaxBackoff:     time.Second,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manager.Connect(ctx)).To(Succeed())
+	})
+
+	// conn acquires the current connection and releases it right away.
+	conn := func() (*fakeConn, error) {
+		conn, release, err := manager.Acquire()
+		if err != nil {
+			return nil, err
+		}
+		release()
+		return conn, nil
+	}
+
+	It("should keep the connection on errors unrelated to the connection", func(ctx SpecContext) {
+		current, err := conn()
+		Expect(err).NotTo(HaveOccurred())
+
+		manager.ObserveError(errnoError(-int(syscall.ENOENT)))
+
+		Expect(conn()).To(BeIdenticalTo(current))
+		Expect(cluster.Shutdown()).To(BeEmpty())
+	})
+
+	It("should keep the connection if an osd request timed out", func(ctx SpecContext) {
+		go manager.Start(ctx)
+
+		current, err := conn()
+		Expect(err).NotTo(HaveOccurred())
+
+		manager.ObserveError(fmt.Errorf("failed to read rbd image: %w", errnoError(-int(syscall.ETIMEDOUT))))
+
+		Consistently(conn).WithTimeout(100 * time.Millisecond).Should(BeIdenticalTo(current))
+		Expect(cluster.Attempts()).To(HaveLen(1))
+		Expect(cluster.Shutdown()).To(BeEmpty())
+	})
+
+	It("should reconnect with backoff after a connection error", func(ctx SpecContext) {
+		go manager.Start(ctx)
+
+		stale, err := conn()
+		Expect(err).NotTo(HaveOccurred())
+
+		By("failing the first two reconnect attempts")
+		cluster.mu.Lock()
+		cluster.failures = 2
+		cluster.mu.Unlock()
+
+		manager.ObserveError(fmt.Errorf("failed to open io context: %w", errnoError(-int(syscall.ENOTCONN))))
+		_, err = conn()
+		Expect(err).To(MatchError(ErrNotConnected))
+
+		By("waiting for the connection to be re-established")
+		Eventually(func() error {
+			_, err := conn()
+			return err
+		}).Should(Succeed())
+
+		current, err := conn()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).NotTo(BeIdenticalTo(stale))
+		Expect(cluster.Shutdown()).To(ConsistOf(BeIdenticalTo(stale)))
+
+		By("ensuring the delay between attempts grew")
+		attempts := cluster.Attempts()
+		Expect(attempts).To(HaveLen(4))
+		Expect(attempts[2].Sub(attempts[1])).To(BeNumerically(">=", 20*time.Millisecond))
+		Expect(attempts[3].Sub(attempts[2])).To(BeNumerically(">=", 40*time.Millisecond))
+	})
+
+	It("should shut down the previous connection only once all borrowers released it", func(ctx SpecContext) {
+		go manager.Start(ctx)
+
+		stale, release, err := manager.Acquire()
+		Expect(err).NotTo(HaveOccurred())
+		_, otherRelease, err := manager.Acquire()
+		Expect(err).NotTo(HaveOccurred())
+
+		By("losing the connection while it is borrowed")
+		manager.ObserveError(errnoError(-int(syscall.ENOTCONN)))
+		Eventually(func() error {
+			_, err := conn()
+			return err
+		}).Should(Succeed())
+		Expect(cluster.Shutdown()).To(BeEmpty())
+
+		By("releasing the borrowers")
+		release()
+		release()
+		Expect(cluster.Shutdown()).To(BeEmpty())
+		otherRelease()
+		Expect(cluster.Shutdown()).To(ConsistOf(BeIdenticalTo(stale)))
+	})
+
+	It("should stop reconnecting once the context is done", func(ctx SpecContext) {
+		cluster.mu.Lock()
+		cluster.failures = 1000
+		cluster.mu.Unlock()
+
+		startCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			manager.Start(startCtx)
+		}()
+
+		manager.ObserveError(errnoError(-int(syscall.ENOTCONN)))
+		Eventually(cluster.Attempts).Should(HaveLen(2))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+		_, err := conn()
+		Expect(err).To(MatchError(ErrNotConnected))
+	})
+})
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package replay
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+)
+
+type HandlerOptions struct {
+	// Replay delivers the current objects to the handler right after registering it.
+	Replay bool
+}
+
+// ReplaySource is an event source that can replay the current objects to newly registered handlers.
+type ReplaySource[E api.Object] interface {
+	event.Source[E]
+	AddHandlerWithOptions(ctx context.Context, handler event.Handler[E], opts HandlerOptions) (event.HandlerRegistration, error)
+}
+
+// Source wraps an event source. Handlers registered via AddHandler only receive future events,
+// as with the wrapped source.
+type Source[E api.Object] struct {
+	event.Source[E]
+	listFunc func(ctx context.Context) ([]E, error)
+}
+
+func NewSource[E api.Object](source event.Source[E], listFunc func(ctx context.Context) ([]E, error)) (*Source[E], error) {
+	if source == nil {
+		return nil, fmt.Errorf("must specify source")
+	}
+	if listFunc == nil {
+		return nil, fmt.Errorf("must specify list func")
+	}
+
+	return &Source[E]{
+		Source:   source,
+		listFunc: listFunc,
+	}, nil
+}
+
+// AddHandlerWithOptions registers the handler. With replay enabled, the current objects are delivered to it
+// ordered by creation time: objects being deleted as TypeUpdated, all others as TypeCreated.
+// The handler is registered before listing, so it may see an object both replayed and from a regular event.
+func (s *Source[E]) AddHandlerWithOptions(ctx context.Context, handler event.Handler[E], opts HandlerOptions) (event.HandlerRegistration, error) {
+	reg, err := s.AddHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Replay {
+		return reg, nil
+	}
+
+	objs, err := s.listFunc(ctx)
+	if err != nil {
+		_ = s.RemoveHandler(reg)
+		return nil, fmt.Errorf("failed to list objects to replay: %w", err)
+	}
+
+	slices.SortStableFunc(objs, func(a, b E) int {
+		return cmp.Or(a.GetCreatedAt().Compare(b.GetCreatedAt()), cmp.Compare(a.GetID(), b.GetID()))
+	})
+	for _, obj := range objs {
+		evtType := event.TypeCreated
+		if obj.GetDeletedAt() != nil {
+			evtType = event.TypeUpdated
+		}
+		handler.Handle(event.Event[E]{Type: evtType, Object: obj})
+	}
+	return reg, nil
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package replay_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ironcore-dev/ceph-provider/internal/replay"
+	"github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+type object struct {
+	api.Metadata
+}
+
+type fakeSource struct {
+	handlers []event.Handler[*object]
+}
+
+func (s *fakeSource) AddHandler(handler event.Handler[*object]) (event.HandlerRegistration, error) {
+	s.handlers = append(s.handlers, handler)
+	return len(s.handlers) - 1, nil
+}
+
+func (s *fakeSource) RemoveHandler(registration event.HandlerRegistration) error {
+	s.handlers[registration.(int)] = nil
+	return nil
+}
+
+func (s *fakeSource) emit(evt event.Event[*object]) {
+	for _, handler := range s.handlers {
+		if handler != nil {
+			handler.Handle(evt)
+		}
+	}
+}
+
+type recorder struct {
+	events []event.Event[*object]
+}
+
+func (r *recorder) Handle(evt event.Event[*object]) {
+	r.events = append(r.events, evt)
+}
+
+func eventOf(evtType event.Type, id string) any {
+	return SatisfyAll(
+		HaveField("Type", evtType),
+		HaveField("Object.ID", id),
+	)
+}
+
+var _ = Describe("Source", func() {
+	var (
+		src     *fakeSource
+		objs    []*object
+		listErr error
+		source  *replay.Source[*object]
+	)
+
+	BeforeEach(func() {
+		now := time.Now()
+		src = &fakeSource{}
+		objs = []*object{
+			{Metadata: api.Metadata{ID: "c", CreatedAt: now.Add(2 * time.Second)}},
+			{Metadata: api.Metadata{ID: "b", CreatedAt: now, DeletedAt: ptr.To(now)}},
+			{Metadata: api.Metadata{ID: "a", CreatedAt: now}},
+		}
+		listErr = nil
+
+		var err error
+		source, err = replay.NewSource[*object](src, func(ctx context.Context) ([]*object, error) {
+			return objs, listErr
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should only deliver future events by default", func(ctx SpecContext) {
+		rec := &recorder{}
+		_, err := source.AddHandlerWithOptions(ctx, rec, replay.HandlerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rec.events).To(BeEmpty())
+
+		src.emit(event.Event[*object]{Type: event.TypeUpdated, Object: objs[0]})
+		Expect(rec.events).To(ConsistOf(eventOf(event.TypeUpdated, "c")))
+	})
+
+	It("should replay the current objects ordered by creation time", func(ctx SpecContext) {
+		rec := &recorder{}
+		_, err := source.AddHandlerWithOptions(ctx, rec, replay.HandlerOptions{Replay: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rec.events).To(HaveExactElements(
+			eventOf(event.TypeCreated, "a"),
+			eventOf(event.TypeUpdated, "b"),
+			eventOf(event.TypeCreated, "c"),
+		))
+
+		src.emit(event.Event[*object]{Type: event.TypeDeleted, Object: objs[0]})
+		Expect(rec.events).To(HaveLen(4))
+	})
+
+	It("should only replay to the newly registered handler", func(ctx SpecContext) {
+		existing := &recorder{}
+		_, err := source.AddHandler(existing)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = source.AddHandlerWithOptions(ctx, &recorder{}, replay.HandlerOptions{Replay: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existing.events).To(BeEmpty())
+	})
+
+	It("should remove the handler if listing fails", func(ctx SpecContext) {
+		listErr = errors.New("list failed")
+		rec := &recorder{}
+
+		_, err := source.AddHandlerWithOptions(ctx, rec, replay.HandlerOptions{Replay: true})
+		Expect(err).To(MatchError(listErr))
+
+		src.emit(event.Event[*object]{Type: event.TypeUpdated, Object: objs[0]})
+		Expect(rec.events).To(BeEmpty())
+	})
+})
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package rook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MonitorDataKey is the key of the mon endpoint ConfigMap listing the monitors as name=host:port pairs.
+const MonitorDataKey = "data"
+
+// MonitorConfigMapSource reads the ceph monitors from the mon endpoint ConfigMap maintained by rook.
+type MonitorConfigMapSource struct {
+	Client client.Reader
+
+	// ConfigMap is the namespace and name of the mon endpoint ConfigMap.
+	ConfigMap client.ObjectKey
+	// DataKey is the key of the ConfigMap the monitors are read from. Defaults to MonitorConfigMapDataKeyDefaultValue.
+	DataKey string
+	// ClusterID selects the cluster of the csi cluster config. Defaults to ClusterIdDefaultValue.
+	ClusterID string
+}
+
+// Monitors returns the comma-separated host:port addresses of the monitors.
+func (s *MonitorConfigMapSource) Monitors(ctx context.Context) (string, error) {
+	dataKey := s.DataKey
+	if dataKey == "" {
+		dataKey = MonitorConfigMapDataKeyDefaultValue
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := s.Client.Get(ctx, s.ConfigMap, configMap); err != nil {
+		return "", fmt.Errorf("failed to get mon endpoint config map %s: %w", s.ConfigMap, err)
+	}
+
+	data, ok := configMap.Data[dataKey]
+	if !ok {
+		return "", fmt.Errorf("mon endpoint config map %s has no key %s", s.ConfigMap, dataKey)
+	}
+
+	if dataKey == MonitorDataKey {
+		return parseMonitorData(data)
+	}
+	clusterID := s.ClusterID
+	if clusterID == "" {
+		clusterID = ClusterIdDefaultValue
+	}
+	return parseCSIClusterConfig(data, clusterID)
+}
+
+// parseMonitorData parses the monitors of the data key, e.g. a=10.0.0.1:6789,b=10.0.0.2:6789.
+func parseMonitorData(data string) (string, error) {
+	var monitors []string
+	for _, entry := range strings.Split(data, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		_, address, ok := strings.Cut(entry, "=")
+		if !ok {
+			return "", fmt.Errorf("monitor %q is not a name=address pair", entry)
+		}
+		monitors = append(monitors, address)
+	}
+	if len(monitors) == 0 {
+		return "", fmt.Errorf("no monitors found")
+	}
+	return strings.Join(monitors, ","), nil
+}
+
+type csiClusterConfig struct {
+	ClusterID string   `json:"clusterID"`
+	Monitors  []string `json:"monitors"`
+}
+
+// parseCSIClusterConfig parses the monitors of the cluster from the csi cluster config json.
+func parseCSIClusterConfig(data, clusterID string) (string, error) {
+	var configs []csiClusterConfig
+	if err := json.Unmarshal([]byte(data), &configs); err != nil {
+		return "", fmt.Errorf("failed to parse csi cluster config: %w", err)
+	}
+
+	for _, config := range configs {
+		if config.ClusterID != clusterID {
+			continue
+		}
+		if len(config.Monitors) == 0 {
+			return "", fmt.Errorf("no monitors found for cluster %s", clusterID)
+		}
+		return strings.Join(config.Monitors, ","), nil
+	}
+	return "", fmt.Errorf("cluster %s not found in csi cluster config", clusterID)
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package round
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Mode is the way sizes are rounded.
+type Mode string
+
+const (
+	// ModeDefault rounds as OffBytes does.
+	ModeDefault Mode = ""
+	// ModeNone keeps sizes as they are.
+	ModeNone Mode = "none"
+	// ModeUp rounds sizes up to the next multiple of the alignment.
+	ModeUp Mode = "up"
+	// ModeNearest rounds sizes to the nearest multiple of the alignment, but never below the alignment.
+	ModeNearest Mode = "nearest"
+)
+
+// Strategy rounds sizes according to its mode and alignment.
+type Strategy struct {
+	Mode Mode
+	// Alignment is the size in bytes sizes are rounded to a multiple of. Required for ModeUp and ModeNearest.
+	Alignment uint64
+}
+
+// Validate checks that the mode is known and has an alignment if it requires one.
+func (s Strategy) Validate() error {
+	switch s.Mode {
+	case ModeDefault, ModeNone:
+		return nil
+	case ModeUp, ModeNearest:
+		if s.Alignment == 0 {
+			return fmt.Errorf("size rounding mode %s requires an alignment", s.Mode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown size rounding mode %q", s.Mode)
+	}
+}
+
+// Round rounds the given size. The size must be positive.
+func (s Strategy) Round(bytes uint64) (uint64, error) {
+	if bytes == 0 {
+		return 0, errors.New("size must be positive")
+	}
+	if err := s.Validate(); err != nil {
+		return 0, err
+	}
+
+	switch s.Mode {
+	case ModeNone:
+		return bytes, nil
+	case ModeUp:
+		return alignedSize(bytes/s.Alignment+min(bytes%s.Alignment, 1), s.Alignment)
+	case ModeNearest:
+		n := bytes / s.Alignment
+		if rem := bytes % s.Alignment; rem >= s.Alignment-rem {
+			n++
+		}
+		return alignedSize(max(n, 1), s.Alignment)
+	default:
+		return OffBytes(bytes), nil
+	}
+}
+
+func alignedSize(n, alignment uint64) (uint64, error) {
+	if n > math.MaxUint64/alignment {
+		return 0, fmt.Errorf("size of %d times %d bytes overflows", n, alignment)
+	}
+	return n * alignment, nil
+}
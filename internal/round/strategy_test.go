@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package round_test
+
+import (
+	"math"
+
+	. "github.com/ironcore-dev/ceph-provider/internal/round"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strategy", func() {
+	DescribeTable("Round",
+		func(strategy Strategy, bytes, expected uint64) {
+			Expect(strategy.Round(bytes)).To(Equal(expected))
+		},
+		Entry("default below a GiB", Strategy{}, uint64(1*MiB+1), uint64(2*MiB)),
+		Entry("default above a GiB", Strategy{}, uint64(1*GiB+1), uint64(2*GiB)),
+		Entry("none", Strategy{Mode: ModeNone}, uint64(1*GiB+1), uint64(1*GiB+1)),
+		Entry("up on the boundary", Strategy{Mode: ModeUp, Alignment: GiB}, uint64(1*GiB), uint64(1*GiB)),
+		Entry("up below the boundary", Strategy{Mode: ModeUp, Alignment: GiB}, uint64(1*GiB-1), uint64(1*GiB)),
+		Entry("up above the boundary", Strategy{Mode: ModeUp, Alignment: GiB}, uint64(1*GiB+1), uint64(2*GiB)),
+		Entry("up below the alignment", Strategy{Mode: ModeUp, Alignment: GiB}, uint64(1), uint64(1*GiB)),
+		Entry("nearest on the boundary", Strategy{Mode: ModeNearest, Alignment: GiB}, uint64(2*GiB), uint64(2*GiB)),
+		Entry("nearest below the boundary", Strategy{Mode: ModeNearest, Alignment: GiB}, uint64(2*GiB-1), uint64(2*GiB)),
+		Entry("nearest above the boundary", Strategy{Mode: ModeNearest, Alignment: GiB}, uint64(2*GiB+1), uint64(2*GiB)),
+		Entry("nearest at half the alignment", Strategy{Mode: ModeNearest, Alignment: GiB}, uint64(2*GiB+GiB/2), uint64(3*GiB)),
+		Entry("nearest below half the alignment", Strategy{Mode: ModeNearest, Alignment: GiB}, uint64(2*GiB+GiB/2-1), uint64(2*GiB)),
+		Entry("nearest below the alignment", Strategy{Mode: ModeNearest, Alignment: GiB}, uint64(1), uint64(1*GiB)),
+	)
+
+	It("should reject a size of zero", func() {
+		Expect(Strategy{Mode: ModeNone}.Round(0)).Error().To(MatchError("size must be positive"))
+	})
+
+	It("should reject sizes overflowing when rounded up", func() {
+		Expect(Strategy{Mode: ModeUp, Alignment: GiB}.Round(math.MaxUint64)).Error().To(HaveOccurred())
+	})
+
+	DescribeTable("Validate",
+		func(strategy Strategy, valid bool) {
+			if valid {
+				Expect(strategy.Validate()).To(Succeed())
+			} else {
+				Expect(strategy.Validate()).NotTo(Succeed())
+			}
+		},
+		Entry("default", Strategy{}, true),
+		Entry("none", Strategy{Mode: ModeNone}, true),
+		Entry("up with alignment", Strategy{Mode: ModeUp, Alignment: GiB}, true),
+		Entry("up without alignment", Strategy{Mode: ModeUp}, false),
+		Entry("nearest without alignment", Strategy{Mode: ModeNearest}, false),
+		Entry("unknown mode", Strategy{Mode: "down", Alignment: GiB}, false),
+	)
+})
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package schema versions the JSON of stored objects and migrates objects of older schema versions when reading them.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// VersionKey is the key of the schema version in the JSON of stored objects.
+const VersionKey = "schemaVersion"
+
+// ErrVersionTooNew is returned for stored objects of a schema version newer than the known one, e.g. written by a
+// newer provider version. They are refused instead of dropping the fields unknown to this version.
+var ErrVersionTooNew = errors.New("schema version is newer than the supported version")
+
+// Migration upgrades the JSON of a stored object to the schema version it is registered for, from the previous one.
+// Numbers of the object are json.Number, so that they are kept exactly.
+type Migration func(obj map[string]any) error
+
+// Migrations are the migrations of a stored type, keyed by the schema version they upgrade to. Objects without a
+// schema version are of version 1, so the migrations are keyed by 2 up to the current version.
+type Migrations map[int]Migration
+
+// Validate checks that there is a migration to every version from 2 up to the current version.
+func (m Migrations) Validate() error {
+	for version := 2; version <= m.Version(); version++ {
+		if m[version] == nil {
+			return fmt.Errorf("missing migration to schema version %d", version)
+		}
+	}
+	return nil
+}
+
+// Version returns the current schema version.
+func (m Migrations) Version() int {
+	return len(m) + 1
+}
+
+// Decode unmarshals the stored JSON into obj, migrating it to the current schema version first. It reports whether
+// the stored object was migrated. Migrated objects are persisted in the current version once they are written again.
+func (m Migrations) Decode(data []byte, obj any) (bool, error) {
+	if len(m) == 0 {
+		return false, json.Unmarshal(data, obj)
+	}
+
+	raw, err := unmarshalRaw(data)
+	if err != nil {
+		return false, err
+	}
+
+	version, err := storedVersion(raw)
+	if err != nil {
+		return false, err
+	}
+	if version > m.Version() {
+		return false, fmt.Errorf("%w: got %d, supported %d", ErrVersionTooNew, version, m.Version())
+	}
+	if version == m.Version() {
+		return false, json.Unmarshal(data, obj)
+	}
+
+	for version < m.Version() {
+		version++
+		if err := m[version](raw); err != nil {
+			return false, fmt.Errorf("failed to migrate to schema version %d: %w", version, err)
+		}
+	}
+
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, obj)
+}
+
+// Encode marshals obj to JSON carrying the current schema version. Objects of version 1 carry no version, so that they
+// stay readable by previous provider versions.
+func (m Migrations) Encode(obj any) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil || len(m) == 0 {
+		return data, err
+	}
+
+	raw, err := unmarshalRaw(data)
+	if err != nil {
+		return nil, err
+	}
+	raw[VersionKey] = m.Version()
+	return json.Marshal(raw)
+}
+
+func unmarshalRaw(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// storedVersion returns the schema version of the stored object, 1 if it has none.
+func storedVersion(raw map[string]any) (int, error) {
+	value, ok := raw[VersionKey]
+	if !ok {
+		return 1, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid schema version %v", value)
+	}
+	version, err := strconv.Atoi(number.String())
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid schema version %v", value)
+	}
+	return version, nil
+}
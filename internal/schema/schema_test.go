@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package schema_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ironcore-dev/ceph-provider/internal/schema"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// image is the v2 shape of a stored image, whose size moved from spec.sizeMiB to spec.size in bytes.
+type image struct {
+	ID   string    `json:"id"`
+	Spec imageSpec `json:"spec"`
+}
+
+type imageSpec struct {
+	Size uint64 `json:"size"`
+}
+
+var migrations = schema.Migrations{
+	2: func(obj map[string]any) error {
+		spec, ok := obj["spec"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		sizeMiB, ok := spec["sizeMiB"].(json.Number)
+		if !ok {
+			return nil
+		}
+		mib, err := sizeMiB.Int64()
+		if err != nil {
+			return err
+		}
+		delete(spec, "sizeMiB")
+		spec["size"] = mib * 1024 * 1024
+		return nil
+	},
+}
+
+var _ = Describe("Migrations", func() {
+	It("should migrate a v1 record to the v2 shape on load", func() {
+		img := &image{}
+		migrated, err := migrations.Decode([]byte(`{"id":"foo","spec":{"sizeMiB":3}}`), img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeTrue())
+		Expect(img).To(Equal(&image{ID: "foo", Spec: imageSpec{Size: 3 * 1024 * 1024}}))
+	})
+
+	It("should write and read records in the current version", func() {
+		data, err := migrations.Encode(&image{ID: "foo", Spec: imageSpec{Size: 1<<53 + 1}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(fmt.Sprintf(`{"id":"foo","spec":{"size":%d},"schemaVersion":2}`, uint64(1<<53+1))))
+
+		img := &image{}
+		migrated, err := migrations.Decode(data, img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeFalse())
+		Expect(img.Spec.Size).To(Equal(uint64(1<<53 + 1)))
+	})
+
+	It("should keep records unversioned without migrations", func() {
+		data, err := schema.Migrations(nil).Encode(&image{ID: "foo"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"id":"foo","spec":{"size":0}}`))
+	})
+
+	It("should refuse records of a newer version", func() {
+		_, err := migrations.Decode([]byte(`{"id":"foo","schemaVersion":3}`), &image{})
+		Expect(err).To(MatchError(schema.ErrVersionTooNew))
+	})
+
+	It("should fail on an invalid version", func() {
+		_, err := migrations.Decode([]byte(`{"id":"foo","schemaVersion":"two"}`), &image{})
+		Expect(err).To(MatchError(ContainSubstring("invalid schema version")))
+	})
+
+	It("should fail if a migration fails", func() {
+		failing := schema.Migrations{2: func(map[string]any) error { return errors.New("boom") }}
+		_, err := failing.Decode([]byte(`{"id":"foo"}`), &image{})
+		Expect(err).To(MatchError(ContainSubstring("failed to migrate to schema version 2: boom")))
+	})
+
+	It("should require a migration to every version", func() {
+		Expect(migrations.Validate()).To(Succeed())
+		Expect(schema.Migrations{3: migrations[2]}.Validate()).To(MatchError("missing migration to schema version 2"))
+	})
+})
@@ -5,11 +5,25 @@ package strategy
 
 import (
 	"crypto/rand"
+	"io"
+	mathrand "math/rand"
+	"sync"
 
 	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/schema"
 	"github.com/ironcore-dev/ironcore/broker/common/idgen"
 )
 
+// WWNLength is the length of the generated WWNs.
+const WWNLength = 16
+
+// ImageMigrations upgrade stored images of older schema versions. Changes to api.Image which older stored images
+// cannot be unmarshaled into register a migration to the next schema version here.
+var ImageMigrations = schema.Migrations{}
+
+// SnapshotMigrations upgrade stored snapshots of older schema versions, see ImageMigrations.
+var SnapshotMigrations = schema.Migrations{}
+
 var SnapshotStrategy = snapshotStrategy{}
 
 type snapshotStrategy struct{}
@@ -19,7 +33,25 @@ func (snapshotStrategy) PrepareForCreate(obj *api.Snapshot) {
 }
 
 var ImageStrategy = imageStrategy{
-	WWNGen: idgen.NewIDGen(rand.Reader, 16),
+	WWNGen: idgen.NewIDGen(rand.Reader, WWNLength),
+}
+
+// NewSeededWWNGen returns a generator of WWNs which are derived deterministically from the seed, e.g. to get
+// predictable WWNs in tests. The WWNs are not unique across generators with the same seed.
+func NewSeededWWNGen(seed int64) idgen.IDGen {
+	return idgen.NewIDGen(&lockedReader{reader: mathrand.New(mathrand.NewSource(seed))}, WWNLength)
+}
+
+// lockedReader serializes reads, as the deterministic random sources are not safe for concurrent use.
+type lockedReader struct {
+	mu     sync.Mutex
+	reader io.Reader
+}
+
+func (r *lockedReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reader.Read(p)
 }
 
 type imageStrategy struct {
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package strategy_test
+
+import (
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ImageStrategy", func() {
+	It("should generate stable wwns from a seed", func() {
+		imageStrategy := strategy.ImageStrategy
+		imageStrategy.WWNGen = strategy.NewSeededWWNGen(42)
+		other := strategy.NewSeededWWNGen(42)
+
+		for range 3 {
+			img := &api.Image{}
+			imageStrategy.PrepareForCreate(img)
+			Expect(img.Spec.WWN).To(HaveLen(strategy.WWNLength))
+			Expect(img.Spec.WWN).To(Equal(other.Generate()))
+			Expect(img.Status.State).To(Equal(api.ImageStatePending))
+		}
+	})
+
+	It("should generate different wwns from different seeds", func() {
+		Expect(strategy.NewSeededWWNGen(1).Generate()).NotTo(Equal(strategy.NewSeededWWNGen(2).Generate()))
+	})
+})
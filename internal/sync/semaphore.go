@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SemaphoreMap is a map of counting semaphores by a given key type [K], each admitting size holders at once.
+//
+// Like the MutexMap, the map only keeps the keys that are held or waited for.
+type SemaphoreMap[K comparable] struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[K]*semaphoreMapEntry
+}
+
+// NewSemaphoreMap creates a new SemaphoreMap admitting size holders per key.
+func NewSemaphoreMap[K comparable](size int) *SemaphoreMap[K] {
+	if size <= 0 {
+		panic(fmt.Errorf("semaphore size must be greater than 0, got %d", size))
+	}
+	return &SemaphoreMap[K]{
+		size:    size,
+		entries: make(map[K]*semaphoreMapEntry),
+	}
+}
+
+type semaphoreMapEntry struct {
+	slots chan struct{}
+	// count is the number of holders and waiters.
+	count int
+}
+
+// Acquire acquires the semaphore of the given key, blocking until a slot is free or ctx is done.
+func (m *SemaphoreMap[K]) Acquire(ctx context.Context, key K) error {
+	m.mu.Lock()
+	entry := m.entries[key]
+	if entry == nil {
+		entry = &semaphoreMapEntry{slots: make(chan struct{}, m.size)}
+		m.entries[key] = entry
+	}
+	entry.count++
+	m.mu.Unlock()
+
+	select {
+	case entry.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		m.leave(key)
+		return ctx.Err()
+	}
+}
+
+// TryAcquire acquires the semaphore of the given key without waiting and reports whether it succeeded.
+func (m *SemaphoreMap[K]) TryAcquire(key K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entries[key]
+	if entry == nil {
+		entry = &semaphoreMapEntry{slots: make(chan struct{}, m.size)}
+		m.entries[key] = entry
+	}
+
+	select {
+	case entry.slots <- struct{}{}:
+		entry.count++
+		return true
+	default:
+		if entry.count == 0 {
+			delete(m.entries, key)
+		}
+		return false
+	}
+}
+
+// Release releases the semaphore of the given key acquired before.
+func (m *SemaphoreMap[K]) Release(key K) {
+	m.mu.Lock()
+	entry := m.entries[key]
+	m.mu.Unlock()
+	if entry == nil {
+		panic(fmt.Errorf("release: key %v not found", key))
+	}
+
+	<-entry.slots
+	m.leave(key)
+}
+
+func (m *SemaphoreMap[K]) leave(key K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entries[key]
+	entry.count--
+	if entry.count == 0 {
+		delete(m.entries, key)
+	}
+}
+
+// Held returns the number of holders of the semaphore of the given key.
+func (m *SemaphoreMap[K]) Held(key K) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entries[key]
+	if entry == nil {
+		return 0
+	}
+	return len(entry.slots)
+}
+
+// Len returns the number of entries in the SemaphoreMap.
+func (m *SemaphoreMap[K]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.entries)
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package sync_test
+
+import (
+	"context"
+
+	utilssync "github.com/ironcore-dev/ceph-provider/internal/sync"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SemaphoreMap", func() {
+	It("should bound the holders per key and garbage collect released keys", func(ctx SpecContext) {
+		m := utilssync.NewSemaphoreMap[string](2)
+
+		Expect(m.Acquire(ctx, "foo")).To(Succeed())
+		Expect(m.Acquire(ctx, "foo")).To(Succeed())
+		Expect(m.Acquire(ctx, "bar")).To(Succeed())
+		Expect(m.Held("foo")).To(Equal(2))
+
+		acquired := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(m.Acquire(ctx, "foo")).To(Succeed())
+			close(acquired)
+		}()
+		Consistently(acquired).ShouldNot(BeClosed())
+
+		m.Release("foo")
+		Eventually(acquired).Should(BeClosed())
+
+		m.Release("foo")
+		m.Release("foo")
+		m.Release("bar")
+		Expect(m.Len()).To(BeZero())
+	})
+
+	It("should not wait for a slot when trying to acquire", func(ctx SpecContext) {
+		m := utilssync.NewSemaphoreMap[string](1)
+
+		Expect(m.TryAcquire("foo")).To(BeTrue())
+		Expect(m.TryAcquire("foo")).To(BeFalse())
+		Expect(m.TryAcquire("bar")).To(BeTrue())
+
+		m.Release("foo")
+		Expect(m.TryAcquire("foo")).To(BeTrue())
+
+		m.Release("foo")
+		m.Release("bar")
+		Expect(m.Len()).To(BeZero())
+	})
+
+	It("should stop waiting once the context is done", func(ctx SpecContext) {
+		m := utilssync.NewSemaphoreMap[string](1)
+		Expect(m.Acquire(ctx, "foo")).To(Succeed())
+
+		waitCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(m.Acquire(waitCtx, "foo")).To(MatchError(context.Canceled))
+
+		m.Release("foo")
+		Expect(m.Len()).To(BeZero())
+	})
+})
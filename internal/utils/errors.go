@@ -19,6 +19,13 @@ var (
 
 	ErrSnapshotNotFound    = errors.New("snapshot not found")
 	ErrSnapshotIsntManaged = errors.New("snapshot isn't managed")
+
+	ErrBucketClassNotFound = errors.New("bucket class not found")
+
+	// ErrInvalidBucketConfig is returned if a bucket configuration annotation cannot be parsed or is invalid.
+	ErrInvalidBucketConfig = errors.New("invalid bucket config")
+	// ErrBucketConfigUnsupported is returned if a valid bucket configuration cannot be applied by the provider.
+	ErrBucketConfigUnsupported = errors.New("bucket config not supported")
 )
 
 func ConvertInternalErrorToGRPC(err error) error {
@@ -31,8 +38,11 @@ func ConvertInternalErrorToGRPC(err error) error {
 	switch {
 	case errors.Is(err, ErrBucketNotFound), errors.Is(err, ErrVolumeNotFound), errors.Is(err, ErrSnapshotNotFound):
 		code = codes.NotFound
-	case errors.Is(err, ErrBucketIsntManaged), errors.Is(err, ErrVolumeIsntManaged), errors.Is(err, ErrSnapshotIsntManaged):
+	case errors.Is(err, ErrBucketIsntManaged), errors.Is(err, ErrVolumeIsntManaged), errors.Is(err, ErrSnapshotIsntManaged),
+		errors.Is(err, ErrBucketClassNotFound), errors.Is(err, ErrInvalidBucketConfig):
 		code = codes.InvalidArgument
+	case errors.Is(err, ErrBucketConfigUnsupported):
+		code = codes.Unimplemented
 	}
 
 	return status.Error(code, err.Error())
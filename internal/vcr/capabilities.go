@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vcr
+
+import (
+	"fmt"
+
+	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+)
+
+// PoolCapabilities are the capabilities the ceph pool can satisfy per volume. Zero values are unlimited.
+type PoolCapabilities struct {
+	// MaxIOPS is the highest IOPS a volume of the pool can be provisioned with.
+	MaxIOPS int64
+	// MaxTPS is the highest throughput in bytes per second a volume of the pool can be provisioned with.
+	MaxTPS int64
+}
+
+// Validate checks that the capabilities are not negative.
+func (c PoolCapabilities) Validate() error {
+	if c.MaxIOPS < 0 {
+		return fmt.Errorf("max iops must not be negative, got %d", c.MaxIOPS)
+	}
+	if c.MaxTPS < 0 {
+		return fmt.Errorf("max tps must not be negative, got %d", c.MaxTPS)
+	}
+	return nil
+}
+
+// Satisfies reports why the pool can't satisfy the requested capabilities of the class, if it can't.
+func (c PoolCapabilities) Satisfies(class *iri.VolumeClass) error {
+	caps := class.GetCapabilities()
+	if c.MaxIOPS > 0 && caps.GetIops() > c.MaxIOPS {
+		return fmt.Errorf("class requests %d iops, pool supports at most %d", caps.GetIops(), c.MaxIOPS)
+	}
+	if c.MaxTPS > 0 && caps.GetTps() > c.MaxTPS {
+		return fmt.Errorf("class requests %d tps, pool supports at most %d", caps.GetTps(), c.MaxTPS)
+	}
+	return nil
+}
+
+// FilterSatisfiable splits the classes into the ones the pool can satisfy and the reasons the others are rejected,
+// keyed by class name.
+func FilterSatisfiable(classes []*iri.VolumeClass, caps PoolCapabilities) ([]*iri.VolumeClass, map[string]error) {
+	var (
+		satisfiable []*iri.VolumeClass
+		rejected    = map[string]error{}
+	)
+	for _, class := range classes {
+		if err := caps.Satisfies(class); err != nil {
+			rejected[class.Name] = err
+			continue
+		}
+		satisfiable = append(satisfiable, class)
+	}
+	return satisfiable, rejected
+}
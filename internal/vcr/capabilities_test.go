@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vcr_test
+
+import (
+	"github.com/ironcore-dev/ceph-provider/internal/vcr"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Capabilities", func() {
+	var classes []*iri.VolumeClass
+
+	BeforeEach(func() {
+		classes = []*iri.VolumeClass{
+			{Name: "slow", Capabilities: &iri.VolumeClassCapabilities{Iops: 100, Tps: 100 * 1024 * 1024}},
+			{Name: "fast", Capabilities: &iri.VolumeClassCapabilities{Iops: 10000, Tps: 100 * 1024 * 1024}},
+			{Name: "wide", Capabilities: &iri.VolumeClassCapabilities{Iops: 100, Tps: 1024 * 1024 * 1024}},
+			{Name: "unspecified"},
+		}
+	})
+
+	It("should only advertise the classes the pool can satisfy", func() {
+		satisfiable, rejected := vcr.FilterSatisfiable(classes, vcr.PoolCapabilities{
+			MaxIOPS: 1000,
+			MaxTPS:  500 * 1024 * 1024,
+		})
+
+		Expect(satisfiable).To(ConsistOf(
+			HaveField("Name", "slow"),
+			HaveField("Name", "unspecified"),
+		))
+		Expect(rejected).To(HaveKeyWithValue("fast", MatchError(ContainSubstring("10000 iops"))))
+		Expect(rejected).To(HaveKeyWithValue("wide", MatchError(ContainSubstring("1073741824 tps"))))
+		Expect(rejected).To(HaveLen(2))
+	})
+
+	It("should advertise all classes without pool limits", func() {
+		satisfiable, rejected := vcr.FilterSatisfiable(classes, vcr.PoolCapabilities{})
+		Expect(satisfiable).To(HaveLen(4))
+		Expect(rejected).To(BeEmpty())
+	})
+
+	It("should reject negative capabilities", func() {
+		Expect(vcr.PoolCapabilities{MaxIOPS: -1}.Validate()).To(HaveOccurred())
+		Expect(vcr.PoolCapabilities{MaxTPS: -1}.Validate()).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package volumeserver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const DefaultPoolStatsRefreshInterval = 30 * time.Second
+
+// StartPoolStatsRefresh refreshes the cached ceph pool stats every pool stats refresh interval until ctx is done.
+func (s *Server) StartPoolStatsRefresh(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		_, _ = s.refreshPoolStats(ctx)
+	}, s.poolStatsRefreshInterval)
+}
+
+// refreshPoolStats fetches the ceph pool stats and caches them. The previously cached stats are kept if fetching
+// fails, so that temporarily unavailable stats don't drop the reported capacity.
+func (s *Server) refreshPoolStats(ctx context.Context) (*ceph.PoolStats, error) {
+	log := s.loggerFrom(ctx)
+
+	poolStats, err := s.cephCommandClient.PoolStats()
+	if err != nil {
+		err = fmt.Errorf("failed to get ceph pool stats: %w", err)
+		log.Error(err, "Keeping last known ceph pool stats")
+		return nil, err
+	}
+
+	log.V(2).Info("Refreshed ceph pool stats",
+		"TotalBytes", poolStats.TotalBytes(),
+		"UsedBytes", poolStats.BytesUsed,
+		"AvailableBytes", poolStats.MaxAvail,
+	)
+
+	s.poolStatsMu.Lock()
+	defer s.poolStatsMu.Unlock()
+	s.poolStats = poolStats
+	return poolStats, nil
+}
+
+// getPoolStats returns the cached ceph pool stats. The stats are fetched if none have been cached yet.
+func (s *Server) getPoolStats(ctx context.Context) (*ceph.PoolStats, error) {
+	s.poolStatsMu.RLock()
+	poolStats := s.poolStats
+	s.poolStatsMu.RUnlock()
+	if poolStats != nil {
+		return poolStats, nil
+	}
+
+	return s.refreshPoolStats(ctx)
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package volumeserver
+
+import (
+	"errors"
+
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeCommand struct {
+	stats *ceph.PoolStats
+	err   error
+	calls int
+}
+
+func (c *fakeCommand) PoolStats() (*ceph.PoolStats, error) {
+	c.calls++
+	return c.stats, c.err
+}
+
+type fakeVolumeClassRegistry []*iri.VolumeClass
+
+func (r fakeVolumeClassRegistry) Get(volumeClassName string) (*iri.VolumeClass, bool) {
+	for _, class := range r {
+		if class.Name == volumeClassName {
+			return class, true
+		}
+	}
+	return nil, false
+}
+
+func (r fakeVolumeClassRegistry) List() []*iri.VolumeClass {
+	return r
+}
+
+var _ = Describe("PoolStats", func() {
+	var (
+		command *fakeCommand
+		srv     *Server
+	)
+
+	BeforeEach(func() {
+		command = &fakeCommand{stats: &ceph.PoolStats{BytesUsed: 300, MaxAvail: 700}}
+
+		var err error
+		srv, err = New(nil, nil, fakeVolumeClassRegistry{{Name: "foo"}}, nil, command, Options{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should report the available pool capacity per volume class", func(ctx SpecContext) {
+		res, err := srv.Status(ctx, &iri.StatusRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.VolumeClassStatus).To(ConsistOf(SatisfyAll(
+			HaveField("VolumeClass.Name", "foo"),
+			HaveField("Quantity", BeEquivalentTo(700)),
+		)))
+		Expect(command.stats.TotalBytes()).To(BeEquivalentTo(1000))
+	})
+
+	It("should serve the cached pool stats until they are refreshed", func(ctx SpecContext) {
+		_, err := srv.Status(ctx, &iri.StatusRequest{})
+		Expect(err).NotTo(HaveOccurred())
+
+		command.stats = &ceph.PoolStats{BytesUsed: 500, MaxAvail: 500}
+		res, err := srv.Status(ctx, &iri.StatusRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.VolumeClassStatus[0].Quantity).To(BeEquivalentTo(700))
+		Expect(command.calls).To(Equal(1))
+
+		_, err = srv.refreshPoolStats(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		res, err = srv.Status(ctx, &iri.StatusRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.VolumeClassStatus[0].Quantity).To(BeEquivalentTo(500))
+	})
+
+	It("should keep the last known pool stats if they are temporarily unavailable", func(ctx SpecContext) {
+		_, err := srv.refreshPoolStats(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		command.stats, command.err = nil, errors.New("mon unreachable")
+		_, err = srv.refreshPoolStats(ctx)
+		Expect(err).To(HaveOccurred())
+
+		res, err := srv.Status(ctx, &iri.StatusRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.VolumeClassStatus[0].Quantity).To(BeEquivalentTo(700))
+	})
+
+	It("should report unavailable if no pool stats have been fetched yet", func(ctx SpecContext) {
+		command.stats, command.err = nil, errors.New("mon unreachable")
+
+		_, err := srv.Status(ctx, &iri.StatusRequest{})
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+	})
+
+	It("should reject a negative refresh interval", func() {
+		_, err := New(nil, nil, fakeVolumeClassRegistry{}, nil, command, Options{PoolStatsRefreshInterval: -1})
+		Expect(err).To(HaveOccurred())
+	})
+})
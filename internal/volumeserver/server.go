@@ -5,6 +5,9 @@ package volumeserver
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/ironcore-dev/ceph-provider/api"
@@ -37,6 +40,10 @@ type Server struct {
 	burstDurationInSeconds int64
 
 	keyEncryption encryption.Encryptor
+
+	poolStatsRefreshInterval time.Duration
+	poolStatsMu              sync.RWMutex
+	poolStats                *ceph.PoolStats
 }
 
 func (s *Server) loggerFrom(ctx context.Context, keysWithValues ...interface{}) logr.Logger {
@@ -50,12 +57,18 @@ type Options struct {
 	BurstDurationInSeconds int64
 
 	VolumeEventStore recorder.EventStore
+
+	// PoolStatsRefreshInterval is the interval the ceph pool stats reported by Status are refreshed in.
+	PoolStatsRefreshInterval time.Duration
 }
 
 func setOptionsDefaults(o *Options) {
 	if o.IDGen == nil {
 		o.IDGen = idgen.Default
 	}
+	if o.PoolStatsRefreshInterval == 0 {
+		o.PoolStatsRefreshInterval = DefaultPoolStatsRefreshInterval
+	}
 }
 
 var _ iri.VolumeRuntimeServer = (*Server)(nil)
@@ -67,6 +80,9 @@ func New(imageStore store.Store[*api.Image],
 	cephCommandClient ceph.Command,
 	opts Options,
 ) (*Server, error) {
+	if opts.PoolStatsRefreshInterval < 0 {
+		return nil, fmt.Errorf("pool stats refresh interval must not be negative, got %s", opts.PoolStatsRefreshInterval)
+	}
 
 	setOptionsDefaults(&opts)
 
@@ -82,5 +98,7 @@ func New(imageStore store.Store[*api.Image],
 
 		burstFactor:            opts.BurstFactor,
 		burstDurationInSeconds: opts.BurstDurationInSeconds,
+
+		poolStatsRefreshInterval: opts.PoolStatsRefreshInterval,
 	}, nil
 }
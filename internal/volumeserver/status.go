@@ -5,10 +5,10 @@ package volumeserver
 
 import (
 	"context"
-	"fmt"
 
-	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func (s *Server) Status(ctx context.Context, req *iri.StatusRequest) (*iri.StatusResponse, error) {
@@ -19,9 +19,9 @@ func (s *Server) Status(ctx context.Context, req *iri.StatusRequest) (*iri.Statu
 	volumeClassList := s.volumeClasses.List()
 
 	log.V(1).Info("Getting ceph pool stats")
-	poolStats, err := s.cephCommandClient.PoolStats()
+	poolStats, err := s.getPoolStats(ctx)
 	if err != nil {
-		return nil, utils.ConvertInternalErrorToGRPC(fmt.Errorf("failed to get ceph pool stats: %w", err))
+		return nil, status.Error(codes.Unavailable, err.Error())
 	}
 
 	var volumeClassStatus []*iri.VolumeClassStatus
@@ -69,7 +69,7 @@ func (s *Server) getIriVolumeAccess(image *api.Image) (*iri.VolumeAccess, error)
 
 	return &iri.VolumeAccess{
 		Driver: DriverName,
-		Handle: image.Spec.WWN,
+		Handle: image.GetWWN(),
 		Attributes: map[string]string{
 			MonitorsKey: access.Monitors,
 			ImageKey:    access.Handle,
@@ -107,8 +107,10 @@ func (s *Server) getIriState(state api.ImageState) (iri.VolumeState, error) {
 	switch state {
 	case api.ImageStateAvailable:
 		return iri.VolumeState_VOLUME_AVAILABLE, nil
-	case api.ImageStatePending:
+	case api.ImageStatePending, api.ImageStateValidated:
 		return iri.VolumeState_VOLUME_PENDING, nil
+	case api.ImageStateFailed:
+		return iri.VolumeState_VOLUME_ERROR, nil
 	default:
 		return 0, fmt.Errorf("unknown volume state '%q'", state)
 	}